@@ -0,0 +1,91 @@
+// Package coredns lets a CoreDNS plugin evaluate SPF through the rest of its
+// plugin chain.  The SPF lookups are served by the next handler, so they see
+// the same cache, forward and rewrite plugins as the client queries.  It is
+// a separate module so the core library does not depend on miekg/dns.
+//
+// The package does not import CoreDNS: Handler has the method set of
+// plugin.Handler, so a plugin passes its Next field as is:
+//
+//	r := coredns.NewSPFResolver(p.Next)
+//	checker := spf.NewChecker(r)
+package coredns
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/t0gun/go-spf/adapters/miekgdns"
+	spfdns "github.com/t0gun/go-spf/dns"
+)
+
+// Handler is the plugin.Handler interface of CoreDNS.
+type Handler interface {
+	ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error)
+	Name() string
+}
+
+// Exchanger sends queries through a CoreDNS plugin chain.  It implements
+// miekgdns.Exchanger.
+type Exchanger struct {
+	Next Handler
+}
+
+// Exchange serves m with Next and returns the message it wrote.  A
+// handler that returns a failing response code without writing, as
+// plugins may, yields an empty answer with that code.
+func (e Exchanger) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	w := &recorder{}
+	rcode, err := e.Next.ServeDNS(ctx, w, m)
+	if err != nil {
+		return nil, err
+	}
+	if w.msg == nil {
+		resp := new(dns.Msg)
+		resp.SetRcode(m, rcode)
+		return resp, nil
+	}
+	return w.msg, nil
+}
+
+// New returns a Resolver that queries next.
+func New(next Handler) *miekgdns.Resolver {
+	return &miekgdns.Resolver{Exchanger: Exchanger{Next: next}}
+}
+
+// NewSPFResolver returns an spfdns.Resolver that sends both TXT and address
+// lookups through next.
+func NewSPFResolver(next Handler) *spfdns.Resolver {
+	r := New(next)
+	return spfdns.NewCustomDNSResolver(r, r)
+}
+
+// recorder is the dns.ResponseWriter handed to the plugin chain.  It poses
+// as a local TCP client so plugins do not truncate answers to UDP size.
+type recorder struct {
+	msg *dns.Msg
+}
+
+var loopback = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+func (w *recorder) LocalAddr() net.Addr  { return loopback }
+func (w *recorder) RemoteAddr() net.Addr { return loopback }
+
+func (w *recorder) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func (w *recorder) Close() error        { return nil }
+func (w *recorder) TsigStatus() error   { return nil }
+func (w *recorder) TsigTimersOnly(bool) {}
+func (w *recorder) Hijack()             {}
@@ -0,0 +1,85 @@
+package coredns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	spf "github.com/t0gun/go-spf"
+	spfdns "github.com/t0gun/go-spf/dns"
+)
+
+var _ dns.ResponseWriter = (*recorder)(nil)
+
+// zone is a plugin serving example.com and failing everything else the
+// way CoreDNS plugins do, by returning the rcode without writing.
+type zone struct{ queries int }
+
+func (z *zone) Name() string { return "zone" }
+
+func (z *zone) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	z.queries++
+	q := r.Question[0]
+	switch q.Name {
+	case "example.com.":
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if q.Qtype == dns.TypeTXT {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"v=spf1 ip4:192.0.2.0/24 -all"},
+			})
+		}
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	case "broken.example.":
+		return dns.RcodeServerFailure, errors.New("no upstream")
+	}
+	return dns.RcodeNameError, nil
+}
+
+func TestExchanger(t *testing.T) {
+	z := &zone{}
+	r := New(z)
+	ctx := context.Background()
+
+	txt, err := r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all"}, txt)
+
+	_, err = r.LookupTXT(ctx, "missing.example")
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrNoDNSrecord)
+	rcode, ok := spfdns.ErrorRcode(err)
+	require.True(t, ok)
+	assert.Equal(t, dns.RcodeNameError, rcode)
+
+	_, err = r.LookupTXT(ctx, "broken.example")
+	assert.EqualError(t, err, "no upstream")
+	assert.Equal(t, 3, z.queries)
+}
+
+func TestRecorderWrite(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeTXT)
+	b, err := m.Pack()
+	require.NoError(t, err)
+
+	w := &recorder{}
+	n, err := w.Write(b)
+	require.NoError(t, err)
+	assert.Equal(t, len(b), n)
+	assert.Equal(t, "example.com.", w.msg.Question[0].Name)
+
+	_, err = w.Write([]byte{1})
+	assert.Error(t, err)
+}
+
+func TestNewSPFResolver(t *testing.T) {
+	c := spf.NewChecker(NewSPFResolver(&zone{}))
+	res, err := c.CheckHost(context.Background(), net.ParseIP("192.0.2.7"), "example.com", "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, spf.Pass, res.Code)
+}
@@ -0,0 +1,27 @@
+module github.com/t0gun/go-spf/adapters/coredns
+
+go 1.25.0
+
+require (
+	github.com/miekg/dns v1.1.73
+	github.com/stretchr/testify v1.10.0
+	github.com/t0gun/go-spf v1.0.0
+	github.com/t0gun/go-spf/adapters/miekgdns v1.0.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// Build against the checkout during development.  Replace directives only
+// apply to the main module, so consumers get the versions required above.
+replace (
+	github.com/t0gun/go-spf => ../..
+	github.com/t0gun/go-spf/adapters/miekgdns => ../miekgdns
+)
@@ -0,0 +1,20 @@
+module github.com/t0gun/go-spf/adapters/libresolv
+
+go 1.25.0
+
+require (
+	github.com/stretchr/testify v1.10.0
+	github.com/t0gun/go-spf v1.0.0
+	golang.org/x/net v0.57.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// Build against the checkout during development.  Replace directives only
+// apply to the main module, so consumers get the version required above.
+replace github.com/t0gun/go-spf => ../..
@@ -0,0 +1,338 @@
+// Package libresolv adapts the system resolver library, res_nquery(3) of
+// libresolv, to the resolver interfaces of github.com/t0gun/go-spf/dns.  It
+// is a separate module because it needs cgo.
+//
+// The Go stdlib only uses libc for getaddrinfo and getnameinfo, so
+// spfdns.NewSystemResolver still sends TXT and MX queries with its own
+// client.  This adapter sends every query through libresolv instead, so all
+// lookups follow resolv.conf options such as rotate, edns0 or trust-ad the
+// way other mail software on the host does.  Each query reads resolv.conf
+// afresh with res_ninit.
+//
+// Without cgo, or on platforms other than Linux and macOS, every lookup
+// fails with ErrUnsupported.
+package libresolv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	spfdns "github.com/t0gun/go-spf/dns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ErrUnsupported is returned by every lookup of a build without libresolv.
+var ErrUnsupported = errors.New("libresolv: not supported by this build")
+
+// maxMsg is the size of the answer buffer, the largest DNS message.
+const maxMsg = 65535
+
+// h_errno values of netdb.h, the same on glibc and BSD libcs.
+const (
+	hostNotFound = 1
+	tryAgain     = 2
+	noData       = 4
+)
+
+// typeSPF is the SPF RR type of RFC 4408, which dnsmessage does not name.
+const typeSPF dnsmessage.Type = 99
+
+// Resolver queries the nameservers of resolv.conf through libresolv.  It
+// implements spfdns.TXTResolver, spfdns.TXTStringsResolver,
+// spfdns.TTLResolver, spfdns.SPFTypeResolver, spfdns.IPResolver,
+// spfdns.NetworkIPResolver, spfdns.MXResolver and spfdns.PTRResolver.
+type Resolver struct {
+	// Server, when set, is the IPv4 host:port queried instead of the
+	// nameservers of resolv.conf.  The other resolv.conf options still
+	// apply.
+	Server string
+}
+
+// New returns a Resolver using the nameservers of resolv.conf.
+func New() *Resolver {
+	return &Resolver{}
+}
+
+// NewSPFResolver returns an spfdns.Resolver backed by libresolv for both
+// TXT and address lookups.
+func NewSPFResolver() *spfdns.Resolver {
+	r := New()
+	return spfdns.NewCustomDNSResolver(r, r)
+}
+
+// RcodeError is returned for answers with a response code other than
+// NOERROR.  It implements spfdns.Rcoder.
+type RcodeError struct {
+	Name  string // queried name
+	Code  int
+	Qtype uint16
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("lookup %s %s: %s", e.Name, typeName(e.Qtype), spfdns.RcodeName(e.Code))
+}
+
+// Rcode returns the DNS response code.
+func (e *RcodeError) Rcode() int { return e.Code }
+
+// typeName returns the mnemonic of qtype, e.g. "TXT".
+func typeName(qtype uint16) string {
+	if qtype == uint16(typeSPF) {
+		return "SPF"
+	}
+	name := dnsmessage.Type(qtype).String()
+	if s, ok := strings.CutPrefix(name, "Type"); ok {
+		return s
+	}
+	return "TYPE" + strconv.Itoa(int(qtype))
+}
+
+// queryError maps a failed res_nquery onto an error.  libresolv fails on
+// every answer with a response code other than NOERROR and on NOERROR
+// answers without records; the response, when one arrived, is left in msg.
+// A nil error means an empty answer.
+func queryError(name string, qtype uint16, msg []byte, herr int) error {
+	// a response has the QR bit set; msg was zeroed before the query
+	if len(msg) >= 4 && msg[2]&0x80 != 0 {
+		if rcode := int(msg[3] & 0x0f); rcode != 0 {
+			return &RcodeError{Name: name, Code: rcode, Qtype: qtype}
+		}
+		return nil
+	}
+	switch herr {
+	case noData:
+		return nil
+	case hostNotFound:
+		return &RcodeError{Name: name, Code: spfdns.RcodeNameError, Qtype: qtype}
+	case tryAgain:
+		return &net.DNSError{Err: "no response from nameserver", Name: name, IsTemporary: true}
+	}
+	return &net.DNSError{Err: "res_nquery failed, h_errno " + strconv.Itoa(herr), Name: name}
+}
+
+// exchange sends one query and returns its answer section.  A NOERROR
+// answer without records is returned without error.
+func (r *Resolver) exchange(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	start := time.Now()
+	raw, err := r.query(ctx, strings.TrimSuffix(name, "."), uint16(qtype))
+	if err != nil {
+		var re *RcodeError
+		if errors.As(err, &re) {
+			spfdns.ReportQuery(ctx, spfdns.QueryInfo{Rcode: re.Code, Server: r.Server, Latency: time.Since(start)})
+		}
+		return nil, err
+	}
+	if raw == nil {
+		spfdns.ReportQuery(ctx, spfdns.QueryInfo{Server: r.Server, Latency: time.Since(start)})
+		return nil, nil
+	}
+	var m dnsmessage.Message
+	if err := m.Unpack(raw); err != nil {
+		return nil, &net.DNSError{Err: "malformed response: " + err.Error(), Name: name, IsTemporary: true}
+	}
+	spfdns.ReportQuery(ctx, spfdns.QueryInfo{Rcode: int(m.RCode), Answers: len(m.Answers), Server: r.Server, Latency: time.Since(start)})
+	return m.Answers, nil
+}
+
+// LookupTXTStrings returns the character-strings of each TXT RR of domain.
+func (r *Resolver) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	rrs, _, err := r.lookupTXT(ctx, domain)
+	return rrs, err
+}
+
+// LookupTXT returns one concatenated string per TXT RR of domain.
+func (r *Resolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	txts, _, err := r.LookupTXTTTL(ctx, domain)
+	return txts, err
+}
+
+// LookupTXTTTL returns one concatenated string per TXT RR of domain and the
+// lowest TTL in the answer, zero for an empty answer.  It implements
+// spfdns.TTLResolver.
+func (r *Resolver) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	rrs, ttl, err := r.lookupTXT(ctx, domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]string, 0, len(rrs))
+	for _, strs := range rrs {
+		out = append(out, strings.Join(strs, ""))
+	}
+	return out, ttl, nil
+}
+
+// lookupTXT returns the character-strings of each TXT RR of domain and the
+// lowest TTL of the answer section, CNAMEs included.
+func (r *Resolver) lookupTXT(ctx context.Context, domain string) ([][]string, time.Duration, error) {
+	answer, err := r.exchange(ctx, domain, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, 0, err
+	}
+	var out [][]string
+	var ttl time.Duration
+	for i, rr := range answer {
+		if rrTTL := time.Duration(rr.Header.TTL) * time.Second; i == 0 || rrTTL < ttl {
+			ttl = rrTTL
+		}
+		if txt, ok := rr.Body.(*dnsmessage.TXTResource); ok {
+			out = append(out, txt.TXT)
+		}
+	}
+	return out, ttl, nil
+}
+
+// LookupSPF returns one concatenated string per SPF (type 99) RR of domain,
+// the record type of RFC 4408.  It implements spfdns.SPFTypeResolver.
+func (r *Resolver) LookupSPF(ctx context.Context, domain string) ([]string, error) {
+	answer, err := r.exchange(ctx, domain, typeSPF)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range answer {
+		if u, ok := rr.Body.(*dnsmessage.UnknownResource); ok && rr.Header.Type == typeSPF {
+			strs, err := characterStrings(u.Data)
+			if err != nil {
+				return nil, &net.DNSError{Err: err.Error(), Name: domain}
+			}
+			out = append(out, strings.Join(strs, ""))
+		}
+	}
+	return out, nil
+}
+
+// characterStrings splits the RDATA of a TXT-like RR into its
+// length-prefixed character-strings (RFC 1035 section 3.3).
+func characterStrings(data []byte) ([]string, error) {
+	var out []string
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < n+1 {
+			return nil, errors.New("truncated character-string")
+		}
+		out = append(out, string(data[1:n+1]))
+		data = data[n+1:]
+	}
+	return out, nil
+}
+
+// LookupIPAddr returns the A and AAAA records of host.  If only one family
+// fails, the other family's answer is still returned.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r.lookupAddrs(ctx, host, dnsmessage.TypeA, dnsmessage.TypeAAAA)
+}
+
+// LookupIP returns the addresses of host for network "ip4" (A queries
+// only), "ip6" (AAAA only) or "ip" (both), as net.Resolver.LookupIP does.
+// It implements spfdns.NetworkIPResolver.
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	qtypes := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	switch network {
+	case "ip4":
+		qtypes = qtypes[:1]
+	case "ip6":
+		qtypes = qtypes[1:]
+	case "ip":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	addrs, err := r.lookupAddrs(ctx, host, qtypes...)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+	return ips, nil
+}
+
+// lookupAddrs queries host for each of qtypes, A or AAAA.  A failure is
+// only returned when no query produced an address.
+func (r *Resolver) lookupAddrs(ctx context.Context, host string, qtypes ...dnsmessage.Type) ([]net.IPAddr, error) {
+	var out []net.IPAddr
+	var firstErr error
+	for _, qtype := range qtypes {
+		answer, err := r.exchange(ctx, host, qtype)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, rr := range answer {
+			switch v := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				out = append(out, net.IPAddr{IP: net.IP(v.A[:])})
+			case *dnsmessage.AAAAResource:
+				out = append(out, net.IPAddr{IP: net.IP(v.AAAA[:])})
+			}
+		}
+	}
+	if len(out) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// LookupMX returns the MX records of name.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	answer, err := r.exchange(ctx, name, dnsmessage.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.MX
+	for _, rr := range answer {
+		if mx, ok := rr.Body.(*dnsmessage.MXResource); ok {
+			out = append(out, &net.MX{Host: mx.MX.String(), Pref: mx.Pref})
+		}
+	}
+	return out, nil
+}
+
+// LookupAddr returns the PTR names of addr, an IP address in textual form.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+	}
+	answer, err := r.exchange(ctx, reverseAddr(ip), dnsmessage.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range answer {
+		if ptr, ok := rr.Body.(*dnsmessage.PTRResource); ok {
+			out = append(out, ptr.PTR.String())
+		}
+	}
+	return out, nil
+}
+
+// reverseAddr returns the in-addr.arpa or ip6.arpa name of ip.
+func reverseAddr(ip net.IP) string {
+	var b strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := 3; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(ip4[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+	const hex = "0123456789abcdef"
+	ip16 := ip.To16()
+	for i := 15; i >= 0; i-- {
+		b.WriteByte(hex[ip16[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip16[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
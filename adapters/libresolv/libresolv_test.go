@@ -0,0 +1,146 @@
+//go:build cgo && (linux || darwin)
+
+package libresolv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	spfdns "github.com/t0gun/go-spf/dns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serve starts a UDP server on a random local port answering with zone.
+func serve(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, maxMsg)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if req.Unpack(buf[:n]) != nil || len(req.Questions) != 1 {
+				continue
+			}
+			m := zone(req)
+			resp, err := m.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = pc.WriteTo(resp, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func zone(req dnsmessage.Message) dnsmessage.Message {
+	q := req.Questions[0]
+	m := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: req.ID, Response: true, RecursionDesired: req.RecursionDesired, RecursionAvailable: true},
+		Questions: req.Questions,
+	}
+	hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	switch q.Name.String() {
+	case "example.com.":
+		switch q.Type {
+		case dnsmessage.TypeTXT:
+			m.Answers = append(m.Answers,
+				dnsmessage.Resource{Header: hdr, Body: &dnsmessage.TXTResource{TXT: []string{"v=spf1 ip4:192.0.2.0/24 ", "-all"}}},
+				dnsmessage.Resource{Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 30},
+					Body: &dnsmessage.TXTResource{TXT: []string{"verification=1"}}})
+		case typeSPF:
+			data := append([]byte{byte(len("v=spf1 -all"))}, "v=spf1 -all"...)
+			m.Answers = append(m.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.UnknownResource{Type: typeSPF, Data: data}})
+		case dnsmessage.TypeA:
+			m.Answers = append(m.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}})
+		case dnsmessage.TypeMX:
+			m.Answers = append(m.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.MXResource{Pref: 10,
+				MX: dnsmessage.MustNewName("mail.example.com.")}})
+		}
+	case "1.2.0.192.in-addr.arpa.":
+		m.Answers = append(m.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.PTRResource{
+			PTR: dnsmessage.MustNewName("mail.example.com.")}})
+	case "refused.example.":
+		m.RCode = dnsmessage.RCodeRefused
+	case "servfail.example.":
+		m.RCode = dnsmessage.RCodeServerFailure
+	default:
+		m.RCode = dnsmessage.RCodeNameError
+	}
+	return m
+}
+
+func TestResolver(t *testing.T) {
+	r := &Resolver{Server: serve(t)}
+	ctx := context.Background()
+
+	strs, err := r.LookupTXTStrings(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"v=spf1 ip4:192.0.2.0/24 ", "-all"}, {"verification=1"}}, strs)
+
+	txt, ttl, err := r.LookupTXTTTL(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all", "verification=1"}, txt)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	spf, err := r.LookupSPF(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, spf)
+
+	addrs, err := r.LookupIPAddr(ctx, "example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "192.0.2.1", addrs[0].IP.String())
+
+	ips, err := r.LookupIP(ctx, "ip6", "example.com")
+	require.NoError(t, err)
+	assert.Empty(t, ips)
+
+	mxs, err := r.LookupMX(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mail.example.com.", Pref: 10}}, mxs)
+
+	names, err := r.LookupAddr(ctx, "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mail.example.com."}, names)
+}
+
+func TestResolverErrors(t *testing.T) {
+	r := &Resolver{Server: serve(t)}
+	ctx := context.Background()
+
+	_, err := r.LookupTXT(ctx, "missing.example")
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrNoDNSrecord)
+
+	_, err = r.LookupTXT(ctx, "servfail.example")
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrTempfail)
+
+	_, err = r.LookupTXT(ctx, "refused.example")
+	var re *RcodeError
+	require.True(t, errors.As(err, &re))
+	assert.Equal(t, spfdns.RcodeRefused, re.Code)
+	assert.Equal(t, "lookup refused.example TXT: REFUSED", err.Error())
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrPermfail)
+
+	_, err = r.LookupIP(ctx, "ip5", "example.com")
+	assert.Error(t, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = r.LookupTXT(cancelled, "example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewSPFResolver(t *testing.T) {
+	assert.NotNil(t, NewSPFResolver())
+}
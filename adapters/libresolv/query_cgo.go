@@ -0,0 +1,103 @@
+//go:build cgo && (linux || darwin)
+
+package libresolv
+
+/*
+#cgo LDFLAGS: -lresolv
+#include <stdlib.h>
+#include <string.h>
+#include <netinet/in.h>
+#include <arpa/inet.h>
+#include <arpa/nameser.h>
+#include <resolv.h>
+#include <netdb.h>
+
+// spf_query sends one IN query with a private resolver state, so concurrent
+// calls do not share the global _res.  When ns is not NULL it replaces the
+// nameservers of resolv.conf.  h_errno of the query is stored in herr.
+static int spf_query(const char *name, int type, const char *ns, int port,
+		unsigned char *buf, int buflen, int *herr) {
+	struct __res_state st;
+	memset(&st, 0, sizeof st);
+	if (res_ninit(&st) != 0) {
+		*herr = NETDB_INTERNAL;
+		return -1;
+	}
+	if (ns != NULL) {
+		struct sockaddr_in sa;
+		memset(&sa, 0, sizeof sa);
+		sa.sin_family = AF_INET;
+		sa.sin_port = htons(port);
+		if (inet_pton(AF_INET, ns, &sa.sin_addr) != 1) {
+			res_nclose(&st);
+			*herr = NETDB_INTERNAL;
+			return -1;
+		}
+		st.nsaddr_list[0] = sa;
+		st.nscount = 1;
+	}
+	int n = res_nquery(&st, name, ns_c_in, type, buf, buflen);
+	*herr = st.res_h_errno;
+	res_nclose(&st);
+	return n;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"unsafe"
+)
+
+// query sends one query through res_nquery and returns the response.  The
+// call cannot be interrupted, so on cancellation it is left to finish in
+// the background while ctx.Err() is returned.
+func (r *Resolver) query(ctx context.Context, name string, qtype uint16) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		msg []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := r.nquery(name, qtype)
+		done <- result{msg, err}
+	}()
+	select {
+	case res := <-done:
+		return res.msg, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Resolver) nquery(name string, qtype uint16) ([]byte, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var cns *C.char
+	var port int
+	if r.Server != "" {
+		host, p, err := net.SplitHostPort(r.Server)
+		if err != nil {
+			return nil, err
+		}
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, err
+		}
+		cns = C.CString(host)
+		defer C.free(unsafe.Pointer(cns))
+	}
+
+	buf := make([]byte, maxMsg)
+	var herr C.int
+	n := C.spf_query(cname, C.int(qtype), cns, C.int(port),
+		(*C.uchar)(unsafe.Pointer(&buf[0])), C.int(len(buf)), &herr)
+	if n < 0 {
+		return nil, queryError(name, qtype, buf, int(herr))
+	}
+	return buf[:n], nil
+}
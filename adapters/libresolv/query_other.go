@@ -0,0 +1,9 @@
+//go:build !cgo || !(linux || darwin)
+
+package libresolv
+
+import "context"
+
+func (r *Resolver) query(context.Context, string, uint16) ([]byte, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,298 @@
+// Package miekgdns adapts a github.com/miekg/dns client to the resolver
+// interfaces of github.com/t0gun/go-spf/dns.  It is a separate module so the
+// core library does not depend on miekg/dns.
+//
+// Unlike the Go stdlib the adapter sees the wire response, so it can return
+// the individual TXT character-strings (RFC 7208 section 3.3) and report the
+// exact response code of failures, which spfdns.ClassifyError uses to tell
+// SERVFAIL from REFUSED.
+package miekgdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	spfdns "github.com/t0gun/go-spf/dns"
+)
+
+// Resolver queries one recursive server with a miekg/dns client.  It
+// implements spfdns.TXTResolver, spfdns.TXTStringsResolver,
+// spfdns.TTLResolver, spfdns.SPFTypeResolver, spfdns.IPResolver, spfdns.NetworkIPResolver,
+// spfdns.MXResolver and spfdns.PTRResolver.
+type Resolver struct {
+	Client *dns.Client // UDP client; truncated answers are retried over TCP
+	Server string      // recursive server as host:port
+
+	// Exchanger, when set, sends every query instead of Client and Server,
+	// e.g. through a CoreDNS plugin chain (see adapters/coredns).  It is
+	// expected to handle truncation itself.
+	Exchanger Exchanger
+}
+
+// Exchanger sends one query and returns the response.
+type Exchanger interface {
+	Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+}
+
+// New returns a Resolver for server, e.g. "127.0.0.1:53".
+func New(server string) *Resolver {
+	return &Resolver{Client: new(dns.Client), Server: server}
+}
+
+// NewSPFResolver returns an spfdns.Resolver backed by a miekg/dns client for
+// both TXT and address lookups.
+func NewSPFResolver(server string) *spfdns.Resolver {
+	r := New(server)
+	return spfdns.NewCustomDNSResolver(r, r)
+}
+
+// RcodeError is returned for answers with a response code other than
+// NOERROR.  It implements spfdns.Rcoder.
+type RcodeError struct {
+	Name  string // queried name
+	Code  int
+	Qtype uint16
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("lookup %s %s: %s", e.Name, dns.TypeToString[e.Qtype], dns.RcodeToString[e.Code])
+}
+
+// Rcode returns the DNS response code.
+func (e *RcodeError) Rcode() int { return e.Code }
+
+// TruncatedError is returned when a UDP answer was truncated and the TCP
+// retry failed or was itself truncated.  It wraps spfdns.ErrTCPFallback, so
+// spfdns.ClassifyError reports it as a temporary error.
+type TruncatedError struct {
+	Name  string // queried name
+	Qtype uint16
+	Err   error // TCP failure, nil when the TCP answer was truncated too
+}
+
+func (e *TruncatedError) Error() string {
+	msg := fmt.Sprintf("lookup %s %s: truncated over UDP, %v", e.Name, dns.TypeToString[e.Qtype], spfdns.ErrTCPFallback)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns spfdns.ErrTCPFallback and the TCP failure.
+func (e *TruncatedError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{spfdns.ErrTCPFallback}
+	}
+	return []error{spfdns.ErrTCPFallback, e.Err}
+}
+
+// exchange sends one query, retrying over TCP when the UDP answer is
+// truncated.  A NOERROR answer without records is returned without error.
+func (r *Resolver) exchange(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+
+	if r.Exchanger != nil {
+		start := time.Now()
+		resp, err := r.Exchanger.Exchange(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		return r.answer(ctx, name, qtype, resp, time.Since(start))
+	}
+	resp, rtt, err := r.Client.ExchangeContext(ctx, m, r.Server)
+	if err == nil && resp.Truncated {
+		udp := rtt
+		tcp := *r.Client
+		tcp.Net = "tcp"
+		resp, rtt, err = tcp.ExchangeContext(ctx, m, r.Server)
+		rtt += udp
+		switch {
+		case err != nil:
+			return nil, &TruncatedError{Name: name, Qtype: qtype, Err: err}
+		case resp.Truncated:
+			return nil, &TruncatedError{Name: name, Qtype: qtype}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.answer(ctx, name, qtype, resp, rtt)
+}
+
+// answer reports resp and returns its answer section, or an RcodeError
+// for a response code other than NOERROR.
+func (r *Resolver) answer(ctx context.Context, name string, qtype uint16, resp *dns.Msg, rtt time.Duration) ([]dns.RR, error) {
+	r.report(ctx, resp, rtt)
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, &RcodeError{Name: name, Code: resp.Rcode, Qtype: qtype}
+	}
+	return resp.Answer, nil
+}
+
+// report passes the response code, answer count and round trip time of
+// resp to a lookup observed with spfdns.ObserveQuery.
+func (r *Resolver) report(ctx context.Context, resp *dns.Msg, rtt time.Duration) {
+	spfdns.ReportQuery(ctx, spfdns.QueryInfo{Rcode: resp.Rcode, Answers: len(resp.Answer), Server: r.Server, Latency: rtt})
+}
+
+// LookupTXTStrings returns the character-strings of each TXT RR of domain.
+func (r *Resolver) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	rrs, _, err := r.lookupTXT(ctx, domain)
+	return rrs, err
+}
+
+// LookupTXT returns one concatenated string per TXT RR of domain.
+func (r *Resolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	txts, _, err := r.LookupTXTTTL(ctx, domain)
+	return txts, err
+}
+
+// LookupTXTTTL returns one concatenated string per TXT RR of domain and the
+// lowest TTL in the answer, zero for an empty answer.  It implements
+// spfdns.TTLResolver, so the decision cache of go-spf follows the TTL.
+func (r *Resolver) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	rrs, ttl, err := r.lookupTXT(ctx, domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]string, 0, len(rrs))
+	for _, strs := range rrs {
+		out = append(out, strings.Join(strs, ""))
+	}
+	return out, ttl, nil
+}
+
+// lookupTXT returns the character-strings of each TXT RR of domain and the
+// lowest TTL of the answer section, CNAMEs included.
+func (r *Resolver) lookupTXT(ctx context.Context, domain string) ([][]string, time.Duration, error) {
+	answer, err := r.exchange(ctx, domain, dns.TypeTXT)
+	if err != nil {
+		return nil, 0, err
+	}
+	var out [][]string
+	var ttl time.Duration
+	for i, rr := range answer {
+		if rrTTL := time.Duration(rr.Header().Ttl) * time.Second; i == 0 || rrTTL < ttl {
+			ttl = rrTTL
+		}
+		if txt, ok := rr.(*dns.TXT); ok {
+			out = append(out, txt.Txt)
+		}
+	}
+	return out, ttl, nil
+}
+
+// LookupSPF returns one concatenated string per SPF (type 99) RR of domain,
+// the record type of RFC 4408.  It implements spfdns.SPFTypeResolver.
+func (r *Resolver) LookupSPF(ctx context.Context, domain string) ([]string, error) {
+	answer, err := r.exchange(ctx, domain, dns.TypeSPF)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range answer {
+		if spf, ok := rr.(*dns.SPF); ok {
+			out = append(out, strings.Join(spf.Txt, ""))
+		}
+	}
+	return out, nil
+}
+
+// LookupIPAddr returns the A and AAAA records of host.  An NXDOMAIN from
+// either query is reported; if only one family fails otherwise, the other
+// family's answer is still returned.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r.lookupAddrs(ctx, host, dns.TypeA, dns.TypeAAAA)
+}
+
+// LookupIP returns the addresses of host for network "ip4" (A queries
+// only), "ip6" (AAAA only) or "ip" (both), as net.Resolver.LookupIP does.
+// It implements spfdns.NetworkIPResolver.
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	qtypes := []uint16{dns.TypeA, dns.TypeAAAA}
+	switch network {
+	case "ip4":
+		qtypes = qtypes[:1]
+	case "ip6":
+		qtypes = qtypes[1:]
+	case "ip":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	addrs, err := r.lookupAddrs(ctx, host, qtypes...)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+	return ips, nil
+}
+
+// lookupAddrs queries host for each of qtypes, A or AAAA.  A failure is
+// only returned when no query produced an address.
+func (r *Resolver) lookupAddrs(ctx context.Context, host string, qtypes ...uint16) ([]net.IPAddr, error) {
+	var out []net.IPAddr
+	var firstErr error
+	for _, qtype := range qtypes {
+		answer, err := r.exchange(ctx, host, qtype)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, rr := range answer {
+			switch v := rr.(type) {
+			case *dns.A:
+				out = append(out, net.IPAddr{IP: v.A})
+			case *dns.AAAA:
+				out = append(out, net.IPAddr{IP: v.AAAA})
+			}
+		}
+	}
+	if len(out) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// LookupMX returns the MX records of name.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	answer, err := r.exchange(ctx, name, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.MX
+	for _, rr := range answer {
+		if mx, ok := rr.(*dns.MX); ok {
+			out = append(out, &net.MX{Host: mx.Mx, Pref: mx.Preference})
+		}
+	}
+	return out, nil
+}
+
+// LookupAddr returns the PTR names of addr, an IP address in textual form.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	rev, err := dns.ReverseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := r.exchange(ctx, rev, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			out = append(out, ptr.Ptr)
+		}
+	}
+	return out, nil
+}
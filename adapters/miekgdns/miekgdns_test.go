@@ -0,0 +1,165 @@
+package miekgdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	spfdns "github.com/t0gun/go-spf/dns"
+)
+
+// serve starts a UDP server on a random local port answering with h.
+func serve(t *testing.T, h dns.HandlerFunc) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: h, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func zone(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	q := req.Question[0]
+	switch q.Name {
+	case "example.com.":
+		if q.Qtype == dns.TypeTXT {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"v=spf1 ip4:192.0.2.0/24 ", "-all"},
+			})
+		}
+		if q.Qtype == dns.TypeSPF {
+			m.Answer = append(m.Answer, &dns.SPF{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeSPF, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"v=spf1 ip4:192.0.2.0/25 ", "-all"},
+			})
+		}
+		if q.Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("192.0.2.1"),
+			})
+		}
+		if q.Qtype == dns.TypeMX {
+			m.Answer = append(m.Answer, &dns.MX{
+				Hdr:        dns.RR_Header{Name: q.Name, Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 60},
+				Preference: 10,
+				Mx:         "mail.example.com.",
+			})
+		}
+	case "1.2.0.192.in-addr.arpa.":
+		m.Answer = append(m.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 60},
+			Ptr: "mail.example.com.",
+		})
+	case "refused.example.":
+		m.SetRcode(req, dns.RcodeRefused)
+	case "big.example.":
+		// serve only listens on UDP, so the TCP retry is refused
+		m.Truncated = true
+	default:
+		m.SetRcode(req, dns.RcodeNameError)
+	}
+	_ = w.WriteMsg(m)
+}
+
+func TestResolver(t *testing.T) {
+	r := New(serve(t, zone))
+	ctx := context.Background()
+
+	strs, err := r.LookupTXTStrings(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"v=spf1 ip4:192.0.2.0/24 ", "-all"}}, strs)
+
+	txt, err := r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all"}, txt)
+
+	txt, ttl, err := r.LookupTXTTTL(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all"}, txt)
+	assert.Equal(t, time.Minute, ttl)
+
+	spf, err := r.LookupSPF(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/25 -all"}, spf)
+
+	ips, err := r.LookupIPAddr(ctx, "example.com")
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+	assert.Equal(t, "192.0.2.1", ips[0].IP.String())
+
+	mxs, err := r.LookupMX(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mail.example.com.", Pref: 10}}, mxs)
+
+	names, err := r.LookupAddr(ctx, "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mail.example.com."}, names)
+}
+
+func TestResolverErrors(t *testing.T) {
+	r := New(serve(t, zone))
+	ctx := context.Background()
+
+	_, err := r.LookupTXT(ctx, "missing.example")
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrNoDNSrecord)
+
+	_, err = r.LookupTXT(ctx, "refused.example")
+	rcode, ok := spfdns.ErrorRcode(err)
+	require.True(t, ok)
+	assert.Equal(t, spfdns.RcodeRefused, rcode)
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrPermfail)
+
+	_, err = r.LookupTXT(ctx, "big.example")
+	var te *TruncatedError
+	require.ErrorAs(t, err, &te)
+	assert.Error(t, te.Err)
+	assert.ErrorIs(t, err, spfdns.ErrTCPFallback)
+	assert.ErrorIs(t, spfdns.ClassifyError(err), spfdns.ErrTempfail)
+}
+
+func TestNewSPFResolver(t *testing.T) {
+	r := NewSPFResolver(serve(t, zone))
+	rec, err := spfdns.GetSPFRecord(context.Background(), "example.com", r)
+	require.NoError(t, err)
+	assert.Equal(t, "v=spf1 ip4:192.0.2.0/24 -all", rec)
+}
+
+// clientExchanger sends queries to addr, standing in for a plugin chain.
+type clientExchanger struct {
+	addr  string
+	count *int
+}
+
+func (c clientExchanger) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	*c.count++
+	resp, _, err := new(dns.Client).ExchangeContext(ctx, m, c.addr)
+	return resp, err
+}
+
+func TestResolverExchanger(t *testing.T) {
+	var count int
+	r := &Resolver{Exchanger: clientExchanger{addr: serve(t, zone), count: &count}}
+	ctx := context.Background()
+
+	txt, ttl, err := r.LookupTXTTTL(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all"}, txt)
+	assert.Equal(t, time.Minute, ttl)
+	assert.Equal(t, 1, count)
+
+	_, err = r.LookupTXT(ctx, "refused.example")
+	var re *RcodeError
+	require.ErrorAs(t, err, &re)
+	assert.Equal(t, dns.RcodeRefused, re.Code)
+}
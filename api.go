@@ -0,0 +1,46 @@
+package spf
+
+import (
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// The aliases below re-export the types from the dns and parser subpackages
+// that form part of the v1 API, so callers can depend on the root package
+// alone.  They are aliases rather than new types, which keeps values
+// interchangeable with code written against the subpackages directly.
+type (
+	// Record is a parsed SPF record.  See parser.Record.
+	Record = parser.Record
+
+	// Mechanism is one mechanism term of a Record.  See parser.Mechanism.
+	Mechanism = parser.Mechanism
+
+	// Modifier is one name=value term of a Record.  See parser.Modifier.
+	Modifier = parser.Modifier
+
+	// Qualifier is the prefix of a Mechanism.  See parser.Qualifier.
+	Qualifier = parser.Qualifier
+
+	// Resolver performs the DNS lookups needed during evaluation.  See
+	// dns.Resolver.
+	Resolver = dns.Resolver
+
+	// TXTResolver looks up TXT records.  See dns.TXTResolver.
+	TXTResolver = dns.TXTResolver
+
+	// IPResolver looks up A and AAAA records.  See dns.IPResolver.
+	IPResolver = dns.IPResolver
+)
+
+// NewResolver returns the default Resolver backed by the Go standard library.
+// It is equivalent to dns.NewDNSResolver.
+func NewResolver() *Resolver {
+	return dns.NewDNSResolver()
+}
+
+// NewCustomResolver returns a Resolver that delegates to txt and ip.  It is
+// equivalent to dns.NewCustomDNSResolver.
+func NewCustomResolver(txt TXTResolver, ip IPResolver) *Resolver {
+	return dns.NewCustomDNSResolver(txt, ip)
+}
@@ -0,0 +1,87 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
+)
+
+// Audit is the syntax health of a domain's SPF policy, as returned by
+// AuditDomain.  Nothing is evaluated against a client.
+type Audit struct {
+	Domain string
+	Found  bool   // the domain publishes an SPF record
+	Record string // root record text, empty when none was found
+
+	// ParseErr is why the root record does not parse.  The other fields
+	// below are then zero.
+	ParseErr error
+
+	// Findings are the TXT character-string checks of the root, then the
+	// root record checks and the tree checks.  A domain whose record is
+	// hidden by a split version tag has only the first, with Found unset.
+	Findings []lint.Finding
+	Lookups  int // worst-case lookups, see RecordGraph.TotalCost
+	Metrics  lint.TreeMetrics
+	// Flattened and FlattenedSize describe flattening the tree: the
+	// networks it authorizes and the length in bytes of "v=spf1" followed
+	// by them, before any all term.
+	Flattened     Flattened
+	FlattenedSize int
+
+	Graph *RecordGraph
+}
+
+// AuditDomain is Checker.AuditDomain using the default resolver.
+func AuditDomain(ctx context.Context, domain string) (Audit, error) {
+	return defaultChecker.AuditDomain(ctx, domain)
+}
+
+// AuditDomain fetches the record tree of domain with WalkRecord and reports
+// record presence, the parse result, lint findings including those of
+// lint.TXTStrings, the lookup estimate and the flattened size in one call.  A domain that does not exist or has no
+// record is reported with Found unset; other failures of the root lookup
+// are returned as errors.
+func (c *Checker) AuditDomain(ctx context.Context, domain string) (Audit, error) {
+	g, err := c.WalkRecord(ctx, domain)
+	switch {
+	case errors.Is(err, ErrNoSPFRecord):
+		// a version tag joined to the next term hides the record
+		d := normalizeFQDN(domain)
+		return Audit{Domain: d, Findings: c.txtFindings(ctx, d)}, nil
+	case errors.Is(err, dns.ErrNoDNSrecord):
+		return Audit{Domain: normalizeFQDN(domain)}, nil
+	case err != nil:
+		return Audit{Domain: normalizeFQDN(domain)}, err
+	}
+	return g.Audit(c.lintConfig()), nil
+}
+
+// Audit reports the health of the tree g, linting with cfg.  It is the code
+// path behind AuditDomain for graphs already walked.
+func (g *RecordGraph) Audit(cfg lint.Config) Audit {
+	a := Audit{Domain: g.Root, Graph: g}
+	root, ok := g.Nodes[g.Root]
+	if !ok || root.Record == "" {
+		return a
+	}
+	a.Found, a.Record = true, root.Record
+	if root.Err != nil {
+		// WalkRecord fails on the root lookup, so this is a parse error
+		a.ParseErr = root.Err
+		return a
+	}
+	a.Metrics = g.Metrics()
+	a.Lookups = g.TotalCost(g.Root)
+	a.Findings = append(a.Findings, root.Findings...)
+	if rec, err := g.opts.Parse(root.Record); err == nil {
+		a.Findings = append(a.Findings, lint.Record(rec, cfg)...)
+	}
+	a.Findings = append(a.Findings, lint.Tree(a.Metrics, cfg)...)
+	a.Flattened = g.Flatten()
+	a.FlattenedSize = len(strings.Join(append([]string{"v=spf1"}, a.Flattened.Networks...), " "))
+	return a
+}
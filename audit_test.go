@@ -0,0 +1,93 @@
+package spf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestChecker_AuditDomain(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":      {"v=spf1 include:_spf.example.net ptr ip4:192.0.2.0/24 -all"},
+		"_spf.example.net": {"v=spf1 ip4:198.51.100.0/24 ip6:2001:db8::/32 -all"},
+		"broken.example":   {"v=spf1 bogus -all"},
+		"other.example":    {"google-site-verification=abc"},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	ctx := context.Background()
+
+	a, err := ch.AuditDomain(ctx, "Example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", a.Domain)
+	assert.True(t, a.Found)
+	assert.Equal(t, "v=spf1 include:_spf.example.net ptr ip4:192.0.2.0/24 -all", a.Record)
+	require.NoError(t, a.ParseErr)
+	assert.Equal(t, 2, a.Lookups)
+	assert.Equal(t, lint.TreeMetrics{MaxIncludeDepth: 1, Domains: 2, ThirdPartyDomains: 1, CIDRs: 3}, a.Metrics)
+	require.Len(t, a.Findings, 1)
+	assert.Equal(t, lint.RulePTR, a.Findings[0].Rule)
+	assert.Equal(t, []string{"ip4:198.51.100.0/24", "ip6:2001:db8::/32", "ip4:192.0.2.0/24"}, a.Flattened.Networks)
+	assert.Equal(t, len("v=spf1 ip4:198.51.100.0/24 ip6:2001:db8::/32 ip4:192.0.2.0/24"), a.FlattenedSize)
+	assert.NotNil(t, a.Graph)
+
+	a, err = ch.AuditDomain(ctx, "broken.example")
+	require.NoError(t, err)
+	assert.True(t, a.Found)
+	assert.Error(t, a.ParseErr)
+	assert.Empty(t, a.Findings)
+
+	for _, d := range []string{"other.example", "missing.example"} {
+		a, err = ch.AuditDomain(ctx, d)
+		require.NoError(t, err, d)
+		assert.False(t, a.Found, d)
+		assert.Empty(t, a.Record, d)
+	}
+
+	_, err = ch.AuditDomain(ctx, "bad..name")
+	assert.Error(t, err)
+}
+
+func TestChecker_AuditDomainTXTStrings(t *testing.T) {
+	txt := fakeTXTStrings{
+		"prefix.example": {{"", "v=spf1 ptr -all"}},
+		"glued.example":  {{"v=spf1", "ip4:192.0.2.0/24 -all"}},
+		"split.example":  {{"v=spf1 include:", "prefix.example -all"}},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	ctx := context.Background()
+
+	a, err := ch.AuditDomain(ctx, "prefix.example")
+	require.NoError(t, err)
+	assert.True(t, a.Found)
+	require.Len(t, a.Findings, 2)
+	assert.Equal(t, lint.RuleVersionPrefix, a.Findings[0].Rule)
+	assert.Equal(t, lint.RulePTR, a.Findings[1].Rule)
+
+	a, err = ch.AuditDomain(ctx, "glued.example")
+	require.NoError(t, err)
+	assert.False(t, a.Found)
+	require.Len(t, a.Findings, 1)
+	assert.Equal(t, lint.RuleSplitVersion, a.Findings[0].Rule)
+	assert.Equal(t, lint.Error, a.Findings[0].Severity)
+
+	g, err := ch.WalkRecord(ctx, "split.example")
+	require.NoError(t, err)
+	assert.Empty(t, g.Nodes["split.example"].Findings)
+	require.Len(t, g.Nodes["prefix.example"].Findings, 1)
+	assert.Equal(t, lint.RuleVersionPrefix, g.Nodes["prefix.example"].Findings[0].Rule)
+}
+
+func TestRecordGraph_AuditParserOptions(t *testing.T) {
+	txt := fakeTXTMap{"example.com": {"v=spf1 a:-legacy.example.com ptr -all"}}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil), WithParserOptions(parser.Options{NoIDNA: true}))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	a := g.Audit(lint.Config{})
+	require.Len(t, a.Findings, 1)
+	assert.Equal(t, lint.RulePTR, a.Findings[0].Rule)
+}
@@ -0,0 +1,76 @@
+package spf
+
+import (
+	"runtime/debug"
+	"sort"
+
+	"github.com/t0gun/go-spf/macro"
+)
+
+// modulePath identifies this module in the build information.
+const modulePath = "github.com/t0gun/go-spf"
+
+// evaluatedMechanisms lists the mechanism kinds evaluateRecord implements, in
+// RFC 7208 section 5 order.  Other kinds parse but never match.
+var evaluatedMechanisms = []string{"all", "include", "a", "mx", "ptr", "ip4", "ip6", "exists"}
+
+// evaluatedModifiers lists the modifiers acted upon during evaluation.
+var evaluatedModifiers = []string{"redirect", "exp"}
+
+// Caps describes what this build of the library supports.
+type Caps struct {
+	Version                 string   // module version, "(devel)" when unknown
+	Mechanisms              []string // mechanism kinds that are evaluated
+	Modifiers               []string // modifiers that are evaluated
+	MacroLetters            string   // letters accepted in domain-specs
+	ExplanationMacroLetters string   // letters accepted only in exp text
+	MaxLookups              int
+	MaxVoidLookups          int
+	Disabled                []string // mechanism kinds disabled by options, sorted
+	Mode                    Mode
+	Quirks                  Quirks // receiver quirks enabled by WithQuirks
+}
+
+// Capabilities reports what the package-level functions support, with the
+// default limits.
+func Capabilities() Caps {
+	return defaultChecker.Capabilities()
+}
+
+// Capabilities reports what c supports: the implemented mechanisms,
+// modifiers and macro letters plus its configured limits.
+func (c *Checker) Capabilities() Caps {
+	caps := Caps{
+		Version:                 version(),
+		Mechanisms:              append([]string(nil), evaluatedMechanisms...),
+		Modifiers:               append([]string(nil), evaluatedModifiers...),
+		MacroLetters:            macro.Letters,
+		ExplanationMacroLetters: macro.ExplanationLetters,
+		MaxLookups:              c.MaxLookups,
+		MaxVoidLookups:          c.MaxVoidLookups,
+		Mode:                    c.mode,
+		Quirks:                  c.quirks,
+	}
+	for kind := range c.disabled {
+		caps.Disabled = append(caps.Disabled, kind)
+	}
+	sort.Strings(caps.Disabled)
+	return caps
+}
+
+// version returns the module version recorded in the build information.
+func version() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if bi.Main.Path == modulePath {
+		return bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
@@ -0,0 +1,33 @@
+package spf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities()
+	assert.Equal(t, evaluatedMechanisms, caps.Mechanisms)
+	assert.Equal(t, []string{"redirect", "exp"}, caps.Modifiers)
+	assert.Equal(t, "slodipvh", caps.MacroLetters)
+	assert.Equal(t, "crt", caps.ExplanationMacroLetters)
+	assert.Equal(t, MaxDNSLookups, caps.MaxLookups)
+	assert.Equal(t, MaxVoidLookups, caps.MaxVoidLookups)
+	assert.Empty(t, caps.Disabled)
+	assert.NotEmpty(t, caps.Version)
+}
+
+func TestChecker_Capabilities(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil), WithDisabledMechanisms("ptr", "Exists"), WithQuirks(Quirks{FirstRecord: true}))
+	ch.MaxLookups = 5
+	caps := ch.Capabilities()
+	assert.Equal(t, 5, caps.MaxLookups)
+	assert.Equal(t, []string{"exists", "ptr"}, caps.Disabled)
+	assert.True(t, caps.Quirks.FirstRecord)
+
+	// callers must not be able to change the package tables
+	caps.Mechanisms[0] = "bogus"
+	assert.Equal(t, "all", evaluatedMechanisms[0])
+}
@@ -0,0 +1,212 @@
+package spf
+
+import (
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/t0gun/go-spf/parser"
+)
+
+// DecisionCacheConfig configures the pass decision cache, see
+// WithDecisionCache.
+type DecisionCacheConfig struct {
+	// MaxTTL bounds how long a decision is kept.  The TTL of the TXT
+	// answers the decision depended on lowers it when the resolver reports
+	// TTLs (dns.TTLResolver).  DefaultDecisionTTL if zero.
+	MaxTTL time.Duration
+	// MaxEntries bounds the number of cached networks across all domains,
+	// DefaultDecisionEntries if zero.  When full, expired entries are
+	// dropped and new decisions are not cached until there is room.
+	MaxEntries int
+}
+
+// Defaults for DecisionCacheConfig.
+const (
+	DefaultDecisionTTL     = 5 * time.Minute
+	DefaultDecisionEntries = 10000
+)
+
+// WithDecisionCache enables a heuristic cache of Pass decisions keyed by the
+// network that matched.  After 192.0.2.7 passes for example.com through
+// ip4:192.0.2.0/24, any client in 192.0.2.0/24 passes for example.com
+// without evaluating the record until the entry expires.  High-volume
+// providers publish a handful of large blocks, so most of their traffic is
+// then answered from memory.
+//
+// This is not RFC 7208 evaluation and is off by default.  The cache is only
+// filled from evaluations where the shortcut is believed to hold:
+//   - the deciding term is a + ip4 or ip6 mechanism, at the top level or
+//     inside includes whose qualifier is +;
+//   - no term reached before it carries a macro or is exists or ptr, whose
+//     outcome may differ for another client or sender;
+//   - no term reached before it has a non-pass qualifier, since such a term
+//     may match other addresses of the network.
+//
+// Even so a cached answer may be wrong: the record may change before the
+// entry expires, a term that did not match this client may match another
+// one in a way these rules miss, and cached results carry no trace,
+// warnings or lookup counts.  Callers that need the exact RFC result for
+// every message must not use it.
+func WithDecisionCache(cfg DecisionCacheConfig) Option {
+	return func(c *Checker) {
+		if cfg.MaxTTL <= 0 {
+			cfg.MaxTTL = DefaultDecisionTTL
+		}
+		if cfg.MaxEntries <= 0 {
+			cfg.MaxEntries = DefaultDecisionEntries
+		}
+		c.decisions = &decisionCache{cfg: cfg, domains: map[string][]decision{}}
+	}
+}
+
+// Invalidate forces re-evaluation for domain after its record changed.  It
+// drops the cached decisions for domain and for every domain whose
+// decisions were read from its record, e.g. through an include, and asks
+// the Resolver's caching backends to forget domain (dns.Invalidator).
+// Other names the record refers to, such as the hosts of its a and mx
+// mechanisms, are invalidated separately.  Invalidate returns the number
+// of decisions dropped.
+func (c *Checker) Invalidate(domain string) int {
+	domain = normalizeFQDN(domain)
+	if c.Resolver != nil {
+		c.Resolver.Invalidate(domain)
+	}
+	if c.decisions == nil {
+		return 0
+	}
+	return c.decisions.invalidate(domain)
+}
+
+// decisionCache holds the networks known to pass, by domain.
+type decisionCache struct {
+	cfg DecisionCacheConfig
+
+	mu      sync.Mutex
+	domains map[string][]decision
+	size    int
+}
+
+type decision struct {
+	net     *net.IPNet
+	deps    []string // domains whose records the decision was read from
+	expires time.Time
+}
+
+// lookup returns the cached network containing ip that passes for domain.
+func (dc *decisionCache) lookup(domain string, ip net.IP, now time.Time) (*net.IPNet, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for _, d := range dc.domains[domain] {
+		if now.Before(d.expires) && d.net.Contains(ip) {
+			return d.net, true
+		}
+	}
+	return nil, false
+}
+
+// store records that clients in n pass for domain until now+ttl, ttl being
+// capped by the configured maximum.  deps are the domains whose records the
+// decision was read from.
+func (dc *decisionCache) store(domain string, n *net.IPNet, deps []string, ttl time.Duration, now time.Time) {
+	if ttl <= 0 || ttl > dc.cfg.MaxTTL {
+		ttl = dc.cfg.MaxTTL
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.size >= dc.cfg.MaxEntries {
+		dc.expire(now)
+		if dc.size >= dc.cfg.MaxEntries {
+			return
+		}
+	}
+	ds := dc.domains[domain]
+	for i, d := range ds {
+		if d.net.String() == n.String() {
+			ds[i].deps, ds[i].expires = deps, now.Add(ttl)
+			return
+		}
+	}
+	dc.domains[domain] = append(ds, decision{net: n, deps: deps, expires: now.Add(ttl)})
+	dc.size++
+}
+
+// expire drops expired entries.  Callers hold mu.
+func (dc *decisionCache) expire(now time.Time) {
+	for domain, ds := range dc.domains {
+		kept := ds[:0]
+		for _, d := range ds {
+			if now.Before(d.expires) {
+				kept = append(kept, d)
+			}
+		}
+		dc.size -= len(ds) - len(kept)
+		if len(kept) == 0 {
+			delete(dc.domains, domain)
+			continue
+		}
+		dc.domains[domain] = kept
+	}
+}
+
+// invalidate drops the decisions for name and those read from its record,
+// returning how many were dropped.
+func (dc *decisionCache) invalidate(name string) int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dropped := len(dc.domains[name])
+	delete(dc.domains, name)
+	for domain, ds := range dc.domains {
+		kept := ds[:0]
+		for _, d := range ds {
+			if !slices.Contains(d.deps, name) {
+				kept = append(kept, d)
+			}
+		}
+		dropped += len(ds) - len(kept)
+		if len(kept) == 0 {
+			delete(dc.domains, domain)
+			continue
+		}
+		dc.domains[domain] = kept
+	}
+	dc.size -= dropped
+	return dropped
+}
+
+// cacheable tracks whether the evaluation so far allows its Pass to be
+// cached for the network that decided it, see WithDecisionCache.
+type cacheable struct {
+	net    *net.IPNet    // ip4/ip6 network of the deciding match
+	unsafe bool          // a term reached could decide differently for another client
+	ttl    time.Duration // lowest TXT TTL seen, zero if unknown
+}
+
+// reached updates the state for mech having been evaluated, matching or not.
+func (cs *cacheable) reached(mech parser.Mechanism, matched bool) {
+	switch {
+	case mech.Macro, mech.Kind == "exists", mech.Kind == "ptr":
+		cs.unsafe = true
+	case resultFromQualifier(mech.Qual) != Pass:
+		cs.unsafe = true
+	}
+	if !matched {
+		return
+	}
+	switch mech.Kind {
+	case "ip4", "ip6":
+		cs.net = mech.Net
+	case "include":
+		// the include's own match decided; keep the network from inside it
+	default:
+		cs.net = nil
+	}
+}
+
+// seenTTL lowers the recorded TTL to ttl when known.
+func (cs *cacheable) seenTTL(ttl time.Duration) {
+	if ttl > 0 && (cs.ttl == 0 || ttl < cs.ttl) {
+		cs.ttl = ttl
+	}
+}
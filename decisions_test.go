@@ -0,0 +1,148 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+// countingTXT counts TXT lookups and reports a fixed TTL.
+type countingTXT struct {
+	fakeTXTMap
+	ttl     time.Duration
+	lookups int
+}
+
+func (f *countingTXT) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	f.lookups++
+	txts, err := f.LookupTXT(ctx, domain)
+	return txts, f.ttl, err
+}
+
+func TestWithDecisionCache(t *testing.T) {
+	txts := &countingTXT{fakeTXTMap: fakeTXTMap{
+		"example.com":      {"v=spf1 include:_spf.example.com -all"},
+		"_spf.example.com": {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"minus.example":    {"v=spf1 -ip4:192.0.2.128/25 ip4:192.0.2.0/24 -all"},
+		"exists.example":   {"v=spf1 exists:%{i}.list.example ip4:192.0.2.0/24 -all"},
+		"all.example":      {"v=spf1 +all"},
+	}, ttl: time.Minute}
+	now := time.Unix(1700000000, 0)
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithDecisionCache(DecisionCacheConfig{}))
+	check := func(ip, domain string) CheckHostResult {
+		t.Helper()
+		res, err := ch.Check(context.Background(), Request{IP: net.ParseIP(ip), MailFrom: "user@" + domain})
+		require.NoError(t, err)
+		return res
+	}
+
+	res := check("192.0.2.7", "example.com")
+	assert.Equal(t, Pass, res.Code)
+	assert.False(t, res.Cached)
+	assert.Equal(t, 2, txts.lookups)
+
+	res = check("192.0.2.200", "example.com")
+	assert.Equal(t, Pass, res.Code)
+	assert.True(t, res.Cached)
+	assert.Equal(t, "example.com", res.TerminatedAt)
+	require.NotEmpty(t, res.Trace)
+	assert.Contains(t, res.Trace[0].Note, "192.0.2.0/24")
+	assert.Equal(t, 2, txts.lookups)
+
+	// outside the network and after the DNS TTL the record is evaluated
+	assert.Equal(t, Fail, check("198.51.100.1", "example.com").Code)
+	now = now.Add(2 * time.Minute)
+	assert.False(t, check("192.0.2.200", "example.com").Cached)
+
+	// passes the heuristic cannot generalise are never cached
+	for _, domain := range []string{"minus.example", "exists.example", "all.example"} {
+		check("192.0.2.7", domain)
+		assert.False(t, check("192.0.2.7", domain).Cached, domain)
+	}
+	assert.Equal(t, Fail, check("192.0.2.200", "minus.example").Code)
+}
+
+func TestWithDecisionCacheNAT64(t *testing.T) {
+	txts := &countingTXT{fakeTXTMap: fakeTXTMap{"example.com": {"v=spf1 ip4:192.0.2.0/24 -all"}}, ttl: time.Minute}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithNAT64(), WithDecisionCache(DecisionCacheConfig{}))
+	for i, ip := range []string{"64:ff9b::192.0.2.7", "64:ff9b::192.0.2.8", "192.0.2.9"} {
+		res, err := ch.Check(context.Background(), Request{IP: net.ParseIP(ip), MailFrom: "user@example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, Pass, res.Code, ip)
+		assert.Equal(t, i > 0, res.Cached, ip)
+	}
+	assert.Equal(t, 1, txts.lookups)
+}
+
+func TestDecisionCache_MaxEntries(t *testing.T) {
+	dc := &decisionCache{cfg: DecisionCacheConfig{MaxTTL: time.Minute, MaxEntries: 1}, domains: map[string][]decision{}}
+	now := time.Unix(1700000000, 0)
+	_, a, _ := net.ParseCIDR("192.0.2.0/24")
+	_, b, _ := net.ParseCIDR("198.51.100.0/24")
+	dc.store("a.example", a, nil, 0, now)
+	dc.store("b.example", b, nil, 0, now)
+	_, ok := dc.lookup("b.example", net.ParseIP("198.51.100.1"), now)
+	assert.False(t, ok, "full cache must not grow")
+
+	later := now.Add(2 * time.Minute)
+	dc.store("b.example", b, nil, 0, later)
+	_, ok = dc.lookup("b.example", net.ParseIP("198.51.100.1"), later)
+	assert.True(t, ok, "expired entries make room")
+	assert.Equal(t, 1, dc.size)
+}
+
+// invalidatingTXT records the names it is asked to invalidate.
+type invalidatingTXT struct {
+	countingTXT
+	invalidated []string
+}
+
+func (f *invalidatingTXT) Invalidate(name string) {
+	f.invalidated = append(f.invalidated, name)
+}
+
+func TestCheckerInvalidate(t *testing.T) {
+	txts := &invalidatingTXT{countingTXT: countingTXT{fakeTXTMap: fakeTXTMap{
+		"example.com":      {"v=spf1 include:_spf.example.com -all"},
+		"other.example":    {"v=spf1 ip4:198.51.100.0/24 -all"},
+		"_spf.example.com": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}, ttl: time.Hour}}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithDecisionCache(DecisionCacheConfig{}))
+	check := func(ip, domain string) CheckHostResult {
+		t.Helper()
+		res, err := ch.Check(context.Background(), Request{IP: net.ParseIP(ip), MailFrom: "user@" + domain})
+		require.NoError(t, err)
+		return res
+	}
+	fill := func() {
+		t.Helper()
+		check("192.0.2.7", "example.com")
+		check("198.51.100.7", "other.example")
+		require.True(t, check("192.0.2.8", "example.com").Cached)
+		require.True(t, check("198.51.100.8", "other.example").Cached)
+	}
+
+	fill()
+	assert.Equal(t, 1, ch.Invalidate("Example.COM."))
+	assert.False(t, check("192.0.2.9", "example.com").Cached)
+	assert.True(t, check("198.51.100.9", "other.example").Cached)
+	assert.Contains(t, txts.invalidated, "example.com")
+
+	// decisions read through an include are dropped with the include target
+	fill()
+	assert.Equal(t, 1, ch.Invalidate("_spf.example.com"))
+	assert.False(t, check("192.0.2.9", "example.com").Cached)
+	assert.Equal(t, 0, ch.Invalidate("unrelated.example"))
+
+	// without a decision cache only the resolver is invalidated
+	plain := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}))
+	assert.Equal(t, 0, plain.Invalidate("other.example"))
+	assert.Contains(t, txts.invalidated, "other.example")
+}
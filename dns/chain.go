@@ -0,0 +1,216 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultAttemptTimeout bounds one backend's attempt in a chain when
+// ChainConfig.AttemptTimeout is zero.
+const DefaultAttemptTimeout = time.Second
+
+// DefaultStickyFor is how long a chain keeps skipping failed backends when
+// ChainConfig.StickyFor is zero.
+const DefaultStickyFor = 5 * time.Second
+
+// ChainConfig tunes NewChainResolver.
+type ChainConfig struct {
+	// AttemptTimeout bounds each backend's attempt at a query, so a stalled
+	// backend hands over to the next one well before the caller's deadline.
+	// DefaultAttemptTimeout if zero.
+	AttemptTimeout time.Duration
+
+	// StickyFor bounds how long, within a sticky context, queries keep
+	// starting at a fallback backend.  Once it elapses the next query
+	// starts at the first backend again, so a primary that has recovered
+	// is used even by a context that outlives one evaluation.
+	// DefaultStickyFor if zero.
+	StickyFor time.Duration
+}
+
+// NewChainResolver returns a Resolver that sends each query to backends in
+// order, for example a local cache, then the corporate resolver, then a
+// public DoH service.  A backend that fails or does not answer within the
+// attempt timeout hands the query to the next one; an NXDOMAIN answer is
+// final.  The error of the last backend tried is returned when all fail.
+//
+// Within a context prepared with StickyContext the chain remembers which
+// backend last answered and starts there for ChainConfig.StickyFor, so one
+// evaluation does not pay the failover delay on every query once the
+// primary has degraded.  Stickiness is time-boxed rather than permanent:
+// after StickyFor the earlier backends are tried again.
+func NewChainResolver(cfg ChainConfig, backends ...*Resolver) *Resolver {
+	if cfg.AttemptTimeout <= 0 {
+		cfg.AttemptTimeout = DefaultAttemptTimeout
+	}
+	if cfg.StickyFor <= 0 {
+		cfg.StickyFor = DefaultStickyFor
+	}
+	ch := &chain{backends: backends, timeout: cfg.AttemptTimeout, stickyFor: cfg.StickyFor}
+	return &Resolver{txtr: ch, ipr: ch, mxr: ch, ptrr: ch}
+}
+
+type stickyKey struct{}
+
+// StickyContext returns a context in which chain resolvers remember, for
+// ChainConfig.StickyFor, the backend that last answered.  Use one per
+// evaluation; spf.Checker does.  A context that is already sticky is
+// returned as is.
+func StickyContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(stickyKey{}).(*sticky); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, stickyKey{}, &sticky{})
+}
+
+// sticky is the per-context state behind StickyContext: the backend each
+// chain last fell back to and when that stops applying.
+type sticky struct {
+	mu    sync.Mutex
+	start map[*chain]stickyStart
+}
+
+type stickyStart struct {
+	index int
+	until time.Time
+}
+
+// get returns the backend ch should start at.
+func (s *sticky) get(ch *chain) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.start[ch]
+	if !ok || time.Now().After(st.until) {
+		return 0
+	}
+	return st.index
+}
+
+// set records that backend i of ch answered.  An answer from the first
+// backend clears the entry; a fallback keeps it for ch.stickyFor from the
+// first fallback, so a long run of queries cannot extend it indefinitely.
+func (s *sticky) set(ch *chain, i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i == 0 {
+		delete(s.start, ch)
+		return
+	}
+	st, ok := s.start[ch]
+	if !ok || time.Now().After(st.until) {
+		st.until = time.Now().Add(ch.stickyFor)
+	}
+	st.index = i
+	if s.start == nil {
+		s.start = map[*chain]stickyStart{}
+	}
+	s.start[ch] = st
+}
+
+// chain is the backend of NewChainResolver.
+type chain struct {
+	backends  []*Resolver
+	timeout   time.Duration
+	stickyFor time.Duration
+}
+
+// try runs query against the backends in order, starting at the sticky one.
+func try[T any](ctx context.Context, ch *chain, query func(ctx context.Context, r *Resolver) (T, error)) (T, error) {
+	var zero T
+	if len(ch.backends) == 0 {
+		return zero, &net.DNSError{Err: "no resolvers in chain", IsTemporary: true}
+	}
+	st, _ := ctx.Value(stickyKey{}).(*sticky)
+	start := 0
+	if st != nil {
+		start = st.get(ch)
+	}
+	var err error
+	for i := start; i < len(ch.backends); i++ {
+		actx, cancel := context.WithTimeout(ctx, ch.timeout)
+		var out T
+		out, err = query(actx, ch.backends[i])
+		cancel()
+		if err == nil || errors.Is(ClassifyError(err), ErrNoDNSrecord) {
+			if st != nil {
+				st.set(ch, i)
+			}
+			return out, err
+		}
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+	}
+	return zero, err
+}
+
+func (ch *chain) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([]string, error) {
+		return r.LookupTXT(ctx, domain)
+	})
+}
+
+func (ch *chain) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([][]string, error) {
+		return r.LookupTXTStrings(ctx, domain)
+	})
+}
+
+type txtTTL struct {
+	txts []string
+	ttl  time.Duration
+}
+
+func (ch *chain) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	out, err := try(ctx, ch, func(ctx context.Context, r *Resolver) (txtTTL, error) {
+		txts, ttl, err := r.LookupTXTTTL(ctx, domain)
+		return txtTTL{txts, ttl}, err
+	})
+	return out.txts, out.ttl, err
+}
+
+// LookupSPF fails over past backends that cannot query the SPF type too.
+func (ch *chain) LookupSPF(ctx context.Context, domain string) ([]string, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([]string, error) {
+		return r.LookupSPF(ctx, domain)
+	})
+}
+
+func (ch *chain) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([]net.IPAddr, error) {
+		return r.ipr.LookupIPAddr(ctx, host)
+	})
+}
+
+// LookupIP serves Resolver.LookupA.  Backends without NetworkIPResolver
+// are asked for both families; LookupA drops the IPv6 answers.
+func (ch *chain) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([]net.IP, error) {
+		if nr, ok := r.ipr.(NetworkIPResolver); ok {
+			return nr.LookupIP(ctx, network, host)
+		}
+		return r.LookupIP(ctx, host)
+	})
+}
+
+func (ch *chain) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([]*net.MX, error) {
+		return r.LookupMX(ctx, name)
+	})
+}
+
+func (ch *chain) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return try(ctx, ch, func(ctx context.Context, r *Resolver) ([]string, error) {
+		return r.ptrr.LookupAddr(ctx, addr)
+	})
+}
+
+// Invalidate forwards to every backend of the chain.
+func (ch *chain) Invalidate(name string) {
+	for _, r := range ch.backends {
+		r.Invalidate(name)
+	}
+}
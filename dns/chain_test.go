@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingTXT answers with txts or err, or stalls until the context ends.
+type countingTXT struct {
+	txts  []string
+	err   error
+	stall bool
+	calls atomic.Int32
+}
+
+func (c *countingTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	c.calls.Add(1)
+	if c.stall {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: "i/o timeout", Name: domain, IsTimeout: true, IsTemporary: true}
+	}
+	return c.txts, c.err
+}
+
+func (c *countingTXT) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	txts, err := c.LookupTXT(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return []net.IPAddr{{IP: net.ParseIP(txts[0])}}, nil
+}
+
+func TestChainResolver(t *testing.T) {
+	servfail := &countingTXT{err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}
+	stalled := &countingTXT{stall: true}
+	good := &countingTXT{txts: []string{"192.0.2.1"}}
+	nx := &countingTXT{err: &net.DNSError{Err: "no such host", IsNotFound: true}}
+	res := func(b *countingTXT) *Resolver { return NewCustomDNSResolver(b, b) }
+	ctx := context.Background()
+
+	r := NewChainResolver(ChainConfig{AttemptTimeout: 20 * time.Millisecond}, res(servfail), res(stalled), res(good))
+	start := time.Now()
+	txts, err := r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1"}, txts)
+	assert.Less(t, time.Since(start), time.Second)
+
+	ips, err := r.LookupIP(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", ips[0].String())
+	// without a sticky context every query starts at the first backend
+	assert.Equal(t, int32(2), servfail.calls.Load())
+
+	// NXDOMAIN is an answer, not a failure
+	r = NewChainResolver(ChainConfig{}, res(nx), res(good))
+	_, err = r.LookupTXT(ctx, "example.com")
+	require.ErrorIs(t, ClassifyError(err), ErrNoDNSrecord)
+	assert.Equal(t, int32(2), good.calls.Load())
+
+	// every backend failing returns the last error
+	r = NewChainResolver(ChainConfig{}, res(servfail), res(servfail))
+	_, err = r.LookupTXT(ctx, "example.com")
+	require.ErrorIs(t, ClassifyError(err), ErrTempfail)
+
+	_, err = NewChainResolver(ChainConfig{}).LookupTXT(ctx, "example.com")
+	require.ErrorIs(t, ClassifyError(err), ErrTempfail)
+}
+
+func TestChainResolverSticky(t *testing.T) {
+	primary := &countingTXT{err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}
+	secondary := &countingTXT{txts: []string{"v=spf1 -all"}}
+	r := NewChainResolver(ChainConfig{}, NewCustomDNSResolver(primary, nil), NewCustomDNSResolver(secondary, nil))
+
+	ctx := StickyContext(context.Background())
+	assert.Equal(t, ctx, StickyContext(ctx))
+	for range 3 {
+		_, err := r.LookupTXT(ctx, "example.com")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), primary.calls.Load())
+	assert.Equal(t, int32(3), secondary.calls.Load())
+
+	// a new evaluation tries the primary again
+	_, err := r.LookupTXT(StickyContext(context.Background()), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), primary.calls.Load())
+}
+
+func TestChainResolverStickyExpires(t *testing.T) {
+	primary := &countingTXT{err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}
+	secondary := &countingTXT{txts: []string{"v=spf1 -all"}}
+	r := NewChainResolver(ChainConfig{StickyFor: 20 * time.Millisecond},
+		NewCustomDNSResolver(primary, nil), NewCustomDNSResolver(secondary, nil))
+
+	ctx := StickyContext(context.Background())
+	_, err := r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	_, err = r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), primary.calls.Load())
+
+	// the primary recovers; once StickyFor elapses the same context uses it
+	primary.err = nil
+	primary.txts = []string{"v=spf1 ~all"}
+	time.Sleep(30 * time.Millisecond)
+	txts, err := r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ~all"}, txts)
+	_, err = r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), primary.calls.Load())
+	assert.Equal(t, int32(2), secondary.calls.Load())
+}
+
+func TestChainResolverStickyPerChain(t *testing.T) {
+	failing := &countingTXT{err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}
+	good := &countingTXT{txts: []string{"v=spf1 -all"}}
+	other := &countingTXT{txts: []string{"v=spf1 ~all"}}
+	a := NewChainResolver(ChainConfig{}, NewCustomDNSResolver(failing, nil), NewCustomDNSResolver(good, nil))
+	b := NewChainResolver(ChainConfig{}, NewCustomDNSResolver(other, nil), NewCustomDNSResolver(good, nil))
+
+	// falling back in one chain does not skip the primary of another
+	ctx := StickyContext(context.Background())
+	_, err := a.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	txts, err := b.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ~all"}, txts)
+}
+
+func TestChainResolverCanceled(t *testing.T) {
+	stalled := &countingTXT{stall: true}
+	good := &countingTXT{txts: []string{"v=spf1 -all"}}
+	r := NewChainResolver(ChainConfig{AttemptTimeout: time.Minute}, NewCustomDNSResolver(stalled, nil), NewCustomDNSResolver(good, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := r.LookupTXT(ctx, "example.com")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, good.calls.Load())
+}
+
+// forgetfulTXT counts the names it is asked to invalidate.
+type forgetfulTXT struct {
+	countingTXT
+	invalidated map[string]int
+}
+
+func (f *forgetfulTXT) Invalidate(name string) {
+	f.invalidated[name]++
+}
+
+func TestResolverInvalidate(t *testing.T) {
+	cache := &forgetfulTXT{invalidated: map[string]int{}}
+	plain := &countingTXT{}
+
+	NewCustomDNSResolver(cache, plain).Invalidate("example.com")
+	assert.Positive(t, cache.invalidated["example.com"])
+
+	// chains forward to their backends
+	cache.invalidated = map[string]int{}
+	chain := NewChainResolver(ChainConfig{}, NewCustomDNSResolver(plain, plain), NewCustomDNSResolver(cache, cache))
+	chain.Invalidate("example.com")
+	assert.Positive(t, cache.invalidated["example.com"])
+	assert.Empty(t, cache.invalidated["other.example"])
+}
@@ -2,12 +2,18 @@
 package dns
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Errors returned during DNS lookups.  They map directly to the
@@ -20,6 +26,12 @@ var (
 	ErrPermfail    = errors.New("permerror: permanent DNS lookup failure")
 )
 
+// ErrTCPFallback is wrapped by backend errors for answers that were
+// truncated over UDP and could not then be fetched over TCP.  Large records
+// commonly hit this; ClassifyError makes it ErrTempfail, since a later retry
+// may succeed, and the text names the reason.
+var ErrTCPFallback = errors.New("tcp-fallback-failed")
+
 // DefaultDialTimeout is the fallback time out if the caller does not pass a deadline/cancellation.
 const DefaultDialTimeout = 5 * time.Second
 
@@ -30,39 +42,100 @@ type TXTResolver interface {
 	LookupTXT(ctx context.Context, domain string) ([]string, error)
 }
 
+// TXTStringsResolver is implemented by TXT resolvers that can return the
+// individual character-strings of each TXT RR instead of one string per RR.
+// When available it is preferred, so the strings can be concatenated as RFC
+// 7208 section 3.3 requires.
+type TXTStringsResolver interface {
+	LookupTXTStrings(ctx context.Context, domain string) ([][]string, error)
+}
+
+// TTLResolver is implemented by TXT resolvers that can report the TTL of
+// their answer.  The strings returned must already be concatenated per RR, as
+// LookupTXT returns them.  The DNS over HTTPS backend of NewDoHResolver and
+// the miekg/dns adapter implement it; the stdlib does not expose TTLs.
+type TTLResolver interface {
+	LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error)
+}
+
+// SPFTypeResolver is implemented by TXT resolvers that can query the SPF
+// RR type 99 of RFC 4408 section 3.1.1, which RFC 7208 section 3.1 retired.
+// It returns one concatenated string per RR, as LookupTXT does.
+type SPFTypeResolver interface {
+	LookupSPF(ctx context.Context, domain string) ([]string, error)
+}
+
 // IPResolver abstract DNS lookups for a and AAAA records.
 type IPResolver interface {
 	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
 }
 
+// NetworkIPResolver is implemented by address resolvers that can query a
+// single family, as net.Resolver.LookupIP does for network "ip4" (A
+// queries only) and "ip6" (AAAA only).  Resolver.LookupA needs it to avoid
+// sending AAAA queries.
+type NetworkIPResolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// MXResolver abstracts DNS lookups for MX records.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// PTRResolver abstracts reverse DNS lookups.  addr is an IP address in
+// textual form, as for net.Resolver.LookupAddr.
+type PTRResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Invalidator is implemented by caching backends that can drop what they
+// hold for a name, see Resolver.Invalidate.
+type Invalidator interface {
+	Invalidate(name string)
+}
+
 // Resolver uses Go's stdlib to implement txt and ip resolver .
 type Resolver struct {
 	txtr TXTResolver
 	ipr  IPResolver
+	mxr  MXResolver
+	ptrr PTRResolver
+
+	sorted bool // see Sorted
 }
 
 // NewDNSResolver returns a DNSResolver that performs DNS lookups using the
 // Go standard library.  Lookups respect context timeouts and cancellations so
-// callers can enforce the limits from RFC 7208 section 11.
-func NewDNSResolver() *Resolver {
+// callers can enforce the limits from RFC 7208 section 11.  Of the options
+// only WithSourceAddr applies.
+func NewDNSResolver(opts ...ResolverOption) *Resolver {
+	cfg := newResolverConfig(opts)
 	nr := &net.Resolver{
 		StrictErrors: true,
 		PreferGo:     true, // force pure-Go DNS implementation
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := &net.Dialer{ //nolint:exhaustruct
-				Timeout: DefaultDialTimeout,
-			}
-
-			return d.DialContext(ctx, network, address)
-		},
+		Dial:         cfg.dial,
 	}
-	//*net.Resolver satisfies BOTH interfaces
-	return &Resolver{txtr: nr, ipr: nr}
+	//*net.Resolver satisfies every interface
+	return &Resolver{txtr: nr, ipr: nr, mxr: nr, ptrr: nr}
+}
+
+// NewSystemResolver returns a Resolver that leaves the choice of DNS
+// implementation to the Go runtime instead of forcing the pure-Go client as
+// NewDNSResolver does.  On cgo-enabled builds this uses the system's libc
+// resolver (and thus nsswitch and local caches) where Go would; build with
+// -tags netcgo or set GODEBUG=netdns=cgo to always use it.  Go sends TXT
+// and MX queries with its own client even then; the adapters/libresolv
+// module sends every query through libresolv.
+func NewSystemResolver() *Resolver {
+	nr := &net.Resolver{StrictErrors: true}
+	return &Resolver{txtr: nr, ipr: nr, mxr: nr, ptrr: nr}
 }
 
 // NewCustomDNSResolver builds a DNSResolver that delegates DNS lookups to the
 // provided implementation.  this can be used for unit tests  or when DNS queries need to
-// be customised.
+// be customised.  MX and PTR lookups go to ip, or else txt, when it
+// implements MXResolver or PTRResolver, and to the stdlib otherwise.
 func NewCustomDNSResolver(txt TXTResolver, ip IPResolver) *Resolver {
 	nr := &net.Resolver{}
 	if txt == nil {
@@ -71,15 +144,99 @@ func NewCustomDNSResolver(txt TXTResolver, ip IPResolver) *Resolver {
 	if ip == nil {
 		ip = nr
 	}
-
-	return &Resolver{txtr: txt, ipr: ip}
+	r := &Resolver{txtr: txt, ipr: ip, mxr: nr, ptrr: nr}
+	for _, impl := range []any{txt, ip} {
+		if mx, ok := impl.(MXResolver); ok {
+			r.mxr = mx
+		}
+		if ptr, ok := impl.(PTRResolver); ok {
+			r.ptrr = ptr
+		}
+	}
+	return r
 }
 
 // LookupTXT forwards the request to the underlying resolver.  The provided
 // context controls timeouts so callers remain compliant with the DNS
 // considerations in RFC 7208 section 11.
 func (d *Resolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
-	return d.txtr.LookupTXT(ctx, domain)
+	return lookupTXT(ctx, d.txtr, domain)
+}
+
+// LookupTXTTTL is LookupTXT that also returns the TTL of the answer when the
+// underlying resolver implements TTLResolver.  The TTL is zero when unknown.
+func (d *Resolver) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	if tr, ok := d.txtr.(TTLResolver); ok {
+		return tr.LookupTXTTTL(ctx, domain)
+	}
+	txts, err := lookupTXT(ctx, d.txtr, domain)
+	return txts, 0, err
+}
+
+// LookupSPF returns the type 99 SPF records of domain when the underlying
+// resolver implements SPFTypeResolver, and errors.ErrUnsupported otherwise;
+// the stdlib cannot query the type.
+func (d *Resolver) LookupSPF(ctx context.Context, domain string) ([]string, error) {
+	if sr, ok := d.txtr.(SPFTypeResolver); ok {
+		return sr.LookupSPF(ctx, domain)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// LookupTXTStrings returns the character-strings of each TXT RR of domain,
+// for checks such as lint.TXTStrings that care how a record was split.  If
+// the underlying resolver does not implement TXTStringsResolver each RR is
+// reported as the single string it returned.
+func (d *Resolver) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	if sr, ok := d.txtr.(TXTStringsResolver); ok {
+		return sr.LookupTXTStrings(ctx, domain)
+	}
+	txts, err := d.txtr.LookupTXT(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	rrs := make([][]string, len(txts))
+	for i, t := range txts {
+		rrs[i] = []string{t}
+	}
+	return rrs, nil
+}
+
+// lookupTXT returns one string per TXT RR.  If r exposes the character-strings
+// of each RR they are concatenated without separators, per RFC 7208 section
+// 3.3, and RRs with identical strings are reported once; the RR order of the
+// answer is otherwise preserved.
+func lookupTXT(ctx context.Context, r TXTResolver, domain string) ([]string, error) {
+	if d, ok := r.(*Resolver); ok {
+		// its LookupTXTStrings would split what its backend joined
+		return d.LookupTXT(ctx, domain)
+	}
+	sr, ok := r.(TXTStringsResolver)
+	if !ok {
+		return r.LookupTXT(ctx, domain)
+	}
+	rrs, err := sr.LookupTXTStrings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return joinTXT(rrs), nil
+}
+
+// joinTXT concatenates the character-strings of each TXT RR and drops RRs
+// whose strings repeat an earlier RR's, as lookupTXT describes.
+func joinTXT(rrs [][]string) []string {
+	txts := make([]string, 0, len(rrs))
+	seen := make(map[string]bool, len(rrs))
+	for _, strs := range rrs {
+		// key on the separated strings so only true duplicates collapse
+		key := strings.Join(strs, "\x00")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		txts = append(txts, strings.Join(strs, ""))
+	}
+	return txts
 }
 
 // LookupIP forwards the IP address lookup to the underlying resolver.The provided
@@ -93,38 +250,281 @@ func (d *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error)
 	for _, a := range addrs {
 		ips = append(ips, a.IP)
 	}
+	if d.sorted {
+		SortIPs(ips)
+	}
 	return ips, nil
 }
 
+// LookupA returns the IPv4 addresses of host from A queries only, when the
+// address backend implements NetworkIPResolver, as net.Resolver and the
+// DNS over HTTPS backend do.  Other backends are asked for both families
+// and the IPv6 answers are dropped, so they may still send AAAA queries.
+func (d *Resolver) LookupA(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	var err error
+	if nr, ok := d.ipr.(NetworkIPResolver); ok {
+		ips, err = nr.LookupIP(ctx, "ip4", host)
+	} else {
+		ips, err = d.LookupIP(ctx, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	v4 := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, ip4)
+		}
+	}
+	if d.sorted {
+		SortIPs(v4)
+	}
+	return v4, nil
+}
+
+// Sorted returns a copy of d whose address and MX answers come back in a
+// deterministic order, see SortIPs and SortMX, instead of the order the
+// backend served them in.  Traces, flattener output and golden tests are
+// then stable across runs and resolvers.  TXT answers keep the served
+// order.
+func (d *Resolver) Sorted() *Resolver {
+	cp := *d
+	cp.sorted = true
+	return &cp
+}
+
+// WithBackends returns a copy of d, keeping its settings such as Sorted,
+// whose queries go to txt and ip as with NewCustomDNSResolver.  It lets a
+// configured Resolver be exercised against other data, as
+// spf.Checker.SelfTest does.
+func (d *Resolver) WithBackends(txt TXTResolver, ip IPResolver) *Resolver {
+	r := NewCustomDNSResolver(txt, ip)
+	r.sorted = d.sorted
+	return r
+}
+
+// SortIPs sorts ips in place: IPv4 addresses first, then IPv6, each in
+// numeric order.
+func SortIPs(ips []net.IP) {
+	slices.SortStableFunc(ips, func(a, b net.IP) int {
+		a4, b4 := a.To4(), b.To4()
+		switch {
+		case a4 != nil && b4 != nil:
+			return bytes.Compare(a4, b4)
+		case a4 != nil:
+			return -1
+		case b4 != nil:
+			return 1
+		}
+		return bytes.Compare(a.To16(), b.To16())
+	})
+}
+
+// SortMX sorts mxs in place by preference, then by host name.
+func SortMX(mxs []*net.MX) {
+	slices.SortStableFunc(mxs, func(a, b *net.MX) int {
+		if c := cmp.Compare(a.Pref, b.Pref); c != 0 {
+			return c
+		}
+		return strings.Compare(strings.ToLower(a.Host), strings.ToLower(b.Host))
+	})
+}
+
+// LookupMX returns the MX records of name, exchanges without the trailing
+// root dot.  Errors are returned unclassified like those of LookupTXT; pass
+// them to ClassifyError.
+func (d *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	mxs, err := d.mxr.LookupMX(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*net.MX, 0, len(mxs))
+	for _, mx := range mxs {
+		out = append(out, &net.MX{Host: strings.TrimSuffix(mx.Host, "."), Pref: mx.Pref})
+	}
+	if d.sorted {
+		SortMX(out)
+	}
+	return out, nil
+}
+
+// LookupPTR returns the names ip reverse-resolves to, without the trailing
+// root dot.  Errors are returned unclassified; pass them to ClassifyError.
+func (d *Resolver) LookupPTR(ctx context.Context, ip net.IP) ([]string, error) {
+	names, err := d.ptrr.LookupAddr(ctx, ip.String())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		out = append(out, strings.TrimSuffix(n, "."))
+	}
+	return out, nil
+}
+
+// Invalidate drops the answers cached for name by every backend that
+// implements Invalidator, so the next lookup reaches DNS again.  Backends
+// without a cache are unaffected; one serving several record types is
+// asked more than once, so Invalidate must be idempotent.
+func (d *Resolver) Invalidate(name string) {
+	for _, b := range []any{d.txtr, d.ipr, d.mxr, d.ptrr} {
+		if inv, ok := b.(Invalidator); ok {
+			inv.Invalidate(name)
+		}
+	}
+}
+
+// Rcoder is implemented by errors from resolver backends that know the DNS
+// response code of the failed query, such as adapters over a wire-level
+// client.  ClassifyError uses it to tell failures apart more precisely than
+// the Go stdlib allows.
+type Rcoder interface {
+	Rcode() int
+}
+
+// DNS response codes (RFC 1035 section 4.1.1) that affect classification.
+const (
+	RcodeServerFailure  = 2
+	RcodeNameError      = 3
+	RcodeNotImplemented = 4
+	RcodeRefused        = 5
+)
+
+// ErrorRcode returns the DNS response code carried by err, if any error in
+// its chain implements Rcoder.
+func ErrorRcode(err error) (int, bool) {
+	var rc Rcoder
+	if errors.As(err, &rc) {
+		return rc.Rcode(), true
+	}
+	return 0, false
+}
+
+// RcodeName returns the mnemonic of a DNS response code, e.g. "REFUSED".
+func RcodeName(rcode int) string {
+	switch rcode {
+	case 0:
+		return "NOERROR"
+	case 1:
+		return "FORMERR"
+	case RcodeServerFailure:
+		return "SERVFAIL"
+	case RcodeNameError:
+		return "NXDOMAIN"
+	case RcodeNotImplemented:
+		return "NOTIMP"
+	case RcodeRefused:
+		return "REFUSED"
+	default:
+		return "RCODE" + strconv.Itoa(rcode)
+	}
+}
+
+// ClassifyError maps a lookup error onto the SPF error model of RFC 7208
+// section 2.6 so every caller treats DNS failures the same way:
+//   - nil → nil
+//   - context cancellation or deadline → returned unchanged; it is not an
+//     SPF condition and the caller decides
+//   - NXDOMAIN → ErrNoDNSrecord
+//   - timeouts and other temporary failures (e.g. SERVFAIL) → ErrTempfail
+//   - a truncated answer whose TCP retry failed (ErrTCPFallback) → ErrTempfail
+//   - anything else → ErrPermfail
+//
+// The original error stays in the chain for the temp and perm cases.  The Go
+// stdlib reports SERVFAIL and REFUSED alike as a temporary "server
+// misbehaving" error.  Backends whose errors implement Rcoder are classified
+// by response code instead: SERVFAIL is temporary, while REFUSED and NOTIMP
+// mean the remote name servers will not answer and become ErrPermfail with
+// the rcode named in the message.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err // propagate – let the caller decide
+	}
+	if errors.Is(err, ErrNoDNSrecord) || errors.Is(err, ErrTempfail) || errors.Is(err, ErrPermfail) {
+		return err // already classified
+	}
+
+	if errors.Is(err, ErrTCPFallback) {
+		return fmt.Errorf("%w: %w", ErrTempfail, err)
+	}
+
+	if rcode, ok := ErrorRcode(err); ok {
+		switch rcode {
+		case RcodeNameError:
+			return ErrNoDNSrecord
+		case RcodeServerFailure:
+			return fmt.Errorf("%w: %w", ErrTempfail, err)
+		case RcodeNotImplemented, RcodeRefused:
+			return fmt.Errorf("%w: %s: %w", ErrPermfail, RcodeName(rcode), err)
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return ErrNoDNSrecord
+		case dnsErr.Temporary():
+			return fmt.Errorf("%w: %w", ErrTempfail, err)
+		}
+	}
+
+	return fmt.Errorf("%w: %w", ErrPermfail, err)
+}
+
 // GetSPFRecord retrieves the TXT records for domain and selects the single
 // valid SPF record.  The behaviour mirrors the DNS processing rules from
 // RFC 7208 section 4.5.
 //   - NXDOMAIN → ("", ErrNoDNSrecord)
 //   - SERVFAIL/timeout → ErrTempfail
 //   - any other error → ErrPermfail
+//   - multi-string TXT RRs are concatenated first (section 3.3)
 //   - then filters for exactly one "v=spf1" record.
 func GetSPFRecord(ctx context.Context, domain string, r TXTResolver) (string, error) {
-	txts, err := r.LookupTXT(ctx, domain)
+	txts, err := lookupTXT(ctx, r, domain)
 	if err != nil {
+		return "", ClassifyError(err)
+	}
 
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return "", err // propagate – let the caller decide
-		}
+	return filterSPF(txts)
+}
 
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			switch {
-			case dnsErr.IsNotFound:
-				return "", ErrNoDNSrecord
-			case dnsErr.Temporary():
-				return "", fmt.Errorf("%w: %w", ErrTempfail, err)
-			}
-		}
+// GetSPFRecords is GetSPFRecord without the single-record rule: it returns
+// every "v=spf1" record published at domain, lower-cased, in answer order.
+// Callers that emulate receivers tolerant of duplicate records use it;
+// RFC 7208 section 4.5 makes more than one record a permerror.
+func GetSPFRecords(ctx context.Context, domain string, r TXTResolver) ([]string, error) {
+	txts, err := lookupTXT(ctx, r, domain)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return SPFRecords(txts), nil
+}
 
-		return "", fmt.Errorf("%w: %w", ErrPermfail, err)
+// SPFRecords returns the "v=spf1" records among txts, trimmed and
+// lower-cased, in order.
+func SPFRecords(txts []string) []string {
+	recs := RawSPFRecords(txts)
+	for i, raw := range recs {
+		recs[i] = strings.ToLower(strings.TrimSpace(raw))
 	}
+	return recs
+}
 
-	return filterSPF(txts)
+// RawSPFRecords is SPFRecords without the normalisation: it returns the
+// "v=spf1" records among txts exactly as served, for audit logs.
+func RawSPFRecords(txts []string) []string {
+	var recs []string
+	for _, raw := range txts {
+		if isSPFv1(strings.TrimSpace(raw)) {
+			recs = append(recs, raw)
+		}
+	}
+	return recs
 }
 
 // filterSPF selects exactly one "v=spf1" string from the provided TXT records.
@@ -133,27 +533,42 @@ func GetSPFRecord(ctx context.Context, domain string, r TXTResolver) (string, er
 //   - 1 record → (that record, nil)
 //   - more than 1 → ("", ErrMultipleSPF)
 func filterSPF(txts []string) (string, error) {
-	const spfV1 = "v=spf1"
-	var found []string
+	var found string
+	count := 0
 
 	for _, raw := range txts {
 		s := strings.TrimSpace(raw)
-		fields := strings.Fields(s)
-		if len(fields) > 0 && strings.EqualFold(fields[0], spfV1) {
-			found = append(found, s)
+		if isSPFv1(s) {
+			found = s
+			count++
 		}
 	}
 
 	// section 4.5: 0 → none; 1 → ok; >1 → permerror
-	switch len(found) {
+	switch count {
 	case 0:
 		return "", nil // allowed
 
 	case 1:
-		foundSpf := strings.ToLower(found[0])
+		foundSpf := strings.ToLower(found)
 		return foundSpf, nil
 
 	default:
 		return "", ErrMultipleSPF
 	}
 }
+
+// isSPFv1 reports whether the trimmed TXT string s starts with the "v=spf1"
+// version tag as a whole term.  It avoids splitting the string, which keeps
+// the common case of many unrelated TXT records allocation free.
+func isSPFv1(s string) bool {
+	const spfV1 = "v=spf1"
+	if len(s) < len(spfV1) || !strings.EqualFold(s[:len(spfV1)], spfV1) {
+		return false
+	}
+	if len(s) == len(spfV1) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s[len(spfV1):])
+	return unicode.IsSpace(r)
+}
@@ -3,6 +3,7 @@ package dns
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -21,6 +22,19 @@ func (f *fakeResolver) LookupTXT(ctx context.Context, domain string) ([]string,
 	return f.txts, f.err
 }
 
+// fakeStringsResolver implements TXTStringsResolver for unit tests.
+type fakeStringsResolver struct {
+	rrs [][]string
+}
+
+func (f *fakeStringsResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	panic("LookupTXTStrings must be preferred")
+}
+
+func (f *fakeStringsResolver) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	return f.rrs, nil
+}
+
 func TestGetSPFRecord_ErrorsAndFiltering(t *testing.T) {
 	tc := []struct {
 		name         string
@@ -112,3 +126,365 @@ func TestFilterSPF(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSPFRecord_MultiStringTXT(t *testing.T) {
+	tc := []struct {
+		name    string
+		rrs     [][]string
+		wantSPF string
+		wantErr error
+	}{
+		{
+			name:    "split record concatenated without separator",
+			rrs:     [][]string{{"v=spf1 ip4:192.0.2.0/24 ", "include:_spf.example.net -all"}},
+			wantSPF: "v=spf1 ip4:192.0.2.0/24 include:_spf.example.net -all",
+		},
+		{
+			name:    "version tag alone in first string",
+			rrs:     [][]string{{"some other txt"}, {"v=spf1", " a", " -all"}},
+			wantSPF: "v=spf1 a -all",
+		},
+		{
+			name:    "mixed-case version tag alone in first string",
+			rrs:     [][]string{{"V=SPF1", " ip4:192.0.2.0/24", " -all"}},
+			wantSPF: "v=spf1 ip4:192.0.2.0/24 -all",
+		},
+		{
+			name:    "version tag glued to the next string is not spf",
+			rrs:     [][]string{{"v=spf1", "ip4:192.0.2.0/24 -all"}},
+			wantSPF: "",
+		},
+		{
+			name:    "duplicate RRs reported once",
+			rrs:     [][]string{{"v=spf1 ", "a -all"}, {"v=spf1 ", "a -all"}},
+			wantSPF: "v=spf1 a -all",
+		},
+		{
+			name:    "two distinct records still multiple",
+			rrs:     [][]string{{"v=spf1 ", "a -all"}, {"v=spf1 mx -all"}},
+			wantErr: ErrMultipleSPF,
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			dr := NewCustomDNSResolver(&fakeStringsResolver{rrs: c.rrs}, nil)
+			spf, err := GetSPFRecord(context.Background(), "example.com", dr)
+			if c.wantErr != nil {
+				require.ErrorIs(t, err, c.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.wantSPF, spf)
+		})
+	}
+}
+
+// benchTXTs resembles a busy apex with verification tokens next to the SPF record.
+var benchTXTs = []string{
+	"google-site-verification=4ibFUgB-wXLQ_S7vsXVomSTVamuOXBiVAzpR5IZ87D0",
+	"MS=ms12345678",
+	"v=spf1 ip4:192.0.2.0/24 ip4:198.51.100.0/24 include:_spf.google.com include:spf.protection.outlook.com ~all",
+	"apple-domain-verification=abcdefghijklmnop",
+	"docusign=1b0a6754-49b1-4db5-8540-d2c12664b289",
+}
+
+func BenchmarkFilterSPF(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := filterSPF(benchTXTs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetSPFRecordParallel(b *testing.B) {
+	dr := NewCustomDNSResolver(&fakeResolver{txts: benchTXTs}, nil)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := GetSPFRecord(ctx, "example.com", dr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// rcodeError is a backend error that exposes its DNS response code.
+type rcodeError int
+
+func (e rcodeError) Error() string { return "dns rcode " + RcodeName(int(e)) }
+func (e rcodeError) Rcode() int    { return int(e) }
+
+func TestClassifyError(t *testing.T) {
+	tc := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"canceled", context.Canceled, context.Canceled},
+		{"deadline", fmt.Errorf("lookup: %w", context.DeadlineExceeded), context.DeadlineExceeded},
+		{"nxdomain", &net.DNSError{Err: "no such host", IsNotFound: true}, ErrNoDNSrecord},
+		{"timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, ErrTempfail},
+		{"servfail", &net.DNSError{Err: "server misbehaving", IsTemporary: true}, ErrTempfail},
+		{"other", errors.New("boom"), ErrPermfail},
+		{"already classified", ErrTempfail, ErrTempfail},
+		{"rcode servfail", rcodeError(RcodeServerFailure), ErrTempfail},
+		{"rcode nxdomain", rcodeError(RcodeNameError), ErrNoDNSrecord},
+		{"rcode refused", fmt.Errorf("query: %w", rcodeError(RcodeRefused)), ErrPermfail},
+		{"rcode notimp", rcodeError(RcodeNotImplemented), ErrPermfail},
+		{"tcp fallback", fmt.Errorf("lookup: %w: connection refused", ErrTCPFallback), ErrTempfail},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := ClassifyError(c.err)
+			if c.want == nil {
+				require.NoError(t, got)
+				return
+			}
+			require.ErrorIs(t, got, c.want)
+		})
+	}
+}
+
+func TestErrorRcode(t *testing.T) {
+	rc, ok := ErrorRcode(fmt.Errorf("wrapped: %w", rcodeError(RcodeRefused)))
+	require.True(t, ok)
+	assert.Equal(t, RcodeRefused, rc)
+	assert.Equal(t, "REFUSED", RcodeName(rc))
+
+	_, ok = ErrorRcode(errors.New("plain"))
+	assert.False(t, ok)
+
+	err := ClassifyError(rcodeError(RcodeRefused))
+	assert.Contains(t, err.Error(), "REFUSED")
+}
+
+func TestNewSystemResolver(t *testing.T) {
+	r := NewSystemResolver()
+	nr, ok := r.txtr.(*net.Resolver)
+	require.True(t, ok)
+	assert.False(t, nr.PreferGo)
+	assert.True(t, nr.StrictErrors)
+	assert.Same(t, nr, r.ipr)
+	assert.Same(t, nr, r.mxr)
+	assert.Same(t, nr, r.ptrr)
+}
+
+func TestGetSPFRecords(t *testing.T) {
+	dr := NewCustomDNSResolver(&fakeResolver{txts: []string{"v=spf1 A -all", "other", " v=spf1 mx -all "}}, nil)
+	recs, err := GetSPFRecords(context.Background(), "example.com", dr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 a -all", "v=spf1 mx -all"}, recs)
+
+	dr = NewCustomDNSResolver(&fakeResolver{err: &net.DNSError{Err: "no such host", IsNotFound: true}}, nil)
+	_, err = GetSPFRecords(context.Background(), "example.com", dr)
+	require.ErrorIs(t, err, ErrNoDNSrecord)
+}
+
+// fakeTTLResolver implements TTLResolver for unit tests.
+type fakeTTLResolver struct{ fakeResolver }
+
+func (f *fakeTTLResolver) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	return f.txts, 300 * time.Second, f.err
+}
+
+func TestResolver_LookupTXTStrings(t *testing.T) {
+	rrs := [][]string{{"v=spf1", " -all"}, {"other"}}
+	got, err := NewCustomDNSResolver(&fakeStringsResolver{rrs: rrs}, nil).LookupTXTStrings(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, rrs, got)
+
+	got, err = NewCustomDNSResolver(&fakeResolver{txts: []string{"v=spf1 -all"}}, nil).LookupTXTStrings(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"v=spf1 -all"}}, got)
+}
+
+func TestResolver_LookupTXTTTL(t *testing.T) {
+	dr := NewCustomDNSResolver(&fakeTTLResolver{fakeResolver{txts: []string{"v=spf1 -all"}}}, nil)
+	txts, ttl, err := dr.LookupTXTTTL(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+	assert.Equal(t, 300*time.Second, ttl)
+
+	dr = NewCustomDNSResolver(&fakeStringsResolver{rrs: [][]string{{"v=spf1 ", "-all"}}}, nil)
+	txts, ttl, err = dr.LookupTXTTTL(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+	assert.Zero(t, ttl)
+}
+
+// fakeSPFTypeResolver implements SPFTypeResolver for unit tests.
+type fakeSPFTypeResolver struct{ fakeResolver }
+
+func (f *fakeSPFTypeResolver) LookupSPF(ctx context.Context, domain string) ([]string, error) {
+	return []string{"v=spf1 +all"}, nil
+}
+
+func TestResolver_LookupSPF(t *testing.T) {
+	dr := NewCustomDNSResolver(&fakeSPFTypeResolver{}, nil)
+	recs, err := dr.LookupSPF(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 +all"}, recs)
+
+	chained := NewChainResolver(ChainConfig{}, NewCustomDNSResolver(&fakeResolver{}, nil), dr)
+	recs, err = chained.LookupSPF(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 +all"}, recs)
+
+	_, err = NewCustomDNSResolver(&fakeResolver{}, nil).LookupSPF(context.Background(), "example.com")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+func TestRawSPFRecords(t *testing.T) {
+	txts := []string{" V=spf1 A -all", "other", "v=spf10 -all", "v=spf1"}
+	assert.Equal(t, []string{" V=spf1 A -all", "v=spf1"}, RawSPFRecords(txts))
+	assert.Equal(t, []string{"v=spf1 a -all", "v=spf1"}, SPFRecords(txts))
+}
+
+// fakeHostResolver implements IPResolver, MXResolver and PTRResolver for
+// unit tests.
+type fakeHostResolver struct {
+	mx  []*net.MX
+	ptr []string
+	err error
+}
+
+func (f *fakeHostResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, f.err
+}
+
+func (f *fakeHostResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return f.mx, f.err
+}
+
+func (f *fakeHostResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return f.ptr, f.err
+}
+
+func TestResolver_LookupMXAndPTR(t *testing.T) {
+	fake := &fakeHostResolver{
+		mx:  []*net.MX{{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com", Pref: 20}},
+		ptr: []string{"mail.example.com."},
+	}
+	dr := NewCustomDNSResolver(&fakeResolver{}, fake)
+	mxs, err := dr.LookupMX(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mx1.example.com", Pref: 10}, {Host: "mx2.example.com", Pref: 20}}, mxs)
+	names, err := dr.LookupPTR(context.Background(), net.ParseIP("192.0.2.1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mail.example.com"}, names)
+
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nxdomain", &net.DNSError{Err: "no such host", IsNotFound: true}, ErrNoDNSrecord},
+		{"timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, ErrTempfail},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dr := NewCustomDNSResolver(nil, &fakeHostResolver{err: tc.err})
+			_, err := dr.LookupMX(context.Background(), "example.com")
+			require.ErrorIs(t, ClassifyError(err), tc.want)
+			_, err = dr.LookupPTR(context.Background(), net.ParseIP("192.0.2.1"))
+			require.ErrorIs(t, ClassifyError(err), tc.want)
+		})
+	}
+}
+
+func TestSortIPs(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("2001:db8::2"),
+		net.ParseIP("198.51.100.1"),
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("192.0.2.10"),
+		net.ParseIP("192.0.2.9").To4(),
+	}
+	SortIPs(ips)
+	var got []string
+	for _, ip := range ips {
+		got = append(got, ip.String())
+	}
+	assert.Equal(t, []string{"192.0.2.9", "192.0.2.10", "198.51.100.1", "2001:db8::1", "2001:db8::2"}, got)
+}
+
+func TestSortMX(t *testing.T) {
+	mxs := []*net.MX{{Host: "b.example", Pref: 10}, {Host: "c.example", Pref: 5}, {Host: "A.example", Pref: 10}}
+	SortMX(mxs)
+	assert.Equal(t, []*net.MX{{Host: "c.example", Pref: 5}, {Host: "A.example", Pref: 10}, {Host: "b.example", Pref: 10}}, mxs)
+}
+
+// fakeAddrResolver serves a fixed address answer.
+type fakeAddrResolver []string
+
+func (f fakeAddrResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var out []net.IPAddr
+	for _, ip := range f {
+		out = append(out, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return out, nil
+}
+
+func TestResolver_Sorted(t *testing.T) {
+	dr := NewCustomDNSResolver(nil, fakeAddrResolver{"2001:db8::1", "192.0.2.2", "192.0.2.1"})
+	ips, err := dr.LookupIP(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ips[0].String(), "served order is kept by default")
+
+	ips, err = dr.Sorted().LookupIP(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", ips[0].String())
+	assert.Equal(t, "2001:db8::1", ips[2].String())
+	assert.False(t, dr.sorted, "Sorted must not modify the receiver")
+}
+
+func TestResolver_WithBackends(t *testing.T) {
+	dr := NewCustomDNSResolver(nil, fakeAddrResolver{"2001:db8::1"}).Sorted()
+	wr := dr.WithBackends(nil, fakeAddrResolver{"2001:db8::2", "192.0.2.1"})
+	ips, err := wr.LookupIP(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1", "2001:db8::2"}, []string{ips[0].String(), ips[1].String()}, "sorted, from the new backend")
+
+	ips, err = dr.LookupIP(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ips[0].String(), "the receiver keeps its backend")
+}
+
+// fakeNetworkResolver is a fakeAddrResolver that also answers per family
+// and records the networks asked for.
+type fakeNetworkResolver struct {
+	fakeAddrResolver
+	networks []string
+}
+
+func (f *fakeNetworkResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	f.networks = append(f.networks, network)
+	var out []net.IP
+	for _, a := range f.fakeAddrResolver {
+		ip := net.ParseIP(a)
+		if network == "ip" || (network == "ip4") == (ip.To4() != nil) {
+			out = append(out, ip)
+		}
+	}
+	return out, nil
+}
+
+func TestResolver_LookupA(t *testing.T) {
+	addrs := fakeAddrResolver{"2001:db8::1", "192.0.2.2", "192.0.2.1"}
+
+	// without NetworkIPResolver both families are fetched and IPv6 dropped
+	ips, err := NewCustomDNSResolver(nil, addrs).LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("192.0.2.2").To4(), net.ParseIP("192.0.2.1").To4()}, ips)
+
+	nr := &fakeNetworkResolver{fakeAddrResolver: addrs}
+	ips, err = NewCustomDNSResolver(nil, nr).Sorted().LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ip4"}, nr.networks)
+	assert.Equal(t, []net.IP{net.ParseIP("192.0.2.1").To4(), net.ParseIP("192.0.2.2").To4()}, ips)
+}
@@ -0,0 +1,277 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxDoHResponse bounds the DNS over HTTPS response body read, the largest
+// possible DNS message.
+const maxDoHResponse = 65535
+
+// NewDoHResolver returns a Resolver that sends every query to the DNS over
+// HTTPS endpoint url (RFC 8484), e.g. "https://dns.example/dns-query".
+// Failed queries return errors implementing Rcoder, so ClassifyError can
+// tell SERVFAIL from REFUSED, and the TXT character-strings are kept apart
+// as RFC 7208 section 3.3 wants.  Use WithHeader or WithUserAgent to
+// identify the querying system to the endpoint's operator.
+func NewDoHResolver(url string, opts ...ResolverOption) *Resolver {
+	cfg := newResolverConfig(opts)
+	client := cfg.client
+	if client == nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.DialContext = cfg.dial
+		client = &http.Client{Transport: tr}
+	}
+	d := &doh{url: url, client: client, header: cfg.header}
+	return &Resolver{txtr: d, ipr: d, mxr: d, ptrr: d}
+}
+
+// doh is the DNS over HTTPS backend of NewDoHResolver.
+type doh struct {
+	url    string
+	client *http.Client
+	header http.Header
+}
+
+// dohRcodeError reports an answer with a response code other than NOERROR.
+type dohRcodeError struct {
+	name  string
+	code  int
+	qtype dnsmessage.Type
+}
+
+func (e *dohRcodeError) Error() string {
+	return fmt.Sprintf("lookup %s %s: %s", e.name, strings.TrimPrefix(e.qtype.String(), "Type"), RcodeName(e.code))
+}
+
+// Rcode returns the DNS response code.
+func (e *dohRcodeError) Rcode() int { return e.code }
+
+// exchange sends one query and returns the answer section.  A NOERROR
+// answer without records is returned without error.
+func (d *doh) exchange(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+	// RFC 8484 section 4.1: the ID should be 0 so responses cache well
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	body, err := q.Pack()
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range d.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &net.DNSError{Err: err.Error(), Name: name, IsTemporary: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &net.DNSError{Err: "DoH status " + strconv.Itoa(resp.StatusCode), Name: name, IsTemporary: true}
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponse))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, IsTemporary: true}
+	}
+
+	var m dnsmessage.Message
+	if err := m.Unpack(raw); err != nil {
+		return nil, &net.DNSError{Err: "malformed DoH response: " + err.Error(), Name: name, IsTemporary: true}
+	}
+	ReportQuery(ctx, QueryInfo{Rcode: int(m.RCode), Answers: len(m.Answers), Server: req.URL.Host, Latency: time.Since(start)})
+	if m.RCode != dnsmessage.RCodeSuccess {
+		return nil, &dohRcodeError{name: name, code: int(m.RCode), qtype: qtype}
+	}
+	return m.Answers, nil
+}
+
+// LookupTXTStrings returns the character-strings of each TXT RR of domain.
+func (d *doh) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	rrs, _, err := d.lookupTXT(ctx, domain)
+	return rrs, err
+}
+
+// LookupTXTTTL returns one concatenated string per TXT RR of domain and the
+// lowest TTL in the answer, zero for an empty answer.  It implements
+// TTLResolver.
+func (d *doh) LookupTXTTTL(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	rrs, ttl, err := d.lookupTXT(ctx, domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	return joinTXT(rrs), ttl, nil
+}
+
+// lookupTXT returns the character-strings of each TXT RR of domain and the
+// lowest TTL of the answer section, CNAMEs included.
+func (d *doh) lookupTXT(ctx context.Context, domain string) ([][]string, time.Duration, error) {
+	answer, err := d.exchange(ctx, domain, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, 0, err
+	}
+	var out [][]string
+	var ttl time.Duration
+	for i, rr := range answer {
+		if rrTTL := time.Duration(rr.Header.TTL) * time.Second; i == 0 || rrTTL < ttl {
+			ttl = rrTTL
+		}
+		if txt, ok := rr.Body.(*dnsmessage.TXTResource); ok {
+			out = append(out, txt.TXT)
+		}
+	}
+	return out, ttl, nil
+}
+
+// LookupTXT returns one concatenated string per TXT RR of domain.
+func (d *doh) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	rrs, err := d.LookupTXTStrings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(rrs))
+	for _, strs := range rrs {
+		out = append(out, strings.Join(strs, ""))
+	}
+	return out, nil
+}
+
+// LookupIPAddr returns the A and AAAA records of host.  If only one family
+// fails, the other family's answer is still returned.
+func (d *doh) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return d.lookupAddrs(ctx, host, dnsmessage.TypeA, dnsmessage.TypeAAAA)
+}
+
+// LookupIP returns the addresses of host for network "ip4" (A queries
+// only), "ip6" (AAAA only) or "ip" (both), as net.Resolver.LookupIP does.
+func (d *doh) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	qtypes := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	switch network {
+	case "ip4":
+		qtypes = qtypes[:1]
+	case "ip6":
+		qtypes = qtypes[1:]
+	case "ip":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	addrs, err := d.lookupAddrs(ctx, host, qtypes...)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+	return ips, nil
+}
+
+// lookupAddrs queries host for each of qtypes, A or AAAA.  A failure is
+// only returned when no query produced an address.
+func (d *doh) lookupAddrs(ctx context.Context, host string, qtypes ...dnsmessage.Type) ([]net.IPAddr, error) {
+	var out []net.IPAddr
+	var firstErr error
+	for _, qtype := range qtypes {
+		answer, err := d.exchange(ctx, host, qtype)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, rr := range answer {
+			switch v := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				out = append(out, net.IPAddr{IP: net.IP(v.A[:])})
+			case *dnsmessage.AAAAResource:
+				out = append(out, net.IPAddr{IP: net.IP(v.AAAA[:])})
+			}
+		}
+	}
+	if len(out) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// LookupMX returns the MX records of name.
+func (d *doh) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	answer, err := d.exchange(ctx, name, dnsmessage.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.MX
+	for _, rr := range answer {
+		if mx, ok := rr.Body.(*dnsmessage.MXResource); ok {
+			out = append(out, &net.MX{Host: mx.MX.String(), Pref: mx.Pref})
+		}
+	}
+	return out, nil
+}
+
+// LookupAddr returns the PTR names of addr, an IP address in textual form.
+func (d *doh) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+	}
+	answer, err := d.exchange(ctx, reverseAddr(ip), dnsmessage.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rr := range answer {
+		if ptr, ok := rr.Body.(*dnsmessage.PTRResource); ok {
+			out = append(out, ptr.PTR.String())
+		}
+	}
+	return out, nil
+}
+
+// reverseAddr returns the in-addr.arpa or ip6.arpa name of ip.
+func reverseAddr(ip net.IP) string {
+	var b strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := 3; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(ip4[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+	const hex = "0123456789abcdef"
+	ip16 := ip.To16()
+	for i := 15; i >= 0; i-- {
+		b.WriteByte(hex[ip16[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip16[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
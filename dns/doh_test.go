@@ -0,0 +1,170 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohZone serves a small zone over DNS over HTTPS and records the
+// User-Agent of the last request.
+func dohZone(t *testing.T, ua *string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ua = r.Header.Get("User-Agent")
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var q dnsmessage.Message
+		if err := q.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		question := q.Questions[0]
+		resp := dnsmessage.Message{Header: dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeSuccess}, Questions: q.Questions}
+		hdr := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		mail := dnsmessage.MustNewName("mail.example.com.")
+		switch question.Name.String() + " " + question.Type.String() {
+		case "example.com. TypeTXT":
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.TXTResource{TXT: []string{"v=spf1 ip4:192.0.2.0/24 ", "-all"}}})
+		case "example.com. TypeA":
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}})
+		case "example.com. TypeMX":
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.MXResource{Pref: 10, MX: mail}})
+		case "1.2.0.192.in-addr.arpa. TypePTR":
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.PTRResource{PTR: mail}})
+		case "example.com. TypeAAAA":
+		case "refused.example. TypeTXT":
+			resp.RCode = dnsmessage.RCodeRefused
+		case "broken.example. TypeTXT":
+			http.Error(w, "upstream down", http.StatusBadGateway)
+			return
+		default:
+			resp.RCode = dnsmessage.RCodeNameError
+		}
+		out, err := resp.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDoHResolver(t *testing.T) {
+	var ua string
+	srv := dohZone(t, &ua)
+	r := NewDoHResolver(srv.URL, WithUserAgent("mta.example spf/1"), WithSourceAddr(net.ParseIP("127.0.0.1")))
+	ctx := context.Background()
+
+	txt, err := r.LookupTXT(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all"}, txt)
+	assert.Equal(t, "mta.example spf/1", ua)
+
+	txt, ttl, err := r.LookupTXTTTL(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v=spf1 ip4:192.0.2.0/24 -all"}, txt)
+	assert.Equal(t, time.Minute, ttl)
+
+	ips, err := r.LookupIP(ctx, "example.com")
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+	assert.Equal(t, "192.0.2.1", ips[0].String())
+
+	mxs, err := r.LookupMX(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mail.example.com", Pref: 10}}, mxs)
+
+	names, err := r.LookupPTR(ctx, net.ParseIP("192.0.2.1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mail.example.com"}, names)
+}
+
+func TestDoHResolverErrors(t *testing.T) {
+	var ua string
+	srv := dohZone(t, &ua)
+	r := NewDoHResolver(srv.URL)
+	ctx := context.Background()
+
+	_, err := r.LookupTXT(ctx, "missing.example")
+	assert.ErrorIs(t, ClassifyError(err), ErrNoDNSrecord)
+	_, err = r.LookupTXT(ctx, "refused.example")
+	rcode, ok := ErrorRcode(err)
+	require.True(t, ok)
+	assert.Equal(t, RcodeRefused, rcode)
+	assert.ErrorIs(t, ClassifyError(err), ErrPermfail)
+	_, err = r.LookupTXT(ctx, "broken.example")
+	assert.ErrorIs(t, ClassifyError(err), ErrTempfail)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = r.LookupTXT(canceled, "example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDoHReportsQueries(t *testing.T) {
+	var ua string
+	srv := dohZone(t, &ua)
+	r := NewDoHResolver(srv.URL)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	ctx, report := ObserveQuery(context.Background())
+	_, err := r.LookupIP(ctx, "example.com")
+	require.NoError(t, err)
+	info, ok := report()
+	require.True(t, ok)
+	assert.Equal(t, 2, info.Exchanges, "A and AAAA")
+	assert.Equal(t, 1, info.Answers)
+	assert.Equal(t, 0, info.Rcode)
+	assert.Equal(t, host, info.Server)
+	assert.Positive(t, info.Latency)
+
+	ctx, report = ObserveQuery(context.Background())
+	ips, err := r.LookupA(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Len(t, ips, 1)
+	info, _ = report()
+	assert.Equal(t, 1, info.Exchanges, "A only")
+
+	ctx, report = ObserveQuery(context.Background())
+	_, err = r.LookupTXT(ctx, "refused.example")
+	require.Error(t, err)
+	info, ok = report()
+	require.True(t, ok)
+	assert.Equal(t, RcodeRefused, info.Rcode)
+	assert.Zero(t, info.Answers)
+
+	// a backend that does not report leaves the observer empty
+	ctx, report = ObserveQuery(context.Background())
+	_, _ = NewCustomDNSResolver(&fakeResolver{}, nil).LookupTXT(ctx, "example.com")
+	_, ok = report()
+	assert.False(t, ok)
+}
+
+func TestReverseAddr(t *testing.T) {
+	assert.Equal(t, "1.2.0.192.in-addr.arpa.", reverseAddr(net.ParseIP("192.0.2.1")))
+	assert.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", reverseAddr(net.ParseIP("2001:db8::1")))
+}
+
+func TestWithSourceAddr(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	cfg := newResolverConfig([]ResolverOption{WithSourceAddr(net.ParseIP("127.0.0.1"))})
+	conn, err := cfg.dial(context.Background(), "udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).IP.String())
+}
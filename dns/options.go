@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// ResolverOption configures NewDNSResolver and NewDoHResolver.
+type ResolverOption func(*resolverConfig)
+
+type resolverConfig struct {
+	source net.IP
+	header http.Header
+	client *http.Client
+}
+
+func newResolverConfig(opts []ResolverOption) *resolverConfig {
+	cfg := &resolverConfig{header: http.Header{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithSourceAddr binds outgoing queries to ip, so multi-homed MTAs send
+// SPF queries from the address DNS operators expect.  It applies to UDP
+// and TCP queries of NewDNSResolver and to the connections of
+// NewDoHResolver unless WithHTTPClient is used.
+func WithSourceAddr(ip net.IP) ResolverOption {
+	return func(cfg *resolverConfig) {
+		cfg.source = ip
+	}
+}
+
+// WithHeader adds an HTTP header to every DNS over HTTPS request, for
+// example to identify the querying system to the resolver operator.
+// Plain DNS has nowhere to carry it and ignores it.
+func WithHeader(key, value string) ResolverOption {
+	return func(cfg *resolverConfig) {
+		cfg.header.Add(key, value)
+	}
+}
+
+// WithUserAgent sets the User-Agent of DNS over HTTPS requests.
+func WithUserAgent(ua string) ResolverOption {
+	return func(cfg *resolverConfig) {
+		cfg.header.Set("User-Agent", ua)
+	}
+}
+
+// WithHTTPClient makes NewDoHResolver send its requests with c.  The
+// client's transport then controls connections, including the source
+// address.
+func WithHTTPClient(c *http.Client) ResolverOption {
+	return func(cfg *resolverConfig) {
+		cfg.client = c
+	}
+}
+
+// dial connects to a name server or DoH endpoint, from the configured
+// source address if any.
+func (cfg *resolverConfig) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	d := net.Dialer{Timeout: DefaultDialTimeout} //nolint:exhaustruct
+	if cfg.source != nil {
+		switch network {
+		case "udp", "udp4", "udp6":
+			d.LocalAddr = &net.UDPAddr{IP: cfg.source}
+		default:
+			d.LocalAddr = &net.TCPAddr{IP: cfg.source}
+		}
+	}
+	return d.DialContext(ctx, network, address)
+}
@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QueryInfo describes the wire exchanges behind one lookup, as reported by
+// backends that see the DNS response.  An address lookup is usually two
+// exchanges, A and AAAA; their answers and latencies are added up.
+type QueryInfo struct {
+	Rcode     int           // first response code other than NOERROR, else NOERROR
+	Answers   int           // records in the answer sections
+	Server    string        // server that answered the last exchange
+	Latency   time.Duration // time spent waiting for responses
+	Exchanges int           // wire exchanges, retries included
+}
+
+// queryKey carries the *queryRecorder installed by ObserveQuery.
+type queryKey struct{}
+
+// queryRecorder accumulates the reports of one observed lookup.
+type queryRecorder struct {
+	mu   sync.Mutex
+	info QueryInfo
+}
+
+// ObserveQuery returns a context for one lookup and a function reporting
+// what the backend saw of it.  The function's bool is false when the
+// backend reported nothing, e.g. the Go stdlib resolver, which does not
+// expose the wire response.
+func ObserveQuery(ctx context.Context) (context.Context, func() (QueryInfo, bool)) {
+	rec := new(queryRecorder)
+	return context.WithValue(ctx, queryKey{}, rec), func() (QueryInfo, bool) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		return rec.info, rec.info.Exchanges > 0
+	}
+}
+
+// ReportQuery records one wire exchange made on behalf of the lookup
+// observed through ctx.  Backends call it once per response or failed
+// exchange; it does nothing when the lookup is not observed.
+func ReportQuery(ctx context.Context, info QueryInfo) {
+	rec, ok := ctx.Value(queryKey{}).(*queryRecorder)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.info.Rcode == 0 {
+		rec.info.Rcode = info.Rcode
+	}
+	rec.info.Answers += info.Answers
+	if info.Server != "" {
+		rec.info.Server = info.Server
+	}
+	rec.info.Latency += info.Latency
+	rec.info.Exchanges += max(info.Exchanges, 1)
+}
@@ -0,0 +1,95 @@
+package spf
+
+import (
+	"context"
+	"time"
+)
+
+// EventKind identifies an evaluation Event.
+type EventKind string
+
+const (
+	EventMechanismStart EventKind = "mechanism-start" // a term is about to be evaluated
+	EventMechanismEnd   EventKind = "mechanism-end"   // a term has been evaluated
+	EventQuery          EventKind = "query"           // a DNS query completed
+	EventResult         EventKind = "result"          // the evaluation finished
+)
+
+// Event is one step of an evaluation, delivered while it runs.
+type Event struct {
+	Kind      EventKind
+	Domain    string // domain whose record is being evaluated
+	Mechanism string // term in canonical form, for mechanism events
+
+	// Query and QueryType name the DNS query of an EventQuery, e.g.
+	// "_spf.example.com" and "TXT"; address lookups are "A/AAAA" or "A".
+	Query     string
+	QueryType string
+	// Rcode, Answers, Server and Latency describe the response of an
+	// EventQuery.  Rcode is empty when no response arrived; Server is
+	// empty unless the backend reports it, see dns.ObserveQuery.
+	Rcode   string
+	Answers int
+	Server  string
+	Latency time.Duration
+
+	// Result is set on EventMechanismEnd when the term ended the
+	// evaluation, and on EventResult.
+	Result Result
+	// Err is the failure of a query, or the error that stopped the
+	// evaluation.
+	Err error
+
+	// Outcome is the complete result, on EventResult only.
+	Outcome *CheckHostResult
+}
+
+// eventsKey carries the per-call event callback in the context.
+type eventsKey struct{}
+
+// CheckWithEvents is Check that calls fn with each Event as evaluation
+// progresses, ending with an EventResult.  fn runs on the evaluating
+// goroutine and should return quickly.  A nil fn makes it Check.
+func (c *Checker) CheckWithEvents(ctx context.Context, req Request, fn func(Event)) (CheckHostResult, error) {
+	if fn == nil {
+		return c.Check(ctx, req)
+	}
+	res, err := c.Check(context.WithValue(ctx, eventsKey{}, fn), req)
+	fn(Event{Kind: EventResult, Domain: res.TerminatedAt, Result: res.Code, Err: err, Outcome: &res})
+	return res, err
+}
+
+// CheckHostStream runs Check in a new goroutine and delivers its events on
+// the returned channel, which is closed after the final EventResult.  Live
+// views can render each step as it happens.  If ctx ends while the consumer
+// is not reading, remaining events are dropped and evaluation aborts.
+func (c *Checker) CheckHostStream(ctx context.Context, req Request) <-chan Event {
+	ch := make(chan Event, 16)
+	go func() {
+		defer close(ch)
+		_, _ = c.CheckWithEvents(ctx, req, func(e Event) {
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return ch
+}
+
+// eventsFrom returns the event callback installed by CheckWithEvents.
+func eventsFrom(ctx context.Context) func(Event) {
+	fn, _ := ctx.Value(eventsKey{}).(func(Event))
+	return fn
+}
+
+// emit delivers e to the evaluation's event callback, if any.
+func (ev *evaluation) emit(e Event) {
+	if ev.events == nil {
+		return
+	}
+	if e.Domain == "" {
+		e.Domain = ev.vars.Domain
+	}
+	ev.events(e)
+}
@@ -0,0 +1,157 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func eventsResolver() *dns.Resolver {
+	txts := fakeTXTMap{
+		"example.com":      {"v=spf1 a include:_spf.example.com -all"},
+		"_spf.example.com": {"v=spf1 ip4:192.0.2.1 -all"},
+	}
+	return dns.NewCustomDNSResolver(txts, fakeIPResolver{"example.com": {"198.51.100.1"}})
+}
+
+func TestChecker_CheckWithEvents(t *testing.T) {
+	ch := NewChecker(eventsResolver())
+	var got []string
+	var last Event
+	res, err := ch.CheckWithEvents(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}, func(e Event) {
+		s := string(e.Kind) + " " + e.Domain
+		switch e.Kind {
+		case EventMechanismStart, EventMechanismEnd:
+			s += " " + e.Mechanism
+		case EventQuery:
+			s += " " + e.QueryType + " " + e.Query
+		}
+		if e.Result != "" {
+			s += " " + string(e.Result)
+		}
+		got = append(got, s)
+		last = e
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+	assert.Equal(t, []string{
+		"query example.com TXT example.com",
+		"mechanism-start example.com a",
+		"query example.com A/AAAA example.com",
+		"mechanism-end example.com a",
+		"mechanism-start example.com include:_spf.example.com",
+		"query example.com TXT _spf.example.com",
+		"mechanism-start _spf.example.com ip4:192.0.2.1/32",
+		"mechanism-end _spf.example.com ip4:192.0.2.1/32 pass",
+		"mechanism-end example.com include:_spf.example.com pass",
+		"result example.com pass",
+	}, got)
+	require.NotNil(t, last.Outcome)
+	assert.Equal(t, res, *last.Outcome)
+}
+
+func TestChecker_CheckWithEventsNil(t *testing.T) {
+	ch := NewChecker(eventsResolver())
+	res, err := ch.CheckWithEvents(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+}
+
+func TestChecker_CheckHostStream(t *testing.T) {
+	ch := NewChecker(eventsResolver())
+	var kinds []EventKind
+	var final Event
+	for e := range ch.CheckHostStream(context.Background(), Request{IP: net.ParseIP("203.0.113.9"), MailFrom: "user@example.com"}) {
+		kinds = append(kinds, e.Kind)
+		final = e
+	}
+	require.NotEmpty(t, kinds)
+	assert.Equal(t, EventResult, final.Kind)
+	assert.Equal(t, Fail, final.Result)
+	assert.Equal(t, 1, countKind(kinds, EventResult))
+	assert.Equal(t, countKind(kinds, EventMechanismStart), countKind(kinds, EventMechanismEnd))
+}
+
+func TestChecker_CheckHostStreamCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch := NewChecker(eventsResolver())
+	// Nobody reads; the stream must still finish and close.
+	stream := ch.CheckHostStream(ctx, Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"})
+	for range stream {
+	}
+}
+
+func countKind(kinds []EventKind, k EventKind) int {
+	n := 0
+	for _, got := range kinds {
+		if got == k {
+			n++
+		}
+	}
+	return n
+}
+
+// reportingTXT answers like fakeTXTMap and reports each query the way a
+// wire-level backend would.
+type reportingTXT fakeTXTMap
+
+func (r reportingTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	txts, err := fakeTXTMap(r).LookupTXT(ctx, domain)
+	dns.ReportQuery(ctx, dns.QueryInfo{Answers: len(txts), Server: "192.0.2.53:53", Latency: time.Millisecond})
+	return txts, err
+}
+
+func TestWithQueryTrace(t *testing.T) {
+	txts := reportingTXT{"example.com": {"v=spf1 a -all"}}
+	r := dns.NewCustomDNSResolver(txts, fakeIPResolver{"example.com": {"198.51.100.1"}})
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+
+	res, err := NewChecker(r).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Empty(t, res.Trace, "queries are only traced on request")
+
+	res, err = NewChecker(r, WithQueryTrace()).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Fail, res.Code)
+	require.Len(t, res.Trace, 2)
+
+	txt := res.Trace[0]
+	assert.Equal(t, "TXT", txt.QueryType)
+	assert.Equal(t, "example.com", txt.Query)
+	assert.Equal(t, "NOERROR", txt.Rcode)
+	assert.Equal(t, 1, txt.Answers)
+	assert.Equal(t, "192.0.2.53:53", txt.Server)
+	assert.Contains(t, txt.Note, "via 192.0.2.53:53")
+
+	// the stdlib-style IP backend reports nothing: answers are counted
+	// from the results and the server is unknown
+	ip := res.Trace[1]
+	assert.Equal(t, "a", ip.Mechanism)
+	assert.Equal(t, "A/AAAA", ip.QueryType)
+	assert.Equal(t, "NOERROR", ip.Rcode)
+	assert.Equal(t, 1, ip.Answers)
+	assert.Empty(t, ip.Server)
+}
+
+func TestEventQueryInfo(t *testing.T) {
+	txts := reportingTXT{"example.com": {"v=spf1 a:missing.example.com -all"}}
+	r := dns.NewCustomDNSResolver(txts, fakeIPResolver{})
+	var queries []Event
+	_, err := NewChecker(r).CheckWithEvents(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}, func(e Event) {
+		if e.Kind == EventQuery {
+			queries = append(queries, e)
+		}
+	})
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	assert.Equal(t, "192.0.2.53:53", queries[0].Server)
+	assert.Equal(t, 1, queries[0].Answers)
+	assert.Equal(t, "NXDOMAIN", queries[1].Rcode)
+	assert.Zero(t, queries[1].Answers)
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+)
+
+// DMARCScope is the SPFDomainScope of a DMARC aggregate report (RFC 7489
+// appendix C): the identity the SPF result is for.
+type DMARCScope string
+
+const (
+	ScopeHELO  DMARCScope = "helo"
+	ScopeMFrom DMARCScope = "mfrom"
+)
+
+// DMARCResult is the SPFResultType of a DMARC aggregate report.  Its values
+// are the RFC 7208 result names, as spf.Result uses them.
+type DMARCResult string
+
+const (
+	DMARCNone      DMARCResult = "none"
+	DMARCNeutral   DMARCResult = "neutral"
+	DMARCPass      DMARCResult = "pass"
+	DMARCFail      DMARCResult = "fail"
+	DMARCSoftFail  DMARCResult = "softfail"
+	DMARCTempError DMARCResult = "temperror"
+	DMARCPermError DMARCResult = "permerror"
+)
+
+// SPFAuthResult is the <spf> element of a record's auth_results in a DMARC
+// aggregate report, the SPFAuthResultType of RFC 7489 appendix C.  It
+// marshals with encoding/xml as the report schema expects.
+type SPFAuthResult struct {
+	XMLName xml.Name    `xml:"spf"`
+	Domain  string      `xml:"domain"`
+	Scope   DMARCScope  `xml:"scope,omitempty"`
+	Result  DMARCResult `xml:"result"`
+}
+
+// DMARCAuthResult converts the result of checking req to its report form.
+// The domain is the one evaluated, req.StartDomain() in lower case.  The
+// scope follows req.Identity, except that a check of a null reverse-path
+// evaluates the HELO domain and is reported as helo (RFC 7489 section
+// 4.1).  A zero result is reported as none.
+func DMARCAuthResult(req spf.Request, res spf.CheckHostResult) SPFAuthResult {
+	scope := ScopeMFrom
+	if req.Identity == spf.IdentityHELO || req.MailFrom == "" || req.MailFrom == "<>" {
+		scope = ScopeHELO
+	}
+	return SPFAuthResult{
+		Domain: strings.ToLower(strings.TrimSuffix(req.StartDomain(), ".")),
+		Scope:  scope,
+		Result: dmarcResult(res.Code),
+	}
+}
+
+// DMARCAuthResults converts the outcome of spf.CheckMailFromAndHELO for
+// req: the MAIL FROM result when it was checked, then the HELO result.
+func DMARCAuthResults(req spf.Request, res spf.IdentityResults) []SPFAuthResult {
+	req.Domain = ""
+	var out []SPFAuthResult
+	if res.MailFromChecked {
+		req.Identity = spf.IdentityMailFrom
+		out = append(out, DMARCAuthResult(req, res.MailFrom))
+	}
+	req.Identity = spf.IdentityHELO
+	return append(out, DMARCAuthResult(req, res.HELO))
+}
+
+// dmarcResult maps an spf.Result to the report enumeration.
+func dmarcResult(code spf.Result) DMARCResult {
+	switch code {
+	case spf.Neutral, spf.Pass, spf.Fail, spf.SoftFail, spf.TempError, spf.PermError:
+		return DMARCResult(code)
+	default:
+		return DMARCNone
+	}
+}
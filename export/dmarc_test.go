@@ -0,0 +1,55 @@
+package export
+
+import (
+	"encoding/xml"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf"
+)
+
+func TestDMARCAuthResult(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	cases := []struct {
+		name string
+		req  spf.Request
+		code spf.Result
+		want SPFAuthResult
+	}{
+		{"mail from", spf.Request{IP: ip, MailFrom: "user@Example.COM"}, spf.Pass,
+			SPFAuthResult{Domain: "example.com", Scope: ScopeMFrom, Result: DMARCPass}},
+		{"helo", spf.Request{IP: ip, HELODomain: "mx.example.net", Identity: spf.IdentityHELO}, spf.SoftFail,
+			SPFAuthResult{Domain: "mx.example.net", Scope: ScopeHELO, Result: DMARCSoftFail}},
+		{"null reverse-path", spf.Request{IP: ip, MailFrom: "<>", HELODomain: "mx.example.net"}, spf.Fail,
+			SPFAuthResult{Domain: "mx.example.net", Scope: ScopeHELO, Result: DMARCFail}},
+		{"zero result", spf.Request{IP: ip, MailFrom: "user@example.com"}, "",
+			SPFAuthResult{Domain: "example.com", Scope: ScopeMFrom, Result: DMARCNone}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, DMARCAuthResult(tc.req, spf.CheckHostResult{Code: tc.code}))
+		})
+	}
+}
+
+func TestDMARCAuthResults(t *testing.T) {
+	req := spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com", HELODomain: "mx.example.net"}
+	got := DMARCAuthResults(req, spf.IdentityResults{
+		HELO:            spf.CheckHostResult{Code: spf.None},
+		MailFrom:        spf.CheckHostResult{Code: spf.Pass},
+		MailFromChecked: true,
+	})
+	assert.Equal(t, []SPFAuthResult{
+		{Domain: "example.com", Scope: ScopeMFrom, Result: DMARCPass},
+		{Domain: "mx.example.net", Scope: ScopeHELO, Result: DMARCNone},
+	}, got)
+
+	got = DMARCAuthResults(req, spf.IdentityResults{HELO: spf.CheckHostResult{Code: spf.Pass}})
+	assert.Equal(t, []SPFAuthResult{{Domain: "mx.example.net", Scope: ScopeHELO, Result: DMARCPass}}, got)
+
+	out, err := xml.Marshal(got[0])
+	require.NoError(t, err)
+	assert.Equal(t, "<spf><domain>mx.example.net</domain><scope>helo</scope><result>pass</result></spf>", string(out))
+}
@@ -0,0 +1,97 @@
+// Package export flattens SPF audit results into rows for columnar analysis
+// tools such as pandas or BigQuery.  Each Row is one audited domain with
+// scalar columns only, so any columnar format can take it as is.  WriteCSV
+// writes CSV; Apache Parquet is written by the separate module
+// github.com/t0gun/go-spf/export/parquet, so the core library does not
+// depend on a Parquet implementation.  WriteOctoDNS and WriteTerraform
+// hand flattened records to infrastructure-as-code pipelines, and
+// DMARCAuthResult gives check results the shape of DMARC aggregate reports.
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+	"github.com/t0gun/go-spf/lint"
+)
+
+// Row is the audit of one domain's record tree.
+type Row struct {
+	Domain            string
+	Record            string // root record text, empty when none was found
+	Lookups           int    // worst-case lookups, see spf.RecordGraph.TotalCost
+	MaxIncludeDepth   int
+	Domains           int
+	ThirdPartyDomains int
+	CIDRs             int
+	Findings          string // lint rule identifiers in report order, joined with ";"
+	Error             string // why the root record could not be fetched or used
+}
+
+// Columns are the CSV header names, in column order.
+var Columns = []string{
+	"domain", "record", "lookups", "max_include_depth", "domains",
+	"third_party_domains", "cidrs", "findings", "error",
+}
+
+// FromGraph audits g, as returned by spf.Checker.WalkRecord, linting the
+// root record and the tree with cfg.  See spf.RecordGraph.Audit.  Error is
+// set from the root node's error, whether fetching or parsing failed.
+func FromGraph(g *spf.RecordGraph, cfg lint.Config) Row {
+	a := g.Audit(cfg)
+	row := Row{Domain: a.Domain, Record: a.Record}
+	if root := g.Nodes[g.Root]; root != nil && root.Err != nil {
+		row.Error = root.Err.Error()
+		return row
+	}
+	if !a.Found {
+		return row
+	}
+	row.Lookups = a.Lookups
+	row.MaxIncludeDepth = a.Metrics.MaxIncludeDepth
+	row.Domains = a.Metrics.Domains
+	row.ThirdPartyDomains = a.Metrics.ThirdPartyDomains
+	row.CIDRs = a.Metrics.CIDRs
+	rules := make([]string, len(a.Findings))
+	for i, f := range a.Findings {
+		rules[i] = f.Rule
+	}
+	row.Findings = strings.Join(rules, ";")
+	return row
+}
+
+// FromError returns the row of a domain whose walk failed, for the error
+// spf.Checker.WalkRecord returned instead of a graph, e.g. NXDOMAIN or a
+// timeout of the root lookup.
+func FromError(domain string, err error) Row {
+	return Row{Domain: domain, Error: err.Error()}
+}
+
+// WriteCSV writes Columns and then rows as RFC 4180 CSV.
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(Columns); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		rec := []string{
+			r.Domain,
+			r.Record,
+			strconv.Itoa(r.Lookups),
+			strconv.Itoa(r.MaxIncludeDepth),
+			strconv.Itoa(r.Domains),
+			strconv.Itoa(r.ThirdPartyDomains),
+			strconv.Itoa(r.CIDRs),
+			r.Findings,
+			r.Error,
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
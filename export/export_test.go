@@ -0,0 +1,77 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf"
+	"github.com/t0gun/go-spf/lint"
+)
+
+type fakeTXT map[string]string
+
+func (f fakeTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	if r, ok := f[domain]; ok {
+		return []string{r}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+}
+
+func TestFromGraphAndWriteCSV(t *testing.T) {
+	txt := fakeTXT{
+		"example.com":      "v=spf1 include:_spf.example.net ptr -all",
+		"_spf.example.net": "v=spf1 ip4:192.0.2.0/24 -all",
+		"open.example":     "v=spf1 ptr +all",
+	}
+	ch := spf.NewChecker(spf.NewCustomResolver(txt, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	row := FromGraph(g, lint.Config{})
+	assert.Equal(t, Row{
+		Domain:            "example.com",
+		Record:            "v=spf1 include:_spf.example.net ptr -all",
+		Lookups:           2,
+		MaxIncludeDepth:   1,
+		Domains:           2,
+		ThirdPartyDomains: 1,
+		CIDRs:             1,
+		Findings:          lint.RulePTR,
+	}, row)
+
+	g, err = ch.WalkRecord(context.Background(), "open.example")
+	require.NoError(t, err)
+	assert.Equal(t, lint.RulePTR+";"+lint.RulePassAll, FromGraph(g, lint.Config{}).Findings)
+
+	var b strings.Builder
+	require.NoError(t, WriteCSV(&b, []Row{row, {Domain: "broken.example", Error: "no SPF record"}}))
+	assert.Equal(t, "domain,record,lookups,max_include_depth,domains,third_party_domains,cidrs,findings,error\n"+
+		"example.com,v=spf1 include:_spf.example.net ptr -all,2,1,2,1,1,ptr,\n"+
+		"broken.example,,0,0,0,0,0,,no SPF record\n", b.String())
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestWriteCSVError(t *testing.T) {
+	require.Error(t, WriteCSV(failWriter{}, []Row{{Domain: "example.com"}}))
+}
+
+func TestFromGraphFetchError(t *testing.T) {
+	g := &spf.RecordGraph{Root: "example.com", Nodes: map[string]*spf.RecordNode{
+		"example.com": {Domain: "example.com", Err: errors.New("temperror: temporary DNS lookup failure")},
+	}}
+	assert.Equal(t, Row{Domain: "example.com", Error: "temperror: temporary DNS lookup failure"}, FromGraph(g, lint.Config{}))
+
+	ch := spf.NewChecker(spf.NewCustomResolver(fakeTXT{}, nil))
+	_, err := ch.WalkRecord(context.Background(), "missing.example")
+	require.Error(t, err)
+	row := FromError("missing.example", err)
+	assert.Equal(t, "missing.example", row.Domain)
+	assert.NotEmpty(t, row.Error)
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+)
+
+// ErrResidual is returned by FlattenedTXT when the flattened tree still has
+// terms that cannot be expressed as networks.
+var ErrResidual = errors.New("flattened record has residual terms")
+
+// TXT is one SPF record to publish through an infrastructure-as-code tool.
+type TXT struct {
+	Zone  string // zone the record lives in, e.g. example.com
+	Name  string // owner name relative to Zone, empty for the apex
+	TTL   int    // seconds, the tool's default when zero
+	Value string // record text, e.g. "v=spf1 ip4:192.0.2.0/24 -all"
+}
+
+// FlattenedTXT builds the record publishing f, as returned by
+// spf.RecordGraph.Flatten, at name in zone: "v=spf1", the networks in
+// order, then the all term (e.g. "-all").  It fails with ErrResidual when f
+// has residual terms, since dropping them would change the result.
+func FlattenedTXT(zone, name string, f spf.Flattened, all string) (TXT, error) {
+	if len(f.Residual) > 0 {
+		return TXT{}, fmt.Errorf("%w: %s", ErrResidual, strings.Join(f.Residual, ", "))
+	}
+	terms := append([]string{"v=spf1"}, f.Networks...)
+	if all != "" {
+		terms = append(terms, all)
+	}
+	return TXT{Zone: zone, Name: name, Value: strings.Join(terms, " ")}, nil
+}
+
+// WriteOctoDNS writes recs as an OctoDNS zone YAML file.  Every record must
+// belong to the same zone; records sharing a name become one TXT record with
+// several values.  Semicolons are escaped as OctoDNS requires.
+func WriteOctoDNS(w io.Writer, recs []TXT) error {
+	byName := map[string][]TXT{}
+	for _, r := range recs {
+		if r.Zone != recs[0].Zone {
+			return fmt.Errorf("octodns: records for zones %s and %s in one file", recs[0].Zone, r.Zone)
+		}
+		byName[r.Name] = append(byName[r.Name], r)
+	}
+	names := make([]string, 0, len(byName))
+	for n := range byName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, n := range names {
+		rs := byName[n]
+		fmt.Fprintf(&b, "%s:\n  type: TXT\n", yamlQuote(n))
+		if rs[0].TTL > 0 {
+			fmt.Fprintf(&b, "  ttl: %d\n", rs[0].TTL)
+		}
+		if len(rs) == 1 {
+			fmt.Fprintf(&b, "  value: %s\n", yamlQuote(octoEscape(rs[0].Value)))
+			continue
+		}
+		b.WriteString("  values:\n")
+		for _, r := range rs {
+			fmt.Fprintf(&b, "  - %s\n", yamlQuote(octoEscape(r.Value)))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTerraform writes recs as dns_txt_record_set resources of the
+// hashicorp/dns provider, one per owner name: records sharing a zone and
+// name become one resource with several values, taking the TTL of the
+// first.  Resource names that would still collide get a numeric suffix.
+// Macro text such as %{i} is escaped so Terraform does not treat it as a
+// template directive.
+func WriteTerraform(w io.Writer, recs []TXT) error {
+	type owner struct{ zone, name string }
+	var owners []owner
+	byOwner := map[owner][]TXT{}
+	for _, r := range recs {
+		o := owner{strings.TrimSuffix(r.Zone, ".") + ".", r.Name}
+		if _, ok := byOwner[o]; !ok {
+			owners = append(owners, o)
+		}
+		byOwner[o] = append(byOwner[o], r)
+	}
+
+	var b strings.Builder
+	used := map[string]bool{}
+	for i, o := range owners {
+		rs := byOwner[o]
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		name := resourceName(rs[0])
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", resourceName(rs[0]), n)
+		}
+		used[name] = true
+		values := make([]string, len(rs))
+		for j, r := range rs {
+			values[j] = hclString(r.Value)
+		}
+		fmt.Fprintf(&b, "resource \"dns_txt_record_set\" %s {\n", hclString(name))
+		fmt.Fprintf(&b, "  zone = %s\n", hclString(o.zone))
+		if o.name != "" {
+			fmt.Fprintf(&b, "  name = %s\n", hclString(o.name))
+		}
+		fmt.Fprintf(&b, "  txt  = [%s]\n", strings.Join(values, ", "))
+		if rs[0].TTL > 0 {
+			fmt.Fprintf(&b, "  ttl  = %d\n", rs[0].TTL)
+		}
+		b.WriteString("}\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// yamlQuote returns s as a single-quoted YAML scalar.
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// octoEscape escapes the semicolons OctoDNS reserves in TXT values.
+func octoEscape(s string) string {
+	return strings.ReplaceAll(s, ";", `\;`)
+}
+
+// hclString returns s as an HCL quoted string with template sequences
+// escaped.
+func hclString(s string) string {
+	q := strconv.Quote(s)
+	q = strings.ReplaceAll(q, "${", "$${")
+	return strings.ReplaceAll(q, "%{", "%%{")
+}
+
+// resourceName derives a Terraform resource name such as
+// "spf_mail_example_com" from the owner name of r.
+func resourceName(r TXT) string {
+	owner := strings.TrimSuffix(r.Zone, ".")
+	if r.Name != "" {
+		owner = r.Name + "." + owner
+	}
+	var b strings.Builder
+	b.WriteString("spf_")
+	for _, c := range strings.ToLower(owner) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf"
+)
+
+func TestFlattenedTXT(t *testing.T) {
+	f := spf.Flattened{Networks: []string{"ip4:192.0.2.0/24", "ip6:2001:db8::/32"}}
+	rec, err := FlattenedTXT("example.com", "", f, "-all")
+	require.NoError(t, err)
+	assert.Equal(t, TXT{Zone: "example.com", Value: "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 -all"}, rec)
+
+	f.Residual = []string{"example.com: mx"}
+	_, err = FlattenedTXT("example.com", "", f, "-all")
+	require.ErrorIs(t, err, ErrResidual)
+}
+
+func TestWriteOctoDNS(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteOctoDNS(&b, []TXT{
+		{Zone: "example.com", Name: "mail", Value: "v=spf1 a -all"},
+		{Zone: "example.com", TTL: 300, Value: "v=spf1 ip4:192.0.2.0/24 -all"},
+		{Zone: "example.com", Value: "owner's token; x"},
+	}))
+	assert.Equal(t, "---\n"+
+		"'':\n  type: TXT\n  ttl: 300\n  values:\n  - 'v=spf1 ip4:192.0.2.0/24 -all'\n  - 'owner''s token\\; x'\n"+
+		"'mail':\n  type: TXT\n  value: 'v=spf1 a -all'\n", b.String())
+
+	err := WriteOctoDNS(&b, []TXT{{Zone: "example.com"}, {Zone: "example.net"}})
+	require.Error(t, err)
+}
+
+func TestWriteTerraform(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteTerraform(&b, []TXT{
+		{Zone: "example.com", TTL: 300, Value: "v=spf1 ip4:192.0.2.0/24 -all"},
+		{Zone: "example.com.", Name: "_spf", Value: "v=spf1 exists:%{i}._ip.example.com -all"},
+	}))
+	assert.Equal(t, `resource "dns_txt_record_set" "spf_example_com" {
+  zone = "example.com."
+  txt  = ["v=spf1 ip4:192.0.2.0/24 -all"]
+  ttl  = 300
+}
+
+resource "dns_txt_record_set" "spf__spf_example_com" {
+  zone = "example.com."
+  name = "_spf"
+  txt  = ["v=spf1 exists:%%{i}._ip.example.com -all"]
+}
+`, b.String())
+}
+
+func TestWriteTerraformSharedOwner(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteTerraform(&b, []TXT{
+		{Zone: "example.com", TTL: 300, Value: "v=spf1 include:_spf.example.com -all"},
+		{Zone: "example.com", Name: "a_b", Value: "v=spf1 -all"},
+		{Zone: "example.com.", Value: "google-site-verification=abc"},
+		{Zone: "example.com", Name: "a.b", Value: "v=spf1 a -all"},
+	}))
+	assert.Equal(t, `resource "dns_txt_record_set" "spf_example_com" {
+  zone = "example.com."
+  txt  = ["v=spf1 include:_spf.example.com -all", "google-site-verification=abc"]
+  ttl  = 300
+}
+
+resource "dns_txt_record_set" "spf_a_b_example_com" {
+  zone = "example.com."
+  name = "a_b"
+  txt  = ["v=spf1 -all"]
+}
+
+resource "dns_txt_record_set" "spf_a_b_example_com_2" {
+  zone = "example.com."
+  name = "a.b"
+  txt  = ["v=spf1 a -all"]
+}
+`, b.String())
+}
@@ -0,0 +1,31 @@
+module github.com/t0gun/go-spf/export/parquet
+
+go 1.25.0
+
+require (
+	github.com/parquet-go/parquet-go v0.32.0
+	github.com/stretchr/testify v1.10.0
+	github.com/t0gun/go-spf v1.0.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/parquet-go/bitpack v1.0.0 // indirect
+	github.com/parquet-go/jsonlite v1.0.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/twpayne/go-geom v1.6.1 // indirect
+	golang.org/x/net v0.55.0 // indirect
+	golang.org/x/sys v0.45.0 // indirect
+	golang.org/x/text v0.37.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// Build against the checkout during development.  Replace directives only
+// apply to the main module, so consumers get the version required above.
+replace github.com/t0gun/go-spf => ../..
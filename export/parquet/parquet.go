@@ -0,0 +1,50 @@
+// Package parquet writes export.Row values as Apache Parquet, for loading
+// SPF audits into pandas, BigQuery or Spark.  It is a separate module so the
+// core library does not depend on a Parquet implementation.
+//
+// The columns have the names and order of export.Columns; the integer
+// columns are INT64 and the others UTF-8 strings.
+package parquet
+
+import (
+	"io"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/t0gun/go-spf/export"
+)
+
+// row is the Parquet schema of export.Row.
+type row struct {
+	Domain            string `parquet:"domain"`
+	Record            string `parquet:"record"`
+	Lookups           int64  `parquet:"lookups"`
+	MaxIncludeDepth   int64  `parquet:"max_include_depth"`
+	Domains           int64  `parquet:"domains"`
+	ThirdPartyDomains int64  `parquet:"third_party_domains"`
+	CIDRs             int64  `parquet:"cidrs"`
+	Findings          string `parquet:"findings"`
+	Error             string `parquet:"error"`
+}
+
+// Write writes rows to w as one Parquet file.
+func Write(w io.Writer, rows []export.Row) error {
+	pw := pq.NewGenericWriter[row](w)
+	out := make([]row, len(rows))
+	for i, r := range rows {
+		out[i] = row{
+			Domain:            r.Domain,
+			Record:            r.Record,
+			Lookups:           int64(r.Lookups),
+			MaxIncludeDepth:   int64(r.MaxIncludeDepth),
+			Domains:           int64(r.Domains),
+			ThirdPartyDomains: int64(r.ThirdPartyDomains),
+			CIDRs:             int64(r.CIDRs),
+			Findings:          r.Findings,
+			Error:             r.Error,
+		}
+	}
+	if _, err := pw.Write(out); err != nil {
+		return err
+	}
+	return pw.Close()
+}
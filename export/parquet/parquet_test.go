@@ -0,0 +1,53 @@
+package parquet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/export"
+)
+
+func TestWrite(t *testing.T) {
+	rows := []export.Row{
+		{
+			Domain:            "example.com",
+			Record:            "v=spf1 include:_spf.example.net ptr -all",
+			Lookups:           2,
+			MaxIncludeDepth:   1,
+			Domains:           2,
+			ThirdPartyDomains: 1,
+			CIDRs:             1,
+			Findings:          "ptr",
+		},
+		{Domain: "broken.example", Error: "no SPF record"},
+	}
+	var b bytes.Buffer
+	require.NoError(t, Write(&b, rows))
+
+	f, err := pq.OpenFile(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, field := range f.Schema().Fields() {
+		names = append(names, field.Name())
+	}
+	assert.Equal(t, export.Columns, names)
+
+	got, err := pq.Read[row](bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, row{Domain: "example.com", Record: rows[0].Record, Lookups: 2, MaxIncludeDepth: 1,
+		Domains: 2, ThirdPartyDomains: 1, CIDRs: 1, Findings: "ptr"}, got[0])
+	assert.Equal(t, row{Domain: "broken.example", Error: "no SPF record"}, got[1])
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestWriteError(t *testing.T) {
+	require.Error(t, Write(failWriter{}, []export.Row{{Domain: "example.com"}}))
+}
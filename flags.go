@@ -0,0 +1,70 @@
+package spf
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Flags tweak a single check, so an MTA deciding policy per recipient or
+// per sending domain does not need a Checker for every combination.  They
+// travel in the context, see WithFlags.  The zero value changes nothing.
+type Flags struct {
+	// Disable lists mechanism kinds disabled for this check in addition to
+	// those of WithDisabledMechanisms, handled as WithDisabledAction says.
+	Disable []string
+	// Timeout replaces the WithTimeout bound for this check, e.g. to give
+	// a slow but important domain more time.  The context's own deadline
+	// still applies.
+	Timeout time.Duration
+	// MaxLookups replaces Checker.MaxLookups for this check when positive.
+	MaxLookups int
+	// QueryTrace records every DNS query in the trace, as WithQueryTrace.
+	QueryTrace bool
+}
+
+// flagsKey carries the Flags installed by WithFlags.
+type flagsKey struct{}
+
+// WithFlags returns a context whose checks use f.  Flags do not combine: a
+// second WithFlags replaces the first.
+func WithFlags(ctx context.Context, f Flags) context.Context {
+	return context.WithValue(ctx, flagsKey{}, f)
+}
+
+// FlagsFrom returns the Flags installed in ctx, if any.
+func FlagsFrom(ctx context.Context) (Flags, bool) {
+	f, ok := ctx.Value(flagsKey{}).(Flags)
+	return f, ok
+}
+
+// applyFlags adjusts ev for the Flags in ctx.
+func (ev *evaluation) applyFlags(ctx context.Context) {
+	f, ok := FlagsFrom(ctx)
+	if !ok {
+		return
+	}
+	for _, kind := range f.Disable {
+		if ev.disabled == nil {
+			ev.disabled = map[string]bool{}
+		}
+		ev.disabled[strings.ToLower(kind)] = true
+	}
+	if f.MaxLookups > 0 {
+		ev.maxLookups = f.MaxLookups
+	}
+	ev.queries = ev.queries || f.QueryTrace
+}
+
+// withTimeout bounds ctx by the Flags timeout or, without one, by the
+// WithTimeout default.
+func (c *Checker) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := c.timeout
+	if f, ok := FlagsFrom(ctx); ok && f.Timeout > 0 {
+		d = f.Timeout
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,125 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestWithFlags(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com": {"v=spf1 a:a1.example a:a2.example a:a3.example ip4:192.0.2.1 -all"},
+	}
+	ips := fakeIPResolver{"a1.example": {"198.51.100.1"}, "a2.example": {"198.51.100.2"}, "a3.example": {"198.51.100.3"}}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, ips))
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+	check := func(ctx context.Context) CheckHostResult {
+		t.Helper()
+		res, err := ch.Check(ctx, req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := check(context.Background())
+	assert.Equal(t, Pass, res.Code)
+	assert.Equal(t, 3, res.Lookups)
+
+	res = check(WithFlags(context.Background(), Flags{Disable: []string{"A"}}))
+	assert.Equal(t, Pass, res.Code)
+	assert.Equal(t, 0, res.Lookups)
+	assert.Contains(t, res.Trace[0].Note, "mechanism disabled by policy")
+
+	res = check(WithFlags(context.Background(), Flags{MaxLookups: 2}))
+	assert.Equal(t, PermError, res.Code)
+
+	res = check(WithFlags(context.Background(), Flags{QueryTrace: true}))
+	var queries int
+	for _, e := range res.Trace {
+		if e.Query != "" {
+			queries++
+		}
+	}
+	assert.Equal(t, 4, queries)
+
+	// flags belong to the check, the Checker is unchanged
+	assert.Equal(t, 3, check(context.Background()).Lookups)
+
+	f, ok := FlagsFrom(WithFlags(context.Background(), Flags{MaxLookups: 5}))
+	assert.True(t, ok)
+	assert.Equal(t, 5, f.MaxLookups)
+	_, ok = FlagsFrom(context.Background())
+	assert.False(t, ok)
+}
+
+func TestWithFlagsQueryTraceSkipsDecisionCache(t *testing.T) {
+	txts := &countingTXT{fakeTXTMap: fakeTXTMap{
+		"example.com":      {"v=spf1 include:_spf.example.com -all"},
+		"_spf.example.com": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}, ttl: time.Hour}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithDecisionCache(DecisionCacheConfig{}))
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+
+	res, err := ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, Pass, res.Code)
+	res, err = ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, res.Cached)
+
+	res, err = ch.Check(WithFlags(context.Background(), Flags{QueryTrace: true}), req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+	assert.False(t, res.Cached)
+	var queries int
+	for _, e := range res.Trace {
+		if e.Query != "" {
+			queries++
+		}
+	}
+	assert.Equal(t, 2, queries)
+}
+
+// stallingTXT answers nothing until the context ends.
+type stallingTXT struct{}
+
+func (stallingTXT) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestWithTimeoutAndFlags(t *testing.T) {
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+	ch := NewChecker(dns.NewCustomDNSResolver(stallingTXT{}, fakeIPResolver{}), WithTimeout(10*time.Millisecond))
+
+	start := time.Now()
+	_, err := ch.Check(context.Background(), req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	start = time.Now()
+	_, err = ch.Check(WithFlags(context.Background(), Flags{Timeout: 50 * time.Millisecond}), req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWithFlagsBypassesDecisionCache(t *testing.T) {
+	txts := fakeTXTMap{"example.com": {"v=spf1 ip4:192.0.2.0/24 -all"}}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithDecisionCache(DecisionCacheConfig{}))
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+
+	_, err := ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	res, err := ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, res.Cached)
+
+	res, err = ch.Check(WithFlags(context.Background(), Flags{Disable: []string{"ip4"}}), req)
+	require.NoError(t, err)
+	assert.False(t, res.Cached)
+	assert.Equal(t, Fail, res.Code)
+}
@@ -0,0 +1,227 @@
+// Package generate builds SPF records from a mail server inventory: the
+// outbound networks an organization runs itself, the sending services it
+// uses and whether its MX hosts send mail.  The result stays within the
+// RFC 7208 lookup limit and a record length budget, moving networks into
+// _spfN subdomain records included from the apex when one record is too
+// long.  Split applies the same layout to the output of a flattener or any
+// other record builder, and Verify checks the composed tree against the
+// lookup limit.  Records are returned as export.TXT, ready for
+// WriteOctoDNS or WriteTerraform.
+package generate
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+	"github.com/t0gun/go-spf/export"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Errors returned by Generate.
+var (
+	ErrUnknownProvider = errors.New("unknown provider")
+	ErrBadNetwork      = errors.New("invalid network")
+	ErrOverBudget      = errors.New("inventory does not fit the budget")
+	ErrInvalid         = errors.New("generated record is invalid")
+)
+
+// Provider is a sending service in the known-provider map.
+type Provider struct {
+	Include string // domain to include
+	// Lookups is what including the provider costs toward the section
+	// 4.6.4 limit, the include term and the provider's own tree, as
+	// published when the map was last reviewed.  Providers change their
+	// records; check the generated tree against live DNS with
+	// spf.Checker.WalkRecord before relying on the estimate.
+	Lookups int
+}
+
+// Providers maps provider names accepted in Inventory.Providers to their
+// SPF records.
+var Providers = map[string]Provider{
+	"amazonses":    {Include: "amazonses.com", Lookups: 1},
+	"fastmail":     {Include: "spf.messagingengine.com", Lookups: 1},
+	"google":       {Include: "_spf.google.com", Lookups: 4},
+	"mailchimp":    {Include: "servers.mcsv.net", Lookups: 1},
+	"mailgun":      {Include: "mailgun.org", Lookups: 3},
+	"microsoft365": {Include: "spf.protection.outlook.com", Lookups: 2},
+	"postmark":     {Include: "spf.mtasv.net", Lookups: 1},
+	"protonmail":   {Include: "_spf.protonmail.ch", Lookups: 1},
+	"salesforce":   {Include: "_spf.salesforce.com", Lookups: 1},
+	"sendgrid":     {Include: "sendgrid.net", Lookups: 1},
+}
+
+// Inventory describes the hosts allowed to send mail for Domain.
+type Inventory struct {
+	Domain    string
+	Networks  []string // outbound addresses or CIDR networks, IPv4 or IPv6
+	Providers []string // names from Providers
+	MX        bool     // the domain's MX hosts send mail too
+	All       string   // closing term, "-all" when empty
+}
+
+// DefaultRecordBytes is the record length budget when Budget leaves it
+// zero: with the question and header the answer still fits the 512-byte
+// UDP response RFC 7208 section 3.4 recommends.
+const DefaultRecordBytes = 450
+
+// Budget bounds the generated records.
+type Budget struct {
+	MaxLookups     int // spf.MaxDNSLookups when zero
+	MaxRecordBytes int // length of each record, DefaultRecordBytes when zero
+}
+
+// Result is the output of Generate.
+type Result struct {
+	// Records are the records to publish: the one at Domain first, then
+	// the _spfN records it includes, if any.
+	Records []export.TXT
+	// Lookups is the estimated lookup cost of evaluating the tree, see
+	// Provider.Lookups.
+	Lookups int
+}
+
+// Generate builds the policy of inv within b.  Networks are deduplicated
+// and aggregated, so contained and adjacent networks collapse into the
+// shortest list of ip4 and ip6 terms, which come first as they cost no
+// lookups; mx and the provider includes follow.  When the record would
+// exceed b.MaxRecordBytes the networks that do not fit are moved into
+// subdomain records as Split does.  ErrOverBudget is returned when no such
+// tree fits b.
+func Generate(inv Inventory, b Budget) (Result, error) {
+	domain, err := parser.ValidateDomain(inv.Domain)
+	if err != nil {
+		return Result{}, err
+	}
+	b.MaxLookups = cmp.Or(b.MaxLookups, spf.MaxDNSLookups)
+	b.MaxRecordBytes = cmp.Or(b.MaxRecordBytes, DefaultRecordBytes)
+	all := cmp.Or(inv.All, "-all")
+
+	nets, err := networkTerms(inv.Networks)
+	if err != nil {
+		return Result{}, err
+	}
+	var tail []string // lookup terms after the networks
+	lookups := 0
+	if inv.MX {
+		tail = append(tail, "mx")
+		lookups++
+	}
+	for _, name := range inv.Providers {
+		p, ok := Providers[strings.ToLower(name)]
+		if !ok {
+			return Result{}, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+		if term := "include:" + p.Include; !slices.Contains(tail, term) {
+			tail = append(tail, term)
+			lookups += p.Lookups
+		}
+	}
+	tail = append(tail, all)
+	if lookups > b.MaxLookups {
+		return Result{}, fmt.Errorf("%w: %d lookups", ErrOverBudget, lookups)
+	}
+
+	return layout(domain, nets, tail, lookups, b)
+}
+
+// networkTerms converts addresses and CIDR networks to the fewest ip4 and
+// ip6 terms covering exactly the same addresses, IPv4 first, each family
+// in address order.
+func networkTerms(in []string) ([]string, error) {
+	var prefixes []netip.Prefix
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		var p netip.Prefix
+		var err error
+		if strings.Contains(s, "/") {
+			p, err = netip.ParsePrefix(s)
+		} else {
+			var a netip.Addr
+			if a, err = netip.ParseAddr(s); err == nil {
+				p = netip.PrefixFrom(a, a.BitLen())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadNetwork, s)
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	prefixes = aggregate(prefixes)
+
+	terms := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		kind := "ip6:"
+		if p.Addr().Is4() {
+			kind = "ip4:"
+		}
+		if p.IsSingleIP() {
+			terms = append(terms, kind+p.Addr().String())
+			continue
+		}
+		terms = append(terms, kind+p.String())
+	}
+	return terms, nil
+}
+
+// aggregate sorts prefixes, drops those contained in another and merges
+// sibling pairs into their parent until nothing changes.
+func aggregate(prefixes []netip.Prefix) []netip.Prefix {
+	for {
+		slices.SortFunc(prefixes, comparePrefix)
+		var out []netip.Prefix
+		merged := false
+		for _, p := range prefixes {
+			if len(out) == 0 {
+				out = append(out, p)
+				continue
+			}
+			last := out[len(out)-1]
+			switch {
+			case last.Addr().Is4() != p.Addr().Is4():
+				out = append(out, p)
+			case last.Bits() <= p.Bits() && last.Contains(p.Addr()):
+				// contained
+			case last.Bits() == p.Bits() && last.Bits() > 0 && sibling(last, p):
+				out[len(out)-1], _ = last.Addr().Prefix(last.Bits() - 1)
+				merged = true
+			default:
+				out = append(out, p)
+			}
+		}
+		prefixes = out
+		if !merged {
+			return prefixes
+		}
+	}
+}
+
+// sibling reports whether a and b, of equal length, halve the same parent.
+func sibling(a, b netip.Prefix) bool {
+	pa, _ := a.Addr().Prefix(a.Bits() - 1)
+	pb, _ := b.Addr().Prefix(b.Bits() - 1)
+	return pa == pb
+}
+
+// comparePrefix orders IPv4 before IPv6, then by address, then broader
+// networks first.
+func comparePrefix(a, b netip.Prefix) int {
+	if a.Addr().Is4() != b.Addr().Is4() {
+		if a.Addr().Is4() {
+			return -1
+		}
+		return 1
+	}
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
@@ -0,0 +1,109 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/export"
+)
+
+func TestNetworkTerms(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{name: "host", in: []string{"192.0.2.1"}, want: []string{"ip4:192.0.2.1"}},
+		{name: "masked", in: []string{"192.0.2.77/24"}, want: []string{"ip4:192.0.2.0/24"}},
+		{name: "duplicate", in: []string{"192.0.2.1", " 192.0.2.1/32"}, want: []string{"ip4:192.0.2.1"}},
+		{name: "contained", in: []string{"192.0.2.7", "192.0.2.0/24"}, want: []string{"ip4:192.0.2.0/24"}},
+		{name: "siblings", in: []string{"192.0.2.0/25", "192.0.2.128/25"}, want: []string{"ip4:192.0.2.0/24"}},
+		{name: "cascade", in: []string{"192.0.2.0", "192.0.2.1", "192.0.2.2/31"}, want: []string{"ip4:192.0.2.0/30"}},
+		{name: "not siblings", in: []string{"192.0.2.128/25", "192.0.3.0/25"}, want: []string{"ip4:192.0.2.128/25", "ip4:192.0.3.0/25"}},
+		{name: "mapped", in: []string{"::ffff:192.0.2.1"}, want: []string{"ip4:192.0.2.1"}},
+		{name: "families", in: []string{"2001:db8::/32", "198.51.100.1"}, want: []string{"ip4:198.51.100.1", "ip6:2001:db8::/32"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := networkTerms(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := networkTerms([]string{"192.0.2.300"})
+	assert.ErrorIs(t, err, ErrBadNetwork)
+}
+
+func TestGenerate(t *testing.T) {
+	res, err := Generate(Inventory{
+		Domain:    "Example.com",
+		Networks:  []string{"192.0.2.0/25", "192.0.2.128/25", "2001:db8::1"},
+		Providers: []string{"Google", "sendgrid", "google"},
+		MX:        true,
+	}, Budget{})
+	require.NoError(t, err)
+	assert.Equal(t, Result{
+		Records: []export.TXT{{Zone: "example.com",
+			Value: "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::1 mx include:_spf.google.com include:sendgrid.net -all"}},
+		Lookups: 6,
+	}, res)
+
+	res, err = Generate(Inventory{Domain: "example.com", All: "~all"}, Budget{})
+	require.NoError(t, err)
+	assert.Equal(t, "v=spf1 ~all", res.Records[0].Value)
+}
+
+func TestGenerateSplit(t *testing.T) {
+	var nets []string
+	for i := 0; i < 40; i++ {
+		nets = append(nets, fmt.Sprintf("198.51.100.%d", 2*i+1)) // never adjacent
+	}
+	inv := Inventory{Domain: "example.com", Networks: nets, Providers: []string{"google"}}
+
+	res, err := Generate(inv, Budget{MaxRecordBytes: 200})
+	require.NoError(t, err)
+	require.Greater(t, len(res.Records), 2)
+	apex := res.Records[0]
+	assert.Empty(t, apex.Name)
+	assert.Equal(t, 4+len(res.Records)-1, res.Lookups)
+
+	var published []string
+	for i, r := range res.Records {
+		assert.LessOrEqual(t, len(r.Value), 200, r.Name)
+		terms := strings.Fields(r.Value)
+		if i > 0 {
+			assert.Equal(t, fmt.Sprintf("_spf%d", i), r.Name)
+			assert.Contains(t, apex.Value, "include:_spf"+fmt.Sprint(i)+".example.com")
+			assert.Equal(t, "-all", terms[len(terms)-1])
+		}
+		for _, term := range terms {
+			if strings.HasPrefix(term, "ip4:") {
+				published = append(published, strings.TrimPrefix(term, "ip4:"))
+			}
+		}
+	}
+	assert.ElementsMatch(t, nets, published)
+	assert.True(t, strings.HasSuffix(apex.Value, "include:_spf.google.com -all"))
+
+	// each subdomain record costs a lookup
+	_, err = Generate(inv, Budget{MaxRecordBytes: 200, MaxLookups: 5})
+	assert.ErrorIs(t, err, ErrOverBudget)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	_, err := Generate(Inventory{Domain: "example.com", Providers: []string{"nosuch"}}, Budget{})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	_, err = Generate(Inventory{Domain: "example.com", Providers: []string{"google", "mailgun", "microsoft365", "sendgrid", "amazonses"}}, Budget{})
+	assert.ErrorIs(t, err, ErrOverBudget)
+
+	_, err = Generate(Inventory{Domain: "example.com", Providers: []string{"microsoft365"}}, Budget{MaxRecordBytes: 20})
+	assert.ErrorIs(t, err, ErrOverBudget)
+
+	_, err = Generate(Inventory{Domain: "bad..example"}, Budget{})
+	assert.Error(t, err)
+}
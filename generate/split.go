@@ -0,0 +1,202 @@
+package generate
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/export"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Split publishes terms, the terms of a record after "v=spf1", at domain
+// within b.  It takes the output of a record builder or flattener, such as
+// the networks of spf.RecordGraph.Flatten followed by an all term.  The
+// leading pass ip4 and ip6 terms that do not fit in the record at domain
+// are moved, in order, into records at _spf1, _spf2, ... subdomains of
+// domain, included in their place; the other terms stay where they are.
+// Result.Lookups counts the lookup terms of the generated records, each
+// include as one; use Verify for the cost of the whole tree.
+// ErrOverBudget is returned when no such tree fits b.
+func Split(domain string, terms []string, b Budget) (Result, error) {
+	domain, err := parser.ValidateDomain(domain)
+	if err != nil {
+		return Result{}, err
+	}
+	b.MaxLookups = cmp.Or(b.MaxLookups, spf.MaxDNSLookups)
+	b.MaxRecordBytes = cmp.Or(b.MaxRecordBytes, DefaultRecordBytes)
+
+	n := 0
+	for n < len(terms) && movable(terms[n]) {
+		n++
+	}
+	tail := terms[n:]
+	rec, err := parser.Parse(strings.ToLower(record(tail)))
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	lookups := 0
+	for _, m := range rec.Mechs {
+		switch m.Kind {
+		case "a", "mx", "ptr", "exists", "include":
+			lookups++
+		}
+	}
+	if rec.Redirect != nil {
+		lookups++
+	}
+	if lookups > b.MaxLookups {
+		return Result{}, fmt.Errorf("%w: %d lookups", ErrOverBudget, lookups)
+	}
+	return layout(domain, terms[:n], tail, lookups, b)
+}
+
+// SplitFlattened is Split for the networks of f followed by all, e.g.
+// "-all".  Like export.FlattenedTXT it fails with export.ErrResidual when f
+// has residual terms.
+func SplitFlattened(domain string, f spf.Flattened, all string, b Budget) (Result, error) {
+	if len(f.Residual) > 0 {
+		return Result{}, fmt.Errorf("%w: %s", export.ErrResidual, strings.Join(f.Residual, ", "))
+	}
+	terms := slices.Clone(f.Networks)
+	if all != "" {
+		terms = append(terms, all)
+	}
+	return Split(domain, terms, b)
+}
+
+// movable reports whether term is a pass ip4 or ip6 mechanism, which
+// matches the same clients from an included record.
+func movable(term string) bool {
+	term = strings.ToLower(strings.TrimPrefix(term, "+"))
+	return strings.HasPrefix(term, "ip4:") || strings.HasPrefix(term, "ip6:")
+}
+
+// layout places nets, then tail, whose lookup terms cost lookups, in a
+// record at domain, moving the networks that do not fit into as few
+// subdomain records as possible.
+func layout(domain string, nets, tail []string, lookups int, b Budget) (Result, error) {
+	// try with k subdomain records until the networks fit in k of them
+	for k := 0; lookups+k <= b.MaxLookups; k++ {
+		var apex []string
+		for i := 1; i <= k; i++ {
+			apex = append(apex, fmt.Sprintf("include:_spf%d.%s", i, domain))
+		}
+		apex = append(apex, tail...)
+		head, rest := pack(nets, b.MaxRecordBytes-recordLen(apex))
+		if head < 0 {
+			break // the other terms alone are too long
+		}
+		subs := groups(rest, b.MaxRecordBytes-recordLen([]string{"-all"}))
+		if subs == nil || len(subs) > k {
+			continue
+		}
+		// here len(subs) == k, or k-1 includes would have done
+		res := Result{Lookups: lookups + k}
+		apex = slices.Concat(nets[:head], apex)
+		res.Records = append(res.Records, export.TXT{Zone: domain, Value: record(apex)})
+		for i, terms := range subs {
+			res.Records = append(res.Records, export.TXT{
+				Zone:  domain,
+				Name:  fmt.Sprintf("_spf%d", i+1),
+				Value: record(slices.Concat(terms, []string{"-all"})),
+			})
+		}
+		for _, r := range res.Records {
+			if _, err := parser.Parse(strings.ToLower(r.Value)); err != nil {
+				return Result{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+			}
+		}
+		return res, nil
+	}
+	return Result{}, fmt.Errorf("%w: %d networks do not fit %d-byte records within %d lookups",
+		ErrOverBudget, len(nets), b.MaxRecordBytes, b.MaxLookups)
+}
+
+// Verify walks the tree res would publish, serving its records from memory
+// and every other include or redirect target through r, and returns the
+// lookups one evaluation may spend on it (spf.RecordGraph.TotalCost).  It
+// returns ErrOverBudget when that exceeds maxLookups, spf.MaxDNSLookups
+// if zero, and the error of any record of the tree that could not be
+// fetched or parsed, since its cost is then unknown.
+func Verify(ctx context.Context, r *dns.Resolver, res Result, maxLookups int) (int, error) {
+	if len(res.Records) == 0 {
+		return 0, fmt.Errorf("%w: no records", ErrInvalid)
+	}
+	var opts []spf.Option
+	for _, txt := range res.Records {
+		opts = append(opts, spf.WithIncludeOverride(fqdn(txt), txt.Value))
+	}
+	root := fqdn(res.Records[0])
+	g, err := spf.NewChecker(r, opts...).WalkRecord(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range slices.Sorted(maps.Keys(g.Nodes)) {
+		if n := g.Nodes[d]; n.Err != nil {
+			return 0, fmt.Errorf("%s: %w", d, n.Err)
+		}
+	}
+	cost := g.TotalCost(g.Root)
+	if cost > cmp.Or(maxLookups, spf.MaxDNSLookups) {
+		return cost, fmt.Errorf("%w: the tree at %s costs %d lookups", ErrOverBudget, root, cost)
+	}
+	return cost, nil
+}
+
+// fqdn returns the owner name of txt.
+func fqdn(txt export.TXT) string {
+	if txt.Name == "" {
+		return txt.Zone
+	}
+	return txt.Name + "." + txt.Zone
+}
+
+// record joins terms into a record.
+func record(terms []string) string {
+	return strings.Join(append([]string{"v=spf1"}, terms...), " ")
+}
+
+// recordLen is the length of record(terms).
+func recordLen(terms []string) int {
+	n := len("v=spf1")
+	for _, t := range terms {
+		n += 1 + len(t)
+	}
+	return n
+}
+
+// pack returns how many leading terms fit in room bytes, each taking a
+// separating space, and the terms left over.  It returns -1 when room is
+// negative.
+func pack(terms []string, room int) (int, []string) {
+	if room < 0 {
+		return -1, nil
+	}
+	n := 0
+	for n < len(terms) && 1+len(terms[n]) <= room {
+		room -= 1 + len(terms[n])
+		n++
+	}
+	return n, terms[n:]
+}
+
+// groups packs terms into as few groups of room bytes as possible, keeping
+// their order.  It returns nil when a term does not fit on its own.
+func groups(terms []string, room int) [][]string {
+	out := [][]string{}
+	for len(terms) > 0 {
+		n, rest := pack(terms, room)
+		if n <= 0 {
+			return nil
+		}
+		out = append(out, terms[:n])
+		terms = rest
+	}
+	return out
+}
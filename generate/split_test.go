@@ -0,0 +1,106 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/export"
+)
+
+// zone serves TXT records; other names do not exist.
+type zone map[string][]string
+
+func (z zone) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txts, ok := z[name]; ok {
+		return txts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (z zone) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// hosts returns n distinct, non-adjacent ip4 terms.
+func hosts(n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		out = append(out, fmt.Sprintf("ip4:198.51.%d.%d", i/100, 2*(i%100)+1))
+	}
+	return out
+}
+
+func TestSplit(t *testing.T) {
+	res, err := Split("example.com", []string{"ip4:192.0.2.0/24", "mx", "-all"}, Budget{})
+	require.NoError(t, err)
+	assert.Equal(t, Result{
+		Records: []export.TXT{{Zone: "example.com", Value: "v=spf1 ip4:192.0.2.0/24 mx -all"}},
+		Lookups: 1,
+	}, res)
+
+	// only the leading networks move; the rest keeps its order
+	terms := append(hosts(30), "a:mail.example.com", "ip4:203.0.113.1", "include:_spf.example.net", "~all")
+	res, err = Split("example.com", terms, Budget{MaxRecordBytes: 250})
+	require.NoError(t, err)
+	require.Greater(t, len(res.Records), 1)
+	assert.Equal(t, 2+len(res.Records)-1, res.Lookups)
+	apex := res.Records[0].Value
+	assert.True(t, strings.HasSuffix(apex, "include:_spf"+fmt.Sprint(len(res.Records)-1)+".example.com a:mail.example.com ip4:203.0.113.1 include:_spf.example.net ~all"), apex)
+	var moved []string
+	for _, r := range res.Records {
+		assert.LessOrEqual(t, len(r.Value), 250, r.Name)
+		for _, term := range strings.Fields(r.Value) {
+			if strings.HasPrefix(term, "ip4:198.51.") {
+				moved = append(moved, term)
+			}
+		}
+	}
+	assert.Equal(t, hosts(30), moved)
+
+	_, err = Split("example.com", append(hosts(200), "-all"), Budget{MaxRecordBytes: 100})
+	assert.ErrorIs(t, err, ErrOverBudget)
+	_, err = Split("example.com", []string{"ip4:192.0.2.0/24", "bogus:x", "-all"}, Budget{})
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestSplitFlattened(t *testing.T) {
+	res, err := SplitFlattened("example.com", spf.Flattened{Networks: hosts(60)}, "-all", Budget{})
+	require.NoError(t, err)
+	assert.Len(t, res.Records, 3)
+	assert.Equal(t, 2, res.Lookups)
+
+	_, err = SplitFlattened("example.com", spf.Flattened{Networks: hosts(1), Residual: []string{"example.com: mx"}}, "-all", Budget{})
+	assert.ErrorIs(t, err, export.ErrResidual)
+}
+
+func TestVerify(t *testing.T) {
+	third := zone{
+		"_spf.example.net": {"v=spf1 include:a.example.net include:b.example.net -all"},
+		"a.example.net":    {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"b.example.net":    {"v=spf1 a mx -all"},
+	}
+	r := dns.NewCustomDNSResolver(third, third)
+
+	res, err := Split("example.com", append(hosts(60), "include:_spf.example.net", "-all"), Budget{})
+	require.NoError(t, err)
+	cost, err := Verify(context.Background(), r, res, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2+1+2+2, cost) // two _spfN, the include and its tree
+
+	cost, err = Verify(context.Background(), r, res, 6)
+	assert.ErrorIs(t, err, ErrOverBudget)
+	assert.Equal(t, 7, cost)
+
+	// a target that cannot be fetched leaves the cost unknown
+	res, err = Split("example.com", []string{"include:missing.example.net", "-all"}, Budget{})
+	require.NoError(t, err)
+	_, err = Verify(context.Background(), r, res, 0)
+	assert.ErrorIs(t, err, dns.ErrNoDNSrecord)
+}
@@ -0,0 +1,58 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/t0gun/go-spf/dns"
+)
+
+// DefaultHealthCheckName is the canary queried by HealthCheck unless
+// WithHealthCheckName sets another.  RFC 2606 reserves it, so it always
+// resolves on a working network.
+const DefaultHealthCheckName = "example.com"
+
+// HealthStatus is the outcome of Checker.HealthCheck.
+type HealthStatus struct {
+	OK      bool          // resolver answered the canary query
+	Name    string        // canary name queried
+	Latency time.Duration // time taken by the query
+	Err     error         // classified lookup error, nil when OK is true
+}
+
+// WithHealthCheckName sets the canary name queried by HealthCheck.  Point it
+// at a name the deployment's resolver is known to answer, such as the
+// operator's own domain.
+func WithHealthCheckName(name string) Option {
+	return func(c *Checker) {
+		c.healthName = name
+	}
+}
+
+// HealthCheck performs a single TXT lookup of the canary name to verify that
+// the resolver is reachable, for readiness probes.  An answer or an NXDOMAIN
+// counts as healthy since both prove the resolver responded; timeouts,
+// SERVFAIL and other failures do not, nor does a Checker without a
+// Resolver.
+func (c *Checker) HealthCheck(ctx context.Context) HealthStatus {
+	name := c.healthName
+	if name == "" {
+		name = DefaultHealthCheckName
+	}
+	if c.Resolver == nil {
+		return HealthStatus{Name: name, Err: ErrNoResolver}
+	}
+	// latency is wall time; c.Clock may be fixed for evaluations
+	start := time.Now()
+	_, err := c.Resolver.LookupTXT(ctx, name)
+	st := HealthStatus{Name: name, Latency: time.Since(start)}
+
+	err = dns.ClassifyError(err)
+	if err != nil && !errors.Is(err, dns.ErrNoDNSrecord) {
+		st.Err = err
+		return st
+	}
+	st.OK = true
+	return st
+}
@@ -0,0 +1,62 @@
+package spf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t0gun/go-spf/dns"
+)
+
+// stepClock advances by step on every call to Now.
+type stepClock struct {
+	t    time.Time
+	step time.Duration
+}
+
+func (c *stepClock) Now() time.Time {
+	c.t = c.t.Add(c.step)
+	return c.t
+}
+
+func TestChecker_HealthCheck(t *testing.T) {
+	cases := []struct {
+		name     string
+		txt      dns.TXTResolver
+		opts     []Option
+		wantOK   bool
+		wantName string
+		wantErr  error
+	}{
+		{"answer", fakeTXTMap{DefaultHealthCheckName: {"v=spf1 -all"}}, nil, true, DefaultHealthCheckName, nil},
+		{"nxdomain still healthy", fakeTXTMap{}, nil, true, DefaultHealthCheckName, nil},
+		{"custom name", fakeTXTMap{"canary.example.org": {"ok"}}, []Option{WithHealthCheckName("canary.example.org")}, true, "canary.example.org", nil},
+		{"servfail", &fakeResolver{err: rcodeError(dns.RcodeServerFailure)}, nil, false, DefaultHealthCheckName, dns.ErrTempfail},
+		{"timeout", &fakeResolver{err: context.DeadlineExceeded}, nil, false, DefaultHealthCheckName, context.DeadlineExceeded},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(tc.txt, nil), tc.opts...)
+			// the latency is measured in wall time, not with the Clock
+			ch.Clock = &stepClock{step: time.Hour}
+			st := ch.HealthCheck(context.Background())
+			assert.Equal(t, tc.wantOK, st.OK)
+			assert.Equal(t, tc.wantName, st.Name)
+			assert.Less(t, st.Latency, time.Hour)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, st.Err, tc.wantErr)
+			} else {
+				assert.NoError(t, st.Err)
+			}
+		})
+	}
+}
+
+func TestChecker_HealthCheckNoResolver(t *testing.T) {
+	st := (&Checker{}).HealthCheck(context.Background())
+	assert.False(t, st.OK)
+	assert.Equal(t, DefaultHealthCheckName, st.Name)
+	assert.ErrorIs(t, st.Err, ErrNoResolver)
+}
@@ -0,0 +1,64 @@
+package spf
+
+import (
+	"context"
+
+	"github.com/t0gun/go-spf/internal/mailaddr"
+)
+
+// IdentityResults holds the outcome of CheckMailFromAndHELO.
+type IdentityResults struct {
+	HELO     CheckHostResult
+	MailFrom CheckHostResult
+
+	// MailFromChecked is false when the MAIL FROM check was skipped because
+	// the reverse-path was null; MailFrom is then the zero value.
+	MailFromChecked bool
+
+	// Decisive names the identity whose result should drive policy: the
+	// MAIL FROM identity when it was checked, otherwise HELO.
+	Decisive Identity
+}
+
+// Result returns the result of the Decisive identity.
+func (r IdentityResults) Result() CheckHostResult {
+	if r.Decisive == IdentityHELO {
+		return r.HELO
+	}
+	return r.MailFrom
+}
+
+// CheckMailFromAndHELO checks both identities as RFC 7208 sections 2.3 and
+// 2.4 recommend: HELO first, then MAIL FROM.  For a null reverse-path the
+// MAIL FROM check would evaluate postmaster@<helo> against the HELO domain
+// again (section 2.4), so it is skipped and HELO decides.  req.Identity and
+// req.Domain are ignored.  policy.IdentityHeaders formats a Received-SPF
+// field for each identity checked.
+func (c *Checker) CheckMailFromAndHELO(ctx context.Context, req Request) (IdentityResults, error) {
+	var out IdentityResults
+	req.Domain = ""
+
+	helo := req
+	helo.Identity = IdentityHELO
+	res, err := c.Check(ctx, helo)
+	if err != nil {
+		return IdentityResults{}, err
+	}
+	out.HELO = res
+	out.Decisive = IdentityHELO
+
+	if mailaddr.Clean(req.MailFrom) == "" {
+		return out, nil
+	}
+
+	mf := req
+	mf.Identity = IdentityMailFrom
+	res, err = c.Check(ctx, mf)
+	if err != nil {
+		return IdentityResults{}, err
+	}
+	out.MailFrom = res
+	out.MailFromChecked = true
+	out.Decisive = IdentityMailFrom
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestChecker_CheckMailFromAndHELO(t *testing.T) {
+	txt := fakeTXTMap{
+		"mx.example.org": {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"example.com":    {"v=spf1 ip4:198.51.100.0/24 -all"},
+	}
+
+	cases := []struct {
+		name         string
+		req          Request
+		wantHELO     Result
+		wantMailFrom Result
+		wantChecked  bool
+		wantDecisive Identity
+	}{
+		{
+			"both identities", Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "alice@example.com", HELODomain: "mx.example.org"},
+			Pass, Fail, true, IdentityMailFrom,
+		},
+		{
+			"null sender is helo only", Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "<>", HELODomain: "mx.example.org"},
+			Pass, "", false, IdentityHELO,
+		},
+		{
+			"spaced null sender is helo only", Request{IP: net.ParseIP("192.0.2.1"), MailFrom: " < > ", HELODomain: "mx.example.org"},
+			Pass, "", false, IdentityHELO,
+		},
+		{
+			"empty sender is helo only", Request{IP: net.ParseIP("198.51.100.1"), HELODomain: "mx.example.org"},
+			Fail, "", false, IdentityHELO,
+		},
+		{
+			"identity and domain ignored", Request{IP: net.ParseIP("198.51.100.1"), MailFrom: "alice@example.com", HELODomain: "mx.example.org", Identity: IdentityHELO, Domain: "other.example"},
+			Fail, Pass, true, IdentityMailFrom,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+			res, err := ch.CheckMailFromAndHELO(context.Background(), tc.req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantHELO, res.HELO.Code)
+			assert.Equal(t, tc.wantMailFrom, res.MailFrom.Code)
+			assert.Equal(t, tc.wantChecked, res.MailFromChecked)
+			assert.Equal(t, tc.wantDecisive, res.Decisive)
+			if tc.wantChecked {
+				assert.Equal(t, tc.wantMailFrom, res.Result().Code)
+			} else {
+				assert.Equal(t, tc.wantHELO, res.Result().Code)
+			}
+		})
+	}
+}
+
+func TestChecker_CheckMailFromAndHELOError(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil))
+	_, err := ch.CheckMailFromAndHELO(context.Background(), Request{MailFrom: "alice@example.com", HELODomain: "mx.example.org"})
+	assert.ErrorIs(t, err, ErrNoIP)
+}
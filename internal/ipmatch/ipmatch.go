@@ -0,0 +1,55 @@
+// Package ipmatch holds the CIDR comparison helpers shared by the SPF
+// mechanism evaluators.  It is internal so the helpers can change without
+// affecting the public v1 API.
+package ipmatch
+
+import "net"
+
+// PrefixEqual compares two IPs under a given prefix length.
+// Used to implement CIDR matching for "a" and "mx" mechanisms.
+//
+// Returns true if the first maskLen bits are identical.
+//   - totalBits = 32 for IPv4, 128 for IPv6.
+//   - 5.6 requires bounds-checking on CIDR lengths.
+func PrefixEqual(a, b net.IP, maskLen, totalBits int) bool {
+	if a == nil || b == nil || maskLen < 0 || maskLen > totalBits {
+		return false
+	}
+	aa := a.To16()
+	bb := b.To16()
+	if aa == nil || bb == nil {
+		return false
+	}
+	mask := net.CIDRMask(maskLen, totalBits)
+	// an IPv4 mask covers only the last four bytes of the 16-byte form
+	off := len(aa) - len(mask)
+	for i := 0; i < len(mask); i++ {
+		if (aa[off+i] & mask[i]) != (bb[off+i] & mask[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Embedded4 returns the IPv4 address embedded in ip under the IPv4/IPv6
+// translation prefix (RFC 6052 section 2.2), or nil when ip is not inside
+// prefix.  The prefix length must be 32, 40, 48, 56, 64 or 96; bits 64 to
+// 71, the "u" octet, never carry address bits.
+func Embedded4(ip net.IP, prefix *net.IPNet) net.IP {
+	ones, bits := prefix.Mask.Size()
+	if bits != 128 || ones%8 != 0 || ones < 32 || ones > 96 || ones == 72 || ones == 80 || ones == 88 {
+		return nil
+	}
+	if ip.To4() != nil || !prefix.Contains(ip) {
+		return nil
+	}
+	ip = ip.To16()
+	v4 := make(net.IP, 0, net.IPv4len)
+	for i := ones / 8; len(v4) < net.IPv4len; i++ {
+		if i == 8 {
+			continue // the u octet
+		}
+		v4 = append(v4, ip[i])
+	}
+	return v4
+}
@@ -0,0 +1,68 @@
+package ipmatch
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixEqual(t *testing.T) {
+	tc := []struct {
+		name      string
+		a, b      string
+		mask      int
+		totalBits int
+		want      bool
+	}{
+		{"v4 same /24", "192.0.2.10", "192.0.2.200", 24, 32, true},
+		{"v4 differ /24", "192.0.2.10", "198.51.100.10", 24, 32, false},
+		{"v4 host /32", "192.0.2.10", "192.0.2.11", 32, 32, false},
+		{"v4 /0 matches anything", "192.0.2.10", "203.0.113.1", 0, 32, true},
+		{"v6 same /64", "2001:db8::1", "2001:db8::ffff", 64, 128, true},
+		{"v6 differ /64", "2001:db8::1", "2001:db8:1::1", 64, 128, false},
+		{"mask out of range", "192.0.2.10", "192.0.2.10", 33, 32, false},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := PrefixEqual(net.ParseIP(c.a), net.ParseIP(c.b), c.mask, c.totalBits)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestEmbedded4(t *testing.T) {
+	tc := []struct {
+		name   string
+		ip     string
+		prefix string
+		want   string
+	}{
+		// RFC 6052 section 2.4 examples for 192.0.2.33
+		{"/32", "2001:db8:c000:221::", "2001:db8::/32", "192.0.2.33"},
+		{"/40", "2001:db8:1c0:2:21::", "2001:db8:100::/40", "192.0.2.33"},
+		{"/48", "2001:db8:122:c000:2:2100::", "2001:db8:122::/48", "192.0.2.33"},
+		{"/56", "2001:db8:122:3c0:0:221::", "2001:db8:122:300::/56", "192.0.2.33"},
+		{"/64", "2001:db8:122:344:c0:2:2100:0", "2001:db8:122:344::/64", "192.0.2.33"},
+		{"/96", "2001:db8:122:344::192.0.2.33", "2001:db8:122:344::/96", "192.0.2.33"},
+		{"well-known prefix", "64:ff9b::192.0.2.33", "64:ff9b::/96", "192.0.2.33"},
+		{"outside prefix", "2001:db8::1", "64:ff9b::/96", ""},
+		{"ipv4 client", "192.0.2.33", "64:ff9b::/96", ""},
+		{"invalid length", "64:ff9b::192.0.2.33", "64:ff9b::/80", ""},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			_, prefix, err := net.ParseCIDR(c.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Embedded4(net.ParseIP(c.ip), prefix)
+			if c.want == "" {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, c.want, got.String())
+		})
+	}
+}
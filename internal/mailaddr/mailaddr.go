@@ -0,0 +1,160 @@
+// Package mailaddr extracts the parts of a MAIL FROM address that SPF needs.
+// It is internal so the parsing rules can evolve without affecting the
+// public v1 API.
+package mailaddr
+
+import "strings"
+
+// Domain extracts the domain part of a MAIL FROM address as described
+// in RFC 7208 section 4.1. It returns the substring after the '@' that
+// separates the local part from the domain and ok set to true when such an
+// '@' is present.  An '@' inside a quoted local part ("a@b"@example.com),
+// a source route (@relay.example:alice@example.com) and comments are not
+// mistaken for it, see Clean.  If sender lacks an '@', it returns ("",
+// false).
+func Domain(sender string) (string, bool) {
+	_, domain, ok := split(Clean(sender))
+	return domain, ok
+}
+
+// LocalPart extracts the string before '@', quotes included for a quoted
+// local part.  If the input lacks '@', RFC 7208 section 4.1 requires that
+// "postmaster" be used instead.
+func LocalPart(sender string) string {
+	if local, _, ok := split(Clean(sender)); ok && local != "" {
+		return local // real local part
+	}
+
+	return "postmaster"
+}
+
+// Clean reduces a MAIL FROM argument to the bare address: surrounding white
+// space and angle brackets are removed, comments in parentheses outside a
+// quoted string are dropped, and an RFC 5321 source route ("@a,@b:") before
+// the mailbox is discarded, as section 4.1.1.3 tells receivers to ignore it.
+func Clean(sender string) string {
+	s := strings.TrimSpace(stripComments(sender))
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">"))
+	if strings.HasPrefix(s, "@") {
+		if colon := indexUnquoted(s, ':'); colon >= 0 {
+			s = s[colon+1:]
+		}
+	}
+	return s
+}
+
+// Normalize returns the sender identity used for macro expansion.  The
+// address is cleaned as by Clean, a missing local part becomes "postmaster"
+// (RFC 7208 section 4.3), and a null reverse-path is replaced by
+// postmaster@<helo> as described in section 2.4.  When helo is unknown the
+// evaluated domain is used instead.
+func Normalize(sender, helo, domain string) string {
+	return NormalizeNull(sender, helo, domain, "postmaster")
+}
+
+// NormalizeNull is Normalize with nullLocal as the local part substituted
+// for a null reverse-path.
+func NormalizeNull(sender, helo, domain, nullLocal string) string {
+	s := Clean(sender)
+	local, _, ok := split(s)
+	switch {
+	case s == "":
+		host := helo
+		if host == "" {
+			host = domain
+		}
+		return nullLocal + "@" + host
+	case !ok:
+		return "postmaster@" + s
+	case local == "":
+		return "postmaster" + s
+	}
+	return s
+}
+
+// International reports whether sender is an internationalized address
+// (RFC 6531), one with non-ASCII characters that needs SMTPUTF8.
+func International(sender string) bool {
+	for i := 0; i < len(sender); i++ {
+		if sender[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// split divides a cleaned address at its last '@' outside a quoted string.
+func split(s string) (local, domain string, ok bool) {
+	at := -1
+	scan(s, func(i int) {
+		if s[i] == '@' {
+			at = i
+		}
+	})
+	if at < 0 {
+		return "", "", false
+	}
+	return s[:at], s[at+1:], true
+}
+
+// indexUnquoted returns the index of the first c outside a quoted string,
+// or -1.
+func indexUnquoted(s string, c byte) int {
+	idx := -1
+	scan(s, func(i int) {
+		if idx < 0 && s[i] == c {
+			idx = i
+		}
+	})
+	return idx
+}
+
+// scan calls fn with the index of every byte of s that is outside a quoted
+// string and not escaped by a backslash within one.
+func scan(s string, fn func(i int)) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++ // quoted-pair
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted:
+			fn(i)
+		}
+	}
+}
+
+// stripComments removes parenthesised comments, which may nest, from s.
+// Parentheses inside a quoted string are kept.
+func stripComments(s string) string {
+	if !strings.ContainsRune(s, '(') {
+		return s
+	}
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && (quoted || depth > 0) && i+1 < len(s):
+			if depth == 0 {
+				b.WriteByte(c)
+				b.WriteByte(s[i+1])
+			}
+			i++
+			continue
+		case depth == 0 && c == '"':
+			quoted = !quoted
+		case !quoted && c == '(':
+			depth++
+			continue
+		case !quoted && c == ')' && depth > 0:
+			depth--
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
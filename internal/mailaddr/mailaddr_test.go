@@ -0,0 +1,108 @@
+package mailaddr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomain(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		sender string
+		domain string
+	}{
+		{"apps@gmail.com", "gmail.com"},
+		{"apps@yahoo.com", "yahoo.com"},
+	}
+
+	for _, c := range tc {
+		got, ok := Domain(c.sender)
+		assert.Equal(t, c.domain, got)
+		assert.True(t, ok)
+	}
+}
+
+func TestLocalPart(t *testing.T) {
+	tc := []struct{ sender, want string }{
+		{"alice@example.com", "alice"},
+		{"<alice@example.com>", "alice"},
+		{"<>", "postmaster"},
+		{"", "postmaster"},
+	}
+
+	for _, c := range tc {
+		t.Run("local parts", func(t *testing.T) {
+			got := LocalPart(c.sender)
+			assert.Equal(t, got, c.want)
+		})
+	}
+
+}
+
+func TestNormalize(t *testing.T) {
+	tc := []struct {
+		name                 string
+		sender, helo, domain string
+		want                 string
+	}{
+		{"plain address", "alice@example.com", "mx.example.org", "example.com", "alice@example.com"},
+		{"angle brackets", "<alice@example.com>", "", "example.com", "alice@example.com"},
+		{"null sender uses helo", "<>", "mx.example.org", "mx.example.org", "postmaster@mx.example.org"},
+		{"null sender without helo", "", "", "example.com", "postmaster@example.com"},
+		{"missing local part", "@example.com", "", "example.com", "postmaster@example.com"},
+		{"bare domain", "example.com", "", "example.com", "postmaster@example.com"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, Normalize(c.sender, c.helo, c.domain))
+		})
+	}
+}
+
+func TestNormalizeNull(t *testing.T) {
+	assert.Equal(t, "bounces@mx.example.org", NormalizeNull("<>", "mx.example.org", "example.com", "bounces"))
+	// only the null reverse-path uses the configured local part
+	assert.Equal(t, "postmaster@example.com", NormalizeNull("@example.com", "", "example.com", "bounces"))
+	assert.Equal(t, "alice@example.com", NormalizeNull("alice@example.com", "", "example.com", "bounces"))
+}
+
+func TestRFC5321Addresses(t *testing.T) {
+	tc := []struct {
+		name   string
+		sender string
+		clean  string
+		local  string
+		domain string
+	}{
+		{"quoted dots", `"john..doe"@example.com`, `"john..doe"@example.com`, `"john..doe"`, "example.com"},
+		{"quoted at sign", `"a@b"@example.com`, `"a@b"@example.com`, `"a@b"`, "example.com"},
+		{"quoted escaped quote", `"a\"@b"@example.com`, `"a\"@b"@example.com`, `"a\"@b"`, "example.com"},
+		{"source route", "<@relay.example,@hop.example:alice@example.com>", "alice@example.com", "alice", "example.com"},
+		{"comment", "alice(home)@example.com", "alice@example.com", "alice", "example.com"},
+		{"nested comment", "alice@(x(y@evil.example))example.com", "alice@example.com", "alice", "example.com"},
+		{"comment outside brackets", " <alice@example.com> (bounce)", "alice@example.com", "alice", "example.com"},
+		{"parens quoted", `"a(b)"@example.com`, `"a(b)"@example.com`, `"a(b)"`, "example.com"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.clean, Clean(c.sender))
+			assert.Equal(t, c.local, LocalPart(c.sender))
+			d, ok := Domain(c.sender)
+			assert.True(t, ok)
+			assert.Equal(t, c.domain, d)
+			assert.Equal(t, c.clean, Normalize(c.sender, "", "example.org"))
+		})
+	}
+
+	_, ok := Domain("example.com")
+	assert.False(t, ok)
+}
+
+func TestInternational(t *testing.T) {
+	assert.False(t, International("alice@example.com"))
+	assert.True(t, International("jürgen@example.com"))
+	assert.True(t, International("alice@bücher.example"))
+}
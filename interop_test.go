@@ -0,0 +1,179 @@
+//go:build interop
+
+// Interoperability harness comparing verdicts with reference
+// implementations.  It evaluates testdata/interop/corpus.txt against live
+// DNS with go-spf and with libspf2's spfquery and pyspf, whichever are
+// installed, and reports every divergence:
+//
+//	go test -tags interop -run Interop -v .
+//
+// SPFQUERY and PYTHON override the commands used.  With INTEROP_REPORT set
+// to a path the report is also written there, so divergence can be tracked
+// as features land.  Divergences are reported, not failed: the reference
+// implementations have their own bugs.
+
+package spf
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+// interopCase is one line of the corpus.
+type interopCase struct {
+	ip, sender, helo string
+}
+
+func (c interopCase) String() string {
+	return strings.TrimSpace(c.ip + " " + c.sender + " " + c.helo)
+}
+
+// reference is an implementation to compare with.
+type reference struct {
+	name  string
+	check func(ctx context.Context, c interopCase) (Result, error)
+}
+
+func readInteropCorpus(t *testing.T) []interopCase {
+	f, err := os.Open("testdata/interop/corpus.txt")
+	require.NoError(t, err)
+	defer f.Close()
+	var out []interopCase
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		require.GreaterOrEqual(t, len(fields), 2, "corpus line %q", line)
+		c := interopCase{ip: fields[0], sender: fields[1]}
+		if len(fields) > 2 {
+			c.helo = fields[2]
+		}
+		out = append(out, c)
+	}
+	require.NoError(t, sc.Err())
+	return out
+}
+
+// interopReferences returns the installed reference implementations.
+func interopReferences() []reference {
+	var refs []reference
+	if path, err := exec.LookPath(cmp.Or(os.Getenv("SPFQUERY"), "spfquery")); err == nil {
+		refs = append(refs, reference{name: "libspf2", check: func(ctx context.Context, c interopCase) (Result, error) {
+			args := []string{"-ip", c.ip, "-sender", nullSender(c.sender)}
+			if c.helo != "" {
+				args = append(args, "-helo", c.helo)
+			}
+			// spfquery exits non-zero for every result but pass; the
+			// verdict is the first line of its output
+			out, _ := exec.CommandContext(ctx, path, args...).Output()
+			return referenceResult(out)
+		}})
+	}
+	python := cmp.Or(os.Getenv("PYTHON"), "python3")
+	if path, err := exec.LookPath(python); err == nil && exec.Command(path, "-c", "import spf").Run() == nil {
+		refs = append(refs, reference{name: "pyspf", check: func(ctx context.Context, c interopCase) (Result, error) {
+			script := "import spf, sys; print(spf.check2(i=sys.argv[1], s=sys.argv[2], h=sys.argv[3])[0])"
+			out, err := exec.CommandContext(ctx, path, "-c", script, c.ip, nullSender(c.sender), c.helo).Output()
+			if err != nil {
+				return "", err
+			}
+			return referenceResult(out)
+		}})
+	}
+	return refs
+}
+
+// nullSender maps the corpus spelling of the null reverse-path to the empty
+// sender the references expect.
+func nullSender(sender string) string {
+	if sender == "<>" {
+		return ""
+	}
+	return sender
+}
+
+// referenceResult reads the verdict from the first line of out.  libspf2
+// reports an error as "error" in older releases.
+func referenceResult(out []byte) (Result, error) {
+	line, _, _ := bytes.Cut(bytes.TrimSpace(out), []byte("\n"))
+	word := strings.ToLower(strings.TrimSpace(string(line)))
+	switch r := Result(word); r {
+	case None, Neutral, Pass, Fail, SoftFail, TempError, PermError:
+		return r, nil
+	case "error":
+		return TempError, nil
+	}
+	return "", fmt.Errorf("unrecognized verdict %q", line)
+}
+
+func TestInteropReferenceImplementations(t *testing.T) {
+	refs := interopReferences()
+	if len(refs) == 0 {
+		t.Skip("neither spfquery nor pyspf is installed")
+	}
+	ch := NewChecker(dns.NewDNSResolver())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := ch.Resolver.LookupTXT(ctx, "gmail.com"); err != nil {
+		t.Skipf("no working DNS: %v", err)
+	}
+
+	var report bytes.Buffer
+	tw := tabwriter.NewWriter(&report, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "check\tgo-spf")
+	for _, ref := range refs {
+		fmt.Fprint(tw, "\t"+ref.name)
+	}
+	fmt.Fprintln(tw, "\tdiverges")
+
+	cases := readInteropCorpus(t)
+	divergent := 0
+	for _, c := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		res, err := ch.Check(ctx, Request{IP: net.ParseIP(c.ip), MailFrom: c.sender, HELODomain: c.helo})
+		require.NoError(t, err, c.String())
+		code := cmp.Or(res.Code, None)
+
+		row := []string{c.String(), string(code)}
+		diverges := false
+		for _, ref := range refs {
+			got, err := ref.check(ctx, c)
+			if err != nil {
+				row = append(row, "error: "+err.Error())
+				diverges = true
+				continue
+			}
+			row = append(row, string(got))
+			diverges = diverges || got != code
+		}
+		cancel()
+		if diverges {
+			divergent++
+			t.Logf("divergence for %s: %v", c, row[1:])
+		}
+		fmt.Fprintf(tw, "%s\t%t\n", strings.Join(row, "\t"), diverges)
+	}
+	require.NoError(t, tw.Flush())
+	fmt.Fprintf(&report, "\n%d of %d checks diverge\n", divergent, len(cases))
+
+	t.Log("\n" + report.String())
+	if path := os.Getenv("INTEROP_REPORT"); path != "" {
+		require.NoError(t, os.WriteFile(path, report.Bytes(), 0o644))
+	}
+}
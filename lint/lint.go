@@ -0,0 +1,194 @@
+// Package lint reports constructs in SPF records that parse and evaluate
+// correctly but are almost certainly mistakes or operational risks.  RFC 7208
+// does not forbid them, so the checks live here rather than in the parser.
+package lint
+
+import (
+	"fmt"
+
+	"github.com/t0gun/go-spf/macro"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Severity grades a Finding.
+type Severity string
+
+const (
+	Warning Severity = "warning" // risky but sometimes intended
+	Error   Severity = "error"   // defeats the purpose of the record
+)
+
+// Rule identifiers.  They are stable so tooling can filter on them.
+const (
+	RuleCIDRZero  = "cidr-zero"  // +ip4:0.0.0.0/0, +ip6::/0 or +a/0 - equivalent to +all
+	RuleCIDRBroad = "cidr-broad" // mask broader than the configured threshold
+	RulePTR       = "ptr"        // ptr mechanism, deprecated by RFC 7208 section 5.5
+	RulePassAll   = "pass-all"   // +all, authorizes every host
+	RulePTRMacro  = "ptr-macro"  // %{p} macro, the outcome depends on reverse DNS
+
+	RuleDuplicateRecord = "duplicate-record" // the same record published more than once
+)
+
+// Default thresholds for RuleCIDRBroad.
+const (
+	DefaultMinPrefix4 = 16
+	DefaultMinPrefix6 = 32
+)
+
+// Finding is one problem found in a record.
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Term     string // offending term in canonical form, empty for tree checks
+	Message  string
+}
+
+// Config tunes the checks.  The zero value selects the defaults.
+type Config struct {
+	MinPrefix4 int // ip4 masks shorter than this are too broad
+	MinPrefix6 int // ip6 masks shorter than this are too broad
+
+	// MaxThirdParty is the number of third-party domains a record tree may
+	// reference before Tree reports it.
+	MaxThirdParty int
+}
+
+func (c Config) min4() int {
+	if c.MinPrefix4 == 0 {
+		return DefaultMinPrefix4
+	}
+	return c.MinPrefix4
+}
+
+func (c Config) min6() int {
+	if c.MinPrefix6 == 0 {
+		return DefaultMinPrefix6
+	}
+	return c.MinPrefix6
+}
+
+// Record runs every check against rec and returns the findings in term
+// order.
+func Record(rec *parser.Record, cfg Config) []Finding {
+	var out []Finding
+	for _, m := range rec.Mechs {
+		out = append(out, Term(m, cfg)...)
+	}
+	if r := rec.Redirect; r != nil && r.Macro && macro.UsesLetter(r.Value, 'p') {
+		out = append(out, ptrMacro(r.String()))
+	}
+	return out
+}
+
+// Term runs every check against the single term m.  Checkers use it to
+// report problems with the terms an evaluation actually exercised.
+func Term(m parser.Mechanism, cfg Config) []Finding {
+	return append(cidr(m, cfg), deprecated(m)...)
+}
+
+// BroadCIDR reports whether m authorizes a network wider than cfg allows,
+// including the /0 case.  Only pass terms authorize: a broad -ip4 is a
+// legitimate deny and a broad ~ or ? term asserts nothing.  Checkers use it
+// for strict evaluation.
+func BroadCIDR(m parser.Mechanism, cfg Config) bool {
+	return passes(m) && len(cidr(m, cfg)) > 0
+}
+
+// passes reports whether m has the pass qualifier, explicit or implied.
+func passes(m parser.Mechanism) bool {
+	return m.Qual == parser.QPlus || m.Qual == 0
+}
+
+// deprecated flags ptr, which RFC 7208 says SHOULD NOT be published, and
+// +all, which turns the record into an open relay for the domain.
+func deprecated(m parser.Mechanism) []Finding {
+	switch {
+	case m.Kind == "ptr":
+		return []Finding{{
+			Rule:     RulePTR,
+			Severity: Warning,
+			Term:     m.String(),
+			Message:  "ptr is slow and unreliable and should not be used (RFC 7208 section 5.5)",
+		}}
+	case m.Kind == "all" && m.Qual == parser.QPlus:
+		return []Finding{{
+			Rule:     RulePassAll,
+			Severity: Error,
+			Term:     m.String(),
+			Message:  "+all authorizes every host on the internet to send for the domain",
+		}}
+	case m.Macro && macro.UsesLetter(m.Domain, 'p'):
+		return []Finding{ptrMacro(m.String())}
+	}
+	return nil
+}
+
+// ptrMacro reports a %{p} macro in term, which has the costs of ptr.
+func ptrMacro(term string) Finding {
+	return Finding{
+		Rule:     RulePTRMacro,
+		Severity: Warning,
+		Term:     term,
+		Message:  "the %{p} macro makes the outcome depend on reverse DNS and should not be used (RFC 7208 section 7.3)",
+	}
+}
+
+// cidr checks the network masks of ip4, ip6, a and mx terms.  A pass term
+// with a /0 mask is equivalent to +all; for softfail and neutral terms a
+// broad mask, /0 included, is only a warning, and fail terms are not
+// checked since denying a broad network is legitimate.
+func cidr(m parser.Mechanism, cfg Config) []Finding {
+	if m.Qual == parser.QMinus {
+		return nil
+	}
+	v4, v6 := prefixes(m)
+	var out []Finding
+	check := func(bits, min int, family string) {
+		switch {
+		case bits < 0:
+		case bits == 0 && !passes(m):
+			out = append(out, Finding{
+				Rule:     RuleCIDRBroad,
+				Severity: Warning,
+				Term:     m.String(),
+				Message:  fmt.Sprintf("%s /0 matches every %s address", m.Kind, family),
+			})
+		case bits == 0:
+			out = append(out, Finding{
+				Rule:     RuleCIDRZero,
+				Severity: Error,
+				Term:     m.String(),
+				Message:  fmt.Sprintf("%s /0 matches every %s address, equivalent to +all", m.Kind, family),
+			})
+		case bits < min:
+			out = append(out, Finding{
+				Rule:     RuleCIDRBroad,
+				Severity: Warning,
+				Term:     m.String(),
+				Message:  fmt.Sprintf("%s /%d is broader than /%d", m.Kind, bits, min),
+			})
+		}
+	}
+	check(v4, cfg.min4(), "IPv4")
+	check(v6, cfg.min6(), "IPv6")
+	return out
+}
+
+// prefixes returns the IPv4 and IPv6 mask lengths m applies, -1 when it has
+// none for that family.
+func prefixes(m parser.Mechanism) (v4, v6 int) {
+	switch m.Kind {
+	case "ip4", "ip6":
+		if m.Net == nil {
+			return -1, -1
+		}
+		ones, bits := m.Net.Mask.Size()
+		if bits == 32 {
+			return ones, -1
+		}
+		return -1, ones
+	case "a", "mx":
+		return m.Mask4, m.Mask6
+	}
+	return -1, -1
+}
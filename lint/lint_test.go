@@ -0,0 +1,109 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestRecordCIDR(t *testing.T) {
+	tc := []struct {
+		name  string
+		spf   string
+		cfg   Config
+		rules []string
+	}{
+		{"clean", "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/48 a mx -all", Config{}, nil},
+		{"ip4 zero", "v=spf1 ip4:0.0.0.0/0 -all", Config{}, []string{RuleCIDRZero}},
+		{"ip6 zero", "v=spf1 ip6:::/0 -all", Config{}, []string{RuleCIDRZero}},
+		{"a zero", "v=spf1 a/0 -all", Config{}, []string{RuleCIDRZero}},
+		{"mx zero v6", "v=spf1 mx//0 -all", Config{}, []string{RuleCIDRZero}},
+		{"ip4 broad", "v=spf1 ip4:10.0.0.0/8 -all", Config{}, []string{RuleCIDRBroad}},
+		{"ip4 at threshold", "v=spf1 ip4:10.0.0.0/16 -all", Config{}, nil},
+		{"ip6 broad", "v=spf1 ip6:2001::/16 -all", Config{}, []string{RuleCIDRBroad}},
+		{"custom threshold", "v=spf1 ip4:10.0.0.0/16 -all", Config{MinPrefix4: 20}, []string{RuleCIDRBroad}},
+		{"several", "v=spf1 ip4:0.0.0.0/0 a/8 -all", Config{}, []string{RuleCIDRZero, RuleCIDRBroad}},
+		{"fail zero", "v=spf1 -ip4:0.0.0.0/0 +all", Config{}, []string{RulePassAll}},
+		{"fail broad", "v=spf1 -ip4:10.0.0.0/8 -ip6:::/0 mx -all", Config{}, nil},
+		{"softfail zero", "v=spf1 ~ip4:0.0.0.0/0", Config{}, []string{RuleCIDRBroad}},
+		{"neutral broad", "v=spf1 ?a/8 -all", Config{}, []string{RuleCIDRBroad}},
+		{"ptr", "v=spf1 ptr:example.com -all", Config{}, []string{RulePTR}},
+		{"pass all", "v=spf1 mx +all", Config{}, []string{RulePassAll}},
+		{"implicit pass all", "v=spf1 all", Config{}, []string{RulePassAll}},
+		{"neutral all", "v=spf1 ?all", Config{}, nil},
+		{"p macro", "v=spf1 exists:%{p}.allow.example -all", Config{}, []string{RulePTRMacro}},
+		{"p macro in redirect", "v=spf1 redirect=%{p2}._spf.example", Config{}, []string{RulePTRMacro}},
+		{"other macros", "v=spf1 exists:%{ir}.%{l}.allow.example -all", Config{}, nil},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			rec, err := parser.Parse(c.spf)
+			require.NoError(t, err)
+			var rules []string
+			for _, f := range Record(rec, c.cfg) {
+				rules = append(rules, f.Rule)
+				assert.NotEmpty(t, f.Term)
+				assert.NotEmpty(t, f.Message)
+			}
+			assert.Equal(t, c.rules, rules)
+		})
+	}
+}
+
+func TestBroadCIDR(t *testing.T) {
+	rec, err := parser.Parse("v=spf1 ip4:192.0.2.0/24 ip4:0.0.0.0/0 include:example.com")
+	require.NoError(t, err)
+	assert.False(t, BroadCIDR(rec.Mechs[0], Config{}))
+	assert.True(t, BroadCIDR(rec.Mechs[1], Config{}))
+	assert.False(t, BroadCIDR(rec.Mechs[2], Config{}))
+
+	rec, err = parser.Parse("v=spf1 -ip4:0.0.0.0/0 ~ip4:10.0.0.0/8 ?ip6:::/0")
+	require.NoError(t, err)
+	for _, m := range rec.Mechs {
+		assert.False(t, BroadCIDR(m, Config{}), m.String())
+	}
+}
+
+func TestTree(t *testing.T) {
+	assert.Empty(t, Tree(TreeMetrics{ThirdPartyDomains: DefaultMaxThirdParty}, Config{}))
+	f := Tree(TreeMetrics{ThirdPartyDomains: DefaultMaxThirdParty + 1}, Config{})
+	require.Len(t, f, 1)
+	assert.Equal(t, RuleThirdPartyBreadth, f[0].Rule)
+	assert.Equal(t, Warning, f[0].Severity)
+	assert.Len(t, Tree(TreeMetrics{ThirdPartyDomains: 2}, Config{MaxThirdParty: 1}), 1)
+}
+
+func TestTXTStrings(t *testing.T) {
+	tc := []struct {
+		name string
+		strs []string
+		rule string
+		want Severity
+	}{
+		{"single string", []string{"v=spf1 -all"}, "", ""},
+		{"tag alone then space", []string{"v=spf1", " ip4:192.0.2.0/24 -all"}, "", ""},
+		{"mixed case tag alone", []string{"V=SPF1", " -all"}, "", ""},
+		{"split at term boundary", []string{"v=spf1 ip4:192.0.2.0/24 ", "-all"}, "", ""},
+		{"tag glued to next term", []string{"v=spf1", "ip4:192.0.2.0/24 -all"}, RuleSplitVersion, Error},
+		{"tag cut in two", []string{"v=sp", "f1 -all"}, RuleSplitVersion, Warning},
+		{"tag cut before digit", []string{"v=spf", "1 -all"}, RuleSplitVersion, Warning},
+		{"not spf", []string{"google-site-", "verification=abc"}, "", ""},
+		{"empty first string", []string{"", "v=spf1 -all"}, RuleVersionPrefix, Warning},
+		{"blank first string", []string{" ", "V=spf1 -all"}, RuleVersionPrefix, Warning},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			f := TXTStrings(c.strs)
+			if c.want == "" {
+				assert.Empty(t, f)
+				return
+			}
+			require.Len(t, f, 1)
+			assert.Equal(t, c.rule, f[0].Rule)
+			assert.Equal(t, c.want, f[0].Severity)
+		})
+	}
+}
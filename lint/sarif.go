@@ -0,0 +1,177 @@
+package lint
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Target is one record checked in a lint run, with where it is stored so
+// code review tools can annotate the right place.
+type Target struct {
+	URI      string // path of the file holding the record, e.g. zones/example.com.yaml
+	Line     int    // 1-based line of the record text in the file, 1 if zero
+	Column   int    // 1-based column where the record text starts, 1 if zero
+	Record   string
+	Findings []Finding
+}
+
+// ExitCode returns 1 when any finding is at or above threshold and 0
+// otherwise, the convention CI runners such as GitHub Actions use to fail a
+// step.  An empty threshold means Error.
+func ExitCode(findings []Finding, threshold Severity) int {
+	if threshold == "" {
+		threshold = Error
+	}
+	for _, f := range findings {
+		if f.Severity.rank() >= threshold.rank() {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (s Severity) rank() int {
+	if s == Error {
+		return 2
+	}
+	return 1
+}
+
+// WriteSARIF writes the findings of targets as a SARIF 2.1.0 log, which
+// GitHub code scanning and other review tools show as inline annotations.
+// Findings with a Term are located at that term within the record; tree
+// findings cover the whole record.
+func WriteSARIF(w io.Writer, targets []Target) error {
+	var results []sarifResult
+	seen := map[string]bool{}
+	var rules []sarifRule
+	for _, t := range targets {
+		for _, f := range t.Findings {
+			if !seen[f.Rule] {
+				seen[f.Rule] = true
+				rules = append(rules, sarifRule{ID: f.Rule})
+			}
+			start, end := locate(t.Record, f.Term)
+			line, col := t.Line, t.Column
+			if line == 0 {
+				line = 1
+			}
+			if col == 0 {
+				col = 1
+			}
+			results = append(results, sarifResult{
+				RuleID:  f.Rule,
+				Level:   sarifLevel(f.Severity),
+				Message: sarifText{Text: f.Message},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysical{
+					ArtifactLocation: sarifArtifact{URI: t.URI},
+					Region:           sarifRegion{StartLine: line, StartColumn: col + start, EndColumn: col + end},
+				}}},
+			})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "spflint", InformationURI: "https://github.com/t0gun/go-spf", Rules: rules}},
+			Results: results,
+		}},
+	}
+	if log.Runs[0].Results == nil {
+		log.Runs[0].Results = []sarifResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// locate returns the byte range of the term of record whose canonical form
+// is term, or the whole record when term is empty or not found.
+func locate(record, term string) (start, end int) {
+	terms, err := parser.Tokenize(record)
+	if term == "" || err != nil {
+		return 0, len(record)
+	}
+	for _, t := range terms {
+		if t.Kind != parser.TermMechanism {
+			continue
+		}
+		// records are matched as served and as the checker lower-cases them
+		for _, text := range []string{t.Text, strings.ToLower(t.Text)} {
+			rec, err := parser.Parse("v=spf1 " + text)
+			if err == nil && len(rec.Mechs) == 1 && rec.Mechs[0].String() == term {
+				return t.Start, t.End
+			}
+		}
+	}
+	return 0, len(record)
+}
+
+func sarifLevel(s Severity) string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysical `json:"physicalLocation"`
+}
+
+type sarifPhysical struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn"`
+}
@@ -0,0 +1,69 @@
+package lint
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestExitCode(t *testing.T) {
+	warn := []Finding{{Rule: RulePTR, Severity: Warning}}
+	fail := []Finding{{Rule: RulePassAll, Severity: Error}}
+
+	assert.Equal(t, 0, ExitCode(nil, Warning))
+	assert.Equal(t, 0, ExitCode(warn, ""))
+	assert.Equal(t, 0, ExitCode(warn, Error))
+	assert.Equal(t, 1, ExitCode(warn, Warning))
+	assert.Equal(t, 1, ExitCode(fail, Error))
+	assert.Equal(t, 1, ExitCode(fail, Warning))
+}
+
+func TestWriteSARIF(t *testing.T) {
+	record := "v=spf1 +a  PTR ip4:0.0.0.0/0 -all"
+	rec, err := parser.Parse(strings.ToLower(record))
+	require.NoError(t, err)
+	findings := append(Record(rec, Config{}), Tree(TreeMetrics{ThirdPartyDomains: 9}, Config{})...)
+	require.Len(t, findings, 3)
+
+	var b strings.Builder
+	require.NoError(t, WriteSARIF(&b, []Target{{URI: "zones/example.com.yaml", Line: 4, Column: 12, Record: record, Findings: findings}}))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal([]byte(b.String()), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	run := log.Runs[0]
+	assert.Equal(t, "spflint", run.Tool.Driver.Name)
+	assert.Equal(t, []sarifRule{{ID: RuleCIDRZero}, {ID: RulePTR}, {ID: RuleThirdPartyBreadth}}, run.Tool.Driver.Rules)
+
+	require.Len(t, run.Results, 3)
+	regions := map[string]sarifRegion{}
+	for _, r := range run.Results {
+		regions[r.RuleID] = r.Locations[0].PhysicalLocation.Region
+		assert.Equal(t, "zones/example.com.yaml", r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+	// PTR starts at byte 11 of the record, column 12 of line 4
+	assert.Equal(t, sarifRegion{StartLine: 4, StartColumn: 23, EndColumn: 26}, regions[RulePTR])
+	assert.Equal(t, sarifRegion{StartLine: 4, StartColumn: 27, EndColumn: 40}, regions[RuleCIDRZero])
+	assert.Equal(t, sarifRegion{StartLine: 4, StartColumn: 12, EndColumn: 12 + len(record)}, regions[RuleThirdPartyBreadth])
+	assert.Equal(t, "error", levelOf(run.Results, RuleCIDRZero))
+	assert.Equal(t, "warning", levelOf(run.Results, RulePTR))
+}
+
+func TestWriteSARIFEmpty(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteSARIF(&b, nil))
+	assert.Contains(t, b.String(), `"results": []`)
+}
+
+func levelOf(rs []sarifResult, rule string) string {
+	for _, r := range rs {
+		if r.RuleID == rule {
+			return r.Level
+		}
+	}
+	return ""
+}
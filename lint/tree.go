@@ -0,0 +1,39 @@
+package lint
+
+import "fmt"
+
+// RuleThirdPartyBreadth flags a record tree that delegates to more
+// third-party domains than the configured threshold.  Every such domain can
+// authorize senders for the root, so breadth is supply-chain exposure.
+const RuleThirdPartyBreadth = "third-party-breadth"
+
+// DefaultMaxThirdParty is the default threshold for RuleThirdPartyBreadth.
+const DefaultMaxThirdParty = 5
+
+// TreeMetrics describe a record together with everything it includes or
+// redirects to.  spf.RecordGraph.Metrics computes them.
+type TreeMetrics struct {
+	MaxIncludeDepth   int // deepest include nesting below the root record
+	Domains           int // distinct domains referenced, the root included
+	ThirdPartyDomains int // referenced domains outside the root's organization
+	CIDRs             int // distinct networks once the tree is flattened
+}
+
+func (c Config) maxThirdParty() int {
+	if c.MaxThirdParty == 0 {
+		return DefaultMaxThirdParty
+	}
+	return c.MaxThirdParty
+}
+
+// Tree runs the checks that need the whole record tree.
+func Tree(m TreeMetrics, cfg Config) []Finding {
+	if limit := cfg.maxThirdParty(); m.ThirdPartyDomains > limit {
+		return []Finding{{
+			Rule:     RuleThirdPartyBreadth,
+			Severity: Warning,
+			Message:  fmt.Sprintf("%d third-party domains can authorize senders, more than %d", m.ThirdPartyDomains, limit),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RuleSplitVersion flags a TXT RR whose "v=spf1" version tag is divided
+// awkwardly between its character-strings.
+const RuleSplitVersion = "split-version"
+
+// RuleVersionPrefix flags a TXT RR whose version tag only starts after an
+// empty first character-string.
+const RuleVersionPrefix = "version-prefix"
+
+const versionTag = "v=spf1"
+
+// TXTStrings checks how the character-strings of one TXT RR carry the
+// version tag.  RFC 7208 section 3.3 joins them without separators, so a
+// publisher who puts "v=spf1" alone in the first string must start the next
+// one with a space; otherwise the RR reads "v=spf1ip4:..." and is not an SPF
+// record at all.  A tag cut in two ("v=sp" "f1 ...") still works but breaks
+// tools that look at the first string only, and is reported as a warning.
+// An empty or blank first string in front of "v=spf1" is a malformed
+// prefix: the joined RR is a record, but readers of the first string see
+// none.  RRs that are not SPF records in either reading produce no findings.
+func TXTStrings(strs []string) []Finding {
+	if len(strs) < 2 {
+		return nil
+	}
+	joined := strings.TrimLeftFunc(strings.Join(strs, ""), unicode.IsSpace)
+	first := strings.TrimLeftFunc(strs[0], unicode.IsSpace)
+
+	if strings.EqualFold(first, versionTag) && !hasVersion(joined) {
+		return []Finding{{
+			Rule:     RuleSplitVersion,
+			Severity: Error,
+			Message: fmt.Sprintf("first string %q is joined to %q without a space, so the record is not recognized as SPF",
+				strs[0], strs[1]),
+		}}
+	}
+	if hasVersion(joined) && first == "" {
+		return []Finding{{
+			Rule:     RuleVersionPrefix,
+			Severity: Warning,
+			Message:  fmt.Sprintf("first string %q is empty; start the first string with v=spf1", strs[0]),
+		}}
+	}
+	if hasVersion(joined) && len(first) < len(versionTag) {
+		return []Finding{{
+			Rule:     RuleSplitVersion,
+			Severity: Warning,
+			Message:  "the v=spf1 version tag is split across character-strings; keep it whole in the first string",
+		}}
+	}
+	return nil
+}
+
+// hasVersion reports whether s starts with the version tag as a whole term.
+func hasVersion(s string) bool {
+	if len(s) < len(versionTag) || !strings.EqualFold(s[:len(versionTag)], versionTag) {
+		return false
+	}
+	if len(s) == len(versionTag) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s[len(versionTag):])
+	return unicode.IsSpace(r)
+}
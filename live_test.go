@@ -0,0 +1,61 @@
+//go:build net
+
+// Live tests against well-known published policies.  They need working DNS
+// and are opt-in: go test -tags net -run Live .
+
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestLiveWellKnownDomains(t *testing.T) {
+	// TEST-NET-1 is never authorized by anyone
+	stranger := "192.0.2.1"
+	notPass := []Result{Fail, SoftFail, Neutral}
+
+	cases := []struct {
+		name   string
+		domain string
+		ip     string
+		want   []Result
+	}{
+		// gmail.com redirects to _spf.google.com, which includes the netblocks
+		{"gmail sender", "gmail.com", "209.85.220.41", []Result{Pass}},
+		{"gmail stranger", "gmail.com", stranger, notPass},
+		// outlook.com includes spf.protection.outlook.com
+		{"outlook sender", "outlook.com", "40.92.0.1", []Result{Pass}},
+		{"outlook stranger", "outlook.com", stranger, notPass},
+		// amazonses.com lists its ranges directly
+		{"amazonses sender", "amazonses.com", "54.240.0.1", []Result{Pass}},
+		{"amazonses stranger", "amazonses.com", stranger, notPass},
+	}
+
+	ch := NewChecker(dns.NewDNSResolver())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := ch.Resolver.LookupTXT(ctx, "gmail.com"); err != nil {
+		t.Skipf("no working DNS: %v", err)
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			res, err := ch.Check(ctx, Request{IP: net.ParseIP(tc.ip), MailFrom: "postmaster@" + tc.domain})
+			require.NoError(t, err)
+			if res.Code == TempError {
+				t.Skipf("resolver unavailable: %v", res.Cause)
+			}
+			assert.Contains(t, tc.want, res.Code, "cause: %v, trace: %+v", res.Cause, res.Trace)
+			assert.NotEmpty(t, res.Chain)
+		})
+	}
+}
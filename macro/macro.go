@@ -0,0 +1,370 @@
+// Package macro expands the SPF macro language defined in RFC 7208 section 7.
+// Expansion is pure string processing; the caller supplies every input value
+// through Vars and performs any DNS work itself.
+package macro
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/t0gun/go-spf/internal/mailaddr"
+)
+
+// Errors returned by Expand.  RFC 7208 section 7.1 treats any syntax error in
+// a macro-string as a permerror.
+var (
+	ErrSyntax       = errors.New("macro syntax error")
+	ErrUnknownMacro = errors.New("unknown macro letter")
+	ErrExpOnly      = errors.New("macro letter only allowed in exp text")
+)
+
+// Errors returned by Vars.Validate.
+var (
+	ErrNoDomain  = errors.New("macro vars: no domain")
+	ErrNoIP      = errors.New("macro vars: no valid client IP")
+	ErrBadSender = errors.New("macro vars: sender has no domain")
+	ErrLocalPart = errors.New("macro vars: local part does not match sender")
+)
+
+// Letters lists the macro letters accepted in a domain-spec and
+// ExplanationLetters the ones accepted only in exp text (RFC 7208 section
+// 7.2).  Upper-case forms of each are also accepted.
+const (
+	Letters            = "slodipvh"
+	ExplanationLetters = "crt"
+)
+
+// maxDomainLen is the longest expanded domain-spec allowed by RFC 7208
+// section 7.3 before left-hand labels are dropped.
+const maxDomainLen = 253
+
+// Vars holds the values macro letters expand to (RFC 7208 section 7.2).
+type Vars struct {
+	Sender    string    // %{s} full sender identity, e.g. alice@example.com
+	LocalPart string    // %{l} local part of Sender
+	Domain    string    // %{d} current domain being evaluated
+	IP        net.IP    // %{i} and %{v} connecting client address
+	HELO      string    // %{h} HELO/EHLO domain
+	Receiver  string    // %{r} hostname of the receiving MTA, exp only
+	Timestamp time.Time // %{t} time of the check, exp only
+
+	// ClientHostname is the %{p} value: a hostname of IP the caller has
+	// already validated with a PTR lookup and forward confirmation.  Empty
+	// expands to "unknown".
+	ClientHostname string
+}
+
+// WithDefaults returns v with the values RFC 7208 derives from the others
+// filled in.  Sender is normalized as check_host does: a null sender becomes
+// postmaster@HELO (or postmaster@Domain without a HELO name, section 2.4)
+// and a bare domain gets the local part "postmaster" (section 4.3).  An
+// empty LocalPart is taken from Sender and an IPv4-mapped IP is reduced to
+// its four-byte form so %{v} and %{i} render it as IPv4.  Receiver,
+// Timestamp and ClientHostname are left alone; they already expand to
+// "unknown" or "0" when unset.
+func (v Vars) WithDefaults() Vars {
+	if v.Sender != "" || v.HELO != "" || v.Domain != "" {
+		v.Sender = mailaddr.Normalize(v.Sender, v.HELO, v.Domain)
+	}
+	if v.LocalPart == "" && v.Sender != "" {
+		v.LocalPart = mailaddr.LocalPart(v.Sender)
+	}
+	if ip4 := v.IP.To4(); ip4 != nil {
+		v.IP = ip4
+	}
+	return v
+}
+
+// Validate reports every input missing or inconsistent for expansion: an
+// empty Domain, an IP that is neither IPv4 nor IPv6, a Sender without a
+// domain part and a LocalPart that differs from the one in Sender.  Call it
+// on the result of WithDefaults to accept a null or bare-domain sender.
+// The errors are joined and each matches one of the ErrNo... or ErrBad...
+// sentinels with errors.Is.
+func (v Vars) Validate() error {
+	var errs []error
+	if v.Domain == "" {
+		errs = append(errs, ErrNoDomain)
+	}
+	if v.IP.To16() == nil {
+		errs = append(errs, ErrNoIP)
+	}
+	if d, ok := mailaddr.Domain(strings.Trim(v.Sender, "<>")); !ok || d == "" {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrBadSender, v.Sender))
+	} else if v.LocalPart != "" && v.LocalPart != mailaddr.LocalPart(v.Sender) {
+		errs = append(errs, fmt.Errorf("%w: %q in %q", ErrLocalPart, v.LocalPart, v.Sender))
+	}
+	return errors.Join(errs...)
+}
+
+// senderDomain returns the %{o} value, the domain part of Sender.
+func (v Vars) senderDomain() string {
+	if at := strings.LastIndexByte(v.Sender, '@'); at >= 0 {
+		return v.Sender[at+1:]
+	}
+	return v.Sender
+}
+
+// Expand expands every macro in spec and returns the resulting string.  It
+// is used for domain-spec values (mechanism targets and redirect), so the
+// result is shortened to 253 octets by removing left-hand labels as required
+// by RFC 7208 section 7.3.
+func Expand(spec string, v Vars) (string, error) {
+	out, err := expand(spec, v, false)
+	if err != nil {
+		return "", err
+	}
+	return truncateDomain(out), nil
+}
+
+// ExpandExplanation expands the TXT string fetched for an exp= modifier.  In
+// addition to the domain-spec letters it accepts %{c}, %{r} and %{t}, which
+// RFC 7208 section 7.2 restricts to explanation text.
+func ExpandExplanation(spec string, v Vars) (string, error) {
+	return expand(spec, v, true)
+}
+
+// HasMacro reports whether s contains macro syntax.
+func HasMacro(s string) bool {
+	return strings.ContainsRune(s, '%')
+}
+
+// UsesLetter reports whether spec contains a %{...} macro of letter, in
+// either case.  Escaped percent signs ("%%") are skipped.
+func UsesLetter(spec string, letter byte) bool {
+	letter = lower(letter)
+	for i := 0; i+2 < len(spec); i++ {
+		if spec[i] != '%' {
+			continue
+		}
+		if spec[i+1] == '{' && lower(spec[i+2]) == letter {
+			return true
+		}
+		i++ // skip the character after %, which may itself be %
+	}
+	return false
+}
+
+// expand walks spec once, copying literals and replacing macro-expand terms.
+//
+//	macro-expand = ( "%{" macro-letter transformers *delimiter "}" )
+//	               / "%%" / "%_" / "%-"
+func expand(spec string, v Vars, exp bool) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		ch := spec[i]
+		if ch != '%' {
+			b.WriteByte(ch)
+			continue
+		}
+		if i+1 >= len(spec) {
+			return "", fmt.Errorf("%w: trailing %%", ErrSyntax)
+		}
+		i++
+		switch spec[i] {
+		case '%':
+			b.WriteByte('%')
+		case '_':
+			b.WriteByte(' ')
+		case '-':
+			b.WriteString("%20")
+		case '{':
+			end := strings.IndexByte(spec[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("%w: unterminated macro", ErrSyntax)
+			}
+			val, err := expandTerm(spec[i+1:i+end], v, exp)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(val)
+			i += end
+		default:
+			return "", fmt.Errorf("%w: %%%c", ErrSyntax, spec[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// expandTerm expands the body of one %{...} term: a macro letter followed by
+// optional transformers and delimiters.
+func expandTerm(term string, v Vars, exp bool) (string, error) {
+	if term == "" {
+		return "", fmt.Errorf("%w: empty macro", ErrSyntax)
+	}
+	letter := term[0]
+	escape := letter >= 'A' && letter <= 'Z'
+	val, err := letterValue(lower(letter), v, exp)
+	if err != nil {
+		return "", err
+	}
+
+	// transformers = *DIGIT [ "r" ]
+	rest := term[1:]
+	n := 0
+	for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+		n++
+	}
+	keep := 0
+	if n > 0 {
+		keep, err = strconv.Atoi(rest[:n])
+		if err != nil || keep == 0 {
+			return "", fmt.Errorf("%w: bad digit transformer %q", ErrSyntax, rest[:n])
+		}
+	}
+	rest = rest[n:]
+	reverse := false
+	if rest != "" && lower(rest[0]) == 'r' {
+		reverse = true
+		rest = rest[1:]
+	}
+
+	// delimiter = "." / "-" / "+" / "," / "/" / "_" / "="
+	delims := rest
+	for i := 0; i < len(delims); i++ {
+		if !strings.ContainsRune(".-+,/_=", rune(delims[i])) {
+			return "", fmt.Errorf("%w: bad delimiter %q", ErrSyntax, delims[i])
+		}
+	}
+	if delims == "" {
+		delims = "."
+	}
+
+	if keep > 0 || reverse || rest != "" {
+		parts := strings.FieldsFunc(val, func(r rune) bool {
+			return strings.ContainsRune(delims, r)
+		})
+		if reverse {
+			for l, r := 0, len(parts)-1; l < r; l, r = l+1, r-1 {
+				parts[l], parts[r] = parts[r], parts[l]
+			}
+		}
+		if keep > 0 && keep < len(parts) {
+			parts = parts[len(parts)-keep:]
+		}
+		val = strings.Join(parts, ".")
+	}
+
+	if escape {
+		val = urlEscape(val)
+	}
+	return val, nil
+}
+
+// letterValue returns the raw value of a lower-case macro letter.  The
+// explanation-only letters are rejected unless exp is set.
+func letterValue(letter byte, v Vars, exp bool) (string, error) {
+	switch letter {
+	case 'c', 'r', 't':
+		if !exp {
+			return "", fmt.Errorf("%w: %q", ErrExpOnly, letter)
+		}
+	}
+	switch letter {
+	case 's':
+		return v.Sender, nil
+	case 'l':
+		return v.LocalPart, nil
+	case 'o':
+		return v.senderDomain(), nil
+	case 'd':
+		return v.Domain, nil
+	case 'i':
+		return dottedIP(v.IP), nil
+	case 'p':
+		// RFC 7208 section 7.3 allows "unknown" when no validated name exists.
+		if v.ClientHostname == "" {
+			return "unknown", nil
+		}
+		return v.ClientHostname, nil
+	case 'v':
+		if v.IP.To4() != nil {
+			return "in-addr", nil
+		}
+		return "ip6", nil
+	case 'h':
+		return v.HELO, nil
+	case 'c':
+		return v.IP.String(), nil
+	case 'r':
+		// RFC 7208 section 7.3 uses "unknown" when the receiver has no name.
+		if v.Receiver == "" {
+			return "unknown", nil
+		}
+		return v.Receiver, nil
+	case 't':
+		if v.Timestamp.IsZero() {
+			return "0", nil
+		}
+		return strconv.FormatInt(v.Timestamp.Unix(), 10), nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownMacro, letter)
+	}
+}
+
+// dottedIP renders ip for %{i}: dotted quad for IPv4 and dot-separated
+// nibbles for IPv6 (RFC 7208 section 7.3).
+func dottedIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return ""
+	}
+	const hexDigits = "0123456789abcdef"
+	nibbles := make([]byte, 0, 63)
+	for i, b := range ip6 {
+		if i > 0 {
+			nibbles = append(nibbles, '.')
+		}
+		nibbles = append(nibbles, hexDigits[b>>4], '.', hexDigits[b&0x0f])
+	}
+	return string(nibbles)
+}
+
+// urlEscape percent-encodes every byte outside the RFC 3986 unreserved set,
+// as required for upper-case macro letters.
+func urlEscape(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0f])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// truncateDomain drops left-hand labels until s fits in 253 octets.
+func truncateDomain(s string) string {
+	for len(s) > maxDomainLen {
+		dot := strings.IndexByte(s, '.')
+		if dot < 0 {
+			return s
+		}
+		s = s[dot+1:]
+	}
+	return s
+}
@@ -0,0 +1,229 @@
+package macro
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	v := Vars{
+		Sender:    "strong-bad@email.example.com",
+		LocalPart: "strong-bad",
+		Domain:    "email.example.com",
+		IP:        net.ParseIP("192.0.2.3"),
+		HELO:      "mx.example.org",
+	}
+
+	tc := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"sender", "%{s}", "strong-bad@email.example.com"},
+		{"sender domain", "%{o}", "email.example.com"},
+		{"domain", "%{d}", "email.example.com"},
+		{"domain right 2", "%{d2}", "example.com"},
+		{"domain reversed", "%{dr}", "com.example.email"},
+		{"ip reversed", "%{ir}.%{v}._spf.%{d2}", "3.2.0.192.in-addr._spf.example.com"},
+		{"local part split", "%{l-}", "strong.bad"},
+		{"helo", "%{h}", "mx.example.org"},
+		{"helo right 2", "%{h2}._spf.example.com", "example.org._spf.example.com"},
+		{"escapes", "a%%b%_c%-d", "a%b c%20d"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Expand(c.spec, v)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestExpandIPv6(t *testing.T) {
+	v := Vars{IP: net.ParseIP("2001:db8::cb01")}
+	got, err := Expand("%{ir}.%{v}._spf.example.com", v)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com", got)
+}
+
+func TestExpandErrors(t *testing.T) {
+	tc := []struct {
+		name string
+		spec string
+		err  error
+	}{
+		{"trailing percent", "foo%", ErrSyntax},
+		{"unterminated", "%{d", ErrSyntax},
+		{"bad escape", "%x", ErrSyntax},
+		{"zero digit", "%{d0}", ErrSyntax},
+		{"bad delimiter", "%{d*}", ErrSyntax},
+		{"unknown letter", "%{z}", ErrUnknownMacro},
+		{"receiver outside exp", "%{r}", ErrExpOnly},
+		{"timestamp outside exp", "%{t}", ErrExpOnly},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Expand(c.spec, Vars{})
+			require.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestExpandTruncatesLongDomain(t *testing.T) {
+	label := strings.Repeat("a", 60)
+	v := Vars{Domain: strings.Join([]string{label, label, label, label, label}, ".")}
+	got, err := Expand("%{d}", v)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(got), maxDomainLen)
+	assert.True(t, strings.HasSuffix(v.Domain, got))
+}
+
+func TestExpandExplanation(t *testing.T) {
+	v := Vars{
+		Sender:    "strong-bad@email.example.com",
+		Domain:    "email.example.com",
+		IP:        net.ParseIP("192.0.2.3"),
+		Receiver:  "mx.receiver.example",
+		Timestamp: time.Unix(1700000000, 0),
+	}
+
+	tc := []struct {
+		name string
+		v    Vars
+		spec string
+		want string
+	}{
+		{"receiver", v, "checked by %{r}", "checked by mx.receiver.example"},
+		{"timestamp", v, "at %{t}", "at 1700000000"},
+		{"client ip", v, "%{c} is not one of %{d}'s designated mail servers.", "192.0.2.3 is not one of email.example.com's designated mail servers."},
+		{"unknown receiver", Vars{}, "%{r}", "unknown"},
+		{"unvalidated client name", Vars{}, "%{p}", "unknown"},
+		{"validated client name", Vars{ClientHostname: "mx1.example.net"}, "from %{p}", "from mx1.example.net"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ExpandExplanation(c.spec, c.v)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestLetters(t *testing.T) {
+	v := Vars{Sender: "strong-bad@email.example.com", Domain: "email.example.com", IP: net.ParseIP("192.0.2.3"), HELO: "mx.example.org"}
+	for _, l := range Letters {
+		_, err := Expand("%{"+string(l)+"}", v)
+		assert.NoError(t, err, "letter %c", l)
+	}
+	for _, l := range ExplanationLetters {
+		_, err := Expand("%{"+string(l)+"}", v)
+		assert.ErrorIs(t, err, ErrExpOnly, "letter %c", l)
+		_, err = ExpandExplanation("%{"+string(l)+"}", v)
+		assert.NoError(t, err, "letter %c", l)
+	}
+}
+
+func TestUsesLetter(t *testing.T) {
+	assert.True(t, UsesLetter("%{p}.example.com", 'p'))
+	assert.True(t, UsesLetter("%{P2r}._spf.%{d}", 'p'))
+	assert.True(t, UsesLetter("x.%{ir}.%{p}", 'P'))
+	assert.False(t, UsesLetter("%{ir}.example.com", 'p'))
+	assert.False(t, UsesLetter("%%{p}.example.com", 'p'), "escaped percent")
+	assert.False(t, UsesLetter("p.example.com", 'p'))
+}
+
+func TestRFCExamples(t *testing.T) {
+	for _, ex := range RFCExamples {
+		t.Run(ex.Section+" "+ex.Spec, func(t *testing.T) {
+			expand := Expand
+			if ex.Exp {
+				expand = ExpandExplanation
+			}
+			got, err := expand(ex.Spec, ex.Vars)
+			require.NoError(t, err)
+			assert.Equal(t, ex.Want, got)
+		})
+	}
+}
+
+func TestVarsWithDefaults(t *testing.T) {
+	tc := []struct {
+		name      string
+		in        Vars
+		sender    string
+		localPart string
+	}{
+		{"full sender", Vars{Sender: "alice@example.com", Domain: "example.com"}, "alice@example.com", "alice"},
+		{"null sender uses helo", Vars{HELO: "mx.example.org", Domain: "example.com"}, "postmaster@mx.example.org", "postmaster"},
+		{"null sender without helo", Vars{Domain: "example.com"}, "postmaster@example.com", "postmaster"},
+		{"bare domain", Vars{Sender: "example.com", Domain: "example.com"}, "postmaster@example.com", "postmaster"},
+		{"angle brackets", Vars{Sender: "<bob@example.com>", Domain: "example.com"}, "bob@example.com", "bob"},
+		{"local part kept", Vars{Sender: "bob@example.com", LocalPart: "bob"}, "bob@example.com", "bob"},
+		{"nothing to derive from", Vars{}, "", ""},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.in.WithDefaults()
+			assert.Equal(t, c.sender, got.Sender)
+			assert.Equal(t, c.localPart, got.LocalPart)
+		})
+	}
+
+	v := Vars{IP: net.ParseIP("192.0.2.3")}.WithDefaults()
+	assert.Len(t, v.IP, net.IPv4len)
+}
+
+func TestVarsValidate(t *testing.T) {
+	ok := Vars{
+		Sender:    "alice@example.com",
+		LocalPart: "alice",
+		Domain:    "example.com",
+		IP:        net.ParseIP("192.0.2.3"),
+	}
+	require.NoError(t, ok.Validate())
+	require.NoError(t, Vars{Domain: "example.com", IP: net.ParseIP("2001:db8::1")}.WithDefaults().Validate())
+
+	tc := []struct {
+		name string
+		mod  func(v *Vars)
+		errs []error
+	}{
+		{"no domain", func(v *Vars) { v.Domain = "" }, []error{ErrNoDomain}},
+		{"no ip", func(v *Vars) { v.IP = nil }, []error{ErrNoIP}},
+		{"bad ip", func(v *Vars) { v.IP = net.IP{1, 2, 3} }, []error{ErrNoIP}},
+		{"sender without domain", func(v *Vars) { v.Sender = "alice@" }, []error{ErrBadSender}},
+		{"sender without at", func(v *Vars) { v.Sender = "example.com" }, []error{ErrBadSender}},
+		{"local part mismatch", func(v *Vars) { v.LocalPart = "bob" }, []error{ErrLocalPart}},
+		{"several", func(v *Vars) { v.Domain, v.IP = "", nil }, []error{ErrNoDomain, ErrNoIP}},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			v := ok
+			c.mod(&v)
+			err := v.Validate()
+			require.Error(t, err)
+			for _, want := range c.errs {
+				assert.ErrorIs(t, err, want)
+			}
+		})
+	}
+}
+
+func TestExpandUTF8LocalPart(t *testing.T) {
+	v := Vars{Sender: "jürgen@example.com", LocalPart: "jürgen", Domain: "example.com"}
+	got, err := Expand("%{l}.%{d}", v)
+	require.NoError(t, err)
+	assert.Equal(t, "jürgen.example.com", got)
+
+	got, err = ExpandExplanation("%{L}", v)
+	require.NoError(t, err)
+	assert.Equal(t, "j%C3%BCrgen", got)
+}
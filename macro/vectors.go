@@ -0,0 +1,63 @@
+package macro
+
+import "net"
+
+// Example is one canonical macro expansion.  Exp marks text that is only
+// valid in an explanation and must be expanded with ExpandExplanation.
+type Example struct {
+	Section string // RFC 7208 section the example comes from
+	Spec    string
+	Vars    Vars
+	Want    string
+	Exp     bool
+}
+
+// rfcVars4 and rfcVars6 are the inputs RFC 7208 section 7.4 assumes: the
+// sender strong-bad@email.example.com connecting from 192.0.2.3 or
+// 2001:db8::cb01.
+var (
+	rfcVars4 = Vars{
+		Sender:    "strong-bad@email.example.com",
+		LocalPart: "strong-bad",
+		Domain:    "email.example.com",
+		IP:        net.ParseIP("192.0.2.3"),
+	}
+	rfcVars6 = Vars{
+		Sender:    "strong-bad@email.example.com",
+		LocalPart: "strong-bad",
+		Domain:    "email.example.com",
+		IP:        net.ParseIP("2001:db8::cb01"),
+	}
+)
+
+// RFCExamples are the macro expansion examples of RFC 7208 section 7.4,
+// plus the escapes of section 7.1 and the upper-case URL escaping rule of
+// section 7.3.  The expander is tested against them and downstream
+// implementations can do the same.
+var RFCExamples = []Example{
+	{"7.4", "%{s}", rfcVars4, "strong-bad@email.example.com", false},
+	{"7.4", "%{o}", rfcVars4, "email.example.com", false},
+	{"7.4", "%{d}", rfcVars4, "email.example.com", false},
+	{"7.4", "%{d4}", rfcVars4, "email.example.com", false},
+	{"7.4", "%{d3}", rfcVars4, "email.example.com", false},
+	{"7.4", "%{d2}", rfcVars4, "example.com", false},
+	{"7.4", "%{d1}", rfcVars4, "com", false},
+	{"7.4", "%{dr}", rfcVars4, "com.example.email", false},
+	{"7.4", "%{d2r}", rfcVars4, "example.email", false},
+	{"7.4", "%{l}", rfcVars4, "strong-bad", false},
+	{"7.4", "%{l-}", rfcVars4, "strong.bad", false},
+	{"7.4", "%{lr}", rfcVars4, "strong-bad", false},
+	{"7.4", "%{lr-}", rfcVars4, "bad.strong", false},
+	{"7.4", "%{l1r-}", rfcVars4, "strong", false},
+	{"7.4", "%{ir}.%{v}._spf.%{d2}", rfcVars4, "3.2.0.192.in-addr._spf.example.com", false},
+	{"7.4", "%{lr-}.lp._spf.%{d2}", rfcVars4, "bad.strong.lp._spf.example.com", false},
+	{"7.4", "%{lr-}.lp.%{ir}.%{v}._spf.%{d2}", rfcVars4, "bad.strong.lp.3.2.0.192.in-addr._spf.example.com", false},
+	{"7.4", "%{ir}.%{v}.%{l1r-}.lp._spf.%{d2}", rfcVars4, "3.2.0.192.in-addr.strong.lp._spf.example.com", false},
+	{"7.4", "%{d2}.trusted-domains.example.net", rfcVars4, "example.com.trusted-domains.example.net", false},
+	{"7.4", "%{ir}.%{v}._spf.%{d2}", rfcVars6, "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com", false},
+	{"7.1", "%%", rfcVars4, "%", true},
+	{"7.1", "a%_b", rfcVars4, "a b", true},
+	{"7.1", "a%-b", rfcVars4, "a%20b", true},
+	{"7.3", "%{S}", rfcVars4, "strong-bad%40email.example.com", false},
+	{"7.3", "%{L}", rfcVars4, "strong-bad", false},
+}
@@ -0,0 +1,108 @@
+package spf
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageID names a piece of human-readable prose produced for a result:
+// an SMTP reply text or the comment of a Received-SPF header.  The RFC
+// terms around it, such as the result keyword, reply codes and header
+// key-value pairs, are never part of a message.
+type MessageID string
+
+const (
+	MsgGreylist        MessageID = "greylist"         // Reply of a greylisted TempError
+	MsgRejectFail      MessageID = "reject-fail"      // reply rejecting a fail
+	MsgRejectPermError MessageID = "reject-permerror" // reply rejecting a permerror
+	MsgDefer           MessageID = "defer"            // reply deferring a temperror
+	MsgAccept          MessageID = "accept"           // reply accepting a message
+
+	// Received-SPF comments, one per result
+	MsgCommentPass      MessageID = "comment-pass"
+	MsgCommentFail      MessageID = "comment-fail"
+	MsgCommentSoftFail  MessageID = "comment-softfail"
+	MsgCommentNeutral   MessageID = "comment-neutral"
+	MsgCommentNone      MessageID = "comment-none"
+	MsgCommentTempError MessageID = "comment-temperror"
+	MsgCommentPermError MessageID = "comment-permerror"
+)
+
+// MessageArgs are the values a message may refer to.
+type MessageArgs struct {
+	Domain     string        // domain whose policy was evaluated
+	Sender     string        // checked identity as an address
+	IP         net.IP        // client address
+	RetryAfter time.Duration // greylisting delay
+}
+
+// Catalog supplies the wording of messages, so replies and header comments
+// can be localized or replaced with operator-specific text.  Message
+// returns false for an id it has no text for, and the default English
+// wording is used instead.
+type Catalog interface {
+	Message(id MessageID, args MessageArgs) (string, bool)
+}
+
+// Messages is a Catalog of fixed texts with placeholders: {domain},
+// {sender}, {ip} and {retry}, the greylisting delay in seconds.
+type Messages map[MessageID]string
+
+// Message implements Catalog.
+func (m Messages) Message(id MessageID, args MessageArgs) (string, bool) {
+	text, ok := m[id]
+	if !ok {
+		return "", false
+	}
+	ip := ""
+	if args.IP != nil {
+		ip = args.IP.String()
+	}
+	return strings.NewReplacer(
+		"{domain}", args.Domain,
+		"{sender}", args.Sender,
+		"{ip}", ip,
+		"{retry}", strconv.Itoa(int(args.RetryAfter.Round(time.Second)/time.Second)),
+	).Replace(text), true
+}
+
+// DefaultMessages is the English wording used where a Catalog has none.
+var DefaultMessages = Messages{
+	MsgGreylist:        "temporary error evaluating SPF record of {domain}, please retry in {retry} seconds",
+	MsgRejectFail:      "SPF validation failed: {domain} does not designate {ip} as permitted sender",
+	MsgRejectPermError: "SPF record of {domain} is invalid",
+	MsgDefer:           "temporary error evaluating SPF record of {domain}",
+	MsgAccept:          "OK",
+
+	MsgCommentPass:      "domain of {sender} designates {ip} as permitted sender",
+	MsgCommentFail:      "domain of {sender} does not designate {ip} as permitted sender",
+	MsgCommentSoftFail:  "domain of transitioning {sender} does not designate {ip} as permitted sender",
+	MsgCommentNeutral:   "{ip} is neither permitted nor denied by domain of {sender}",
+	MsgCommentNone:      "domain of {sender} does not provide an SPF record",
+	MsgCommentTempError: "error in processing during lookup of {sender}",
+	MsgCommentPermError: "permanent error in processing domain of {sender}",
+}
+
+// Message returns the text of id from cat, falling back to DefaultMessages
+// when cat is nil or has no text for id.
+func Message(cat Catalog, id MessageID, args MessageArgs) string {
+	if cat != nil {
+		if text, ok := cat.Message(id, args); ok {
+			return text
+		}
+	}
+	text, _ := DefaultMessages.Message(id, args)
+	return text
+}
+
+// CommentID returns the id of the Received-SPF comment for code.
+func CommentID(code Result) MessageID {
+	switch code {
+	case Pass, Fail, SoftFail, Neutral, TempError, PermError:
+		return MessageID("comment-" + string(code))
+	default:
+		return MsgCommentNone
+	}
+}
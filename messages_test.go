@@ -0,0 +1,45 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestMessages(t *testing.T) {
+	args := MessageArgs{Domain: "example.com", Sender: "user@example.com", IP: net.ParseIP("192.0.2.1"), RetryAfter: 90 * time.Second}
+	cat := Messages{
+		MsgRejectFail:  "{ip} n'est pas autorisé à envoyer pour {domain}",
+		MsgCommentPass: "{sender} autorise {ip}",
+		MsgGreylist:    "réessayez dans {retry} secondes",
+	}
+
+	assert.Equal(t, "192.0.2.1 n'est pas autorisé à envoyer pour example.com", Message(cat, MsgRejectFail, args))
+	assert.Equal(t, "user@example.com autorise 192.0.2.1", Message(cat, MsgCommentPass, args))
+	assert.Equal(t, "réessayez dans 90 secondes", Message(cat, MsgGreylist, args))
+	// ids without a translation fall back to the default wording
+	assert.Equal(t, "SPF record of example.com is invalid", Message(cat, MsgRejectPermError, args))
+	assert.Equal(t, "OK", Message(nil, MsgAccept, args))
+
+	for _, code := range []Result{Pass, Fail, SoftFail, Neutral, None, TempError, PermError} {
+		_, ok := DefaultMessages[CommentID(code)]
+		assert.True(t, ok, code)
+	}
+	assert.Equal(t, MsgCommentNone, CommentID(""))
+}
+
+func TestWithCatalog(t *testing.T) {
+	servfail := &fakeResolver{err: rcodeError(dns.RcodeServerFailure)}
+	greylist := func(context.Context, Request, CheckHostResult) (time.Duration, bool) { return time.Minute, true }
+	ch := NewChecker(dns.NewCustomDNSResolver(servfail, nil), WithGreylist(greylist),
+		WithCatalog(Messages{MsgGreylist: "bitte in {retry} Sekunden erneut versuchen"}))
+	res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, TempError, res.Code)
+	assert.Equal(t, "451 4.7.24 bitte in 60 Sekunden erneut versuchen", res.Reply)
+}
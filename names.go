@@ -0,0 +1,16 @@
+package spf
+
+import "strings"
+
+// normalizeFQDN returns name in the form every comparison and lookup in the
+// evaluator uses: lower case, without the trailing root dot.  DNS names
+// compare case-insensitively (RFC 4343) and "example.com." and
+// "example.com" are the same fully qualified name.
+func normalizeFQDN(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// sameDomain reports whether a and b name the same domain.
+func sameDomain(a, b string) bool {
+	return normalizeFQDN(a) == normalizeFQDN(b)
+}
@@ -0,0 +1,73 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestNormalizeFQDN(t *testing.T) {
+	tc := []struct {
+		in, want string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"Mail.Example.com.", "mail.example.com"},
+		{"_spf.Example.com", "_spf.example.com"},
+		{"", ""},
+	}
+	for _, c := range tc {
+		assert.Equal(t, c.want, normalizeFQDN(c.in), c.in)
+	}
+}
+
+func TestSameDomain(t *testing.T) {
+	assert.True(t, sameDomain("Example.com.", "example.COM"))
+	assert.False(t, sameDomain("example.com", "example.org"))
+	assert.False(t, sameDomain("mail.example.com", "example.com"))
+}
+
+func TestChecker_TargetsCaseAndDotInsensitive(t *testing.T) {
+	txt := fakeTXTMap{
+		"child.example": {"v=spf1 ip4:198.51.100.0/24 -all"},
+		"redir.example": {"v=spf1 ip4:203.0.113.0/24 -all"},
+	}
+	ips := fakeIPResolver{"host.example": {"192.0.2.1"}}
+	rec, err := parser.Parse("v=spf1 a:Host.Example. include:Child.EXAMPLE. redirect=Redir.Example.")
+	require.NoError(t, err)
+
+	cases := []struct {
+		ip   string
+		want Result
+	}{
+		{"192.0.2.1", Pass},
+		{"198.51.100.1", Pass},
+		{"203.0.113.1", Pass},
+		{"10.0.0.1", Fail},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ip, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, ips))
+			res, err := ch.Evaluate(context.Background(), net.ParseIP(tc.ip), "Example.COM.", rec, "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+		})
+	}
+}
+
+func TestChecker_WalkRecordNormalizesTargets(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{
+		"example.com": {"v=spf1 include:Inc.Example. include:inc.example -all"},
+		"inc.example": {"v=spf1 -all"},
+	}, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Len(t, g.Nodes, 2)
+	assert.NoError(t, g.Nodes["inc.example"].Err)
+}
@@ -0,0 +1,375 @@
+package spf
+
+import (
+	"cmp"
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Option configures a Checker.  Options are applied in order by NewChecker.
+type Option func(*Checker)
+
+// DisabledAction controls what happens when evaluation reaches a mechanism
+// disabled with WithDisabledMechanisms.
+type DisabledAction int
+
+const (
+	// DisabledNoMatch treats the mechanism as not matching and records a
+	// trace note, so evaluation continues with the next term.
+	DisabledNoMatch DisabledAction = iota
+	// DisabledPermError aborts evaluation with PermError.
+	DisabledPermError
+)
+
+// WithDisabledMechanisms bans the named mechanism kinds, e.g. "ptr" or
+// "exists".  A disabled mechanism performs no DNS lookups; how it affects
+// the result is controlled by WithDisabledAction.
+func WithDisabledMechanisms(kinds ...string) Option {
+	return func(c *Checker) {
+		if c.disabled == nil {
+			c.disabled = make(map[string]bool, len(kinds))
+		}
+		for _, k := range kinds {
+			c.disabled[strings.ToLower(k)] = true
+		}
+	}
+}
+
+// WithDisabledAction sets how disabled mechanisms are treated.  The default
+// is DisabledNoMatch.
+func WithDisabledAction(a DisabledAction) Option {
+	return func(c *Checker) {
+		c.disabledAction = a
+	}
+}
+
+// InternalErrorAction selects the result returned when the library itself
+// fails, for example because the Checker has no Resolver, rather than DNS or
+// the published record.
+type InternalErrorAction int
+
+const (
+	// InternalTempError fails open: the result is TempError, so the MTA
+	// defers and the message is retried once the fault is fixed.  This is
+	// the default.
+	InternalTempError InternalErrorAction = iota
+	// InternalPermError fails closed with PermError.
+	InternalPermError
+	// InternalFail fails closed with Fail.
+	InternalFail
+)
+
+// WithInternalErrorAction sets the result of internal errors, see
+// InternalErrorAction.  Whatever the action, the result's Cause wraps
+// ErrInternal, a trace note records the decision and the error is counted in
+// Checker.InternalErrors.
+func WithInternalErrorAction(a InternalErrorAction) Option {
+	return func(c *Checker) {
+		c.internalAction = a
+	}
+}
+
+// Mode selects the specification whose semantics the Checker follows.
+type Mode int
+
+const (
+	// ModeRFC7208 follows RFC 7208, the default.
+	ModeRFC7208 Mode = iota
+	// ModeRFC4408 emulates the obsolete RFC 4408 for parity with legacy
+	// deployments where its processing differs from RFC 7208:
+	//   - void lookups are not limited, RFC 4408 had no such limit;
+	//   - an mx mechanism with more than MaxMXNames exchanges checks the
+	//     first MaxMXNames by preference instead of failing with PermError
+	//     (RFC 4408 section 10.1);
+	//   - SPF (type 99) records are queried before TXT and replace them
+	//     when present (sections 4.4 and 4.5), when the resolver backend
+	//     implements dns.SPFTypeResolver.
+	// The ptr mechanism, the %{p} macro and the mapping of DNS errors to
+	// TempError and PermError are the same in both documents, so the mode
+	// leaves them alone.
+	ModeRFC4408
+)
+
+// WithMode selects the specification semantics, see Mode.
+func WithMode(m Mode) Option {
+	return func(c *Checker) {
+		c.mode = m
+	}
+}
+
+// Greylister is consulted when Check produces TempError.  It returns how long
+// the client should wait before retrying and whether the message should be
+// greylisted at all, typically after recording the triplet in the caller's
+// greylist store.
+type Greylister func(ctx context.Context, req Request, res CheckHostResult) (retryAfter time.Duration, ok bool)
+
+// WithGreylist installs g as the TempError hook.  When g greylists a message
+// the result carries RetryAfter and a suggested 451 Reply.
+func WithGreylist(g Greylister) Option {
+	return func(c *Checker) {
+		c.greylist = g
+	}
+}
+
+// WithCatalog sets the Catalog supplying the text of the greylisting Reply,
+// so it can be localized.  The reply and enhanced status codes are kept.
+func WithCatalog(cat Catalog) Option {
+	return func(c *Checker) {
+		c.catalog = cat
+	}
+}
+
+// WithClock sets the Clock used for the %{t} macro and for expiry in the
+// decision cache of WithDecisionCache.  Elapsed times, such as
+// HealthCheck latency and CheckHostResult.Elapsed, and chain resolver
+// stickiness always use the system clock.  Tests pass a fixed or stepping
+// clock to make results deterministic.
+func WithClock(clk Clock) Option {
+	return func(c *Checker) {
+		c.Clock = clk
+	}
+}
+
+// WithStrictCIDR makes evaluation fail with PermError (cause ErrBroadCIDR)
+// when it reaches a pass ip4, ip6, a or mx term whose mask is /0 or broader
+// than the thresholds in cfg.  Such terms effectively equal +all and are
+// usually pasted by mistake; the lint package reports the same terms as
+// findings.  Terms with another qualifier authorize nothing and are
+// evaluated as usual, see lint.BroadCIDR.
+func WithStrictCIDR(cfg lint.Config) Option {
+	return func(c *Checker) {
+		c.strictCIDR = &cfg
+	}
+}
+
+// WithSortedAnswers makes the Checker's Resolver return address and MX
+// answers in a deterministic order, see dns.Resolver.Sorted.  Evaluation
+// results do not depend on answer order; traces and flattened output do.
+func WithSortedAnswers() Option {
+	return func(c *Checker) {
+		if c.Resolver != nil {
+			c.Resolver = c.Resolver.Sorted()
+		}
+	}
+}
+
+// WithExistsRanges enables a non-standard extension for DNSWL-style
+// policies: an exists mechanism matches only when one of the returned A
+// records lies inside one of nets, e.g. 127.0.0.0/24, instead of whenever
+// any record exists.  Answers outside the ranges are a non-match noted in
+// the trace.  Without this option exists follows RFC 7208 section 5.7.
+func WithExistsRanges(nets ...*net.IPNet) Option {
+	return func(c *Checker) {
+		c.existsRanges = append(c.existsRanges, nets...)
+	}
+}
+
+// WithExistsAAAA makes exists match when the target has A or AAAA
+// records, as some receivers do.  RFC 7208 section 5.7 asks for an A query
+// whatever the connection's address family, so by default exists sends
+// only an A query and a name with nothing but AAAA records is a void
+// lookup.  This is not RFC 7208 behaviour.
+func WithExistsAAAA() Option {
+	return func(c *Checker) {
+		c.existsAAAA = true
+	}
+}
+
+// WithInternalResult short-circuits the check for clients on internal
+// networks: Check returns code, e.g. Pass or None, with cause
+// ErrInternalNetwork and without any DNS lookup, so internal relays neither
+// spend lookups nor get rejected.  The networks are nets or, when none are
+// given, loopback, private (RFC 1918 and RFC 4193) and link-local
+// addresses.  This is not RFC 7208 behaviour.
+func WithInternalResult(code Result, nets ...*net.IPNet) Option {
+	return func(c *Checker) {
+		c.internal = &internalNets{code: code, nets: nets}
+	}
+}
+
+// internalNets is the configuration of WithInternalResult.
+type internalNets struct {
+	code Result
+	nets []*net.IPNet
+}
+
+// contains reports whether ip is on one of the internal networks.
+func (in *internalNets) contains(ip net.IP) bool {
+	if len(in.nets) == 0 {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+	for _, n := range in.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithIncludeOverride serves record as the SPF record of domain instead of
+// looking it up, so a not-yet-published include can be tested from a
+// staging environment, e.g.
+//
+//	WithIncludeOverride("_spf.new.example", "v=spf1 ip4:192.0.2.0/24 -all")
+//
+// The override applies wherever the record of domain is fetched: include
+// and redirect targets, the start domain and WalkRecord.  The term that
+// reaches it still counts toward the DNS-lookup limit, and a trace note
+// records that the record was overridden.  Use it more than once to
+// override several domains.
+func WithIncludeOverride(domain, record string) Option {
+	return func(c *Checker) {
+		if c.overrides == nil {
+			c.overrides = make(map[string]string)
+		}
+		c.overrides[normalizeFQDN(domain)] = record
+	}
+}
+
+// WellKnownNAT64 is the well-known IPv4/IPv6 translation prefix
+// 64:ff9b::/96 of RFC 6052 section 2.1.
+var WellKnownNAT64 = &net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)}
+
+// WithNAT64 is for receivers behind NAT64, where IPv4 clients connect from
+// an IPv6 address and would otherwise never match ip4 mechanisms.  A client
+// address inside one of prefixes, or WellKnownNAT64 when none are given, is
+// replaced by the IPv4 address embedded in it (RFC 6052 section 2.2) for the
+// whole evaluation, including the %{i} and %{v} macros, and a trace note
+// records the translation.  Prefix lengths other than those of RFC 6052
+// never match.  This is not RFC 7208 behaviour.
+func WithNAT64(prefixes ...*net.IPNet) Option {
+	return func(c *Checker) {
+		if len(prefixes) == 0 {
+			prefixes = []*net.IPNet{WellKnownNAT64}
+		}
+		c.nat64 = append(c.nat64, prefixes...)
+	}
+}
+
+// SizeLimits bound the DNS data accepted during evaluation.  Oversized data
+// is a PermError with cause ErrTooLarge, detected before the record is
+// parsed.  A zero field means no limit.
+type SizeLimits struct {
+	MaxTXTBytes    int // total size of the TXT answer at one name
+	MaxRecordBytes int // size of the selected SPF record
+	MaxTerms       int // terms in the record, excluding the version
+
+	// MaxTreeTerms bounds the terms of all records fetched by one
+	// evaluation: the start record and every include and redirect target
+	// reached, so machine-generated include trees cannot make evaluation
+	// arbitrarily expensive.  Fetched records count even when their terms
+	// are never reached.
+	MaxTreeTerms int
+}
+
+// WithSizeLimits enforces l on every record fetched, including include and
+// redirect targets.  It bounds memory spent on adversarial answers, which
+// over TCP may be far larger than the 512 bytes RFC 7208 section 3.4
+// recommends records stay within.
+func WithSizeLimits(l SizeLimits) Option {
+	return func(c *Checker) {
+		c.sizeLimits = l
+	}
+}
+
+// WithParserOptions sets how the Checker validates and parses names, for
+// example to accept legacy host names that IDNA rejects.  It applies to the
+// starting domain, fetched records and mechanism targets; see
+// parser.Options.
+func WithParserOptions(o parser.Options) Option {
+	return func(c *Checker) {
+		c.parserOpts = o
+	}
+}
+
+// WithRejectEAI makes Check return None with cause ErrEAISender for a MAIL
+// FROM address containing non-ASCII characters (RFC 6531), for legacy
+// environments that cannot carry such addresses further.  By default they
+// are evaluated: the domain part is converted to its A-label form and the
+// local part is kept in UTF-8 for %{l}.
+func WithRejectEAI() Option {
+	return func(c *Checker) {
+		c.rejectEAI = true
+	}
+}
+
+// WithDefaultHELO sets the name %{h} expands to when a request carries no
+// HELO name, as with the package-level CheckHost.  It only feeds macros: the
+// identity checked for a null reverse-path still comes from the request.
+func WithDefaultHELO(name string) Option {
+	return func(c *Checker) {
+		c.defaultHELO = name
+	}
+}
+
+// WithReceiverHostname sets the receiving MTA's hostname, which %{r} expands
+// to when a request does not name one.
+func WithReceiverHostname(name string) Option {
+	return func(c *Checker) {
+		c.receiver = name
+	}
+}
+
+// ApplyDefaults returns req with an empty HELODomain or ReceiverHostname
+// replaced by the values set with WithDefaultHELO and WithReceiverHostname.
+// Pass the result to the policy package so the Received-SPF field reports
+// them too.
+func (c *Checker) ApplyDefaults(req Request) Request {
+	req.HELODomain = cmp.Or(req.HELODomain, c.defaultHELO)
+	req.ReceiverHostname = cmp.Or(req.ReceiverHostname, c.receiver)
+	return req
+}
+
+// WithQueryTrace records every DNS query in the trace, not only failures:
+// the name and type, response code, answer count and latency.  Backends
+// that see the wire response, such as NewDoHResolver and the miekgdns
+// adapter, also report the server that answered, so operators can tell a
+// slow authoritative server from slow recursion.
+func WithQueryTrace() Option {
+	return func(c *Checker) {
+		c.queryTrace = true
+	}
+}
+
+// WithShadowResult makes a PermError caused by the section 4.6.4 lookup
+// limit carry an advisory ShadowResult: the verdict the record would have
+// produced without the lookup and void limits, so operators can see what
+// an over-long record is meant to say.  The result itself stays the
+// PermError RFC 7208 requires.
+func WithShadowResult() Option {
+	return func(c *Checker) {
+		c.shadow = true
+	}
+}
+
+// WithTimeout bounds every check to d, on top of any deadline of the
+// caller's context.  Flags.Timeout replaces it for a single check.  Without
+// it only the context bounds a check.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Checker) {
+		c.timeout = d
+	}
+}
+
+// ModifierHandler receives an unknown modifier of the record published at
+// domain, such as the RFC 6652 reporting modifiers ra=, rp= and rr=.  m.Value
+// is the raw value and m.Macro reports whether it holds macros; the library
+// neither expands nor interprets it.
+type ModifierHandler func(ctx context.Context, domain string, m parser.Modifier)
+
+// WithModifierHandler calls h with every unknown modifier of each record
+// evaluated, including included records and redirect targets, in record
+// order before the record's mechanisms run.  RFC 7208 section 6 has
+// unknown modifiers ignored, so h cannot change the result.  Checks served
+// from the decision cache evaluate no record, so the cache is bypassed
+// while h is set.
+func WithModifierHandler(h ModifierHandler) Option {
+	return func(c *Checker) {
+		c.modifiers = h
+	}
+}
@@ -0,0 +1,597 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestWithDisabledMechanisms(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	ips := fakeIPResolver{"example.com": {"192.0.2.1"}}
+
+	cases := []struct {
+		name      string
+		record    string
+		opts      []Option
+		want      Result
+		wantCause error
+		wantNote  string
+	}{
+		{
+			name:   "enabled a matches",
+			record: "v=spf1 a -all",
+			want:   Pass,
+		},
+		{
+			name:     "disabled a is skipped",
+			record:   "v=spf1 a -all",
+			opts:     []Option{WithDisabledMechanisms("A")},
+			want:     Fail,
+			wantNote: "a",
+		},
+		{
+			name:      "disabled a as permerror",
+			record:    "v=spf1 a -all",
+			opts:      []Option{WithDisabledMechanisms("a"), WithDisabledAction(DisabledPermError)},
+			want:      PermError,
+			wantCause: ErrMechanismDisabled,
+		},
+		{
+			name:     "ptr and exists disabled",
+			record:   "v=spf1 ptr exists:%{i}.example.com ~all",
+			opts:     []Option{WithDisabledMechanisms("ptr", "exists")},
+			want:     SoftFail,
+			wantNote: "ptr",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, ips)
+			ch := NewChecker(r, tc.opts...)
+			res, err := ch.CheckHost(context.Background(), ip, "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.wantCause != nil {
+				require.ErrorIs(t, res.Cause, tc.wantCause)
+			}
+			if tc.wantNote != "" {
+				require.NotEmpty(t, res.Trace)
+				assert.Equal(t, tc.wantNote, res.Trace[0].Mechanism)
+				assert.Equal(t, "example.com", res.Trace[0].Domain)
+			}
+		})
+	}
+}
+
+func TestWithGreylist(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	servfail := &fakeResolver{err: rcodeError(dns.RcodeServerFailure)}
+	pass := &fakeResolver{txts: []string{"v=spf1 +all"}}
+
+	cases := []struct {
+		name      string
+		txt       dns.TXTResolver
+		greylist  bool
+		want      Result
+		wantRetry time.Duration
+		wantReply string
+	}{
+		{"temperror greylisted", servfail, true, TempError, 5 * time.Minute, "451 4.7.24 temporary error evaluating SPF record of example.com, please retry in 300 seconds"},
+		{"temperror not greylisted", servfail, false, TempError, 0, ""},
+		{"pass never consults hook", pass, true, Pass, 0, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			g := func(ctx context.Context, req Request, res CheckHostResult) (time.Duration, bool) {
+				calls++
+				assert.Equal(t, TempError, res.Code)
+				assert.Equal(t, "example.com", req.StartDomain())
+				return 5 * time.Minute, tc.greylist
+			}
+			ch := NewChecker(dns.NewCustomDNSResolver(tc.txt, nil), WithGreylist(g))
+			res, err := ch.Check(context.Background(), Request{IP: ip, MailFrom: "user@example.com"})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			assert.Equal(t, tc.wantRetry, res.RetryAfter)
+			assert.Equal(t, tc.wantReply, res.Reply)
+			if tc.want != TempError {
+				assert.Zero(t, calls)
+			}
+		})
+	}
+}
+
+// spfTypeTXT serves type 99 SPF records next to the TXT records of
+// fakeTXTMap.
+type spfTypeTXT struct {
+	fakeTXTMap
+	spf map[string][]string
+}
+
+func (f spfTypeTXT) LookupSPF(ctx context.Context, name string) ([]string, error) {
+	return f.spf[name], nil
+}
+
+func TestWithMode(t *testing.T) {
+	var mxs []*net.MX
+	for i := range MaxMXNames + 1 {
+		mxs = append(mxs, &net.MX{Host: fmt.Sprintf("mx%d.example.com", i), Pref: uint16(i)})
+	}
+	hosts := fakeHosts{
+		fakeIPResolver: fakeIPResolver{
+			"example.com":      {"192.0.2.1"},
+			"mx0.example.com":  {"192.0.2.10"},
+			"mx10.example.com": {"192.0.2.20"},
+		},
+		mx: map[string][]*net.MX{"example.com": mxs},
+	}
+	txts := spfTypeTXT{
+		fakeTXTMap: fakeTXTMap{
+			"void.example": {"v=spf1 a:gone1.example.com a:gone2.example.com a:gone3.example.com a:example.com -all"},
+			"mx.example":   {"v=spf1 mx:example.com -all"},
+			"type.example": {"v=spf1 -all"},
+			"txt.example":  {"v=spf1 +all"},
+		},
+		spf: map[string][]string{"type.example": {"v=spf1 +all"}},
+	}
+	r := dns.NewCustomDNSResolver(txts, hosts)
+
+	cases := []struct {
+		name   string
+		domain string
+		ip     string
+		rfc    Result // ModeRFC7208
+		legacy Result // ModeRFC4408
+	}{
+		{"void lookups", "void.example", "192.0.2.1", PermError, Pass},
+		{"first of too many exchanges", "mx.example", "192.0.2.10", PermError, Pass},
+		{"exchange past the limit", "mx.example", "192.0.2.20", PermError, Fail},
+		{"spf type replaces txt", "type.example", "192.0.2.1", Fail, Pass},
+		{"txt without spf type", "txt.example", "192.0.2.1", Pass, Pass},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for mode, want := range map[Mode]Result{ModeRFC7208: tc.rfc, ModeRFC4408: tc.legacy} {
+				ch := NewChecker(r, WithMode(mode))
+				res, err := ch.CheckHost(context.Background(), net.ParseIP(tc.ip), tc.domain, "user@"+tc.domain)
+				require.NoError(t, err)
+				assert.Equal(t, want, res.Code, "mode %d", mode)
+			}
+		})
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	cases := []struct {
+		name string
+		clk  Clock
+		want time.Time
+	}{
+		{"fixed", fixedClock(at), at},
+		{"func", ClockFunc(func() time.Time { return at.Add(time.Hour) }), at.Add(time.Hour)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil), WithClock(tc.clk))
+			assert.Equal(t, tc.want, ch.now())
+		})
+	}
+
+	// nil keeps the system clock
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil), WithClock(nil))
+	assert.WithinDuration(t, time.Now(), ch.now(), time.Minute)
+}
+
+func TestWithStrictCIDR(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	cases := []struct {
+		name      string
+		record    string
+		opts      []Option
+		want      Result
+		wantCause error
+	}{
+		{"zero allowed by default", "v=spf1 ip4:0.0.0.0/0 -all", nil, Pass, nil},
+		{"zero rejected", "v=spf1 ip4:0.0.0.0/0 -all", []Option{WithStrictCIDR(lint.Config{})}, PermError, ErrBroadCIDR},
+		{"broad rejected", "v=spf1 ip4:192.0.0.0/8 -all", []Option{WithStrictCIDR(lint.Config{})}, PermError, ErrBroadCIDR},
+		{"custom threshold", "v=spf1 ip4:192.0.0.0/8 -all", []Option{WithStrictCIDR(lint.Config{MinPrefix4: 8})}, Pass, nil},
+		{"earlier match wins", "v=spf1 ip4:192.0.2.0/24 ip4:0.0.0.0/0 -all", []Option{WithStrictCIDR(lint.Config{})}, Pass, nil},
+		{"broad deny allowed", "v=spf1 -ip4:10.0.0.0/8 -ip4:0.0.0.0/0 +all", []Option{WithStrictCIDR(lint.Config{})}, Fail, nil},
+		{"broad softfail allowed", "v=spf1 ~ip4:0.0.0.0/0", []Option{WithStrictCIDR(lint.Config{})}, SoftFail, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, nil), tc.opts...)
+			res, err := ch.CheckHost(context.Background(), ip, "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.wantCause != nil {
+				assert.ErrorIs(t, res.Cause, tc.wantCause)
+			}
+		})
+	}
+}
+
+func TestWithExistsRanges(t *testing.T) {
+	ips := fakeIPResolver{
+		"listed.example":   {"127.0.0.2"},
+		"wildcard.example": {"198.51.100.1"},
+	}
+	_, loop, _ := net.ParseCIDR("127.0.0.0/24")
+	cases := []struct {
+		name   string
+		record string
+		opts   []Option
+		want   Result
+		note   bool
+	}{
+		{"rfc any answer matches", "v=spf1 exists:wildcard.example -all", nil, Pass, false},
+		{"answer in range", "v=spf1 exists:listed.example -all", []Option{WithExistsRanges(loop)}, Pass, false},
+		{"answer outside range", "v=spf1 exists:wildcard.example -all", []Option{WithExistsRanges(loop)}, Fail, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, ips), tc.opts...)
+			res, err := ch.CheckHost(context.Background(), net.ParseIP("192.0.2.1"), "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.note {
+				require.Len(t, res.Trace, 1)
+				assert.Equal(t, "exists", res.Trace[0].Mechanism)
+			}
+		})
+	}
+}
+
+func TestWithSortedAnswers(t *testing.T) {
+	r := dns.NewCustomDNSResolver(nil, fakeIPResolver{"example.com": {"2001:db8::1", "192.0.2.2", "192.0.2.1"}})
+	ch := NewChecker(r, WithSortedAnswers())
+	ips, err := ch.Resolver.LookupIP(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Len(t, ips, 3)
+	assert.Equal(t, "192.0.2.1", ips[0].String())
+	assert.Equal(t, "192.0.2.2", ips[1].String())
+
+	// the caller's resolver is left alone
+	ips, err = r.LookupIP(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ips[0].String())
+
+	assert.Nil(t, NewChecker(nil, WithSortedAnswers()).Resolver)
+}
+
+func TestWithInternalErrorAction(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		want Result
+	}{
+		{"default fails open", nil, TempError},
+		{"permerror", []Option{WithInternalErrorAction(InternalPermError)}, PermError},
+		{"fail", []Option{WithInternalErrorAction(InternalFail)}, Fail},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(nil, tc.opts...)
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			require.ErrorIs(t, res.Cause, ErrInternal)
+			require.Len(t, res.Trace, 1)
+			assert.Contains(t, res.Trace[0].Note, "internal error")
+			assert.EqualValues(t, 1, ch.InternalErrors())
+		})
+	}
+}
+
+func TestWithSizeLimits(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com":      {"v=spf1 ip4:192.0.2.1 include:big.example -all", "some-verification-token=abcdef"},
+		"big.example":      {"v=spf1 ip4:198.51.100.1 ip4:198.51.100.2 ip4:198.51.100.3 -all"},
+		"redirect.example": {"v=spf1 redirect=big.example"},
+	}
+	cases := []struct {
+		name   string
+		domain string
+		ip     string
+		limits SizeLimits
+		want   Result
+	}{
+		{"no limits", "example.com", "198.51.100.3", SizeLimits{}, Pass},
+		{"txt answer too large", "example.com", "192.0.2.1", SizeLimits{MaxTXTBytes: 64}, PermError},
+		{"record within limits", "example.com", "192.0.2.1", SizeLimits{MaxTXTBytes: 100, MaxRecordBytes: 60, MaxTerms: 3}, Pass},
+		{"include record too long", "example.com", "198.51.100.3", SizeLimits{MaxRecordBytes: 60}, PermError},
+		{"redirect target too many terms", "redirect.example", "198.51.100.3", SizeLimits{MaxTerms: 3}, PermError},
+		{"tree within limit", "example.com", "198.51.100.3", SizeLimits{MaxTreeTerms: 7}, Pass},
+		{"include tree too many terms", "example.com", "198.51.100.3", SizeLimits{MaxTreeTerms: 6}, PermError},
+		{"include never fetched", "example.com", "192.0.2.1", SizeLimits{MaxTreeTerms: 3}, Pass},
+		{"redirect tree too many terms", "redirect.example", "198.51.100.3", SizeLimits{MaxTreeTerms: 4}, PermError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txts, nil), WithSizeLimits(tc.limits))
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP(tc.ip), MailFrom: "user@" + tc.domain})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.want == PermError {
+				require.ErrorIs(t, res.Cause, ErrTooLarge)
+			}
+		})
+	}
+}
+
+func TestWithParserOptions(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com":         {"v=spf1 include:-legacy.example.com -all"},
+		"-legacy.example.com": {"v=spf1 ip4:192.0.2.1 -all"},
+	}
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+
+	res, err := NewChecker(dns.NewCustomDNSResolver(txts, nil)).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, PermError, res.Code)
+
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, nil), WithParserOptions(parser.Options{NoIDNA: true}))
+	res, err = ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+}
+
+func TestWithParserOptionsValidate(t *testing.T) {
+	txts := fakeTXTMap{"intranet": {"v=spf1 a:mailhub -all"}}
+	ips := fakeIPResolver{"mailhub": {"10.0.0.25"}}
+	req := Request{IP: net.ParseIP("10.0.0.25"), MailFrom: "user@intranet"}
+
+	res, err := NewChecker(dns.NewCustomDNSResolver(txts, ips)).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, None, res.Code)
+	assert.ErrorIs(t, res.Cause, parser.ErrSingleLabel)
+
+	singleLabel := parser.Options{Validate: func(name string, target bool) (string, error) {
+		if name = strings.TrimSuffix(name, "."); !strings.Contains(name, ".") {
+			return strings.ToLower(name), nil
+		}
+		return parser.ValidateTargetName(name)
+	}}
+	res, err = NewChecker(dns.NewCustomDNSResolver(txts, ips), WithParserOptions(singleLabel)).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+}
+
+func TestWithRejectEAI(t *testing.T) {
+	txts := fakeTXTMap{
+		"xn--bcher-kva.example": {"v=spf1 exists:%{l}.l.example exists:%{o}.o.example -all"},
+	}
+	ips := fakeIPResolver{
+		"xn--jrgen-kva.l.example":         {"127.0.0.1"},
+		"xn--bcher-kva.example.o.example": {"127.0.0.1"},
+	}
+	ctx := context.Background()
+
+	// %{l} keeps the UTF-8 local part, %{o} is the A-label domain
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, ips))
+	for _, from := range []string{"jürgen@bücher.example", "bob@bücher.example"} {
+		res, err := ch.Check(ctx, Request{IP: net.ParseIP("192.0.2.1"), MailFrom: from})
+		require.NoError(t, err)
+		assert.Equal(t, Pass, res.Code, from)
+	}
+
+	ch = NewChecker(dns.NewCustomDNSResolver(txts, ips), WithRejectEAI())
+	res, err := ch.Check(ctx, Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "jürgen@bücher.example"})
+	require.NoError(t, err)
+	assert.Equal(t, None, res.Code)
+	assert.ErrorIs(t, res.Cause, ErrEAISender)
+
+	// a HELO check does not look at MAIL FROM
+	res, err = ch.Check(ctx, Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "jürgen@bücher.example", HELODomain: "xn--bcher-kva.example", Identity: IdentityHELO})
+	require.NoError(t, err)
+	assert.NotEqual(t, None, res.Code)
+}
+
+func TestWithDefaultHELOAndReceiver(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com":         {"v=spf1 exists:%{h}.helo.example -all exp=explain.example.com"},
+		"explain.example.com": {"rejected by %{r}"},
+	}
+	ips := fakeIPResolver{"mx.example.org.helo.example": {"127.0.0.1"}}
+	ctx := context.Background()
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "alice@example.com"}
+
+	res, err := NewChecker(dns.NewCustomDNSResolver(txts, ips)).Check(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, Fail, res.Code)
+	assert.Equal(t, "rejected by unknown", res.Explanation)
+
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, ips), WithDefaultHELO("mx.example.org"), WithReceiverHostname("in.example.net"))
+	res, err = ch.Check(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+
+	// the request's own values win
+	other := req
+	other.HELODomain, other.ReceiverHostname = "client.example.net", "mx.example.com"
+	res, err = ch.Check(ctx, other)
+	require.NoError(t, err)
+	assert.Equal(t, Fail, res.Code)
+	assert.Equal(t, "rejected by mx.example.com", res.Explanation)
+
+	filled := ch.ApplyDefaults(req)
+	assert.Equal(t, "mx.example.org", filled.HELODomain)
+	assert.Equal(t, "in.example.net", filled.ReceiverHostname)
+	assert.Equal(t, other, ch.ApplyDefaults(other))
+}
+
+func TestWithInternalResult(t *testing.T) {
+	txts := fakeTXTMap{"example.com": {"v=spf1 -all"}}
+	ctx := context.Background()
+	check := func(ch *Checker, ip string) CheckHostResult {
+		t.Helper()
+		res, err := ch.Check(ctx, Request{IP: net.ParseIP(ip), MailFrom: "alice@example.com"})
+		require.NoError(t, err)
+		return res
+	}
+
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, nil), WithInternalResult(Pass))
+	for _, ip := range []string{"10.1.2.3", "172.16.0.1", "192.168.1.1", "127.0.0.1", "169.254.1.1", "::1", "fe80::1", "fd00::1"} {
+		res := check(ch, ip)
+		assert.Equal(t, Pass, res.Code, ip)
+		assert.ErrorIs(t, res.Cause, ErrInternalNetwork, ip)
+		assert.Zero(t, res.Lookups, ip)
+	}
+	assert.Equal(t, Fail, check(ch, "192.0.2.1").Code)
+
+	_, custom, err := net.ParseCIDR("100.64.0.0/10")
+	require.NoError(t, err)
+	ch = NewChecker(dns.NewCustomDNSResolver(txts, nil), WithInternalResult(None, custom))
+	assert.Equal(t, None, check(ch, "100.64.1.1").Code)
+	// explicit networks replace the defaults
+	assert.Equal(t, Fail, check(ch, "10.1.2.3").Code)
+}
+
+func TestWithNAT64(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com": {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"example.net": {"v=spf1 exists:%{ir}.%{v}.wl.example.com -all"},
+		"example.org": {"v=spf1 ip6:2001:db8::/32 -all"},
+	}
+	ips := fakeIPResolver{"33.2.0.198.in-addr.wl.example.com": {"127.0.0.2"}}
+	r := dns.NewCustomDNSResolver(txts, ips)
+	check := func(ch *Checker, ip, from string) CheckHostResult {
+		t.Helper()
+		res, err := ch.Check(context.Background(), Request{IP: net.ParseIP(ip), MailFrom: from})
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.Equal(t, Fail, check(NewChecker(r), "64:ff9b::192.0.2.33", "a@example.com").Code, "no translation by default")
+
+	ch := NewChecker(r, WithNAT64())
+	res := check(ch, "64:ff9b::192.0.2.33", "a@example.com")
+	assert.Equal(t, Pass, res.Code)
+	require.NotEmpty(t, res.Trace)
+	assert.Equal(t, "NAT64 client 64:ff9b::c000:221 evaluated as 192.0.2.33", res.Trace[0].Note)
+	assert.Equal(t, "64:ff9b::c000:221", res.IP.String(), "the result keeps the connecting address")
+
+	// macros see the embedded address too
+	assert.Equal(t, Pass, check(ch, "64:ff9b::198.0.2.33", "a@example.net").Code)
+	// addresses outside the prefix are untouched
+	assert.Equal(t, Pass, check(ch, "2001:db8::1", "a@example.org").Code)
+
+	_, local, err := net.ParseCIDR("2001:db8:64::/96")
+	require.NoError(t, err)
+	ch = NewChecker(r, WithNAT64(local))
+	assert.Equal(t, Pass, check(ch, "2001:db8:64::192.0.2.33", "a@example.com").Code)
+	assert.Equal(t, Fail, check(ch, "64:ff9b::192.0.2.33", "a@example.com").Code, "explicit prefixes replace the default")
+}
+
+func TestWithIncludeOverride(t *testing.T) {
+	txts := fakeTXTMap{"example.com": {"v=spf1 include:_spf.new.example.com -all"}}
+	r := dns.NewCustomDNSResolver(txts, nil)
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "a@example.com"}
+
+	res, err := NewChecker(r).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, PermError, res.Code, "the include is not published yet")
+
+	ch := NewChecker(r, WithIncludeOverride("_SPF.new.example.com.", "v=spf1 ip4:192.0.2.0/24 -all"))
+	res, err = ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+	assert.Equal(t, 1, res.Lookups, "the include still counts")
+	assert.Contains(t, res.Trace, TraceEntry{Domain: "example.com", Note: "record of _spf.new.example.com overridden, not looked up", LookupsRemaining: 9})
+
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Contains(t, g.Nodes, "_spf.new.example.com")
+	assert.NoError(t, g.Nodes["_spf.new.example.com"].Err)
+	assert.Equal(t, "v=spf1 ip4:192.0.2.0/24 -all", g.Nodes["_spf.new.example.com"].Record)
+}
+
+// familyIPResolver is a fakeIPResolver that answers per family and records
+// the networks asked for, like net.Resolver.LookupIP.
+type familyIPResolver struct {
+	fakeIPResolver
+	networks []string
+}
+
+func (f *familyIPResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	f.networks = append(f.networks, network)
+	addrs, err := f.LookupIPAddr(ctx, host)
+	var out []net.IP
+	for _, a := range addrs {
+		if network == "ip" || (network == "ip4") == (a.IP.To4() != nil) {
+			out = append(out, a.IP)
+		}
+	}
+	return out, err
+}
+
+func TestWithExistsAAAA(t *testing.T) {
+	txts := fakeTXTMap{"example.com": {"v=spf1 exists:v6only.example -all"}}
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+
+	ips := &familyIPResolver{fakeIPResolver: fakeIPResolver{"v6only.example": {"2001:db8::1"}}}
+	res, err := NewChecker(dns.NewCustomDNSResolver(txts, ips), WithQueryTrace()).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Fail, res.Code, "RFC 7208 section 5.7: A records only")
+	assert.Equal(t, 1, res.VoidLookups)
+	assert.Equal(t, []string{"ip4"}, ips.networks, "no AAAA query is sent")
+	assert.Equal(t, "A", res.Trace[len(res.Trace)-1].QueryType)
+
+	ips.networks = nil
+	res, err = NewChecker(dns.NewCustomDNSResolver(txts, ips), WithExistsAAAA(), WithQueryTrace()).Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+	assert.Empty(t, ips.networks, "both families through LookupIPAddr")
+	assert.Equal(t, "A/AAAA", res.Trace[len(res.Trace)-1].QueryType)
+}
+
+func TestWithModifierHandler(t *testing.T) {
+	txts := &countingTXT{fakeTXTMap: fakeTXTMap{
+		"example.com":      {"v=spf1 ra=postmaster rp=100 include:_spf.example.com -all"},
+		"_spf.example.com": {"v=spf1 rr=%{d}:all ip4:192.0.2.0/24 -all"},
+	}, ttl: time.Minute}
+	type seen struct {
+		domain string
+		mod    parser.Modifier
+	}
+	var got []seen
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, nil),
+		WithDecisionCache(DecisionCacheConfig{}),
+		WithModifierHandler(func(ctx context.Context, domain string, m parser.Modifier) {
+			got = append(got, seen{domain, m})
+		}))
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "a@example.com"}
+
+	res, err := ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code, "unknown modifiers do not change the result")
+	want := []seen{
+		{"example.com", parser.Modifier{Name: "ra", Value: "postmaster"}},
+		{"example.com", parser.Modifier{Name: "rp", Value: "100"}},
+		{"_spf.example.com", parser.Modifier{Name: "rr", Value: "%{d}:all", Macro: true}},
+	}
+	assert.Equal(t, want, got)
+
+	// a second check is not answered from the decision cache
+	got = nil
+	res, err = ch.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.False(t, res.Cached)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,54 @@
+package spf
+
+import (
+	"context"
+	"errors"
+
+	"github.com/t0gun/go-spf/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// WithOrgDomainFallback enables a non-RFC heuristic some anti-spam stacks
+// expect: when the evaluated domain publishes no SPF record or does not
+// exist, the record of its organizational domain (the public suffix plus one
+// label, e.g. example.co.uk for mail.example.co.uk) is evaluated instead.
+// Results produced this way have OrgFallback set and a trace note.
+func WithOrgDomainFallback() Option {
+	return func(c *Checker) {
+		c.orgFallback = true
+	}
+}
+
+// checkOrgDomain re-runs req against the organizational domain of the
+// domain that produced the None result res.  res is returned unchanged when
+// the domain is already organizational, the suffix cannot be determined or
+// the organizational domain yields None as well.
+func (c *Checker) checkOrgDomain(ctx context.Context, req Request, res CheckHostResult) (CheckHostResult, error) {
+	if !errors.Is(res.Cause, ErrNoSPFRecord) && !errors.Is(res.Cause, dns.ErrNoDNSrecord) {
+		// malformed domains stay None
+		return res, nil
+	}
+	// publicsuffix expects the lower-case A-label form without the root dot
+	domain, err := c.parserOpts.ValidateDomain(req.StartDomain())
+	if err != nil {
+		return res, nil
+	}
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil || sameDomain(org, domain) {
+		return res, nil
+	}
+
+	req.Domain = org
+	orgRes, err := c.check(ctx, req, c.Resolver)
+	if err != nil {
+		return orgRes, err
+	}
+	if orgRes.Code == None {
+		// nothing to fall back to; keep the result of the domain itself
+		return res, nil
+	}
+	orgRes.OrgFallback = true
+	note := TraceEntry{Domain: domain, Note: "non-RFC: no SPF record, using organizational domain " + org}
+	orgRes.Trace = append([]TraceEntry{note}, orgRes.Trace...)
+	return orgRes, nil
+}
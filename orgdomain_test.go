@@ -0,0 +1,60 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestWithOrgDomainFallback(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.co.uk":       {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"mail.example.co.uk":  {"google-site-verification=abc"},
+		"own.example.co.uk":   {"v=spf1 -all"},
+		"other.example.co.uk": {"v=spf1 +all"},
+	}
+	ip := net.ParseIP("192.0.2.1")
+
+	cases := []struct {
+		name         string
+		domain       string
+		opts         []Option
+		want         Result
+		wantFallback bool
+	}{
+		{"disabled by default", "mail.example.co.uk", nil, None, false},
+		{"no record uses org domain", "mail.example.co.uk", []Option{WithOrgDomainFallback()}, Pass, true},
+		{"nxdomain uses org domain", "gone.example.co.uk", []Option{WithOrgDomainFallback()}, Pass, true},
+		{"own record wins", "own.example.co.uk", []Option{WithOrgDomainFallback()}, Fail, false},
+		{"org domain itself", "example.co.uk", []Option{WithOrgDomainFallback()}, Pass, false},
+		{"org domain without record", "mail.nospf.example", []Option{WithOrgDomainFallback()}, None, false},
+		{"mixed case and root dot", "Mail.Example.CO.UK.", []Option{WithOrgDomainFallback()}, Pass, true},
+		{"internationalized name", "mail.bücher.example.co.uk", []Option{WithOrgDomainFallback()}, Pass, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil), tc.opts...)
+			res, err := ch.Check(context.Background(), Request{IP: ip, Domain: tc.domain})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			assert.Equal(t, tc.wantFallback, res.OrgFallback)
+			if tc.wantFallback {
+				require.NotEmpty(t, res.Trace)
+				assert.Contains(t, res.Trace[0].Note, "non-RFC")
+				want, err := parser.ValidateDomain(tc.domain)
+				require.NoError(t, err)
+				assert.Equal(t, want, res.Trace[0].Domain)
+			} else {
+				for _, e := range res.Trace {
+					assert.NotContains(t, e.Note, "non-RFC")
+				}
+			}
+		})
+	}
+}
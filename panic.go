@@ -0,0 +1,49 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/t0gun/go-spf/macro"
+)
+
+// InternalError describes a panic recovered during evaluation, for example
+// from a resolver backend bug.  It is wrapped, together with ErrInternal, by
+// the Cause of the result; use errors.As to retrieve it.
+type InternalError struct {
+	Value any    // value passed to panic
+	Stack []byte // goroutine stack at the time of the panic
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("panic during evaluation: %v", e.Value)
+}
+
+// PanicHook is called with every panic recovered during evaluation, before
+// the result is returned, so the stack can be logged or reported.
+type PanicHook func(ctx context.Context, req Request, e *InternalError)
+
+// WithPanicHook installs h, see PanicHook.
+func WithPanicHook(h PanicHook) Option {
+	return func(c *Checker) {
+		c.panicHook = h
+	}
+}
+
+// recoverPanic turns a panic in the evaluation of req into the internal
+// error result chosen by WithInternalErrorAction, so a single bad record or
+// resolver cannot crash the embedding MTA.  It must be deferred directly.
+func (c *Checker) recoverPanic(ctx context.Context, req Request, res *CheckHostResult, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	ie := &InternalError{Value: v, Stack: debug.Stack()}
+	if c.panicHook != nil {
+		c.panicHook(ctx, req, ie)
+	}
+	// the evaluation state is unusable, start a fresh trace
+	ev := &evaluation{vars: macro.Vars{Domain: req.StartDomain()}, maxLookups: c.MaxLookups}
+	*res, *err = ev.finish(c.internalError(ev, ie)), nil
+}
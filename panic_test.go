@@ -0,0 +1,46 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// panicIPResolver is an IPResolver with a bug.
+type panicIPResolver struct{}
+
+func (panicIPResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	panic("resolver bug")
+}
+
+func TestChecker_RecoversPanic(t *testing.T) {
+	var hooked *InternalError
+	r := dns.NewCustomDNSResolver(&fakeResolver{txts: []string{"v=spf1 a -all"}}, panicIPResolver{})
+	ch := NewChecker(r, WithInternalErrorAction(InternalPermError), WithPanicHook(func(ctx context.Context, req Request, e *InternalError) {
+		hooked = e
+	}))
+
+	res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, PermError, res.Code)
+	require.ErrorIs(t, res.Cause, ErrInternal)
+	var ie *InternalError
+	require.True(t, errors.As(res.Cause, &ie))
+	assert.Equal(t, "resolver bug", ie.Value)
+	assert.NotEmpty(t, ie.Stack)
+	assert.Same(t, ie, hooked)
+	assert.EqualValues(t, 1, ch.InternalErrors())
+
+	rec, perr := parser.Parse("v=spf1 a -all")
+	require.NoError(t, perr)
+	res, err = ch.Evaluate(context.Background(), net.ParseIP("192.0.2.1"), "example.com", rec, "")
+	require.NoError(t, err)
+	assert.Equal(t, PermError, res.Code)
+	assert.EqualValues(t, 2, ch.InternalErrors())
+}
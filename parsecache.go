@@ -0,0 +1,78 @@
+package spf
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/t0gun/go-spf/parser"
+)
+
+// DefaultParseCacheSize is the number of records WithParseCache keeps when
+// given a size of zero or less.
+const DefaultParseCacheSize = 1024
+
+// WithParseCache keeps the parse results of the size most recently used
+// record texts, so repeated evaluations of popular domains skip parsing.
+// Unlike WithDecisionCache it does not change any result: entries are keyed
+// by the exact record text, records that fail to parse are cached with
+// their error, and evaluation never modifies a parsed record.  The TXT
+// lookups still happen on every evaluation.
+func WithParseCache(size int) Option {
+	return func(c *Checker) {
+		if size <= 0 {
+			size = DefaultParseCacheSize
+		}
+		c.parsed = &parseCache{size: size, ll: list.New(), items: map[string]*list.Element{}}
+	}
+}
+
+// parseCache is a least recently used cache of parser results.
+type parseCache struct {
+	size int
+
+	mu    sync.Mutex
+	ll    *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type parseEntry struct {
+	text string
+	rec  *parser.Record
+	err  error
+}
+
+// parse returns the cached result for text, parsing it with opts on a miss.
+func (pc *parseCache) parse(opts parser.Options, text string) (*parser.Record, error) {
+	pc.mu.Lock()
+	if el, ok := pc.items[text]; ok {
+		pc.ll.MoveToFront(el)
+		e := el.Value.(*parseEntry)
+		pc.mu.Unlock()
+		return e.rec, e.err
+	}
+	pc.mu.Unlock()
+
+	// parse outside the lock; a concurrent miss on the same text parses twice
+	rec, err := opts.Parse(text)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if _, ok := pc.items[text]; !ok {
+		pc.items[text] = pc.ll.PushFront(&parseEntry{text: text, rec: rec, err: err})
+		if pc.ll.Len() > pc.size {
+			oldest := pc.ll.Back()
+			pc.ll.Remove(oldest)
+			delete(pc.items, oldest.Value.(*parseEntry).text)
+		}
+	}
+	return rec, err
+}
+
+// parse parses a record with the Checker's parser options and quirks,
+// through the parse cache when one is configured.
+func (c *Checker) parse(text string) (*parser.Record, error) {
+	if c.parsed == nil {
+		return c.recordOptions().Parse(text)
+	}
+	return c.parsed.parse(c.recordOptions(), text)
+}
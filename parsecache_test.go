@@ -0,0 +1,88 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+func TestParseCache(t *testing.T) {
+	ch := NewChecker(nil, WithParseCache(2))
+
+	a, err := ch.parse("v=spf1 a -all")
+	require.NoError(t, err)
+	again, err := ch.parse("v=spf1 a -all")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+
+	// parse errors are cached too
+	_, err = ch.parse("v=spf1 bogus")
+	require.Error(t, err)
+	_, err2 := ch.parse("v=spf1 bogus")
+	assert.Same(t, err, err2)
+
+	// "v=spf1 a -all" was used before "v=spf1 bogus" and is evicted first
+	_, err = ch.parse("v=spf1 mx -all")
+	require.NoError(t, err)
+	assert.Equal(t, 2, ch.parsed.ll.Len())
+	assert.NotContains(t, ch.parsed.items, "v=spf1 a -all")
+	assert.Contains(t, ch.parsed.items, "v=spf1 bogus")
+
+	assert.Equal(t, DefaultParseCacheSize, NewChecker(nil, WithParseCache(0)).parsed.size)
+}
+
+func TestWithParseCacheResults(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":      {"v=spf1 include:_spf.example.net -all"},
+		"_spf.example.net": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}
+	plain := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	cached := NewChecker(dns.NewCustomDNSResolver(txt, nil), WithParseCache(8))
+	for _, ip := range []string{"192.0.2.1", "198.51.100.1", "192.0.2.1"} {
+		req := Request{IP: net.ParseIP(ip), MailFrom: "alice@example.com"}
+		want, err := plain.Check(context.Background(), req)
+		require.NoError(t, err)
+		got, err := cached.Check(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, want.Code, got.Code)
+		assert.Equal(t, want.Trace, got.Trace)
+	}
+	assert.Equal(t, 2, cached.parsed.ll.Len())
+}
+
+// flattenedRecord resembles a large flattened record of n networks.
+func flattenedRecord(n int) string {
+	terms := []string{"v=spf1"}
+	for i := range n {
+		terms = append(terms, fmt.Sprintf("ip4:10.%d.%d.0/24", i/256, i%256))
+	}
+	return strings.Join(append(terms, "ip6:2001:db8::/32", "-all"), " ")
+}
+
+func BenchmarkParseFlattened(b *testing.B) {
+	rec := flattenedRecord(40)
+	b.Run("parser", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := parser.Parse(rec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cache", func(b *testing.B) {
+		ch := NewChecker(nil, WithParseCache(0))
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := ch.parse(rec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
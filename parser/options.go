@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"errors"
+
+	"golang.org/x/net/idna"
+)
+
+// Options adjusts how records are split into terms and how names in them
+// are validated.  The zero value is what the package-level Parse, Tokenize,
+// ValidateDomain and ValidateTargetName use: terms separated by spaces only,
+// idna.Lookup for domains, the same profile without the STD3 rules for
+// targets, followed by the letter-digit-hyphen label check.
+//
+// Parse rejects record text outside printable ASCII with ErrInvalidByte
+// before any name is validated, so a U-label such as "a:bücher.example" in
+// a record is an error whatever the IDNA settings.  They apply to names
+// validated directly, such as the starting domain of a check, and to
+// names produced by macro expansion, which may carry non-ASCII input such
+// as the local part of an internationalized sender.
+//
+// idna.Lookup rejects names such as "-legacy.example.com" that still appear
+// in published records.  A custom IDNA profile, or none at all, lets callers
+// accept them; the label check is then left to the profile and only the
+// length and empty-label rules of RFC 7208 section 4.3 remain.
+type Options struct {
+	// LenientWhitespace accepts tabs, CR and LF wherever a space may
+	// appear in a record, as many receivers do, instead of rejecting them
+	// with ErrInvalidByte.  Records are then split into terms at any of
+	// them.  Other control characters are still rejected.
+	LenientWhitespace bool
+
+	// IDNA converts names to their A-label form, for example
+	// idna.Registration or a profile built with idna.New.  nil selects the
+	// default profiles.
+	IDNA *idna.Profile
+
+	// NoIDNA disables IDNA mapping: names must already be printable ASCII
+	// and are only lower-cased.  It takes precedence over IDNA.
+	NoIDNA bool
+
+	// Validate, when set, replaces the validation of ValidateDomain and
+	// ValidateTargetName, and so of every name Parse checks.  target is
+	// true for target names, whose labels may contain underscores.  It
+	// returns the name to use, normally in lower-case A-label form.
+	// Embedders with unusual namespaces can relax single rules and defer
+	// to the zero Options for the rest, e.g. to accept single-label
+	// intranet names:
+	//
+	//	Validate: func(name string, target bool) (string, error) {
+	//		if !strings.Contains(strings.TrimSuffix(name, "."), ".") {
+	//			return strings.ToLower(strings.TrimSuffix(name, ".")), nil
+	//		}
+	//		if target {
+	//			return parser.ValidateTargetName(name)
+	//		}
+	//		return parser.ValidateDomain(name)
+	//	}
+	//
+	// IDNA and NoIDNA are not consulted when Validate is set.
+	Validate func(name string, target bool) (string, error)
+}
+
+// errNotASCII is reported when NoIDNA is set and a name is not printable
+// ASCII.  validate maps it to ErrIDNAConversion.
+var errNotASCII = errors.New("name is not printable ASCII")
+
+// ValidateDomain is the package-level ValidateDomain using o.
+func (o Options) ValidateDomain(raw string) (string, error) {
+	if o.Validate != nil {
+		return o.Validate(raw, false)
+	}
+	return o.validate(raw, false)
+}
+
+// ValidateTargetName is the package-level ValidateTargetName using o.
+func (o Options) ValidateTargetName(raw string) (string, error) {
+	if o.Validate != nil {
+		return o.Validate(raw, true)
+	}
+	return o.validate(raw, true)
+}
+
+// toASCII converts name to its A-label form with the profile selected by o.
+func (o Options) toASCII(name string, allowUnderscore bool) (string, error) {
+	switch {
+	case o.NoIDNA:
+		for i := 0; i < len(name); i++ {
+			if name[i] <= 0x20 || name[i] >= 0x7f {
+				return "", errNotASCII
+			}
+		}
+		return name, nil
+	case o.IDNA != nil:
+		return o.IDNA.ToASCII(name)
+	case allowUnderscore:
+		return relaxedProfile.ToASCII(name)
+	default:
+		return idna.Lookup.ToASCII(name)
+	}
+}
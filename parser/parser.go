@@ -41,7 +41,7 @@ type Mechanism struct {
 	Domain string     // only a, mx, include, exists use this
 	Mask4  int        // only a/mx when dual CIDR present
 	Mask6  int
-	Macro  bool // only exists and later exp uses this
+	Macro  bool // domain-spec contains macros that need expansion
 }
 
 // Record holds a parsed SPF record.
@@ -60,16 +60,45 @@ var (
 	ErrLabelTooLong   = errors.New("domain label exceeds 63 octets")
 	ErrDomainTooLong  = errors.New("domain exceeds 255 octets")
 	ErrIDNAConversion = errors.New("IDNA ToASCII failed")
+	ErrInvalidLabel   = errors.New("domain label is not letters, digits and hyphens")
 )
 
+// relaxedProfile is idna.Lookup without the STD3 ASCII rules, so labels such
+// as "_spf" survive IDNA conversion and reach the explicit LDH check.
+var relaxedProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
 var ErrNotModifier = errors.New("-not-modifier")
 
+// errNoMatch is returned by a mechanism parser when the term is not its
+// mechanism, telling the dispatcher to try the next parser.  It is a shared
+// value because every term passes through several parsers.
+var errNoMatch = errors.New("no match")
+
+// Errors for terms that are not valid mechanisms.
+var (
+	ErrUnknownMechanism = errors.New("unknown mechanism")
+	ErrAllArgument      = errors.New("all takes no arguments")
+)
+
+// ErrInvalidByte is returned by Parse for a record holding a byte outside
+// the printable ASCII range RFC 7208 section 4.6.1 allows, such as NUL,
+// another control character or the first byte of a UTF-8 sequence.  Names
+// in records must therefore be written as A-labels; see
+// Options.LenientWhitespace for tabs and line breaks.
+var ErrInvalidByte = errors.New("invalid byte in record")
+
 /* ========= public parser entry-point ========= */
 // Parse checks the record syntax defined in RFC 7208 section 4.6 and returns a structured representation.
 // The function performs no DNS lookups or macro expansion; evaluation according to section 5 is handled elsewhere.
 
 func Parse(rawTXT string) (*Record, error) {
-	tokens, tokErr := tokenizer(rawTXT)
+	return Options{}.Parse(rawTXT)
+}
+
+// Parse is the package-level Parse with the name validation and whitespace
+// handling selected by o.
+func (o Options) Parse(rawTXT string) (*Record, error) {
+	tokens, tokErr := o.tokenizer(rawTXT)
 	if tokErr != nil {
 		return nil, tokErr
 	}
@@ -77,8 +106,8 @@ func Parse(rawTXT string) (*Record, error) {
 	// ordered list of mechanism parsers
 	mechParsers := []func(Qualifier, string) (*Mechanism, error){
 		parseAll, parseIP4, parseIP6,
-		parseA, parseMX, parsePTR,
-		parseExists, parseInclude,
+		o.parseA, o.parseMX, parsePTR,
+		parseExists, o.parseInclude,
 	}
 	record := &Record{}
 	for _, tok := range tokens {
@@ -94,10 +123,11 @@ func Parse(rawTXT string) (*Record, error) {
 					return nil, fmt.Errorf("duplicate redirect")
 				}
 				if !strings.ContainsRune(mod.Value, '%') {
-					if _, e := ValidateDomain(mod.Value); e != nil {
+					if _, e := o.ValidateTargetName(mod.Value); e != nil {
 						return nil, e
 					}
 				}
+				mod.Value = trimRootDot(mod.Value)
 				record.Redirect = mod
 				mod.Macro = strings.ContainsRune(mod.Value, '%')
 
@@ -106,16 +136,17 @@ func Parse(rawTXT string) (*Record, error) {
 					return nil, fmt.Errorf("duplicate exp")
 				}
 				if !strings.ContainsRune(mod.Value, '%') {
-					if _, e := ValidateDomain(mod.Value); e != nil {
+					if _, e := o.ValidateTargetName(mod.Value); e != nil {
 						return nil, e
 					}
 				}
+				mod.Value = trimRootDot(mod.Value)
 				record.Exp = mod
 				mod.Macro = strings.ContainsRune(mod.Value, '%')
 
 			default:
-				record.Unknown = append(record.Unknown, *mod)
 				mod.Macro = strings.ContainsRune(mod.Value, '%')
+				record.Unknown = append(record.Unknown, *mod)
 
 			}
 			continue // done with this token skip to next loop
@@ -128,15 +159,21 @@ func Parse(rawTXT string) (*Record, error) {
 
 		// mechanisms are discovered from this point
 		q, rest := stripQualifier(tok)
+		rest = lowerName(rest)
 		var mech *Mechanism
 		var perr error
 		for _, pf := range mechParsers {
-			if mech, perr = pf(q, rest); perr == nil {
-				break // found a match
+			// stop at the first parser that claims the term, whether or not
+			// its arguments are valid, so its diagnostic is kept
+			if mech, perr = pf(q, rest); !errors.Is(perr, errNoMatch) {
+				break
 			}
 		}
-		if perr != nil || mech == nil {
-			return nil, fmt.Errorf("permerror: %v", perr)
+		if errors.Is(perr, errNoMatch) {
+			return nil, fmt.Errorf("permerror: %w %q", ErrUnknownMechanism, tok)
+		}
+		if perr != nil {
+			return nil, fmt.Errorf("permerror: %w", perr)
 		}
 		record.Mechs = append(record.Mechs, *mech)
 	}
@@ -146,11 +183,13 @@ func Parse(rawTXT string) (*Record, error) {
 // tokenizer splits a raw SPF record into whitespace-separated terms and drops
 // the leading "v=spf1" version tag.  It implements the tokenisation described
 // in RFC 7208 section 4.6.
-func tokenizer(raw string) ([]string, error) {
-	raw = strings.TrimSpace(raw)
-	if !strings.HasPrefix(strings.ToLower(raw), "v=spf1") {
+func (o Options) tokenizer(raw string) ([]string, error) {
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(raw)), "v=spf1") {
 		return nil, fmt.Errorf("missing v=spf1")
 	}
+	if err := checkBytes(raw, o.LenientWhitespace); err != nil {
+		return nil, err
+	}
 	// throw away version tag
 	fields := strings.Fields(raw)[1:]
 	// sanity check
@@ -160,6 +199,40 @@ func tokenizer(raw string) ([]string, error) {
 	return fields, nil
 }
 
+// checkBytes rejects raw unless it is printable ASCII separated by spaces,
+// the only characters the section 4.6.1 grammar allows, or also by tabs, CR
+// and LF when lenient is set.  TXT data is attacker-controlled, so the error
+// names the byte and its offset in raw rather than letting it reach a term
+// parser.
+func checkBytes(raw string, lenient bool) error {
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case lenient && isLenientSpace(c):
+		case c == 0:
+			return fmt.Errorf("permerror: %w: NUL at offset %d", ErrInvalidByte, i)
+		case c < ' ' || c == 0x7f:
+			return fmt.Errorf("permerror: %w: control character 0x%02x at offset %d", ErrInvalidByte, c, i)
+		case c >= 0x80:
+			return fmt.Errorf("permerror: %w: non-ASCII byte 0x%02x at offset %d", ErrInvalidByte, c, i)
+		}
+	}
+	return nil
+}
+
+// isLenientSpace reports whether c separates terms under
+// Options.LenientWhitespace in addition to the space.
+func isLenientSpace(c byte) bool {
+	return c == '\t' || c == '\r' || c == '\n'
+}
+
+// trimRootDot removes the single trailing dot of a fully qualified
+// domain-spec such as "example.com.", so targets are stored in one form
+// whether or not they contain macros.  Names are always absolute in SPF.
+func trimRootDot(spec string) string {
+	return strings.TrimSuffix(spec, ".")
+}
+
 // stripQualifier returns the qualifier (+, -, ~, ?) and the remainder of the token.
 // if no qualifier is present, QPlus is implied.
 func stripQualifier(tok string) (Qualifier, string) {
@@ -174,20 +247,45 @@ func stripQualifier(tok string) (Qualifier, string) {
 	}
 }
 
+// lowerName lower-cases the mechanism name at the start of a term, the part
+// before its ':' or '/' argument separator.  Names are case-insensitive
+// (RFC 7208 section 4.6.1); arguments keep their case, since macro letters
+// in a domain-spec are significant.
+func lowerName(term string) string {
+	end := strings.IndexAny(term, ":/")
+	if end < 0 {
+		end = len(term)
+	}
+	return strings.ToLower(term[:end]) + term[end:]
+}
+
 // parseAll parses the "all" mechanism.  It matches any sender and has no
 // arguments as specified in RFC 7208 section 5.1.
 func parseAll(q Qualifier, rest string) (*Mechanism, error) {
+	if !isTerm(rest, "all") {
+		return nil, errNoMatch
+	}
 	if rest != "all" {
-		return nil, fmt.Errorf("not all")
+		return nil, fmt.Errorf("%w: %q", ErrAllArgument, rest)
 	}
 	return &Mechanism{Qual: q, Kind: "all"}, nil
 }
 
+// isTerm reports whether rest is the mechanism name, alone or followed by
+// its ':' or '/' argument separator.  It keeps tokens such as "allow" or
+// "mxfoo" from being claimed by the parser of a shorter name.
+func isTerm(rest, name string) bool {
+	if !strings.HasPrefix(rest, name) {
+		return false
+	}
+	return len(rest) == len(name) || rest[len(name)] == ':' || rest[len(name)] == '/'
+}
+
 // parseIP4 parses the "ip4" mechanism which matches IPv4 networks as described
 // in RFC 7208 section 5.2.
 func parseIP4(q Qualifier, rest string) (*Mechanism, error) {
 	if !strings.HasPrefix(rest, "ip4:") {
-		return nil, fmt.Errorf("no match")
+		return nil, errNoMatch
 	}
 
 	cidr := strings.TrimPrefix(rest, "ip4:")
@@ -218,7 +316,7 @@ func parseIP4(q Qualifier, rest string) (*Mechanism, error) {
 // RFC 7208 section 5.2.
 func parseIP6(q Qualifier, rest string) (*Mechanism, error) {
 	if !strings.HasPrefix(rest, "ip6:") {
-		return nil, fmt.Errorf("no match")
+		return nil, errNoMatch
 	}
 	cidr := strings.TrimPrefix(rest, "ip6:")
 
@@ -256,9 +354,9 @@ func parseIP6(q Qualifier, rest string) (*Mechanism, error) {
 // If a slash segment is missing, defaults are /32 for IPv4 and /128 for IPv6.
 // Any syntax violation is a permerror (we return a regular error and let the
 // caller wrap it as permerror).
-func parseA(q Qualifier, rest string) (*Mechanism, error) {
-	if !strings.HasPrefix(rest, "a") {
-		return nil, fmt.Errorf("no match") // dispatcher will try the next helper
+func (o Options) parseA(q Qualifier, rest string) (*Mechanism, error) {
+	if !isTerm(rest, "a") {
+		return nil, errNoMatch // dispatcher will try the next helper
 	}
 	// chop off leading "a"
 	spec := rest[1:]       // could be "", ":domain", "/mask", ":domain/...", etc.
@@ -281,12 +379,14 @@ func parseA(q Qualifier, rest string) (*Mechanism, error) {
 		afterColon := strings.TrimPrefix(spec, ":")
 		// split once: left = domain, right (optional) = "mask" or "mask4/mask6"
 		domainPart, maskPart, _ := strings.Cut(afterColon, "/")
-		// check domain part
+		// check domain part, macro-containing specs are validated after expansion
 		if domainPart != "" {
-			if _, err := ValidateDomain(domainPart); err != nil {
-				return nil, fmt.Errorf("bad a record domain %q", domainPart)
+			if !strings.ContainsRune(domainPart, '%') {
+				if _, err := o.ValidateTargetName(domainPart); err != nil {
+					return nil, fmt.Errorf("bad a record domain %q", domainPart)
+				}
 			}
-			domain = domainPart
+			domain = trimRootDot(domainPart)
 		}
 		// check if mask exists
 		if maskPart != "" {
@@ -308,6 +408,7 @@ func parseA(q Qualifier, rest string) (*Mechanism, error) {
 		Domain: domain, // "" = current domain
 		Mask4:  mask4,
 		Mask6:  mask6,
+		Macro:  strings.ContainsRune(domain, '%'),
 	}, nil
 }
 
@@ -317,20 +418,33 @@ func parseA(q Qualifier, rest string) (*Mechanism, error) {
 //
 //	"24"       -> mask4=24 mask6=-1
 //	"24/64"    -> mask4=24 mask6=64
+//	"24//64"   -> mask4=24 mask6=64  (RFC 7208 dual-cidr-length form)
+//	"/64"      -> mask4=-1 mask6=64  (from "a//64")
 //
 // Returns error if:
-//   - non-decimal
-//   - /0 CIDR that exceeds bounds (0–32, 0–128)
+//   - a length is empty, signed, non-decimal or has a leading zero
+//     (RFC 7208 ABNF: "0" / %x31-39 0*1DIGIT)
+//   - a length exceeds its bounds (0–32, 0–128)
 //   - more than two slash-separated parts
 func parseMasks(maskstr string) (mask4, mask6 int, err error) {
 	toInt := func(s string, max int) (int, error) {
+		if s == "" || strings.Trim(s, "0123456789") != "" || (len(s) > 1 && s[0] == '0') {
+			return 0, fmt.Errorf("invalid cidr length %q", s)
+		}
 		n, e := strconv.Atoi(s)
-		if e != nil || n < 0 || n > max {
+		if e != nil || n > max {
 			return 0, fmt.Errorf("cidr out of range")
 		}
 		return n, nil
 	}
 
+	// RFC 7208 section 5.6 separates the ip6 length with "//"
+	if v6, ok := strings.CutPrefix(maskstr, "/"); ok {
+		mask6, err = toInt(v6, 128)
+		return -1, mask6, err
+	}
+	maskstr = strings.Replace(maskstr, "//", "/", 1)
+
 	parts := strings.Split(maskstr, "/")
 	switch len(parts) {
 	case 1:
@@ -365,9 +479,9 @@ func parseMasks(maskstr string) (mask4, mask6 int, err error) {
 //
 // Any syntax error is a permerror; the helper returns a normal error and the
 // dispatcher wraps it.
-func parseMX(q Qualifier, rest string) (*Mechanism, error) {
-	if !strings.HasPrefix(rest, "mx") {
-		return nil, fmt.Errorf("no match") // dispatcher will try the next helper
+func (o Options) parseMX(q Qualifier, rest string) (*Mechanism, error) {
+	if !isTerm(rest, "mx") {
+		return nil, errNoMatch // dispatcher will try the next helper
 	}
 	spec := rest[2:] // trim leading mx
 	domain := ""     // empty = “current” SPF domain
@@ -388,10 +502,12 @@ func parseMX(q Qualifier, rest string) (*Mechanism, error) {
 		afterColon := strings.TrimPrefix(spec, ":")
 		domainPart, maskPart, _ := strings.Cut(afterColon, "/")
 		if domainPart != "" {
-			if _, err := ValidateDomain(domainPart); err != nil {
-				return nil, fmt.Errorf("bad domain %q", domainPart)
+			if !strings.ContainsRune(domainPart, '%') {
+				if _, err := o.ValidateTargetName(domainPart); err != nil {
+					return nil, fmt.Errorf("bad domain %q", domainPart)
+				}
 			}
-			domain = domainPart
+			domain = trimRootDot(domainPart)
 		}
 		if maskPart != "" {
 			var err error
@@ -410,6 +526,7 @@ func parseMX(q Qualifier, rest string) (*Mechanism, error) {
 		Domain: domain,
 		Mask4:  mask4,
 		Mask6:  mask6,
+		Macro:  strings.ContainsRune(domain, '%'),
 	}, nil
 }
 
@@ -422,15 +539,18 @@ func parseMX(q Qualifier, rest string) (*Mechanism, error) {
 // in Mechanism.Domain; macro expansion happens during evaluation.
 // ptr is strongly discouraged in spf records and may course unnecessary lookups
 func parsePTR(q Qualifier, rest string) (*Mechanism, error) {
-	if !strings.HasPrefix(rest, "ptr") {
-		return nil, fmt.Errorf(" no match")
+	if !isTerm(rest, "ptr") {
+		return nil, errNoMatch
 	}
 	spec := rest[3:] // trim leading "ptr"
 	switch {
 	case spec == "":
 		// bare "ptr" - nothing to do here
 	case strings.HasPrefix(spec, ":"):
-		spec = strings.TrimPrefix(spec, ":")
+		spec = trimRootDot(strings.TrimPrefix(spec, ":"))
+	default:
+		// ptr takes no CIDR length
+		return nil, fmt.Errorf("invalid ptr-mechanism syntax %q", rest)
 	}
 	return &Mechanism{
 		Qual:   q,
@@ -452,9 +572,9 @@ func parsePTR(q Qualifier, rest string) (*Mechanism, error) {
 func parseExists(q Qualifier, rest string) (*Mechanism, error) {
 	const prefix = "exists:"
 	if !strings.HasPrefix(rest, prefix) {
-		return nil, fmt.Errorf("no match")
+		return nil, errNoMatch
 	}
-	spec := rest[len(prefix):]
+	spec := trimRootDot(rest[len(prefix):])
 	if spec == "" {
 		return nil, fmt.Errorf("empty exists domain") // will break spf
 	}
@@ -474,15 +594,20 @@ func parseExists(q Qualifier, rest string) (*Mechanism, error) {
 // validated here; actual DNS lookups and macro expansion happen later.
 // On success, it returns a Mechanism with Kind="include", Domain set to
 // the raw spec, Macro=true if any '%' appears, and the given qualifier.
-func parseInclude(q Qualifier, rest string) (*Mechanism, error) {
+func (o Options) parseInclude(q Qualifier, rest string) (*Mechanism, error) {
 	const prefix = "include:"
 	if !strings.HasPrefix(rest, prefix) {
-		return nil, fmt.Errorf("no match")
+		return nil, errNoMatch
 	}
-	spec := rest[len(prefix):]
+	spec := trimRootDot(rest[len(prefix):])
 	if spec == "" {
 		return nil, fmt.Errorf("include has an empty domain") // will break spf
 	}
+	if !strings.ContainsRune(spec, '%') {
+		if _, err := o.ValidateTargetName(spec); err != nil {
+			return nil, fmt.Errorf("bad include domain %q", spec)
+		}
+	}
 	return &Mechanism{
 		Qual:   q,
 		Kind:   "include",
@@ -511,16 +636,33 @@ func parseInclude(q Qualifier, rest string) (*Mechanism, error) {
 // On success the function returns the ASCII (lower-case) domain and nil.
 // On failure, it returns an empty string along with a sentinel error.
 func ValidateDomain(raw string) (string, error) {
+	return Options{}.ValidateDomain(raw)
+}
+
+// ValidateTargetName is ValidateDomain for names used as mechanism and
+// modifier targets (a, mx, include, redirect, exp).  Those are looked up
+// rather than used as host names, so it also accepts underscores, which are
+// ubiquitous in service names such as "_spf.google.com" and
+// "_netblocks.mimecast.com".
+func ValidateTargetName(raw string) (string, error) {
+	return Options{}.ValidateTargetName(raw)
+}
+
+// validate implements ValidateDomain.  When allowUnderscore is set the LDH
+// rule is relaxed to also accept underscores, which appear in service names
+// such as "_spf.example.com".  The LDH rule only applies with the default
+// IDNA profile; a custom or disabled profile owns label syntax.
+func (o Options) validate(raw string, allowUnderscore bool) (string, error) {
 	raw = strings.TrimSpace(raw)
 	// Trim the single trailing dot if any
 	raw = strings.TrimSuffix(raw, ".")
 
-	// convert to A-label RFC 5890 section 2.3
-	ascii, err := idna.Lookup.ToASCII(raw)
+	ascii, err := o.toASCII(raw, allowUnderscore)
 	if err != nil {
 		return "", ErrIDNAConversion
 	}
 	ascii = strings.ToLower(ascii)
+	ldh := !o.NoIDNA && o.IDNA == nil
 
 	// check overall length limit
 	if len(ascii) > 255 {
@@ -540,6 +682,8 @@ func ValidateDomain(raw string) (string, error) {
 		case len(lbl) > 63:
 			return "", ErrLabelTooLong
 
+		case ldh && !isLDHLabel(lbl, allowUnderscore):
+			return "", ErrInvalidLabel
 		}
 
 	}
@@ -547,6 +691,25 @@ func ValidateDomain(raw string) (string, error) {
 	return ascii, nil
 }
 
+// isLDHLabel reports whether lbl follows the letter-digit-hyphen rule of
+// RFC 1123 section 2.1: only a-z, 0-9 and "-", with no hyphen at either end.
+// allowUnderscore additionally admits "_" anywhere in the label.
+func isLDHLabel(lbl string, allowUnderscore bool) bool {
+	if lbl[0] == '-' || lbl[len(lbl)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(lbl); i++ {
+		c := lbl[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+		case c == '_' && allowUnderscore:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // parserModifier splits one SPF term of the form “name=value” into a *Modifier.
 // It performs *only* the neutral syntax work mandated by RFC 7208 section 6:
 //
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/idna"
 )
 
 // ---------- quick helpers ---------- //
@@ -126,6 +127,21 @@ func TestParse(t *testing.T) {
 			spf:     "v=spf1 a24/64/96 -all",
 			wantErr: true,
 		},
+		{
+			name:     "a rfc dual cidr",
+			spf:      "v=spf1 a:mail.example.com/24//64 -all",
+			wantMech: []Mechanism{aMech(QPlus, "mail.example.com", 24, 64), allMech(QMinus, "all")},
+		},
+		{
+			name:     "a ip6 cidr only",
+			spf:      "v=spf1 a//64 -all",
+			wantMech: []Mechanism{aMech(QPlus, "", -1, 64), allMech(QMinus, "all")},
+		},
+		{
+			name:     "a with helo macro",
+			spf:      "v=spf1 a:%{h}/24 -all",
+			wantMech: []Mechanism{{Qual: QPlus, Kind: "a", Domain: "%{h}", Mask4: 24, Mask6: -1, Macro: true}, allMech(QMinus, "all")},
+		},
 		{
 			name:     "mx with masks",
 			spf:      "v=spf1 mx/24 -all",
@@ -179,6 +195,22 @@ func TestParse(t *testing.T) {
 			spf:      "v=spf1 include:_spf.include.com -all",
 			wantMech: []Mechanism{IncMech(QPlus, "_spf.include.com", false), allMech(QMinus, "all")},
 		},
+		{
+			name: "underscore service names as targets",
+			spf:  "v=spf1 include:_spf.google.com include:_netblocks.mimecast.com a:_mta.example.com mx:_mx.example.com -all",
+			wantMech: []Mechanism{IncMech(QPlus, "_spf.google.com", false), IncMech(QPlus, "_netblocks.mimecast.com", false),
+				aMech(QPlus, "_mta.example.com", -1, -1), mxMech(QPlus, "_mx.example.com", -1, -1), allMech(QMinus, "all")},
+		},
+		{
+			name:         "underscore redirect target",
+			spf:          "v=spf1 redirect=_spf.example.com",
+			wantRedirect: mod("redirect=_spf.example.com"),
+		},
+		{
+			name:    "include with invalid domain",
+			spf:     "v=spf1 include:-bad.example.com -all",
+			wantErr: true,
+		},
 		{
 			name: "2 includes then all",
 			spf:  "v=spf1 include:sendgrid.net -include:servers.mcsv.net -all",
@@ -219,6 +251,83 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseMasks(t *testing.T) {
+	cases := []struct {
+		in           string
+		mask4, mask6 int
+		wantErr      bool
+	}{
+		{"24", 24, -1, false},
+		{"0", 0, -1, false},
+		{"32", 32, -1, false},
+		{"24//64", 24, 64, false},
+		{"24/64", 24, 64, false}, // accepted before RFC 7208 dual-cidr support
+		{"/64", -1, 64, false},
+		{"/0", -1, 0, false},
+		{"/128", -1, 128, false},
+		{"33", 0, 0, true},
+		{"24//129", 0, 0, true},
+		{"/129", 0, 0, true},
+		{"", 0, 0, true},
+		{"/", 0, 0, true},
+		{"24//", 0, 0, true},
+		{"24/", 0, 0, true},
+		{"24///64", 0, 0, true},
+		{"24//64//96", 0, 0, true},
+		{"24/64/96", 0, 0, true},
+		{"//64", 0, 0, true},
+		{"+24", 0, 0, true},
+		{"-0", 0, 0, true},
+		{"024", 0, 0, true},
+		{"24//064", 0, 0, true},
+		{"/+64", 0, 0, true},
+		{"x", 0, 0, true},
+	}
+	for _, tc := range cases {
+		m4, m6, err := parseMasks(tc.in)
+		if tc.wantErr {
+			assert.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.mask4, m4, tc.in)
+		assert.Equal(t, tc.mask6, m6, tc.in)
+	}
+}
+
+func TestParseDualCIDR(t *testing.T) {
+	cases := []struct {
+		spf          string
+		mask4, mask6 int
+		wantErr      bool
+	}{
+		{"v=spf1 a//64 -all", -1, 64, false},
+		{"v=spf1 a/24//64 -all", 24, 64, false},
+		{"v=spf1 a:example.com//64 -all", -1, 64, false},
+		{"v=spf1 a:example.com/24//64 -all", 24, 64, false},
+		{"v=spf1 mx//64 -all", -1, 64, false},
+		{"v=spf1 mx:example.com/24//64 -all", 24, 64, false},
+		{"v=spf1 a/24// -all", 0, 0, true},
+		{"v=spf1 mx:example.com///64 -all", 0, 0, true},
+		{"v=spf1 a:example.com/24//129 -all", 0, 0, true},
+	}
+	for _, tc := range cases {
+		rec, err := Parse(tc.spf)
+		if tc.wantErr {
+			assert.Error(t, err, tc.spf)
+			continue
+		}
+		require.NoError(t, err, tc.spf)
+		require.NotEmpty(t, rec.Mechs, tc.spf)
+		assert.Equal(t, tc.mask4, rec.Mechs[0].Mask4, tc.spf)
+		assert.Equal(t, tc.mask6, rec.Mechs[0].Mask6, tc.spf)
+		// the canonical form uses "//" and parses back to the same record
+		again, err := Parse(rec.String())
+		require.NoError(t, err, rec.String())
+		assert.True(t, Equal(rec, again), tc.spf)
+	}
+}
+
 func TestValidateDomain(t *testing.T) {
 	t.Parallel()
 	var longLabel = strings.Repeat("a", 64) + ".com"
@@ -277,3 +386,231 @@ func TestValidateDomain(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateDomainRelaxed(t *testing.T) {
+	tc := []struct {
+		name            string
+		raw             string
+		allowUnderscore bool
+		want            string
+		err             error
+	}{
+		{"strict rejects underscore", "_spf.example.com", false, "", ErrIDNAConversion},
+		{"relaxed accepts leading underscore", "_spf.example.com", true, "_spf.example.com", nil},
+		{"relaxed accepts inner underscore", "mail_out.example.com", true, "mail_out.example.com", nil},
+		{"relaxed still rejects leading hyphen", "-spf.example.com", true, "", ErrIDNAConversion},
+		{"relaxed rejects other symbols", "sp!f.example.com", true, "", ErrInvalidLabel},
+		{"relaxed lower-cases", "_SPF.Example.COM", true, "_spf.example.com", nil},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			validate := Options{}.ValidateDomain
+			if c.allowUnderscore {
+				validate = Options{}.ValidateTargetName
+			}
+			got, err := validate(c.raw)
+			if c.err != nil {
+				require.ErrorIs(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestIsLDHLabel(t *testing.T) {
+	assert.True(t, isLDHLabel("example", false))
+	assert.True(t, isLDHLabel("ex-ample9", false))
+	assert.False(t, isLDHLabel("-example", false))
+	assert.False(t, isLDHLabel("example-", false))
+	assert.False(t, isLDHLabel("ex_ample", false))
+	assert.True(t, isLDHLabel("_spf", true))
+	assert.False(t, isLDHLabel("sp f", true))
+}
+
+func TestValidateTargetName(t *testing.T) {
+	for _, name := range []string{"_spf.google.com", "_netblocks.mimecast.com", "_spf.salesforce.com", "spf.protection.outlook.com"} {
+		got, err := ValidateTargetName(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, name, got)
+	}
+
+	_, err := ValidateTargetName("localhost")
+	require.ErrorIs(t, err, ErrSingleLabel)
+}
+
+func TestParseMixedCaseMechanisms(t *testing.T) {
+	rec, err := Parse("v=spf1 IP4:192.0.2.0/24 Ip6:2001:DB8::/32 A:Example.COM/24//64 MX -PTR Exists:%{I}.Example.com ~Include:_SPF.example.net ?ALL")
+	require.NoError(t, err)
+	lower, err := Parse("v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 a:example.com/24//64 mx -ptr exists:%{I}.Example.com ~include:_spf.example.net ?all")
+	require.NoError(t, err)
+	assert.True(t, Equal(rec, lower))
+	assert.Equal(t, rec.Hash(), lower.Hash())
+	assert.Equal(t, "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 a:example.com/24//64 mx -ptr exists:%{I}.Example.com ~include:_spf.example.net ?all", rec.String())
+
+	// macro letters keep their case
+	assert.Equal(t, "%{I}.Example.com", rec.Mechs[5].Domain)
+
+	_, err = Parse("v=spf1 ALLOW -all")
+	assert.ErrorIs(t, err, ErrUnknownMechanism)
+}
+
+func TestParseNearMissTokens(t *testing.T) {
+	cases := []struct {
+		name    string
+		spf     string
+		wantErr error
+		unknown []Modifier
+	}{
+		{"all with domain", "v=spf1 all:example.com", ErrAllArgument, nil},
+		{"all with cidr", "v=spf1 -all/24", ErrAllArgument, nil},
+		{"all with empty argument", "v=spf1 ~all:", ErrAllArgument, nil},
+		{"allow is not a", "v=spf1 allow -all", ErrUnknownMechanism, nil},
+		{"alls is not all", "v=spf1 alls", ErrUnknownMechanism, nil},
+		{"mxfoo is not mx", "v=spf1 mxfoo -all", ErrUnknownMechanism, nil},
+		{"ptrs is not ptr", "v=spf1 ptrs -all", ErrUnknownMechanism, nil},
+		{"ptr takes no cidr", "v=spf1 ptr/24 -all", nil, nil},
+		{"allow= is an unknown modifier", "v=spf1 allow=foo -all", nil, []Modifier{*mod("allow=foo")}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := Parse(tc.spf)
+			if tc.unknown != nil {
+				require.NoError(t, err)
+				assert.Equal(t, tc.unknown, rec.Unknown)
+				return
+			}
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	legacy := idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.CheckHyphens(false))
+	tc := []struct {
+		name string
+		opts Options
+		raw  string
+		want string
+		err  error
+	}{
+		{"default rejects leading hyphen", Options{}, "-legacy.example.com", "", ErrIDNAConversion},
+		{"custom profile accepts leading hyphen", Options{IDNA: legacy}, "-legacy.example.com", "-legacy.example.com", nil},
+		{"custom profile still maps unicode", Options{IDNA: legacy}, "bücher.example", "xn--bcher-kva.example", nil},
+		{"no idna accepts legacy labels", Options{NoIDNA: true}, "-Legacy_host.example.com.", "-legacy_host.example.com", nil},
+		{"no idna rejects unicode", Options{NoIDNA: true}, "bücher.example", "", ErrIDNAConversion},
+		{"no idna keeps structural checks", Options{NoIDNA: true}, "example..com", "", ErrEmptyLabel},
+		{"registration profile", Options{IDNA: idna.Registration}, "example.com", "example.com", nil},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.opts.ValidateTargetName(c.raw)
+			if c.err != nil {
+				require.ErrorIs(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+
+	// U-labels in record text are rejected before any profile applies
+	for _, o := range []Options{{}, {IDNA: legacy}, {IDNA: idna.Registration}} {
+		_, err := o.Parse("v=spf1 a:bücher.example -all")
+		require.ErrorIs(t, err, ErrInvalidByte)
+	}
+
+	_, err := Parse("v=spf1 include:-legacy.example.com -all")
+	require.Error(t, err)
+	rec, err := Options{NoIDNA: true}.Parse("v=spf1 include:-legacy.example.com a:-legacy.example.com -all")
+	require.NoError(t, err)
+	assert.Equal(t, "-legacy.example.com", rec.Mechs[0].Domain)
+}
+
+func TestOptionsValidate(t *testing.T) {
+	var targets []bool
+	intranet := Options{Validate: func(name string, target bool) (string, error) {
+		targets = append(targets, target)
+		name = strings.TrimSuffix(name, ".")
+		if !strings.Contains(name, ".") {
+			return strings.ToLower(name), nil
+		}
+		return ValidateTargetName(name)
+	}}
+
+	_, err := ValidateDomain("intranet")
+	require.ErrorIs(t, err, ErrSingleLabel)
+	got, err := intranet.ValidateDomain("Intranet.")
+	require.NoError(t, err)
+	assert.Equal(t, "intranet", got)
+
+	rec, err := intranet.Parse("v=spf1 a:mailhub include:_spf.example.com -all")
+	require.NoError(t, err)
+	assert.Equal(t, "mailhub", rec.Mechs[0].Domain)
+	assert.Equal(t, []bool{false, true, true}, targets)
+
+	// the rest of the rules still come from the default validation
+	_, err = intranet.Parse("v=spf1 a:bad..example.com -all")
+	require.Error(t, err)
+}
+
+func TestParseTrailingDot(t *testing.T) {
+	rec, err := Parse("v=spf1 a:mail.example.com./24 mx:example.com. ptr:example.com. exists:%{i}.list.example. include:_spf.example.com. redirect=example.net. exp=explain.example.com.")
+	require.NoError(t, err)
+	var domains []string
+	for _, m := range rec.Mechs {
+		domains = append(domains, m.Domain)
+	}
+	assert.Equal(t, []string{"mail.example.com", "example.com", "example.com", "%{i}.list.example", "_spf.example.com"}, domains)
+	assert.Equal(t, 24, rec.Mechs[0].Mask4)
+	assert.Equal(t, "example.net", rec.Redirect.Value)
+	assert.Equal(t, "explain.example.com", rec.Exp.Value)
+
+	_, err = Parse("v=spf1 include:. -all")
+	require.Error(t, err)
+}
+
+func TestParseInvalidBytes(t *testing.T) {
+	cases := []struct {
+		name string
+		spf  string
+		want string
+	}{
+		{"nul", "v=spf1 a\x00 -all", "NUL at offset 8"},
+		{"tab", "v=spf1\ta -all", "control character 0x09 at offset 6"},
+		{"newline", "v=spf1 a\n-all", "control character 0x0a at offset 8"},
+		{"trailing newline", "v=spf1 -all\r\n", "control character 0x0d at offset 11"},
+		{"del", "v=spf1 a:ex\x7fample.com -all", "control character 0x7f at offset 11"},
+		{"utf-8", "v=spf1 a:bücher.example -all", "non-ASCII byte 0xc3 at offset 10"},
+		{"latin-1", "v=spf1 exp=\xe9.example.com -all", "non-ASCII byte 0xe9 at offset 11"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.spf)
+			require.ErrorIs(t, err, ErrInvalidByte)
+			assert.Contains(t, err.Error(), tc.want)
+		})
+	}
+
+	// spaces around the record are still allowed
+	_, err := Parse("  v=spf1 a  -all ")
+	require.NoError(t, err)
+	// as are tabs and line breaks with LenientWhitespace, but nothing else
+	lenient := Options{LenientWhitespace: true}
+	rec, err := lenient.Parse("v=spf1\ta\r\n-all\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "v=spf1 a -all", rec.String())
+	_, err = lenient.Parse("v=spf1 a\x00 -all")
+	require.ErrorIs(t, err, ErrInvalidByte)
+	_, err = lenient.Parse("v=spf1 a\v-all")
+	require.ErrorIs(t, err, ErrInvalidByte)
+	// macros are checked as written, before any expansion
+	_, err = Parse("v=spf1 exists:%{l}.%{d}.example.com -all")
+	require.NoError(t, err)
+}
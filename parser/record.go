@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// String returns the canonical text of the mechanism.  The "+" qualifier is
+// omitted, networks are printed in their masked CIDR form, domains without
+// macros are lower-cased, default /32 and /128 lengths are dropped and dual
+// CIDR lengths use the RFC 7208 section 5.6 "//" separator, so two
+// mechanisms with the same meaning print identically.
+func (m Mechanism) String() string {
+	var b strings.Builder
+	if m.Qual != QPlus && m.Qual != 0 {
+		b.WriteRune(rune(m.Qual))
+	}
+	b.WriteString(m.Kind)
+	switch m.Kind {
+	case "ip4", "ip6":
+		if m.Net != nil {
+			b.WriteByte(':')
+			b.WriteString(m.Net.String())
+		}
+	case "a", "mx":
+		if m.Domain != "" {
+			b.WriteByte(':')
+			b.WriteString(canonicalDomain(m.Domain))
+		}
+		if m.Mask4 >= 0 && m.Mask4 != 32 {
+			b.WriteByte('/')
+			b.WriteString(strconv.Itoa(m.Mask4))
+		}
+		if m.Mask6 >= 0 && m.Mask6 != 128 {
+			b.WriteString("//")
+			b.WriteString(strconv.Itoa(m.Mask6))
+		}
+	default:
+		if m.Domain != "" {
+			b.WriteByte(':')
+			b.WriteString(canonicalDomain(m.Domain))
+		}
+	}
+	return b.String()
+}
+
+// canonicalDomain lower-cases a domain-spec unless it holds macros, whose
+// letter case is significant (RFC 7208 section 7.3).
+func canonicalDomain(spec string) string {
+	if strings.ContainsRune(spec, '%') {
+		return spec
+	}
+	return strings.ToLower(spec)
+}
+
+// String returns the modifier as "name=value".
+func (m Modifier) String() string {
+	return m.Name + "=" + m.Value
+}
+
+// String returns the canonical text of the record: the version tag, the
+// mechanisms in order, then redirect, exp and any unknown modifiers.  Parsing
+// the result yields a Record equal to r.
+func (r *Record) String() string {
+	terms := make([]string, 0, len(r.Mechs)+len(r.Unknown)+3)
+	terms = append(terms, "v=spf1")
+	for _, m := range r.Mechs {
+		terms = append(terms, m.String())
+	}
+	if r.Redirect != nil {
+		terms = append(terms, r.Redirect.String())
+	}
+	if r.Exp != nil {
+		terms = append(terms, r.Exp.String())
+	}
+	for _, m := range r.Unknown {
+		terms = append(terms, m.String())
+	}
+	return strings.Join(terms, " ")
+}
+
+// Equal reports whether two records have the same semantic content.  It
+// compares canonical forms, so formatting differences such as an explicit
+// "+" qualifier, the placement of modifiers or an unmasked network address
+// do not matter.  Two nil records are equal.
+func Equal(a, b *Record) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.String() == b.String()
+}
+
+// Hash returns a stable hex SHA-256 digest of the record's semantic content,
+// computed over String.  Term order is preserved, so it changes whenever the
+// evaluation could, but cosmetic edits such as whitespace, an explicit "+"
+// or the letter case of names and macro-free domains do not affect it.  Caches and monitors use it to detect
+// real policy changes.
+func (r *Record) Hash() string {
+	sum := sha256.Sum256([]byte(r.String()))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordString(t *testing.T) {
+	tc := []struct {
+		name string
+		spf  string
+		want string
+	}{
+		{"implicit qualifier dropped", "v=spf1 +a -all", "v=spf1 a -all"},
+		{"network masked", "v=spf1 ip4:192.0.2.77/24 ~all", "v=spf1 ip4:192.0.2.0/24 ~all"},
+		{"host network", "v=spf1 ip6:2001:db8::1 -all", "v=spf1 ip6:2001:db8::1/128 -all"},
+		{"dual cidr", "v=spf1 mx:mail.example.com/24/64 -all", "v=spf1 mx:mail.example.com/24//64 -all"},
+		{"default masks dropped", "v=spf1 a/32 mx//128 a:example.com/32//64 -all", "v=spf1 a mx a:example.com//64 -all"},
+		{"domain case folded", "v=spf1 a:Mail.Example.COM include:_SPF.Example.com -all", "v=spf1 a:mail.example.com include:_spf.example.com -all"},
+		{"macro case kept", "v=spf1 exists:%{I}.Example.com -all", "v=spf1 exists:%{I}.Example.com -all"},
+		{"modifiers last", "v=spf1 redirect=spf.example.com a", "v=spf1 a redirect=spf.example.com"},
+		{"domain mechanisms", "v=spf1 ?include:_spf.example.com exists:%{i}.example.com ptr -all",
+			"v=spf1 ?include:_spf.example.com exists:%{i}.example.com ptr -all"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			rec, err := Parse(c.spf)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, rec.String())
+
+			// the canonical form must parse back to an equal record
+			again, err := Parse(rec.String())
+			require.NoError(t, err)
+			assert.True(t, Equal(rec, again))
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tc := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"identical", "v=spf1 a -all", "v=spf1 a -all", true},
+		{"explicit plus", "v=spf1 +a -all", "v=spf1 a -all", true},
+		{"extra whitespace", "v=spf1   ip4:192.0.2.0/24    -all", "v=spf1 ip4:192.0.2.0/24 -all", true},
+		{"unmasked network", "v=spf1 ip4:192.0.2.1/24 -all", "v=spf1 ip4:192.0.2.0/24 -all", true},
+		{"different qualifier", "v=spf1 a -all", "v=spf1 a ~all", false},
+		{"different order", "v=spf1 a mx -all", "v=spf1 mx a -all", false},
+		{"different redirect", "v=spf1 redirect=a.example.com", "v=spf1 redirect=b.example.com", false},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			a, err := Parse(c.a)
+			require.NoError(t, err)
+			b, err := Parse(c.b)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, Equal(a, b))
+		})
+	}
+
+	assert.True(t, Equal(nil, nil))
+	assert.False(t, Equal(nil, &Record{}))
+}
+
+func TestRecordHash(t *testing.T) {
+	tc := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"whitespace", "v=spf1  a   -all", "v=spf1 a -all", true},
+		{"explicit plus", "v=spf1 +ip4:192.0.2.0/24 -all", "v=spf1 ip4:192.0.2.0/24 -all", true},
+		{"domain case", "v=spf1 include:Example.COM -all", "v=spf1 include:example.com -all", true},
+		{"default mask", "v=spf1 a/32 -all", "v=spf1 a -all", true},
+		{"unmasked network", "v=spf1 ip4:192.0.2.9/24 -all", "v=spf1 ip4:192.0.2.0/24 -all", true},
+		{"term order", "v=spf1 a mx -all", "v=spf1 mx a -all", false},
+		{"qualifier", "v=spf1 a -all", "v=spf1 a ~all", false},
+		{"mask", "v=spf1 a/24 -all", "v=spf1 a -all", false},
+		{"macro case", "v=spf1 exists:%{i}.example.com", "v=spf1 exists:%{I}.example.com", false},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			a, err := Parse(c.a)
+			require.NoError(t, err)
+			b, err := Parse(c.b)
+			require.NoError(t, err)
+			assert.Len(t, a.Hash(), 64)
+			assert.Equal(t, c.same, a.Hash() == b.Hash())
+		})
+	}
+}
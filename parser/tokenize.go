@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+)
+
+// TermKind classifies a Term returned by Tokenize.
+type TermKind int
+
+const (
+	TermVersion   TermKind = iota // the leading "v=spf1"
+	TermMechanism                 // a known mechanism, RFC 7208 section 5
+	TermModifier                  // name=value, RFC 7208 section 6
+	TermUnknown                   // anything else; Parse rejects these
+)
+
+func (k TermKind) String() string {
+	switch k {
+	case TermVersion:
+		return "version"
+	case TermMechanism:
+		return "mechanism"
+	case TermModifier:
+		return "modifier"
+	default:
+		return "unknown"
+	}
+}
+
+// Term is one whitespace-separated token of a record.  Start and End are
+// byte offsets into the input, so record[Start:End] == Text.
+type Term struct {
+	Kind       TermKind
+	Text       string
+	Start, End int
+
+	// Qualifier is the explicit qualifier of a mechanism, 0 when omitted.
+	Qualifier Qualifier
+	// Name is the lower-cased mechanism or modifier name.
+	Name string
+	// Value is what follows the name: a mechanism's argument without the
+	// ":" separator, including any "/" masks, or a modifier's value.
+	Value string
+}
+
+// ErrNoVersion is returned by Tokenize when the record does not start with
+// the "v=spf1" version tag.
+var ErrNoVersion = errors.New("missing v=spf1")
+
+// mechanismNames are the mechanisms of RFC 7208 section 5.
+var mechanismNames = []string{"all", "include", "a", "mx", "ptr", "ip4", "ip6", "exists"}
+
+// Tokenize splits record into classified terms without validating their
+// arguments, for tools such as syntax highlighters that need positions and
+// must cope with records Parse rejects.  Only a missing version tag is an
+// error.  Terms are separated by spaces, as for Parse; a term holding a
+// byte Parse rejects, such as a tab, is TermUnknown.
+func Tokenize(record string) ([]Term, error) {
+	return Options{}.Tokenize(record)
+}
+
+// Tokenize is the package-level Tokenize with the whitespace handling
+// selected by o: with LenientWhitespace, tabs, CR and LF separate terms as
+// they do for o.Parse.
+func (o Options) Tokenize(record string) ([]Term, error) {
+	space := func(c byte) bool { return c == ' ' || o.LenientWhitespace && isLenientSpace(c) }
+	var terms []Term
+	for i := 0; i < len(record); {
+		if space(record[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(record) && !space(record[i]) {
+			i++
+		}
+		t := classify(record[start:i], start)
+		if checkBytes(t.Text, false) != nil {
+			t = Term{Kind: TermUnknown, Text: t.Text, Start: t.Start, End: t.End}
+		}
+		terms = append(terms, t)
+	}
+	if len(terms) == 0 || !strings.EqualFold(terms[0].Text, "v=spf1") {
+		return nil, ErrNoVersion
+	}
+	terms[0] = Term{Kind: TermVersion, Text: terms[0].Text, Start: terms[0].Start, End: terms[0].End}
+	return terms, nil
+}
+
+// classify builds the Term for text found at offset start.
+func classify(text string, start int) Term {
+	t := Term{Kind: TermUnknown, Text: text, Start: start, End: start + len(text)}
+	if name, value, ok := strings.Cut(text, "="); ok && isModifierName(name) {
+		t.Kind, t.Name, t.Value = TermModifier, strings.ToLower(name), value
+		return t
+	}
+	rest := text
+	switch rest[0] {
+	case '+', '-', '~', '?':
+		t.Qualifier, rest = Qualifier(rest[0]), rest[1:]
+	}
+	end := strings.IndexAny(rest, ":/")
+	if end < 0 {
+		end = len(rest)
+	}
+	name := strings.ToLower(rest[:end])
+	for _, m := range mechanismNames {
+		if name == m {
+			t.Kind, t.Name, t.Value = TermMechanism, name, strings.TrimPrefix(rest[end:], ":")
+			return t
+		}
+	}
+	t.Qualifier = 0
+	return t
+}
+
+// isModifierName reports whether s is a valid modifier name:
+// ALPHA *( ALPHA / DIGIT / "-" / "_" / "." ).
+func isModifierName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20 // fold ASCII letters
+		switch {
+		case c >= 'a' && c <= 'z':
+		case i > 0 && (s[i] >= '0' && s[i] <= '9' || s[i] == '-' || s[i] == '_' || s[i] == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	const rec = "v=spf1  -ip4:192.0.2.0/24 a/24 include:_spf.example.com\tredirect=example.net foo:bar ~ALL"
+	terms, err := Options{LenientWhitespace: true}.Tokenize(rec)
+	require.NoError(t, err)
+
+	want := []Term{
+		{Kind: TermVersion, Text: "v=spf1", Start: 0, End: 6},
+		{Kind: TermMechanism, Text: "-ip4:192.0.2.0/24", Start: 8, End: 25, Qualifier: QMinus, Name: "ip4", Value: "192.0.2.0/24"},
+		{Kind: TermMechanism, Text: "a/24", Start: 26, End: 30, Name: "a", Value: "/24"},
+		{Kind: TermMechanism, Text: "include:_spf.example.com", Start: 31, End: 55, Name: "include", Value: "_spf.example.com"},
+		{Kind: TermModifier, Text: "redirect=example.net", Start: 56, End: 76, Name: "redirect", Value: "example.net"},
+		{Kind: TermUnknown, Text: "foo:bar", Start: 77, End: 84},
+		{Kind: TermMechanism, Text: "~ALL", Start: 85, End: 89, Qualifier: QTilde, Name: "all"},
+	}
+	assert.Equal(t, want, terms)
+	for _, term := range terms {
+		assert.Equal(t, term.Text, rec[term.Start:term.End])
+	}
+
+	// by default a tab is part of a term, which Parse rejects
+	terms, err = Tokenize(rec)
+	require.NoError(t, err)
+	require.Len(t, terms, 6)
+	assert.Equal(t, Term{Kind: TermUnknown, Text: "include:_spf.example.com\tredirect=example.net", Start: 31, End: 76}, terms[3])
+	terms, err = Tokenize("v=spf1 a:bücher.example -all")
+	require.NoError(t, err)
+	assert.Equal(t, TermUnknown, terms[1].Kind)
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	for _, rec := range []string{"", "   ", "v=spf10 -all", "-all v=spf1"} {
+		_, err := Tokenize(rec)
+		require.ErrorIs(t, err, ErrNoVersion, rec)
+	}
+
+	// arguments are not validated
+	terms, err := Tokenize("v=spf1 ip4:999.1.1.1 =x -")
+	require.NoError(t, err)
+	assert.Equal(t, TermMechanism, terms[1].Kind)
+	assert.Equal(t, TermUnknown, terms[2].Kind)
+	assert.Equal(t, TermUnknown, terms[3].Kind)
+	assert.Equal(t, "unknown", terms[3].Kind.String())
+}
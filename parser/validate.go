@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Identifiers of the checks run by Record.Validate.  They are stable so CI
+// jobs can allow or deny individual checks.
+const (
+	CheckRedirectWithAll = "redirect-with-all" // redirect is never used when all is present
+	CheckTargetName      = "target-name"       // exp or redirect is not a valid domain
+	CheckZeroMask        = "zero-mask"         // a /0 network matches every address
+	CheckSelfInclude     = "self-include"      // include or redirect of the record's own domain
+)
+
+// Issue is one semantic problem reported by Record.Validate.
+type Issue struct {
+	Check   string // one of the Check constants
+	Term    string // offending term in canonical form
+	Message string
+}
+
+// Validate runs semantic checks on a syntactically valid record without any
+// DNS lookups, so records kept in version control can be checked in CI.  It
+// reports redirect alongside all (RFC 7208 section 6.1 ignores the
+// redirect), exp or redirect targets that are not valid domain names when
+// they hold no macros, ip4, ip6, a and mx terms with a /0 mask, and include
+// or redirect pointing back at domain, which always ends in a permerror.
+// domain is the name the record is published at; the self-reference check
+// is skipped when it is empty.  Records returned by Parse never fail the
+// target name check; it catches records built or edited in code.
+func (r *Record) Validate(domain string) []Issue {
+	var out []Issue
+	self := normalizeName(domain)
+	hasAll := false
+	for _, m := range r.Mechs {
+		switch m.Kind {
+		case "all":
+			hasAll = true
+		case "ip4", "ip6":
+			if m.Net != nil {
+				if ones, _ := m.Net.Mask.Size(); ones == 0 {
+					out = append(out, zeroMask(m))
+				}
+			}
+		case "a", "mx":
+			if m.Mask4 == 0 || m.Mask6 == 0 {
+				out = append(out, zeroMask(m))
+			}
+		case "include":
+			if self != "" && !m.Macro && normalizeName(m.Domain) == self {
+				out = append(out, Issue{
+					Check:   CheckSelfInclude,
+					Term:    m.String(),
+					Message: fmt.Sprintf("include of %s's own record loops until the lookup limit is exceeded", self),
+				})
+			}
+		}
+	}
+
+	if r.Redirect != nil {
+		if hasAll {
+			out = append(out, Issue{
+				Check:   CheckRedirectWithAll,
+				Term:    r.Redirect.String(),
+				Message: "redirect is ignored because the record contains an all mechanism (RFC 7208 section 6.1)",
+			})
+		}
+		if self != "" && !r.Redirect.Macro && normalizeName(r.Redirect.Value) == self {
+			out = append(out, Issue{
+				Check:   CheckSelfInclude,
+				Term:    r.Redirect.String(),
+				Message: fmt.Sprintf("redirect to %s's own record loops until the lookup limit is exceeded", self),
+			})
+		}
+		out = append(out, targetName(r.Redirect)...)
+	}
+	if r.Exp != nil {
+		out = append(out, targetName(r.Exp)...)
+	}
+	return out
+}
+
+func zeroMask(m Mechanism) Issue {
+	return Issue{
+		Check:   CheckZeroMask,
+		Term:    m.String(),
+		Message: fmt.Sprintf("%s with a /0 mask matches every address", m.Kind),
+	}
+}
+
+// targetName checks a macro-less exp or redirect value.
+func targetName(mod *Modifier) []Issue {
+	if strings.ContainsRune(mod.Value, '%') {
+		return nil
+	}
+	if _, err := ValidateTargetName(mod.Value); err != nil {
+		return []Issue{{
+			Check:   CheckTargetName,
+			Term:    mod.String(),
+			Message: fmt.Sprintf("%s target is not a valid domain: %v", mod.Name, err),
+		}}
+	}
+	return nil
+}
+
+// normalizeName lower-cases name and drops a trailing root dot.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
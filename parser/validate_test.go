@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordValidate(t *testing.T) {
+	tc := []struct {
+		name   string
+		spf    string
+		domain string
+		want   []string
+	}{
+		{"clean", "v=spf1 ip4:192.0.2.0/24 include:_spf.example.net -all", "example.com", nil},
+		{"redirect with all", "v=spf1 a -all redirect=_spf.example.com", "example.com", []string{CheckRedirectWithAll}},
+		{"redirect alone", "v=spf1 a redirect=_spf.example.com", "example.com", nil},
+		{"ip4 zero mask", "v=spf1 ip4:0.0.0.0/0 -all", "example.com", []string{CheckZeroMask}},
+		{"ip6 zero mask", "v=spf1 ip6:::/0 -all", "example.com", []string{CheckZeroMask}},
+		{"a zero mask", "v=spf1 a/0 mx//0 -all", "example.com", []string{CheckZeroMask, CheckZeroMask}},
+		{"self include", "v=spf1 include:Example.com. -all", "example.com", []string{CheckSelfInclude}},
+		{"self redirect", "v=spf1 redirect=example.com", "example.com.", []string{CheckSelfInclude}},
+		{"self check skipped without domain", "v=spf1 include:example.com -all", "", nil},
+		{"macro include not compared", "v=spf1 include:%{d} -all", "example.com", nil},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			rec, err := Parse(c.spf)
+			require.NoError(t, err)
+			var got []string
+			for _, is := range rec.Validate(c.domain) {
+				got = append(got, is.Check)
+				assert.NotEmpty(t, is.Term)
+				assert.NotEmpty(t, is.Message)
+			}
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestRecordValidateTargetName(t *testing.T) {
+	rec, err := Parse("v=spf1 -all exp=explain.example.com")
+	require.NoError(t, err)
+	rec.Exp.Value = "not a domain"
+	rec.Redirect = &Modifier{Name: "redirect", Value: "%{d}.example.com", Macro: true}
+
+	issues := rec.Validate("")
+	require.Len(t, issues, 2)
+	assert.Equal(t, CheckRedirectWithAll, issues[0].Check)
+	assert.Equal(t, CheckTargetName, issues[1].Check)
+	assert.Equal(t, "exp=not a domain", issues[1].Term)
+}
@@ -0,0 +1,137 @@
+package spf
+
+import (
+	"net"
+
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/macro"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// PlannedQuery is one DNS query that evaluating a record would issue.
+type PlannedQuery struct {
+	Type      string // "TXT", "A", "A/AAAA", "MX" or "PTR", as in the query trace
+	Name      string // query name after macro expansion
+	Mechanism string // term that causes the query, empty for the record lookup
+	Counted   bool   // counts toward the RFC 7208 section 4.6.4 lookup limit
+	Note      string // follow-up work that cannot be planned without answers
+}
+
+// Plan returns, in order, the DNS queries that evaluating record for req
+// would perform, without sending any of them.  It assumes no DNS-based
+// mechanism matches, so the list is the worst case for one record; ip4 and
+// ip6 terms are matched locally and end the plan when they match.  Queries
+// that depend on answers (MX host addresses, the records behind include and
+// redirect) are described by a Note instead of being expanded.  Macros are
+// expanded where the inputs are known.
+//
+// Types name the lookups the evaluator makes, as WithQueryTrace reports
+// them: "A/AAAA" is an address lookup of both families, which is what the
+// a mechanism and MX and PTR validation issue.  The exp= TXT lookup is
+// planned when the plan ends in a fail, and the plan stops where evaluation
+// would, at a disabled mechanism under DisabledPermError or a too broad
+// network under WithStrictCIDR.
+func (c *Checker) Plan(req Request, record string) ([]PlannedQuery, error) {
+	rec, err := c.parse(record)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := c.parserOpts.ValidateDomain(req.StartDomain())
+	if err != nil {
+		return nil, err
+	}
+	ev := c.newEvaluation(req, domain)
+
+	existsType := "A"
+	if c.existsAAAA {
+		existsType = "A/AAAA"
+	}
+
+	plan := []PlannedQuery{{Type: "TXT", Name: domain}}
+	for _, mech := range rec.Mechs {
+		if c.disabled[mech.Kind] {
+			if c.disabledAction == DisabledPermError {
+				return plan, nil
+			}
+			continue
+		}
+		if c.strictCIDR != nil && lint.BroadCIDR(mech, *c.strictCIDR) {
+			return plan, nil
+		}
+		target, err := ev.targetDomain(mech)
+		if err != nil {
+			return nil, err
+		}
+		switch mech.Kind {
+		case "all":
+			return c.planExp(ev, plan, rec, mech), nil
+		case "ip4", "ip6":
+			if matchesNetwork(mech, ev.ip) {
+				return c.planExp(ev, plan, rec, mech), nil
+			}
+		case "a":
+			plan = append(plan, PlannedQuery{Type: "A/AAAA", Name: target, Mechanism: mech.Kind, Counted: true})
+		case "mx":
+			plan = append(plan, PlannedQuery{Type: "MX", Name: target, Mechanism: mech.Kind, Counted: true,
+				Note: "then A/AAAA for each MX host (at most 10)"})
+		case "ptr":
+			if req.ClientHostname != "" {
+				continue // compared with the caller-validated name, no query
+			}
+			plan = append(plan, PlannedQuery{Type: "PTR", Name: reverseName(ev.ip), Mechanism: mech.Kind, Counted: true,
+				Note: "then A/AAAA for each returned name (at most 10)"})
+		case "exists":
+			plan = append(plan, PlannedQuery{Type: existsType, Name: target, Mechanism: mech.Kind, Counted: true})
+		case "include":
+			plan = append(plan, PlannedQuery{Type: "TXT", Name: target, Mechanism: mech.Kind, Counted: true,
+				Note: "then the queries of the included record"})
+		}
+	}
+
+	if rec.Redirect != nil {
+		target := rec.Redirect.Value
+		if rec.Redirect.Macro {
+			if target, err = macro.Expand(target, ev.vars); err != nil {
+				return nil, err
+			}
+		}
+		plan = append(plan, PlannedQuery{Type: "TXT", Name: target, Mechanism: "redirect", Counted: true,
+			Note: "then the queries of the redirected record"})
+	}
+	return plan, nil
+}
+
+// planExp returns plan followed by the exp= lookup that a fail from mech,
+// the term ending the plan, would make.  Like explain, an exp= whose name
+// cannot be expanded issues no query.
+func (c *Checker) planExp(ev *evaluation, plan []PlannedQuery, rec *parser.Record, mech parser.Mechanism) []PlannedQuery {
+	if rec.Exp == nil || resultFromQualifier(mech.Qual) != Fail {
+		return plan
+	}
+	target, err := macro.Expand(rec.Exp.Value, ev.vars)
+	if err == nil {
+		target, err = c.parserOpts.ValidateTargetName(target)
+	}
+	if err != nil {
+		return plan
+	}
+	return append(plan, PlannedQuery{Type: "TXT", Name: target, Mechanism: "exp"})
+}
+
+// matchesNetwork reports whether an ip4 or ip6 mechanism matches ip.
+func matchesNetwork(mech parser.Mechanism, ip net.IP) bool {
+	if mech.Kind == "ip4" {
+		ip4 := ip.To4()
+		return ip4 != nil && mech.Net.Contains(ip4)
+	}
+	return ip.To4() == nil && ip.To16() != nil && mech.Net.Contains(ip)
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name for the client IP.
+func reverseName(ip net.IP) string {
+	name, err := macro.Expand("%{ir}.%{v}.arpa", macro.Vars{IP: ip})
+	if err != nil {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,141 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestChecker_Plan(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil))
+	req := Request{IP: net.ParseIP("192.0.2.3"), MailFrom: "alice@example.com", HELODomain: "mx.example.org"}
+
+	cases := []struct {
+		name   string
+		record string
+		want   []PlannedQuery
+	}{
+		{
+			name:   "ip4 match ends plan",
+			record: "v=spf1 ip4:192.0.2.0/24 a -all",
+			want:   []PlannedQuery{{Type: "TXT", Name: "example.com"}},
+		},
+		{
+			name:   "dns mechanisms in order",
+			record: "v=spf1 a mx:mail.example.com include:_spf.example.net -all",
+			want: []PlannedQuery{
+				{Type: "TXT", Name: "example.com"},
+				{Type: "A/AAAA", Name: "example.com", Mechanism: "a", Counted: true},
+				{Type: "MX", Name: "mail.example.com", Mechanism: "mx", Counted: true, Note: "then A/AAAA for each MX host (at most 10)"},
+				{Type: "TXT", Name: "_spf.example.net", Mechanism: "include", Counted: true, Note: "then the queries of the included record"},
+			},
+		},
+		{
+			name:   "macros expanded",
+			record: "v=spf1 exists:%{ir}.%{l}._spf.%{d} ptr -all",
+			want: []PlannedQuery{
+				{Type: "TXT", Name: "example.com"},
+				{Type: "A", Name: "3.2.0.192.alice._spf.example.com", Mechanism: "exists", Counted: true},
+				{Type: "PTR", Name: "3.2.0.192.in-addr.arpa", Mechanism: "ptr", Counted: true, Note: "then A/AAAA for each returned name (at most 10)"},
+			},
+		},
+		{
+			name:   "exp after a fail",
+			record: "v=spf1 ip4:198.51.100.0/24 -all exp=why.%{d}",
+			want: []PlannedQuery{
+				{Type: "TXT", Name: "example.com"},
+				{Type: "TXT", Name: "why.example.com", Mechanism: "exp"},
+			},
+		},
+		{
+			name:   "no exp without a fail",
+			record: "v=spf1 ip4:192.0.2.0/24 -all exp=why.%{d}",
+			want:   []PlannedQuery{{Type: "TXT", Name: "example.com"}},
+		},
+		{
+			name:   "redirect when no all",
+			record: "v=spf1 ip4:198.51.100.0/24 redirect=_spf.%{h}",
+			want: []PlannedQuery{
+				{Type: "TXT", Name: "example.com"},
+				{Type: "TXT", Name: "_spf.mx.example.org", Mechanism: "redirect", Counted: true, Note: "then the queries of the redirected record"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ch.Plan(req, tc.record)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestChecker_PlanClientHostname(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil))
+	req := Request{IP: net.ParseIP("192.0.2.3"), MailFrom: "alice@example.com", ClientHostname: "mx.example.com"}
+	got, err := ch.Plan(req, "v=spf1 ptr exists:%{p}.allow.example -all")
+	require.NoError(t, err)
+	assert.Equal(t, []PlannedQuery{
+		{Type: "TXT", Name: "example.com"},
+		{Type: "A", Name: "mx.example.com.allow.example", Mechanism: "exists", Counted: true},
+	}, got)
+}
+
+// queriesOf returns the queries recorded in a WithQueryTrace trace.
+func queriesOf(trace []TraceEntry) []PlannedQuery {
+	var out []PlannedQuery
+	for _, e := range trace {
+		if e.Query != "" {
+			out = append(out, PlannedQuery{Type: e.QueryType, Name: e.Query})
+		}
+	}
+	return out
+}
+
+// typesAndNames strips plan to what a query trace records.
+func typesAndNames(plan []PlannedQuery) []PlannedQuery {
+	out := make([]PlannedQuery, 0, len(plan))
+	for _, q := range plan {
+		out = append(out, PlannedQuery{Type: q.Type, Name: q.Name})
+	}
+	return out
+}
+
+func TestChecker_PlanMatchesTrace(t *testing.T) {
+	txt := fakeTXTMap{
+		"_spf.example.net": {"v=spf1 -all"},
+		"why.example.com":  {"not allowed"},
+	}
+	ips := fakeIPResolver{"example.com": {"198.51.100.1"}}
+	req := Request{IP: net.ParseIP("192.0.2.3"), MailFrom: "alice@example.com"}
+
+	cases := []struct {
+		name   string
+		record string
+		opts   []Option
+	}{
+		{"every lookup", "v=spf1 a exists:%{l}.x.example include:_spf.example.net -all exp=why.%{d}", nil},
+		{"disabled permerror", "v=spf1 a ptr exists:%{l}.x.example -all",
+			[]Option{WithDisabledMechanisms("ptr"), WithDisabledAction(DisabledPermError)}},
+		{"disabled no match", "v=spf1 ptr a -all", []Option{WithDisabledMechanisms("ptr")}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			zone := fakeTXTMap{"example.com": {tc.record}}
+			for name, rec := range txt {
+				zone[name] = rec
+			}
+			ch := NewChecker(dns.NewCustomDNSResolver(zone, ips), append(tc.opts, WithQueryTrace())...)
+			plan, err := ch.Plan(req, tc.record)
+			require.NoError(t, err)
+			res, err := ch.Check(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, typesAndNames(plan), queriesOf(res.Trace))
+		})
+	}
+}
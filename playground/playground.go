@@ -0,0 +1,294 @@
+// Package playground serves the JSON endpoints behind an SPF record
+// playground: a record goes in, diagnostics and simulated results come out.
+//
+// The handler is meant to face the internet, so every request body is size
+// limited and, unless Config.AllowDNS is set, no DNS query leaves the
+// process: include and redirect targets resolve only from the records
+// submitted with the request.
+package playground
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// DefaultMaxBodyBytes is the request size limit used when
+// Config.MaxBodyBytes is zero.
+const DefaultMaxBodyBytes = 16 << 10
+
+// maxZoneRecords bounds the records one request may submit.
+const maxZoneRecords = 50
+
+// Config configures Handler.
+type Config struct {
+	// MaxBodyBytes limits request bodies, DefaultMaxBodyBytes if zero.
+	MaxBodyBytes int64
+
+	// AllowDNS lets /simulate and /flatten query Resolver for names that
+	// were not submitted with the request.  Off by default.
+	AllowDNS bool
+	// Resolver is used when AllowDNS is set, dns.NewDNSResolver if nil.
+	Resolver *dns.Resolver
+
+	// Lint configures the /lint checks.
+	Lint lint.Config
+}
+
+// Request is the body accepted by every endpoint.  Each endpoint reads the
+// fields it needs.
+type Request struct {
+	Record   string            `json:"record"`    // record under test
+	Domain   string            `json:"domain"`    // domain publishing Record
+	IP       string            `json:"ip"`        // client address for /simulate
+	MailFrom string            `json:"mail_from"` // MAIL FROM for /simulate
+	HELO     string            `json:"helo"`      // HELO name for /simulate
+	Records  map[string]string `json:"records"`   // other records, by domain
+	// Strings are the character-strings of the TXT RR holding the record,
+	// for /lint.  They replace Record when set.
+	Strings []string `json:"strings"`
+}
+
+// Term is a token of the record in /parse output.
+type Term struct {
+	Kind  string `json:"kind"`
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// ParseResponse is the /parse response.
+type ParseResponse struct {
+	Terms     []Term `json:"terms"`
+	Canonical string `json:"canonical,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LintResponse is the /lint response.
+type LintResponse struct {
+	Findings []lint.Finding `json:"findings"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// SimulateResponse is the /simulate response.
+type SimulateResponse struct {
+	Result   string           `json:"result"`
+	Cause    string           `json:"cause,omitempty"`
+	Trace    []spf.TraceEntry `json:"trace,omitempty"`
+	Warnings []spf.Warning    `json:"warnings,omitempty"`
+	Lookups  int              `json:"lookups"`
+}
+
+// FlattenResponse is the /flatten response.
+type FlattenResponse struct {
+	Networks []string `json:"networks"`
+	Residual []string `json:"residual,omitempty"`
+}
+
+// errorResponse is the body of every 4xx reply.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler returns the playground endpoints: POST /parse, /lint, /simulate
+// and /flatten, each taking a JSON Request.
+func Handler(cfg Config) http.Handler {
+	if cfg.MaxBodyBytes == 0 {
+		cfg.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if cfg.AllowDNS && cfg.Resolver == nil {
+		cfg.Resolver = dns.NewDNSResolver()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /parse", cfg.endpoint(cfg.parse))
+	mux.HandleFunc("POST /lint", cfg.endpoint(cfg.lint))
+	mux.HandleFunc("POST /simulate", cfg.endpoint(cfg.simulate))
+	mux.HandleFunc("POST /flatten", cfg.endpoint(cfg.flatten))
+	return mux
+}
+
+// endpoint decodes the size-limited body, runs fn and writes its response.
+func (cfg Config) endpoint(fn func(context.Context, Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeJSON(w, status, errorResponse{Error: err.Error()})
+			return
+		}
+		if len(req.Records) > maxZoneRecords {
+			writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "too many records"})
+			return
+		}
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// parse tokenizes and parses the record.  Syntax errors are reported in the
+// response, not as a failed request.
+func (cfg Config) parse(_ context.Context, req Request) (any, error) {
+	var resp ParseResponse
+	terms, err := parser.Tokenize(req.Record)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, nil
+	}
+	for _, t := range terms {
+		resp.Terms = append(resp.Terms, Term{Kind: t.Kind.String(), Text: t.Text, Start: t.Start, End: t.End})
+	}
+	rec, err := parser.Parse(req.Record)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, nil
+	}
+	resp.Canonical = rec.String()
+	return resp, nil
+}
+
+// lint reports the lint findings of the record.  Character-strings given
+// in Strings are checked with lint.TXTStrings, then joined into the record,
+// which must start with the version tag.
+func (cfg Config) lint(_ context.Context, req Request) (any, error) {
+	findings := []lint.Finding{}
+	record := req.Record
+	if len(req.Strings) > 0 {
+		findings = append(findings, lint.TXTStrings(req.Strings)...)
+		record = strings.Join(req.Strings, "")
+		if len(dns.RawSPFRecords([]string{record})) == 0 {
+			return LintResponse{Findings: findings, Error: "strings do not form an SPF record"}, nil
+		}
+	}
+	rec, err := parser.Parse(record)
+	if err != nil {
+		return LintResponse{Findings: findings, Error: err.Error()}, nil
+	}
+	findings = append(findings, lint.Record(rec, cfg.Lint)...)
+	return LintResponse{Findings: findings}, nil
+}
+
+// simulate evaluates the record for the client in req.
+func (cfg Config) simulate(ctx context.Context, req Request) (any, error) {
+	ip := net.ParseIP(req.IP)
+	if ip == nil {
+		return nil, errors.New("ip is not an IP address")
+	}
+	rec, err := parser.Parse(req.Record)
+	if err != nil {
+		return SimulateResponse{Result: string(spf.PermError), Cause: err.Error()}, nil
+	}
+	ch := spf.NewChecker(cfg.resolver(req))
+	res, err := ch.EvaluateRequest(ctx, spf.Request{IP: ip, MailFrom: req.MailFrom, HELODomain: req.HELO, Domain: req.Domain}, rec)
+	if err != nil {
+		return nil, err
+	}
+	resp := SimulateResponse{Result: string(res.Code), Trace: res.Trace, Warnings: res.Warnings, Lookups: res.Lookups}
+	if res.Cause != nil {
+		resp.Cause = res.Cause.Error()
+	}
+	return resp, nil
+}
+
+// flatten collects the networks reachable from the record.
+func (cfg Config) flatten(ctx context.Context, req Request) (any, error) {
+	if req.Record != "" {
+		if req.Records == nil {
+			req.Records = map[string]string{}
+		}
+		req.Records[req.Domain] = req.Record
+	}
+	g, err := spf.NewChecker(cfg.resolver(req)).WalkRecord(ctx, req.Domain)
+	if err != nil {
+		return nil, err
+	}
+	f := g.Flatten()
+	if f.Networks == nil {
+		f.Networks = []string{}
+	}
+	return FlattenResponse{Networks: f.Networks, Residual: f.Residual}, nil
+}
+
+// resolver serves the submitted records, falling back to real DNS only when
+// the configuration allows it.
+func (cfg Config) resolver(req Request) *dns.Resolver {
+	z := &zone{records: map[string]string{}}
+	for d, r := range req.Records {
+		if name, err := parser.ValidateTargetName(d); err == nil {
+			z.records[name] = r
+		}
+	}
+	if cfg.AllowDNS {
+		z.next = cfg.Resolver
+	}
+	return dns.NewCustomDNSResolver(z, z)
+}
+
+// zone answers TXT queries from submitted records.  Other names, and every
+// address, MX and PTR query, are NXDOMAIN unless next is set.
+type zone struct {
+	records map[string]string
+	next    *dns.Resolver
+}
+
+func (z *zone) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r, ok := z.records[name]; ok {
+		return []string{r}, nil
+	}
+	if z.next != nil {
+		return z.next.LookupTXT(ctx, name)
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (z *zone) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if z.next == nil {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	ips, err := z.next.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+	return addrs, nil
+}
+
+func (z *zone) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if z.next == nil {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return z.next.LookupMX(ctx, name)
+}
+
+func (z *zone) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if z.next == nil {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return z.next.LookupPTR(ctx, net.ParseIP(addr))
+}
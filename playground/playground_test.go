@@ -0,0 +1,125 @@
+package playground
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(t *testing.T, h http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return rr
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler(Config{})
+
+	rr := post(t, h, "/parse", `{"record":"v=spf1 a:Example.com -all"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var parsed ParseResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &parsed))
+	assert.Len(t, parsed.Terms, 3)
+	assert.Equal(t, "v=spf1 a:example.com -all", parsed.Canonical)
+
+	rr = post(t, h, "/parse", `{"record":"v=spf1 bogus"}`)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &parsed))
+	assert.NotEmpty(t, parsed.Error)
+
+	rr = post(t, h, "/lint", `{"record":"v=spf1 ip4:0.0.0.0/0 -all"}`)
+	var linted LintResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &linted))
+	require.Len(t, linted.Findings, 1)
+	assert.Equal(t, "cidr-zero", linted.Findings[0].Rule)
+
+	rr = post(t, h, "/simulate", `{"record":"v=spf1 include:_spf.example.net -all","domain":"example.com","ip":"192.0.2.1",
+		"mail_from":"alice@example.com","records":{"_spf.example.net":"v=spf1 ip4:192.0.2.0/24 -all"}}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var sim SimulateResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sim))
+	assert.Equal(t, "pass", sim.Result)
+	assert.Equal(t, 1, sim.Lookups)
+
+	rr = post(t, h, "/flatten", `{"record":"v=spf1 ip4:198.51.100.1 include:_spf.example.net -all","domain":"example.com",
+		"records":{"_spf.example.net":"v=spf1 ip4:192.0.2.0/24 a -all"}}`)
+	var flat FlattenResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &flat))
+	assert.Equal(t, []string{"ip4:198.51.100.1/32", "ip4:192.0.2.0/24"}, flat.Networks)
+	assert.Equal(t, []string{"_spf.example.net: a"}, flat.Residual)
+}
+
+func TestHandlerSimulateHELO(t *testing.T) {
+	h := Handler(Config{})
+	for _, record := range []string{"v=spf1 include:%{h}._spf.example.net -all", "v=spf1 include:%{o}._spf.example.net -all"} {
+		// %{o} of a null sender is the HELO name, from postmaster@<helo>
+		rr := post(t, h, "/simulate", `{"record":"`+record+`","domain":"example.com","ip":"192.0.2.1","helo":"mx1.example.org",
+			"records":{"mx1.example.org._spf.example.net":"v=spf1 ip4:192.0.2.0/24 -all"}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var sim SimulateResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sim))
+		assert.Equal(t, "pass", sim.Result, record)
+	}
+}
+
+func TestHandlerLintStrings(t *testing.T) {
+	h := Handler(Config{})
+	cases := []struct {
+		body     string
+		wantRule string
+		wantErr  bool
+	}{
+		{`{"strings":["", "v=spf1 -all"]}`, "version-prefix", false},
+		{`{"strings":["v=spf1", "ip4:192.0.2.0/24 -all"]}`, "split-version", true},
+		{`{"strings":["v=spf1 ", "-all"]}`, "", false},
+	}
+	for _, tc := range cases {
+		rr := post(t, h, "/lint", tc.body)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var linted LintResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &linted))
+		assert.Equal(t, tc.wantErr, linted.Error != "", tc.body)
+		if tc.wantRule == "" {
+			assert.Empty(t, linted.Findings, tc.body)
+			continue
+		}
+		require.Len(t, linted.Findings, 1, tc.body)
+		assert.Equal(t, tc.wantRule, linted.Findings[0].Rule)
+	}
+}
+
+func TestHandlerNoDNS(t *testing.T) {
+	h := Handler(Config{})
+	// the include target was not submitted and DNS is not allowed
+	rr := post(t, h, "/simulate", `{"record":"v=spf1 include:example.org -all","domain":"example.com","ip":"192.0.2.1"}`)
+	var sim SimulateResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sim))
+	assert.Equal(t, "permerror", sim.Result)
+
+	// mx must not fall back to the system resolver either
+	rr = post(t, h, "/simulate", `{"record":"v=spf1 mx:example.org -all","domain":"example.com","ip":"192.0.2.1"}`)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sim))
+	assert.Equal(t, "fail", sim.Result)
+	assert.Equal(t, 1, sim.Lookups)
+}
+
+func TestHandlerLimits(t *testing.T) {
+	h := Handler(Config{MaxBodyBytes: 64})
+	rr := post(t, h, "/parse", `{"record":"v=spf1 `+strings.Repeat("ip4:192.0.2.1 ", 10)+`-all"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	rr = post(t, h, "/parse", `{"recrod":"v=spf1 -all"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/parse", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = post(t, Handler(Config{}), "/simulate", `{"record":"v=spf1 -all","ip":"nope"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"net"
+	"strings"
+)
+
+// Forwarding decides whether a message that failed SPF arrived through a
+// forwarder the operator trusts, such as a mailing list or an alias
+// service.  Forwarding breaks SPF by design (RFC 7208 appendix D), so such
+// a fail says nothing about the original sender.  It returns a short
+// rationale for the audit log and whether the forwarding is trusted.
+type Forwarding func(in Input) (rationale string, trusted bool)
+
+// TrustedForwarders trusts messages relayed by a client in nets, for
+// example the outbound ranges of a known forwarding service.
+func TrustedForwarders(nets ...*net.IPNet) Forwarding {
+	return func(in Input) (string, bool) {
+		for _, n := range nets {
+			if in.Request.IP != nil && n.Contains(in.Request.IP) {
+				return "client " + in.Request.IP.String() + " in known forwarder range " + n.String(), true
+			}
+		}
+		return "", false
+	}
+}
+
+// TrustedARC trusts messages whose ARC chain validated and was last sealed
+// by one of sealers, matched case-insensitively.  ARC only records what
+// earlier hops saw, so list sealers whose authentication results you are
+// willing to rely on.
+func TrustedARC(sealers ...string) Forwarding {
+	return func(in Input) (string, bool) {
+		if in.ARC != ARCPass {
+			return "", false
+		}
+		for _, s := range sealers {
+			if strings.EqualFold(in.ARCSealer, s) {
+				return "ARC pass sealed by " + strings.ToLower(in.ARCSealer), true
+			}
+		}
+		return "", false
+	}
+}
+
+// AnyForwarding trusts a message when any of fs does, reporting the
+// rationale of the first.
+func AnyForwarding(fs ...Forwarding) Forwarding {
+	return func(in Input) (string, bool) {
+		for _, f := range fs {
+			if why, ok := f(in); ok {
+				return why, true
+			}
+		}
+		return "", false
+	}
+}
@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t0gun/go-spf"
+)
+
+func TestDecideForwarding(t *testing.T) {
+	_, lists, _ := net.ParseCIDR("198.51.100.0/24")
+	cfg := Config{Forwarding: AnyForwarding(TrustedForwarders(lists), TrustedARC("lists.example.org"))}
+	cases := []struct {
+		name   string
+		ip     string
+		code   spf.Result
+		arc    ARCResult
+		sealer string
+		want   Verdict
+		reason string
+	}{
+		{"known forwarder", "198.51.100.7", spf.Fail, ARCNone, "", Accept, "SPF fail accepted, trusted forwarding: client 198.51.100.7 in known forwarder range 198.51.100.0/24"},
+		{"arc pass trusted sealer", "203.0.113.1", spf.Fail, ARCPass, "Lists.Example.org", Accept, "SPF fail accepted, trusted forwarding: ARC pass sealed by lists.example.org"},
+		{"arc pass other sealer", "203.0.113.1", spf.Fail, ARCPass, "evil.example", Reject, ""},
+		{"arc fail", "203.0.113.1", spf.Fail, ARCFail, "lists.example.org", Reject, ""},
+		{"softfail untouched", "198.51.100.7", spf.SoftFail, ARCNone, "", Accept, ""},
+		{"temperror untouched", "198.51.100.7", spf.TempError, ARCNone, "", Defer, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := Input{
+				Request:   spf.Request{IP: net.ParseIP(tc.ip), MailFrom: "alice@example.com"},
+				Result:    spf.CheckHostResult{Code: tc.code},
+				ARC:       tc.arc,
+				ARCSealer: tc.sealer,
+			}
+			a := Decide(cfg, in)
+			assert.Equal(t, tc.want, a.Verdict)
+			assert.Equal(t, tc.reason, a.Reason)
+			assert.Contains(t, a.Header, string(tc.code))
+		})
+	}
+}
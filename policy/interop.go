@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/t0gun/go-spf"
+)
+
+// PySPFHeader returns a complete Received-SPF field, name included, laid out
+// in the order pyspf's get_header uses: the comment, then client-ip,
+// envelope-from, helo, receiver and identity.  It is the format of
+// Action.Header.  Only the order of the parts follows pyspf; the output has
+// not been checked against pyspf and is not promised to match it byte for
+// byte, so downstream parsers should read the RFC 7208 section 9.1
+// key-value pairs rather than the exact text.  envelope-from is always a
+// quoted-string and a HELO name or receiver that is not a dot-atom is
+// quoted.  The interop-tagged TestReferenceFields compares the output with
+// a locally installed pyspf.
+func PySPFHeader(receiver string, in Input) string {
+	return HeaderName + ": " + header(receiver, in, nil)
+}
+
+// LibSPF2Header returns a complete Received-SPF field, name included, laid
+// out in the order libspf2 uses, which follows the example in RFC 7208
+// section 9.1: receiver comes first among the key-value pairs and softfail
+// is worded "transitioning domain of".  As with PySPFHeader only the layout
+// follows the reference; values are quoted the same way as there, and
+// TestReferenceFields compares the output with a locally installed
+// spfquery.
+func LibSPF2Header(receiver string, in Input) string {
+	req := in.Request
+	code, who, identity := headerParts(in)
+
+	var b strings.Builder
+	b.WriteString(HeaderName)
+	b.WriteString(": ")
+	b.WriteString(string(code))
+	b.WriteString(" (")
+	if receiver != "" {
+		b.WriteString(commentText(receiver))
+		b.WriteString(": ")
+	}
+	if code == spf.SoftFail {
+		fmt.Fprintf(&b, "transitioning domain of %s does not designate %s as permitted sender", who, req.IP)
+	} else {
+		b.WriteString(comment(nil, code, who, req.IP))
+	}
+	b.WriteString(")")
+	if receiver != "" {
+		fmt.Fprintf(&b, " receiver=%s;", value(receiver))
+	}
+	fmt.Fprintf(&b, " client-ip=%s;", req.IP)
+	if req.MailFrom != "" {
+		fmt.Fprintf(&b, " envelope-from=%s;", quotedString(req.MailFrom))
+	}
+	if req.HELODomain != "" {
+		fmt.Fprintf(&b, " helo=%s;", value(req.HELODomain))
+	}
+	fmt.Fprintf(&b, " identity=%s;", identity)
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t0gun/go-spf"
+)
+
+func TestInteropHeaders(t *testing.T) {
+	req := spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "myname@example.com", HELODomain: "foo.example.com"}
+	cases := []struct {
+		name    string
+		code    spf.Result
+		libspf2 string
+		pyspf   string
+	}{
+		{
+			"pass", spf.Pass,
+			`Received-SPF: pass (mybox.example.org: domain of myname@example.com designates 192.0.2.1 as permitted sender) receiver=mybox.example.org; client-ip=192.0.2.1; envelope-from="myname@example.com"; helo=foo.example.com; identity=mailfrom;`,
+			`Received-SPF: pass (mybox.example.org: domain of myname@example.com designates 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from="myname@example.com"; helo=foo.example.com; receiver=mybox.example.org; identity=mailfrom;`,
+		},
+		{
+			"softfail", spf.SoftFail,
+			`Received-SPF: softfail (mybox.example.org: transitioning domain of myname@example.com does not designate 192.0.2.1 as permitted sender) receiver=mybox.example.org; client-ip=192.0.2.1; envelope-from="myname@example.com"; helo=foo.example.com; identity=mailfrom;`,
+			`Received-SPF: softfail (mybox.example.org: domain of transitioning myname@example.com does not designate 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from="myname@example.com"; helo=foo.example.com; receiver=mybox.example.org; identity=mailfrom;`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := Input{Request: req, Result: spf.CheckHostResult{Code: tc.code}}
+			assert.Equal(t, tc.libspf2, LibSPF2Header("mybox.example.org", in))
+			assert.Equal(t, tc.pyspf, PySPFHeader("mybox.example.org", in))
+		})
+	}
+}
+
+func TestQuotedString(t *testing.T) {
+	cases := map[string]string{
+		"myname@example.com":           `"myname@example.com"`,
+		"<>":                           `"<>"`,
+		`"john smith"@example.com`:     `"\"john smith\"@example.com"`,
+		`a\b@example.com`:              `"a\\b@example.com"`,
+		"jöran@bücher.example":         `"jöran@bücher.example"`,
+		"a\tb@example.com":             "\"a\tb@example.com\"",
+		"a\r\nX-Evil: 1@example.com":   `"aX-Evil: 1@example.com"`,
+		"a\x00\x7f\u0085b@example.com": `"ab@example.com"`,
+		"a\xffb@example.com":           `"ab@example.com"`,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, quotedString(in), "%q", in)
+	}
+}
+
+func TestHeaderQuotesHELO(t *testing.T) {
+	req := spf.Request{IP: net.ParseIP("192.0.2.1"), HELODomain: "evil.example; identity=mailfrom\r\nX-Evil: (1)"}
+	in := Input{Request: req, Result: spf.CheckHostResult{Code: spf.Pass}}
+	want := `pass (mx.example.org: domain of postmaster@evil.example; identity=mailfromX-Evil: \(1\) designates 192.0.2.1 as permitted sender)` +
+		` client-ip=192.0.2.1; helo="evil.example; identity=mailfromX-Evil: (1)"; receiver=mx.example.org; identity=mailfrom;`
+	assert.Equal(t, want, header("mx.example.org", in, nil))
+	assert.Equal(t, HeaderName+": "+want, PySPFHeader("mx.example.org", in))
+	assert.NotContains(t, LibSPF2Header("mx.example.org", in), "\n")
+
+	in.Request = spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "a)b@example.com", HELODomain: "mx.example.com"}
+	assert.Equal(t, `pass (domain of a\)b@example.com designates 192.0.2.1 as permitted sender)`+
+		` client-ip=192.0.2.1; envelope-from="a)b@example.com"; helo=mx.example.com; identity=mailfrom;`, header("", in, nil))
+}
+
+func TestHeaderQuotesReceiver(t *testing.T) {
+	req := spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "myname@example.com", HELODomain: "foo.example.com"}
+	in := Input{Request: req, Result: spf.CheckHostResult{Code: spf.Pass}}
+	receiver := "mx (a); identity=helo\r\nX-Evil: 1"
+	want := `pass (mx \(a\); identity=heloX-Evil: 1: domain of myname@example.com designates 192.0.2.1 as permitted sender)` +
+		` client-ip=192.0.2.1; envelope-from="myname@example.com"; helo=foo.example.com;` +
+		` receiver="mx (a); identity=heloX-Evil: 1"; identity=mailfrom;`
+	assert.Equal(t, want, header(receiver, in, nil))
+	assert.Equal(t, HeaderName+": "+want, PySPFHeader(receiver, in))
+	assert.Equal(t, HeaderName+`: pass (mx \(a\); identity=heloX-Evil: 1: domain of myname@example.com designates 192.0.2.1 as permitted sender)`+
+		` receiver="mx (a); identity=heloX-Evil: 1"; client-ip=192.0.2.1; envelope-from="myname@example.com"; helo=foo.example.com; identity=mailfrom;`,
+		LibSPF2Header(receiver, in))
+}
+
+func TestCommentText(t *testing.T) {
+	cases := map[string]string{
+		"myname@example.com":       "myname@example.com",
+		"a(b)c@example.com":        `a\(b\)c@example.com`,
+		`a\b@example.com`:          `a\\b@example.com`,
+		"a\r\nb@example.com":       "ab@example.com",
+		`"john smith"@example.com`: `"john smith"@example.com`,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, commentText(in), "%q", in)
+	}
+}
@@ -0,0 +1,348 @@
+// Package policy turns an SPF result into what an MTA should do with the
+// message.  RFC 7208 only defines results; the actions in section 8 are
+// recommendations that operators tune to their own stack.  Keeping that
+// mapping here separates "what the RFC says" (package spf) from "what my MTA
+// does" (this package).
+package policy
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/t0gun/go-spf"
+)
+
+// Verdict is the disposition chosen for a message.
+type Verdict string
+
+const (
+	Accept     Verdict = "accept"     // deliver normally
+	Quarantine Verdict = "quarantine" // deliver, but mark or file as suspicious
+	Reject     Verdict = "reject"     // refuse with a permanent 5xx reply
+	Defer      Verdict = "defer"      // refuse with a transient 4xx reply
+)
+
+// Strictness selects how hard the non-pass results are treated.
+type Strictness int
+
+const (
+	// Normal rejects fail, defers temperror and accepts everything else, as
+	// RFC 7208 section 8 suggests.
+	Normal Strictness = iota
+	// Relaxed never refuses a message: fail is quarantined and temperror
+	// accepted.
+	Relaxed
+	// Strict additionally quarantines softfail and rejects permerror.
+	Strict
+)
+
+// Config is the operator configuration for Decide.
+type Config struct {
+	Strictness Strictness
+
+	// Exceptions forces a verdict for a domain and its subdomains, for
+	// example Accept for a known forwarder.  Keys are lower-case domains; the
+	// most specific match wins.
+	Exceptions map[string]Verdict
+
+	// Receiver is the hostname written into the Received-SPF header.  When
+	// empty the request's ReceiverHostname is used.
+	Receiver string
+
+	// ProtectedZones lists zones, in lower case, whose subdomains are not
+	// meant to send mail unless they publish their own record, as operators
+	// who rely on a wildcard "v=spf1 -all" intend.  A None result for a
+	// strict subdomain of one of them, whether the name does not exist or
+	// has no record, is decided as if it were fail.  The zone itself is not
+	// affected and the Received-SPF header still reports none.
+	ProtectedZones []string
+
+	// Forwarding, when set, is asked about every fail.  If it reports
+	// trusted forwarding the message is accepted instead, and its rationale
+	// is kept in Action.Reason.  See TrustedForwarders and TrustedARC.
+	Forwarding Forwarding
+
+	// Catalog, when set, supplies the wording of Action.Text and of the
+	// comment in Action.Header, e.g. to localize them; see spf.Messages.
+	// Result keywords, reply codes and header key-value pairs are not
+	// affected.
+	Catalog spf.Catalog
+}
+
+// Input is one SPF evaluation to decide on.
+type Input struct {
+	Request spf.Request
+	Result  spf.CheckHostResult
+
+	// DMARC reports that the author domain publishes a DMARC policy.  SPF
+	// fail is then quarantined rather than rejected so DMARC can make the
+	// final call (RFC 7489 section 10.1).
+	DMARC bool
+
+	// ARC is the outcome of the caller's ARC validation of the message (RFC
+	// 8617) and ARCSealer the d= domain of its most recent ARC-Seal.  They
+	// are only evidence for Config.Forwarding; Decide does not use them
+	// otherwise.
+	ARC       ARCResult
+	ARCSealer string
+}
+
+// ARCResult is the chain validation status of an ARC set (RFC 8617 section
+// 4.4), the empty string when the message carries none.
+type ARCResult string
+
+const (
+	ARCNone ARCResult = ""
+	ARCPass ARCResult = "pass"
+	ARCFail ARCResult = "fail"
+)
+
+// Action is the decision for one message.
+type Action struct {
+	Verdict      Verdict
+	SMTPCode     int    // reply code, 250 for accepted messages
+	EnhancedCode string // RFC 3463 status code, RFC 7372 codes for SPF
+	Text         string // reply text
+	Header       string // Received-SPF header value, without the field name
+
+	// Reason explains a verdict that departs from the SPF result by local
+	// policy, for the audit log.  Empty when the result was decided as is.
+	Reason string
+}
+
+// HeaderName is the field name for Action.Header (RFC 7208 section 9.1).
+const HeaderName = "Received-SPF"
+
+// Decide maps the result in in to an Action according to cfg.
+func Decide(cfg Config, in Input) Action {
+	domain := strings.ToLower(in.Request.StartDomain())
+	decided, reason := in, ""
+	if in.Result.Code == spf.None {
+		if zone, ok := protectedZone(cfg.ProtectedZones, domain); ok {
+			decided.Result.Code = spf.Fail
+			reason = fmt.Sprintf("no SPF record at %s, a subdomain of protected zone %s: treated as fail", domain, zone)
+		}
+	}
+	v := verdict(cfg, decided)
+	if decided.Result.Code == spf.Fail && cfg.Forwarding != nil {
+		if why, ok := cfg.Forwarding(in); ok {
+			v = Accept
+			reason = "SPF fail accepted, trusted forwarding: " + why
+		}
+	}
+	if ex, ok := exception(cfg.Exceptions, domain); ok {
+		v = ex
+		reason = ""
+	}
+
+	a := Action{Verdict: v, Header: header(cmp.Or(cfg.Receiver, in.Request.ReceiverHostname), in, cfg.Catalog), Reason: reason}
+	args := spf.MessageArgs{Domain: domain, IP: in.Request.IP}
+	switch v {
+	case Reject:
+		a.SMTPCode = 550
+		if in.Result.Code == spf.PermError {
+			a.EnhancedCode = "5.7.24"
+			a.Text = spf.Message(cfg.Catalog, spf.MsgRejectPermError, args)
+		} else {
+			a.EnhancedCode = "5.7.23"
+			a.Text = spf.Message(cfg.Catalog, spf.MsgRejectFail, args)
+		}
+	case Defer:
+		a.SMTPCode = 451
+		a.EnhancedCode = "4.7.24"
+		a.Text = spf.Message(cfg.Catalog, spf.MsgDefer, args)
+	default:
+		a.SMTPCode = 250
+		a.EnhancedCode = "2.0.0"
+		a.Text = spf.Message(cfg.Catalog, spf.MsgAccept, args)
+	}
+	return a
+}
+
+// verdict is the verdict for the result before exceptions apply.
+func verdict(cfg Config, in Input) Verdict {
+	switch in.Result.Code {
+	case spf.Fail:
+		if cfg.Strictness == Relaxed || in.DMARC {
+			return Quarantine
+		}
+		return Reject
+	case spf.SoftFail:
+		if cfg.Strictness == Strict {
+			return Quarantine
+		}
+	case spf.TempError:
+		if cfg.Strictness != Relaxed {
+			return Defer
+		}
+	case spf.PermError:
+		if cfg.Strictness == Strict {
+			return Reject
+		}
+	}
+	return Accept
+}
+
+// exception finds the most specific entry in ex for domain or a parent.
+func exception(ex map[string]Verdict, domain string) (Verdict, bool) {
+	for d := domain; d != ""; {
+		if v, ok := ex[d]; ok {
+			return v, true
+		}
+		dot := strings.IndexByte(d, '.')
+		if dot < 0 {
+			break
+		}
+		d = d[dot+1:]
+	}
+	return "", false
+}
+
+// protectedZone returns the zone in zones that domain is a strict
+// subdomain of.
+func protectedZone(zones []string, domain string) (string, bool) {
+	for _, z := range zones {
+		if strings.HasSuffix(domain, "."+strings.TrimSuffix(z, ".")) {
+			return z, true
+		}
+	}
+	return "", false
+}
+
+// header formats a Received-SPF value as described in RFC 7208 section 9.1,
+// with the comment worded by cat.
+func header(receiver string, in Input, cat spf.Catalog) string {
+	req := in.Request
+	code, who, identity := headerParts(in)
+
+	var b strings.Builder
+	b.WriteString(string(code))
+	b.WriteString(" (")
+	if receiver != "" {
+		b.WriteString(commentText(receiver))
+		b.WriteString(": ")
+	}
+	b.WriteString(comment(cat, code, who, req.IP))
+	b.WriteString(")")
+	fmt.Fprintf(&b, " client-ip=%s;", req.IP)
+	if req.MailFrom != "" {
+		fmt.Fprintf(&b, " envelope-from=%s;", quotedString(req.MailFrom))
+	}
+	if req.HELODomain != "" {
+		fmt.Fprintf(&b, " helo=%s;", value(req.HELODomain))
+	}
+	if receiver != "" {
+		fmt.Fprintf(&b, " receiver=%s;", value(receiver))
+	}
+	fmt.Fprintf(&b, " identity=%s;", identity)
+	return b.String()
+}
+
+// quotedString returns s as an RFC 5322 section 3.2.4 quoted-string, the
+// form RFC 7208 section 9.1 gives key-value pairs.  Backslash and double
+// quote become quoted-pairs, UTF-8 stays as RFC 6532 allows in a
+// SMTPUTF8 message, and characters a quoted-string cannot hold, controls
+// other than tab and invalid UTF-8, are dropped so the field cannot be
+// split or folded by the sender.
+func quotedString(s string) string {
+	return `"` + escape(s, `"\`) + `"`
+}
+
+// value returns s as the value of a key-value pair: unchanged when it is a
+// dot-atom, as a well-formed HELO name is, and as a quoted-string otherwise,
+// so a HELO name holding ";" or a line break cannot add pairs or fields.
+func value(s string) string {
+	if isDotAtom(s) {
+		return s
+	}
+	return quotedString(s)
+}
+
+// commentText returns s for use inside the comment of a Received-SPF field
+// (RFC 5322 section 3.2.2).  Parentheses and backslash become quoted-pairs
+// and other characters are filtered as by quotedString, so a sender or HELO
+// name cannot close the comment early.
+func commentText(s string) string {
+	return escape(s, `()\`)
+}
+
+// escape writes the characters of special as quoted-pairs and drops
+// controls other than tab and invalid UTF-8.
+func escape(s, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(special, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t' || r >= ' ' && r < 0x7f || r >= 0xa0 && r != utf8.RuneError:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isDotAtom reports whether s is an RFC 5322 section 3.2.3 dot-atom-text.
+func isDotAtom(s string) bool {
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" {
+			return false
+		}
+		for i := 0; i < len(atom); i++ {
+			c := atom[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+				strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IdentityHeaders returns a Received-SPF value, without the field name, for
+// each identity checked by spf.CheckMailFromAndHELO for req: HELO, then MAIL
+// FROM when it was checked.  Each names its identity with identity= and
+// words its comment for the address that identity stands for, so the
+// message shows unambiguously what was checked (RFC 7208 section 9.1).
+// Prepending them in the order returned leaves the MAIL FROM field on top.
+// cfg.Receiver and cfg.Catalog apply as for Decide.
+func IdentityHeaders(cfg Config, req spf.Request, res spf.IdentityResults) []string {
+	receiver := cmp.Or(cfg.Receiver, req.ReceiverHostname)
+	req.Domain = ""
+	req.Identity = spf.IdentityHELO
+	out := []string{header(receiver, Input{Request: req, Result: res.HELO}, cfg.Catalog)}
+	if res.MailFromChecked {
+		req.Identity = spf.IdentityMailFrom
+		out = append(out, header(receiver, Input{Request: req, Result: res.MailFrom}, cfg.Catalog))
+	}
+	return out
+}
+
+// headerParts returns the result code, the identity checked as an address
+// and the identity name for a Received-SPF field.  A zero code is None and
+// the null reverse-path is reported as postmaster at the HELO domain.  who
+// is escaped for the comment, see commentText.
+func headerParts(in Input) (code spf.Result, who string, identity spf.Identity) {
+	req := in.Request
+	code = in.Result.Code
+	if code == "" {
+		code = spf.None
+	}
+	identity = req.Identity
+	if identity == "" {
+		identity = spf.IdentityMailFrom
+	}
+	who = req.MailFrom
+	if identity == spf.IdentityHELO || who == "" || who == "<>" {
+		who = "postmaster@" + req.HELODomain
+	}
+	return code, commentText(who), identity
+}
+
+// comment is the human readable part of the Received-SPF header.
+func comment(cat spf.Catalog, code spf.Result, who string, ip net.IP) string {
+	return spf.Message(cat, spf.CommentID(code), spf.MessageArgs{Sender: who, IP: ip})
+}
@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t0gun/go-spf"
+)
+
+func TestDecide(t *testing.T) {
+	req := spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "alice@example.com", HELODomain: "mx.example.org"}
+
+	cases := []struct {
+		name     string
+		cfg      Config
+		code     spf.Result
+		dmarc    bool
+		want     Verdict
+		wantSMTP int
+		wantEnh  string
+	}{
+		{"pass", Config{}, spf.Pass, false, Accept, 250, "2.0.0"},
+		{"none", Config{}, spf.None, false, Accept, 250, "2.0.0"},
+		{"fail", Config{}, spf.Fail, false, Reject, 550, "5.7.23"},
+		{"fail relaxed", Config{Strictness: Relaxed}, spf.Fail, false, Quarantine, 250, "2.0.0"},
+		{"fail with dmarc", Config{}, spf.Fail, true, Quarantine, 250, "2.0.0"},
+		{"softfail", Config{}, spf.SoftFail, false, Accept, 250, "2.0.0"},
+		{"softfail strict", Config{Strictness: Strict}, spf.SoftFail, false, Quarantine, 250, "2.0.0"},
+		{"temperror", Config{}, spf.TempError, false, Defer, 451, "4.7.24"},
+		{"temperror relaxed", Config{Strictness: Relaxed}, spf.TempError, false, Accept, 250, "2.0.0"},
+		{"permerror", Config{}, spf.PermError, false, Accept, 250, "2.0.0"},
+		{"permerror strict", Config{Strictness: Strict}, spf.PermError, false, Reject, 550, "5.7.24"},
+		{"exception on domain", Config{Exceptions: map[string]Verdict{"example.com": Accept}}, spf.Fail, false, Accept, 250, "2.0.0"},
+		{"exception on other domain", Config{Exceptions: map[string]Verdict{"example.net": Accept}}, spf.Fail, false, Reject, 550, "5.7.23"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := Decide(tc.cfg, Input{Request: req, Result: spf.CheckHostResult{Code: tc.code}, DMARC: tc.dmarc})
+			assert.Equal(t, tc.want, a.Verdict)
+			assert.Equal(t, tc.wantSMTP, a.SMTPCode)
+			assert.Equal(t, tc.wantEnh, a.EnhancedCode)
+			assert.NotEmpty(t, a.Text)
+		})
+	}
+}
+
+func TestDecideProtectedZones(t *testing.T) {
+	cfg := Config{ProtectedZones: []string{"example.com"}}
+	cases := []struct {
+		name   string
+		cfg    Config
+		from   string
+		code   spf.Result
+		want   Verdict
+		reason bool
+	}{
+		{"subdomain without record", cfg, "alice@shop.example.com", spf.None, Reject, true},
+		{"deep subdomain", cfg, "alice@a.b.example.com", spf.None, Reject, true},
+		{"zone itself", cfg, "alice@example.com", spf.None, Accept, false},
+		{"other zone", cfg, "alice@example.net", spf.None, Accept, false},
+		{"suffix is not a subdomain", cfg, "alice@badexample.com", spf.None, Accept, false},
+		{"subdomain with record", cfg, "alice@shop.example.com", spf.Pass, Accept, false},
+		{"relaxed", Config{ProtectedZones: []string{"example.com"}, Strictness: Relaxed}, "alice@shop.example.com", spf.None, Quarantine, true},
+		{"exception wins", Config{ProtectedZones: []string{"example.com"}, Exceptions: map[string]Verdict{"shop.example.com": Accept}}, "alice@shop.example.com", spf.None, Accept, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := Input{Request: spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: tc.from}, Result: spf.CheckHostResult{Code: tc.code}}
+			a := Decide(tc.cfg, in)
+			assert.Equal(t, tc.want, a.Verdict)
+			assert.Equal(t, tc.reason, a.Reason != "")
+			assert.Contains(t, a.Header, string(tc.code))
+		})
+	}
+}
+
+func TestException(t *testing.T) {
+	ex := map[string]Verdict{
+		"example.com":     Accept,
+		"bad.example.com": Reject,
+		"forwarder.test":  Quarantine,
+	}
+	cases := []struct {
+		domain string
+		want   Verdict
+		ok     bool
+	}{
+		{"example.com", Accept, true},
+		{"mail.example.com", Accept, true},
+		{"x.bad.example.com", Reject, true},
+		{"forwarder.test", Quarantine, true},
+		{"example.org", "", false},
+		{"notexample.com", "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.domain, func(t *testing.T) {
+			got, ok := exception(ex, tc.domain)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	cases := []struct {
+		name     string
+		receiver string
+		req      spf.Request
+		code     spf.Result
+		want     string
+	}{
+		{
+			"pass mailfrom", "mx.example.org",
+			spf.Request{IP: ip, MailFrom: "alice@example.com", HELODomain: "client.example.com"}, spf.Pass,
+			`pass (mx.example.org: domain of alice@example.com designates 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from="alice@example.com"; helo=client.example.com; receiver=mx.example.org; identity=mailfrom;`,
+		},
+		{
+			"fail helo", "",
+			spf.Request{IP: ip, HELODomain: "client.example.com", Identity: spf.IdentityHELO}, spf.Fail,
+			`fail (domain of postmaster@client.example.com does not designate 192.0.2.1 as permitted sender) client-ip=192.0.2.1; helo=client.example.com; identity=helo;`,
+		},
+		{
+			"zero result is none", "",
+			spf.Request{IP: ip, MailFrom: "<>", HELODomain: "client.example.com"}, "",
+			`none (domain of postmaster@client.example.com does not provide an SPF record) client-ip=192.0.2.1; envelope-from="<>"; helo=client.example.com; identity=mailfrom;`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := header(tc.receiver, Input{Request: tc.req, Result: spf.CheckHostResult{Code: tc.code}}, nil)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	req := spf.Request{IP: ip, MailFrom: "alice@example.com", HELODomain: "client.example.com", ReceiverHostname: "mx.example.org"}
+	res := spf.IdentityResults{
+		HELO:            spf.CheckHostResult{Code: spf.None},
+		MailFrom:        spf.CheckHostResult{Code: spf.Pass},
+		MailFromChecked: true,
+		Decisive:        spf.IdentityMailFrom,
+	}
+	assert.Equal(t, []string{
+		`none (mx.example.org: domain of postmaster@client.example.com does not provide an SPF record) client-ip=192.0.2.1; envelope-from="alice@example.com"; helo=client.example.com; receiver=mx.example.org; identity=helo;`,
+		`pass (mx.example.org: domain of alice@example.com designates 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from="alice@example.com"; helo=client.example.com; receiver=mx.example.org; identity=mailfrom;`,
+	}, IdentityHeaders(Config{}, req, res))
+
+	// a null reverse-path is only checked as HELO
+	req.MailFrom = "<>"
+	res = spf.IdentityResults{HELO: spf.CheckHostResult{Code: spf.Fail}, Decisive: spf.IdentityHELO}
+	assert.Equal(t, []string{
+		`fail (mx.example.net: domain of postmaster@client.example.com does not designate 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from="<>"; helo=client.example.com; receiver=mx.example.net; identity=helo;`,
+	}, IdentityHeaders(Config{Receiver: "mx.example.net"}, req, res))
+}
+
+func TestDecideReceiverFromRequest(t *testing.T) {
+	in := Input{
+		Request: spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "alice@example.com", ReceiverHostname: "in.example.net"},
+		Result:  spf.CheckHostResult{Code: spf.Pass},
+	}
+	assert.Contains(t, Decide(Config{}, in).Header, " receiver=in.example.net;")
+	assert.Contains(t, Decide(Config{Receiver: "mx.example.org"}, in).Header, " receiver=mx.example.org;")
+}
+
+func TestDecideCatalog(t *testing.T) {
+	cfg := Config{Receiver: "mx.example.net", Catalog: spf.Messages{
+		spf.MsgRejectFail:  "{domain} n'autorise pas {ip}",
+		spf.MsgCommentFail: "le domaine de {sender} n'autorise pas {ip}",
+	}}
+	in := Input{
+		Request: spf.Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"},
+		Result:  spf.CheckHostResult{Code: spf.Fail},
+	}
+	a := Decide(cfg, in)
+	assert.Equal(t, 550, a.SMTPCode)
+	assert.Equal(t, "5.7.23", a.EnhancedCode)
+	assert.Equal(t, "example.com n'autorise pas 192.0.2.1", a.Text)
+	assert.Equal(t, `fail (mx.example.net: le domaine de user@example.com n'autorise pas 192.0.2.1) client-ip=192.0.2.1; envelope-from="user@example.com"; receiver=mx.example.net; identity=mailfrom;`, a.Header)
+
+	// untranslated messages keep the default wording
+	in.Result.Code = spf.TempError
+	assert.Equal(t, "temporary error evaluating SPF record of example.com", Decide(cfg, in).Text)
+}
@@ -0,0 +1,142 @@
+//go:build interop
+
+// Comparison of Received-SPF fields with the reference implementations.
+// Every check of the root interop corpus is run through libspf2's spfquery
+// and pyspf, whichever are installed, and the field each writes is compared
+// with LibSPF2Header and PySPFHeader for the same result:
+//
+//	go test -tags interop -run ReferenceFields -v ./policy
+//
+// SPFQUERY and PYTHON override the commands used, as in the root harness.
+
+package policy
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf"
+)
+
+// captureReceiver is the receiver name passed to the references.
+const captureReceiver = "mx.example.org"
+
+// fieldReference runs one reference implementation and returns its result
+// and Received-SPF field.
+type fieldReference struct {
+	name   string
+	format func(string, Input) string
+	run    func(ctx context.Context, ip, sender, helo string) (spf.Result, string, error)
+}
+
+func fieldReferences() []fieldReference {
+	var refs []fieldReference
+	if path, err := exec.LookPath(cmp.Or(os.Getenv("SPFQUERY"), "spfquery")); err == nil {
+		refs = append(refs, fieldReference{name: "libspf2", format: LibSPF2Header,
+			run: func(ctx context.Context, ip, sender, helo string) (spf.Result, string, error) {
+				args := []string{"-ip", ip, "-sender", sender, "-name", captureReceiver}
+				if helo != "" {
+					args = append(args, "-helo", helo)
+				}
+				// non-zero exit for every result but pass; the result is
+				// the first line and the field the one naming itself
+				out, _ := exec.CommandContext(ctx, path, args...).Output()
+				return splitCapture(string(out))
+			}})
+	}
+	python := cmp.Or(os.Getenv("PYTHON"), "python3")
+	if path, err := exec.LookPath(python); err == nil && exec.Command(path, "-c", "import spf").Run() == nil {
+		refs = append(refs, fieldReference{name: "pyspf", format: PySPFHeader,
+			run: func(ctx context.Context, ip, sender, helo string) (spf.Result, string, error) {
+				script := "import spf, sys\n" +
+					"q = spf.query(i=sys.argv[1], s=sys.argv[2], h=sys.argv[3], receiver=sys.argv[4])\n" +
+					"res = q.check()[0]\n" +
+					"print(res)\n" +
+					"print(q.get_header(res, sys.argv[4]))\n"
+				out, err := exec.CommandContext(ctx, path, "-c", script, ip, sender, helo, captureReceiver).Output()
+				if err != nil {
+					return "", "", err
+				}
+				return splitCapture(string(out))
+			}})
+	}
+	return refs
+}
+
+// splitCapture reads the result from the first line of out and the field
+// from the line starting with the field name, which is added when a
+// reference prints the value alone.
+func splitCapture(out string) (spf.Result, string, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	code := spf.Result(strings.ToLower(strings.TrimSpace(lines[0])))
+	for _, l := range lines[1:] {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, HeaderName+":") {
+			return code, l, nil
+		}
+	}
+	if len(lines) > 1 {
+		return code, HeaderName + ": " + strings.TrimSpace(lines[len(lines)-1]), nil
+	}
+	return code, "", os.ErrNotExist
+}
+
+// readCorpus returns the checks of the root interop corpus as ip, sender
+// and helo, with the null reverse-path spelled as the empty sender.
+func readCorpus(t *testing.T) [][3]string {
+	f, err := os.Open(filepath.Join("..", "testdata", "interop", "corpus.txt"))
+	require.NoError(t, err)
+	defer f.Close()
+	var out [][3]string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		c := [3]string{fields[0], fields[1]}
+		if c[1] == "<>" {
+			c[1] = ""
+		}
+		if len(fields) > 2 {
+			c[2] = fields[2]
+		}
+		out = append(out, c)
+	}
+	require.NoError(t, sc.Err())
+	return out
+}
+
+func TestReferenceFields(t *testing.T) {
+	refs := fieldReferences()
+	if len(refs) == 0 {
+		t.Skip("neither spfquery nor pyspf is installed")
+	}
+	cases := readCorpus(t)
+	for _, ref := range refs {
+		for _, c := range cases {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			code, field, err := ref.run(ctx, c[0], c[1], c[2])
+			cancel()
+			if err != nil {
+				t.Logf("%s: %v: %v", ref.name, c, err)
+				continue
+			}
+			in := Input{
+				Request: spf.Request{IP: net.ParseIP(c[0]), MailFrom: c[1], HELODomain: c[2]},
+				Result:  spf.CheckHostResult{Code: code},
+			}
+			assert.Equal(t, field, ref.format(captureReceiver, in), "%s: %v", ref.name, c)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolFull is returned by Pool.Check when every worker is busy and the
+// queue is at its configured length.
+var ErrPoolFull = errors.New("spf: worker pool queue full")
+
+// PoolConfig bounds the concurrency of a Pool.
+type PoolConfig struct {
+	// Workers is the number of checks run at once, 1 if zero or less.
+	Workers int
+	// Queue is the number of Check callers allowed to wait for a worker.
+	// Callers beyond it get ErrPoolFull at once.  Zero means no waiting:
+	// a check either starts immediately or is refused.
+	Queue int
+}
+
+// PoolStats are the counters of a Pool, see Pool.Stats.
+type PoolStats struct {
+	Running   int           // checks in progress
+	Queued    int           // callers waiting for a worker
+	Completed int64         // checks finished
+	Rejected  int64         // Check calls refused with ErrPoolFull
+	Waited    time.Duration // total time callers spent queued
+	MaxWait   time.Duration // longest single wait
+}
+
+// Pool runs checks on a Checker with bounded concurrency, so an embedding
+// MTA can cap the goroutines and DNS queries in flight under load and
+// watch queue wait times to tune the limits.  It is safe for concurrent
+// use.
+type Pool struct {
+	c     *Checker
+	slots chan struct{}
+	queue int
+
+	queued    atomic.Int64
+	completed atomic.Int64
+	rejected  atomic.Int64
+
+	mu      sync.Mutex
+	waited  time.Duration
+	maxWait time.Duration
+}
+
+// NewPool returns a Pool running checks on c.
+func NewPool(c *Checker, cfg PoolConfig) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	return &Pool{c: c, slots: make(chan struct{}, cfg.Workers), queue: max(cfg.Queue, 0)}
+}
+
+// Check runs c.Check for req once a worker is free.  It returns ErrPoolFull
+// when the queue is full and the context error if ctx ends while waiting.
+func (p *Pool) Check(ctx context.Context, req Request) (CheckHostResult, error) {
+	if err := p.acquire(ctx, true); err != nil {
+		return CheckHostResult{}, err
+	}
+	defer p.release()
+	return p.c.Check(ctx, req)
+}
+
+// BatchResult is the outcome of one request of CheckBatch.
+type BatchResult struct {
+	Result CheckHostResult
+	Err    error
+}
+
+// CheckBatch checks every request of reqs and returns the outcomes in the
+// same order.  It starts at most as many goroutines as the pool has
+// workers and waits for free workers instead of failing with ErrPoolFull.
+// Requests not started when ctx ends report the context error.
+func (p *Pool) CheckBatch(ctx context.Context, reqs []Request) []BatchResult {
+	out := make([]BatchResult, len(reqs))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range min(cap(p.slots), len(reqs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(reqs) {
+					return
+				}
+				if err := p.acquire(ctx, false); err != nil {
+					out[i].Err = err
+					continue
+				}
+				out[i].Result, out[i].Err = p.c.Check(ctx, reqs[i])
+				p.release()
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// Stats returns a snapshot of the pool's counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Running:   len(p.slots),
+		Queued:    int(p.queued.Load()),
+		Completed: p.completed.Load(),
+		Rejected:  p.rejected.Load(),
+		Waited:    p.waited,
+		MaxWait:   p.maxWait,
+	}
+}
+
+// acquire takes a worker slot, waiting for one unless the queue is full.
+// bounded applies the queue length; batch workers are already bounded by
+// their own number.
+func (p *Pool) acquire(ctx context.Context, bounded bool) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if bounded && p.queued.Add(1) > int64(p.queue) {
+		p.queued.Add(-1)
+		p.rejected.Add(1)
+		return ErrPoolFull
+	}
+	if !bounded {
+		p.queued.Add(1)
+	}
+	defer p.queued.Add(-1)
+
+	start := time.Now()
+	select {
+	case p.slots <- struct{}{}:
+		p.recordWait(time.Since(start))
+		return nil
+	case <-ctx.Done():
+		p.recordWait(time.Since(start))
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	<-p.slots
+	p.completed.Add(1)
+}
+
+func (p *Pool) recordWait(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waited += d
+	p.maxWait = max(p.maxWait, d)
+}
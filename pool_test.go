@@ -0,0 +1,98 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+// gatedTXT blocks every lookup until gate is closed.
+type gatedTXT struct {
+	gate    chan struct{}
+	started chan struct{}
+}
+
+func (g gatedTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	g.started <- struct{}{}
+	select {
+	case <-g.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []string{"v=spf1 ip4:192.0.2.0/24 -all"}, nil
+}
+
+func TestPoolCheck(t *testing.T) {
+	txt := gatedTXT{gate: make(chan struct{}), started: make(chan struct{}, 8)}
+	p := NewPool(NewChecker(dns.NewCustomDNSResolver(txt, nil)), PoolConfig{Workers: 1, Queue: 1})
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "alice@example.com"}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make(chan Result, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := p.Check(ctx, req)
+			assert.NoError(t, err)
+			results <- res.Code
+		}()
+	}
+	<-txt.started
+	require.Eventually(t, func() bool { return p.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, p.Stats().Running)
+
+	// one running and one queued: a third caller is refused
+	_, err := p.Check(ctx, req)
+	require.ErrorIs(t, err, ErrPoolFull)
+
+	// a queued caller gives up with its context
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	p2 := NewPool(p.c, PoolConfig{Workers: 1, Queue: 5})
+	p2.slots <- struct{}{}
+	_, err = p2.Check(cctx, req)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(txt.gate)
+	wg.Wait()
+	close(results)
+	for code := range results {
+		assert.Equal(t, Pass, code)
+	}
+	st := p.Stats()
+	assert.Equal(t, PoolStats{Completed: 2, Rejected: 1, Waited: st.Waited, MaxWait: st.MaxWait}, st)
+	assert.Positive(t, st.MaxWait)
+}
+
+func TestPoolCheckBatch(t *testing.T) {
+	txt := fakeTXTMap{"example.com": {"v=spf1 ip4:192.0.2.0/24 -all"}}
+	p := NewPool(NewChecker(dns.NewCustomDNSResolver(txt, nil)), PoolConfig{Workers: 3})
+
+	var reqs []Request
+	for _, ip := range []string{"192.0.2.1", "198.51.100.1", "192.0.2.2", "203.0.113.1", "192.0.2.3"} {
+		reqs = append(reqs, Request{IP: net.ParseIP(ip), MailFrom: "alice@example.com"})
+	}
+	out := p.CheckBatch(context.Background(), reqs)
+	require.Len(t, out, len(reqs))
+	want := []Result{Pass, Fail, Pass, Fail, Pass}
+	for i, r := range out {
+		require.NoError(t, r.Err)
+		assert.Equal(t, want[i], r.Result.Code, i)
+	}
+	assert.Equal(t, int64(len(reqs)), p.Stats().Completed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range p.CheckBatch(ctx, reqs[:2]) {
+		assert.ErrorIs(t, r.Err, context.Canceled)
+	}
+	assert.Empty(t, p.CheckBatch(context.Background(), nil))
+}
@@ -0,0 +1,79 @@
+package spf
+
+import (
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Quirks are deviations from RFC 7208 seen at large mailbox providers.  They
+// let deliverability tooling predict what a particular receiver will decide
+// rather than what the RFC says.  Each field names a behaviour instead of a
+// provider: providers do not document their evaluators and change them
+// without notice, so callers map the knobs to the receivers they observe.
+// ProviderQuirks holds starting points for some large receivers.  The zero
+// value is strict RFC 7208 behaviour.
+type Quirks struct {
+	// FirstRecord evaluates the first of several published v=spf1 records
+	// instead of returning PermError (section 4.5).  A trace note records
+	// that duplicates were ignored.
+	FirstRecord bool
+
+	// DuplicateRecords evaluates a record published several times with
+	// byte-identical text as if it were published once, instead of
+	// returning PermError (section 4.5).  The duplicates are reported as a
+	// lint.RuleDuplicateRecord warning.  Records that differ still take the
+	// FirstRecord path or fail.
+	DuplicateRecords bool
+
+	// MacroErrorNoMatch treats an a, exists or include term whose macro
+	// domain-spec does not expand to a usable name as not matching, instead
+	// of returning PermError (section 7.1).  A trace note records the
+	// failure.
+	MacroErrorNoMatch bool
+
+	// LenientWhitespace accepts records that separate terms with tabs, CR
+	// or LF instead of spaces, which parser.Parse otherwise rejects with
+	// parser.ErrInvalidByte (section 4.6.1), see
+	// parser.Options.LenientWhitespace.  Whitespace around the whole record
+	// is always ignored.
+	LenientWhitespace bool
+}
+
+// ProviderQuirks maps receiver names to the Quirks matching how they have
+// been seen to evaluate SPF, for WithQuirks:
+//   - "gmail": a record published more than once with identical text is
+//     evaluated instead of failing with PermError (DuplicateRecords).
+//   - "outlook": Microsoft 365 and Outlook.com treat a term whose macro
+//     does not expand to a usable name as not matching (MacroErrorNoMatch).
+//
+// The bundles record observed behaviour as of the last review of this map,
+// not anything the providers publish.  Receivers change without notice;
+// confirm a prediction against real deliveries before acting on it.
+var ProviderQuirks = map[string]Quirks{
+	"gmail":   {DuplicateRecords: true},
+	"outlook": {MacroErrorNoMatch: true},
+}
+
+// WithQuirks enables the receiver quirks set in q, see Quirks.
+func WithQuirks(q Quirks) Option {
+	return func(c *Checker) {
+		c.quirks = q
+	}
+}
+
+// recordOptions are the parser options for fetched records: the Checker's,
+// with Quirks.LenientWhitespace applied.
+func (c *Checker) recordOptions() parser.Options {
+	o := c.parserOpts
+	o.LenientWhitespace = o.LenientWhitespace || c.quirks.LenientWhitespace
+	return o
+}
+
+// macroNoMatch reports whether a failed domain-spec expansion of mech is
+// treated as no match under Quirks.MacroErrorNoMatch, noting it if so.
+func (c *Checker) macroNoMatch(ev *evaluation, mech parser.Mechanism, err error) bool {
+	if !c.quirks.MacroErrorNoMatch || !mech.Macro {
+		return false
+	}
+	ev.note(mech.Kind, "macro expansion failed, treated as no match: "+err.Error())
+	return true
+}
@@ -0,0 +1,124 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
+)
+
+func TestWithQuirks(t *testing.T) {
+	txts := fakeTXTMap{
+		"dup.example":   {"v=spf1 ip4:192.0.2.1 -all", "v=spf1 -all"},
+		"macro.example": {"v=spf1 exists:%{z}.example ip4:192.0.2.1 -all"},
+		"inc.example":   {"v=spf1 include:%{z}.example ip4:192.0.2.1 -all"},
+		"outer.example": {"v=spf1 include:dup.example -all"},
+		"same.example":  {"v=spf1 ip4:192.0.2.1 -all", "v=spf1 ip4:192.0.2.1 -all"},
+		"case.example":  {"v=spf1 ip4:192.0.2.1 -all", "V=SPF1 ip4:192.0.2.1 -all"},
+		"mixed.example": {"v=spf1 ip4:192.0.2.1 -all", "v=spf1 ip4:192.0.2.1 -all", "v=spf1 -all"},
+		"tab.example":   {"v=spf1 ip4:192.0.2.1\t-all"},
+		"crlf.example":  {"v=spf1 include:tab.example\r\n-all"},
+	}
+	cases := []struct {
+		name   string
+		domain string
+		quirks Quirks
+		want   Result
+		note   string
+	}{
+		{"multiple records rfc", "dup.example", Quirks{}, PermError, ""},
+		{"multiple records first", "dup.example", Quirks{FirstRecord: true}, Pass, "2 SPF records at dup.example, evaluating the first"},
+		{"multiple records in include", "outer.example", Quirks{FirstRecord: true}, Pass, "2 SPF records at dup.example, evaluating the first"},
+		{"identical records rfc", "same.example", Quirks{}, PermError, ""},
+		{"identical records deduplicated", "same.example", Quirks{DuplicateRecords: true}, Pass, "duplicate SPF records at same.example ignored"},
+		{"records differing in case", "case.example", Quirks{DuplicateRecords: true}, PermError, ""},
+		{"distinct records remain", "mixed.example", Quirks{DuplicateRecords: true}, PermError, "duplicate SPF records at mixed.example"},
+		{"distinct records remain first", "mixed.example", Quirks{DuplicateRecords: true, FirstRecord: true}, Pass, "duplicate SPF records at mixed.example"},
+		{"macro error rfc", "macro.example", Quirks{}, PermError, ""},
+		{"macro error no match", "macro.example", Quirks{MacroErrorNoMatch: true}, Pass, "macro expansion failed"},
+		{"include macro error no match", "inc.example", Quirks{MacroErrorNoMatch: true}, Pass, "macro expansion failed"},
+		{"tab rfc", "tab.example", Quirks{}, PermError, ""},
+		{"tab lenient", "tab.example", Quirks{LenientWhitespace: true}, Pass, ""},
+		{"crlf in include lenient", "crlf.example", Quirks{LenientWhitespace: true}, Pass, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithQuirks(tc.quirks))
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@" + tc.domain})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.note != "" {
+				require.NotEmpty(t, res.Trace)
+				assert.Contains(t, res.Trace[0].Note, tc.note)
+			}
+		})
+	}
+}
+
+func TestQuirksDuplicateRecordsWarning(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com":  {"v=spf1 include:same.example include:same.example -all"},
+		"same.example": {"v=spf1 ip4:192.0.2.1 -all", "v=spf1 ip4:192.0.2.1 -all"},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithQuirks(Quirks{DuplicateRecords: true}))
+	res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("198.51.100.1"), MailFrom: "user@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, Fail, res.Code)
+	assert.Equal(t, []Warning{{
+		Domain:  "same.example",
+		Rule:    lint.RuleDuplicateRecord,
+		Message: "duplicate SPF records at same.example ignored",
+	}}, res.Warnings)
+}
+
+func TestProviderQuirks(t *testing.T) {
+	txts := fakeTXTMap{
+		"same.example":  {"v=spf1 ip4:192.0.2.1 -all", "v=spf1 ip4:192.0.2.1 -all"},
+		"macro.example": {"v=spf1 exists:%{z}.example ip4:192.0.2.1 -all"},
+	}
+	cases := []struct {
+		provider string
+		domain   string
+		want     Result
+	}{
+		{"gmail", "same.example", Pass},
+		{"gmail", "macro.example", PermError},
+		{"outlook", "same.example", PermError},
+		{"outlook", "macro.example", Pass},
+	}
+	for _, tc := range cases {
+		q, ok := ProviderQuirks[tc.provider]
+		require.True(t, ok, tc.provider)
+		ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithQuirks(q))
+		res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@" + tc.domain})
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, res.Code, tc.provider+" "+tc.domain)
+	}
+}
+
+func TestWalkRecordQuirks(t *testing.T) {
+	txts := fakeTXTMap{
+		"example.com":  {"v=spf1 include:same.example -all"},
+		"same.example": {"v=spf1 ip4:192.0.2.1 -all", "v=spf1 ip4:192.0.2.1 -all"},
+	}
+	r := dns.NewCustomDNSResolver(txts, nil)
+
+	g, err := NewChecker(r).WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.ErrorIs(t, g.Nodes["same.example"].Err, dns.ErrMultipleSPF)
+
+	g, err = NewChecker(r, WithQuirks(ProviderQuirks["gmail"])).WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	n := g.Nodes["same.example"]
+	require.NoError(t, n.Err)
+	assert.Equal(t, "v=spf1 ip4:192.0.2.1 -all", n.Record)
+	require.Len(t, n.Findings, 1)
+	assert.Equal(t, lint.RuleDuplicateRecord, n.Findings[0].Rule)
+
+	_, err = NewChecker(r, WithSizeLimits(SizeLimits{MaxRecordBytes: 10})).WalkRecord(context.Background(), "example.com")
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
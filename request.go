@@ -0,0 +1,76 @@
+package spf
+
+import (
+	"net"
+
+	"github.com/t0gun/go-spf/internal/mailaddr"
+)
+
+// Identity names the SMTP identity an evaluation authorizes (RFC 7208
+// section 2).
+type Identity string
+
+const (
+	IdentityMailFrom Identity = "mailfrom" // MAIL FROM reverse-path, section 2.4
+	IdentityHELO     Identity = "helo"     // HELO/EHLO hostname, section 2.3
+)
+
+// Request carries every input of one check_host evaluation.  Unlike the
+// positional CheckHost arguments it can express all the values macros need.
+type Request struct {
+	IP               net.IP   // connecting client address, %{i}
+	MailFrom         string   // MAIL FROM address, "" or "<>" for bounces
+	HELODomain       string   // HELO/EHLO hostname, %{h}
+	Identity         Identity // identity being checked, IdentityMailFrom if empty
+	ReceiverHostname string   // receiving MTA hostname, %{r}
+
+	// ClientHostname is a hostname of IP that the caller has already
+	// validated: its PTR record names it and it resolves back to IP, the
+	// check most MTAs do for logging.  When set, %{p} expands to it and the
+	// ptr mechanism compares against it instead of repeating the PTR and
+	// address lookups.  Leave it empty when no name was validated.
+	ClientHostname string
+
+	// NullSenderLocalPart replaces "postmaster" as the local part of the
+	// identity used for a null reverse-path and for HELO checks, where
+	// RFC 7208 section 2.4 has %{s}, %{l} and %{o} expand from
+	// postmaster@<HELODomain>.  Leave it empty for RFC behaviour.
+	NullSenderLocalPart string
+
+	// Domain overrides the domain where evaluation starts.  When empty it is
+	// derived from Identity: the MAIL FROM domain (or HELODomain for a null
+	// reverse-path), or HELODomain for IdentityHELO.
+	Domain string
+}
+
+// StartDomain returns the domain check_host starts evaluating at, the
+// <domain> argument of RFC 7208 section 4.1.
+func (r Request) StartDomain() string {
+	if r.Domain != "" {
+		return r.Domain
+	}
+	if r.Identity == IdentityHELO {
+		return r.HELODomain
+	}
+	if d, ok := mailaddr.Domain(r.MailFrom); ok && d != "" {
+		return d
+	}
+	return r.HELODomain
+}
+
+// nullLocal returns the local part substituted for a null reverse-path.
+func (r Request) nullLocal() string {
+	if r.NullSenderLocalPart == "" {
+		return "postmaster"
+	}
+	return r.NullSenderLocalPart
+}
+
+// sender returns the MAIL FROM value to use for macro expansion.  A HELO
+// check always uses postmaster@<helo> per RFC 7208 section 2.3.
+func (r Request) sender() string {
+	if r.Identity == IdentityHELO {
+		return ""
+	}
+	return r.MailFrom
+}
@@ -0,0 +1,147 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/macro"
+)
+
+// fixedClock is a Clock that always reports the same instant.
+type fixedClock time.Time
+
+func (f fixedClock) Now() time.Time { return time.Time(f) }
+
+func TestRequestDomain(t *testing.T) {
+	tc := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"mail from domain", Request{MailFrom: "alice@example.com", HELODomain: "mx.example.org"}, "example.com"},
+		{"null sender uses helo", Request{MailFrom: "<>", HELODomain: "mx.example.org"}, "mx.example.org"},
+		{"helo identity", Request{MailFrom: "alice@example.com", HELODomain: "mx.example.org", Identity: IdentityHELO}, "mx.example.org"},
+		{"explicit domain wins", Request{MailFrom: "alice@example.com", Domain: "example.net"}, "example.net"},
+		{"quoted local part with at sign", Request{MailFrom: `"alice@evil.example"@example.com`}, "example.com"},
+		{"source route ignored", Request{MailFrom: "<@relay.example:alice@example.com>"}, "example.com"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, c.req.StartDomain())
+		})
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":    {"v=spf1 -all"},
+		"mx.example.org": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}
+	ip := net.ParseIP("192.0.2.1")
+
+	cases := []struct {
+		name string
+		req  Request
+		want Result
+	}{
+		{"mail from identity", Request{IP: ip, MailFrom: "alice@example.com", HELODomain: "mx.example.org"}, Fail},
+		{"helo identity", Request{IP: ip, MailFrom: "alice@example.com", HELODomain: "mx.example.org", Identity: IdentityHELO}, Pass},
+		{"null sender checks helo domain", Request{IP: ip, MailFrom: "<>", HELODomain: "mx.example.org"}, Pass},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+			res, err := ch.Check(context.Background(), tc.req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+		})
+	}
+}
+
+func TestChecker_CheckContract(t *testing.T) {
+	txt := fakeTXTMap{
+		"nospf.example.com": {"google-site-verification=abc"},
+		"multi.example.com": {"v=spf1 -all", "v=spf1 +all"},
+	}
+	ip := net.ParseIP("192.0.2.1")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name      string
+		ctx       context.Context
+		req       Request
+		wantCode  Result
+		wantCause error
+		wantErr   error
+	}{
+		{"nxdomain is none", context.Background(), Request{IP: ip, Domain: "missing.example.com"}, None, dns.ErrNoDNSrecord, nil},
+		{"no record is none", context.Background(), Request{IP: ip, Domain: "nospf.example.com"}, None, ErrNoSPFRecord, nil},
+		{"multiple records is permerror", context.Background(), Request{IP: ip, Domain: "multi.example.com"}, PermError, dns.ErrMultipleSPF, nil},
+		{"missing ip is an error", context.Background(), Request{Domain: "nospf.example.com"}, "", nil, ErrNoIP},
+		{"canceled context is an error", canceled, Request{IP: ip, Domain: "nospf.example.com"}, "", nil, context.Canceled},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+			res, err := ch.Check(tc.ctx, tc.req)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCode, res.Code)
+			assert.ErrorIs(t, res.Cause, tc.wantCause)
+		})
+	}
+}
+
+func TestChecker_newEvaluationReceiverAndTime(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil), WithClock(fixedClock(at)))
+
+	req := Request{
+		IP:               net.ParseIP("192.0.2.3"),
+		MailFrom:         "alice@example.com",
+		ReceiverHostname: "mx.receiver.example",
+	}
+	ev := ch.newEvaluation(req, "example.com")
+
+	got, err := macro.ExpandExplanation("%{r} %{t}", ev.vars)
+	require.NoError(t, err)
+	assert.Equal(t, "mx.receiver.example 1700000000", got)
+}
+
+func TestRequest_NullSenderMacros(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil))
+	ip := net.ParseIP("192.0.2.1")
+	cases := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"sender", Request{IP: ip, MailFrom: "alice@example.com", HELODomain: "mx.example.org"}, "alice.example.com.alice@example.com"},
+		{"empty mail from", Request{IP: ip, HELODomain: "mx.example.org"}, "postmaster.mx.example.org.postmaster@mx.example.org"},
+		{"null reverse-path", Request{IP: ip, MailFrom: "<>", HELODomain: "mx.example.org"}, "postmaster.mx.example.org.postmaster@mx.example.org"},
+		{"helo identity", Request{IP: ip, MailFrom: "alice@example.com", HELODomain: "mx.example.org", Identity: IdentityHELO}, "postmaster.mx.example.org.postmaster@mx.example.org"},
+		{"no helo", Request{IP: ip, Domain: "example.com"}, "postmaster.example.com.postmaster@example.com"},
+		{"configured local part", Request{IP: ip, MailFrom: "<>", HELODomain: "mx.example.org", NullSenderLocalPart: "bounces"}, "bounces.mx.example.org.bounces@mx.example.org"},
+		{"configured local part ignored for senders", Request{IP: ip, MailFrom: "alice@example.com", NullSenderLocalPart: "bounces"}, "alice.example.com.alice@example.com"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ch.Plan(tc.req, "v=spf1 exists:%{l}.%{o}.%{s} -all")
+			require.NoError(t, err)
+			require.Len(t, got, 2)
+			assert.Equal(t, tc.want, got[1].Name)
+		})
+	}
+}
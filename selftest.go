@@ -0,0 +1,251 @@
+package spf
+
+import (
+	"context"
+	"net"
+
+	"github.com/t0gun/go-spf/dns"
+)
+
+// SelfTestReport is the outcome of Checker.SelfTest.
+type SelfTestReport struct {
+	Vectors    int         // vectors evaluated
+	Deviations []Deviation // vectors whose result differs from RFC 7208
+}
+
+// Compliant reports whether every vector produced the RFC 7208 result.
+func (r SelfTestReport) Compliant() bool { return len(r.Deviations) == 0 }
+
+// Deviation is a self-test vector whose result differs from the one RFC
+// 7208 requires.
+type Deviation struct {
+	Name    string // vector name
+	Section string // RFC 7208 section the vector exercises
+	Want    Result
+	Got     Result
+	Cause   error // cause of Got, if any
+}
+
+// SelfTest runs the built-in conformance vectors, drawn from the RFC 7208
+// test suite, with c's configuration: limits, mode, quirks, disabled
+// mechanisms and every other option.  It lets operators show that a
+// deployed configuration still follows the RFC, and lists where it does
+// not; options that knowingly depart from it, such as WithInternalResult
+// or WithNAT64, may show up as deviations.
+//
+// Each vector's DNS data is served from memory in place of the backends of
+// c.Resolver, which keeps its own settings such as sorted answers, so no
+// query leaves the process; the decision cache and greylisting hook are not
+// consulted.  Only a context error stops the run.
+func (c *Checker) SelfTest(ctx context.Context) (SelfTestReport, error) {
+	var rep SelfTestReport
+	for _, v := range selfTestVectors {
+		res, err := c.selfTestCheck(ctx, v.req, c.selfTestResolver(v.zone))
+		if err != nil {
+			if ctx.Err() != nil {
+				return rep, ctx.Err()
+			}
+			res = CheckHostResult{Cause: err}
+		}
+		rep.Vectors++
+		if res.Code != v.want {
+			rep.Deviations = append(rep.Deviations, Deviation{Name: v.name, Section: v.section, Want: v.want, Got: res.Code, Cause: res.Cause})
+		}
+	}
+	return rep, nil
+}
+
+// selfTestResolver serves zone through c.Resolver.
+func (c *Checker) selfTestResolver(zone selfTestZone) *dns.Resolver {
+	if c.Resolver == nil {
+		return dns.NewCustomDNSResolver(zone, zone)
+	}
+	return c.Resolver.WithBackends(zone, zone)
+}
+
+// selfTestCheck is check against r with panics recovered, as in Check.
+func (c *Checker) selfTestCheck(ctx context.Context, req Request, r *dns.Resolver) (res CheckHostResult, err error) {
+	defer c.recoverPanic(ctx, req, &res, &err)
+	return c.check(ctx, req, r)
+}
+
+// selfTestVector is one conformance vector of SelfTest.
+type selfTestVector struct {
+	name    string
+	section string
+	zone    selfTestZone
+	req     Request
+	want    Result
+}
+
+// selfTestRRs are the records of one name in a selfTestZone.
+type selfTestRRs struct {
+	txt  []string
+	addr []string
+	mx   []string
+}
+
+// selfTestZone serves the DNS data of a vector.  Names without an entry are
+// NXDOMAIN; a name with an entry but no records of the queried type is
+// NODATA.
+type selfTestZone map[string]selfTestRRs
+
+func (z selfTestZone) lookup(name string) (selfTestRRs, error) {
+	rrs, ok := z[name]
+	if !ok {
+		return rrs, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return rrs, nil
+}
+
+func (z selfTestZone) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	rrs, err := z.lookup(name)
+	return rrs.txt, err
+}
+
+func (z selfTestZone) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	rrs, err := z.lookup(host)
+	var out []net.IPAddr
+	for _, a := range rrs.addr {
+		out = append(out, net.IPAddr{IP: net.ParseIP(a)})
+	}
+	return out, err
+}
+
+func (z selfTestZone) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	rrs, err := z.lookup(name)
+	var out []*net.MX
+	for i, host := range rrs.mx {
+		out = append(out, &net.MX{Host: host, Pref: uint16(10 * (i + 1))})
+	}
+	return out, err
+}
+
+func (z selfTestZone) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+// selfTestRequest is the MAIL FROM check of user@domain from ip.
+func selfTestRequest(ip, domain string) Request {
+	return Request{IP: net.ParseIP(ip), MailFrom: "user@" + domain, HELODomain: "mail." + domain}
+}
+
+// selfTestVectors are adapted from the RFC 7208 test suite, using
+// documentation addresses and names under .example.
+var selfTestVectors = []selfTestVector{
+	{
+		name: "ip4 cidr match", section: "5.6", want: Pass,
+		zone: selfTestZone{"e1.example": {txt: []string{"v=spf1 ip4:192.0.2.0/24 -all"}}},
+		req:  selfTestRequest("192.0.2.7", "e1.example"),
+	},
+	{
+		name: "ip6 match", section: "5.6", want: Pass,
+		zone: selfTestZone{"e2.example": {txt: []string{"v=spf1 ip6:2001:db8::/32 -all"}}},
+		req:  selfTestRequest("2001:db8::1", "e2.example"),
+	},
+	{
+		name: "all qualifiers", section: "4.6.2", want: SoftFail,
+		zone: selfTestZone{"e3.example": {txt: []string{"v=spf1 ip4:192.0.2.0/24 ~all"}}},
+		req:  selfTestRequest("198.51.100.1", "e3.example"),
+	},
+	{
+		name: "default result", section: "4.7", want: Neutral,
+		zone: selfTestZone{"e4.example": {txt: []string{"v=spf1 ip4:192.0.2.0/24"}}},
+		req:  selfTestRequest("198.51.100.1", "e4.example"),
+	},
+	{
+		name: "no record", section: "4.5", want: None,
+		zone: selfTestZone{"e5.example": {txt: []string{"google-site-verification=x"}}},
+		req:  selfTestRequest("192.0.2.1", "e5.example"),
+	},
+	{
+		name: "multiple records", section: "4.5", want: PermError,
+		zone: selfTestZone{"e6.example": {txt: []string{"v=spf1 -all", "v=spf1 +all"}}},
+		req:  selfTestRequest("192.0.2.1", "e6.example"),
+	},
+	{
+		name: "syntax error", section: "4.6", want: PermError,
+		zone: selfTestZone{"e7.example": {txt: []string{"v=spf1 ip4:192.0.2.300 -all"}}},
+		req:  selfTestRequest("192.0.2.1", "e7.example"),
+	},
+	{
+		name: "unknown modifier ignored", section: "6", want: Pass,
+		zone: selfTestZone{"e8.example": {txt: []string{"v=spf1 moo=cow ip4:192.0.2.1 -all"}}},
+		req:  selfTestRequest("192.0.2.1", "e8.example"),
+	},
+	{
+		name: "include pass", section: "5.2", want: Pass,
+		zone: selfTestZone{
+			"e9.example":      {txt: []string{"v=spf1 include:_spf.e9.example -all"}},
+			"_spf.e9.example": {txt: []string{"v=spf1 ip4:192.0.2.1 -all"}},
+		},
+		req: selfTestRequest("192.0.2.1", "e9.example"),
+	},
+	{
+		name: "include fail is no match", section: "5.2", want: Fail,
+		zone: selfTestZone{
+			"e10.example":      {txt: []string{"v=spf1 include:_spf.e10.example -all"}},
+			"_spf.e10.example": {txt: []string{"v=spf1 -all"}},
+		},
+		req: selfTestRequest("192.0.2.1", "e10.example"),
+	},
+	{
+		name: "include without record", section: "5.2", want: PermError,
+		zone: selfTestZone{"e11.example": {txt: []string{"v=spf1 include:missing.e11.example -all"}}},
+		req:  selfTestRequest("192.0.2.1", "e11.example"),
+	},
+	{
+		name: "redirect", section: "6.1", want: Fail,
+		zone: selfTestZone{
+			"e12.example":      {txt: []string{"v=spf1 redirect=_spf.e12.example"}},
+			"_spf.e12.example": {txt: []string{"v=spf1 -all"}},
+		},
+		req: selfTestRequest("192.0.2.1", "e12.example"),
+	},
+	{
+		name: "redirect ignored with all", section: "6.1", want: Pass,
+		zone: selfTestZone{"e13.example": {txt: []string{"v=spf1 +all redirect=missing.e13.example"}}},
+		req:  selfTestRequest("192.0.2.1", "e13.example"),
+	},
+	{
+		name: "a with cidr", section: "5.3", want: Pass,
+		zone: selfTestZone{"e14.example": {txt: []string{"v=spf1 a/24 -all"}, addr: []string{"192.0.2.10"}}},
+		req:  selfTestRequest("192.0.2.99", "e14.example"),
+	},
+	{
+		name: "mx", section: "5.4", want: Pass,
+		zone: selfTestZone{
+			"e15.example":      {txt: []string{"v=spf1 mx -all"}, mx: []string{"mail.e15.example"}},
+			"mail.e15.example": {addr: []string{"192.0.2.25"}},
+		},
+		req: selfTestRequest("192.0.2.25", "e15.example"),
+	},
+	{
+		name: "exists with macros", section: "7.3", want: Pass,
+		zone: selfTestZone{
+			"e16.example":                     {txt: []string{"v=spf1 exists:%{ir}.%{l}._spf.%{d} -all"}},
+			"1.2.0.192.user._spf.e16.example": {addr: []string{"127.0.0.2"}},
+		},
+		req: selfTestRequest("192.0.2.1", "e16.example"),
+	},
+	{
+		name: "lookup limit", section: "4.6.4", want: PermError,
+		zone: selfTestZone{
+			"e17.example": {txt: []string{"v=spf1 a:h.e17.example a:h.e17.example a:h.e17.example a:h.e17.example " +
+				"a:h.e17.example a:h.e17.example a:h.e17.example a:h.e17.example a:h.e17.example a:h.e17.example " +
+				"a:h.e17.example -all"}},
+			"h.e17.example": {addr: []string{"198.51.100.1"}},
+		},
+		req: selfTestRequest("192.0.2.1", "e17.example"),
+	},
+	{
+		name: "void lookup limit", section: "4.6.4", want: PermError,
+		zone: selfTestZone{"e18.example": {txt: []string{"v=spf1 a:v1.e18.example a:v2.e18.example a:v3.e18.example -all"}}},
+		req:  selfTestRequest("192.0.2.1", "e18.example"),
+	},
+	{
+		name: "malformed domain", section: "4.3", want: None,
+		zone: selfTestZone{},
+		req:  Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@bad..example"},
+	},
+}
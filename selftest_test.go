@@ -0,0 +1,65 @@
+package spf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestSelfTest(t *testing.T) {
+	// the configured resolver is never queried
+	unused := dns.NewCustomDNSResolver(fakeTXTMap{}, fakeIPResolver{})
+
+	rep, err := NewChecker(unused).SelfTest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, len(selfTestVectors), rep.Vectors)
+	assert.Empty(t, rep.Deviations)
+	assert.True(t, rep.Compliant())
+
+	rep, err = NewChecker(unused, WithDisabledMechanisms("mx")).SelfTest(context.Background())
+	require.NoError(t, err)
+	assert.False(t, rep.Compliant())
+	require.Len(t, rep.Deviations, 1)
+	d := rep.Deviations[0]
+	assert.Equal(t, "mx", d.Name)
+	assert.Equal(t, "5.4", d.Section)
+	assert.Equal(t, Pass, d.Want)
+	assert.Equal(t, Fail, d.Got)
+
+	ch := NewChecker(unused)
+	ch.MaxLookups = 20
+	rep, err = ch.SelfTest(context.Background())
+	require.NoError(t, err)
+	require.Len(t, rep.Deviations, 1)
+	assert.Equal(t, "lookup limit", rep.Deviations[0].Name)
+}
+
+func TestSelfTestResolverKeepsSettings(t *testing.T) {
+	zone := selfTestZone{"h.example": {addr: []string{"2001:db8::1", "192.0.2.1"}}}
+	unused := dns.NewCustomDNSResolver(fakeTXTMap{}, fakeIPResolver{})
+
+	ips, err := NewChecker(unused).selfTestResolver(zone).LookupIP(context.Background(), "h.example")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ips[0].String())
+
+	ips, err = NewChecker(unused, WithSortedAnswers()).selfTestResolver(zone).LookupIP(context.Background(), "h.example")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", ips[0].String(), "answers sorted as configured")
+}
+
+func TestSelfTestSkipsDecisionCache(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{}, nil), WithDecisionCache(DecisionCacheConfig{}))
+	_, err := ch.SelfTest(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, ch.decisions.size)
+}
+
+func TestSelfTestCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewChecker(nil).SelfTest(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
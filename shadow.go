@@ -0,0 +1,51 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/t0gun/go-spf/parser"
+)
+
+// MaxShadowLookups bounds the DNS-querying terms of a shadow evaluation, so
+// include and redirect loops still end.
+const MaxShadowLookups = 100
+
+// ShadowResult is the advisory outcome attached by WithShadowResult to a
+// PermError caused by the section 4.6.4 lookup limit: the record evaluated
+// again with up to MaxShadowLookups lookups and no void lookup limit.  It
+// tells what the publisher presumably meant, not what RFC 7208 decides;
+// enforcing it would reward records every compliant verifier rejects.
+type ShadowResult struct {
+	Code         Result
+	Cause        error
+	Mechanism    string // term that produced Code, as in CheckHostResult
+	TerminatedAt string // domain whose record produced Code
+	Lookups      int    // lookups the shadow evaluation needed
+	VoidLookups  int
+}
+
+// shadowResult evaluates rec, the record of domain that ev gave up on,
+// without the lookup limits.  It returns nil when the context ends first.
+// The shadow evaluation's trace and events are discarded.
+func (c *Checker) shadowResult(ctx context.Context, ev *evaluation, req Request, domain string, rec *parser.Record) *ShadowResult {
+	sev := c.newEvaluation(req, domain)
+	sev.resolver = ev.resolver
+	sev.disabled = ev.disabled
+	sev.maxLookups = MaxShadowLookups
+	sev.shadow = true
+	res, err := c.evaluateRecord(ctx, sev, rec)
+	if err != nil {
+		ev.note("", "shadow evaluation aborted: "+err.Error())
+		return nil
+	}
+	ev.note("", fmt.Sprintf("lookup limit exceeded, advisory shadow result is %s after %d lookups", res.Code, sev.lookups))
+	return &ShadowResult{
+		Code:         res.Code,
+		Cause:        res.Cause,
+		Mechanism:    res.Mechanism,
+		TerminatedAt: sev.vars.Domain,
+		Lookups:      sev.lookups,
+		VoidLookups:  sev.voids,
+	}
+}
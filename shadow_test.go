@@ -0,0 +1,87 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// shadowZone publishes a record with n include terms, the last of which
+// authorizes 192.0.2.1, and void a mechanisms just before the last.
+func shadowZone(n, voids int) fakeTXTMap {
+	var terms []string
+	txts := fakeTXTMap{}
+	for i := 1; i < n; i++ {
+		name := fmt.Sprintf("inc%d.example", i)
+		terms = append(terms, "include:"+name)
+		txts[name] = []string{"v=spf1 -all"}
+	}
+	for i := 0; i < voids; i++ {
+		terms = append(terms, fmt.Sprintf("a:void%d.example", i))
+	}
+	terms = append(terms, "include:last.example")
+	txts["last.example"] = []string{"v=spf1 ip4:192.0.2.1 -all"}
+	txts["example.com"] = []string{"v=spf1 " + strings.Join(terms, " ") + " -all"}
+	return txts
+}
+
+func TestWithShadowResult(t *testing.T) {
+	req := Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"}
+
+	cases := []struct {
+		name        string
+		txts        fakeTXTMap
+		shadow      bool
+		want        Result
+		wantShadow  Result
+		wantLookups int
+	}{
+		{name: "within limit", txts: shadowZone(5, 0), shadow: true, want: Pass},
+		{name: "over limit without option", txts: shadowZone(12, 0), want: PermError},
+		{name: "over limit", txts: shadowZone(12, 0), shadow: true, want: PermError, wantShadow: Pass, wantLookups: 12},
+		{name: "void limit lifted", txts: shadowZone(9, 3), shadow: true, want: PermError, wantShadow: Pass, wantLookups: 12},
+		{name: "shadow bounded", txts: shadowZone(MaxShadowLookups+1, 0), shadow: true, want: PermError, wantShadow: PermError, wantLookups: MaxShadowLookups + 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []Option
+			if tc.shadow {
+				opts = append(opts, WithShadowResult())
+			}
+			ch := NewChecker(dns.NewCustomDNSResolver(tc.txts, fakeIPResolver{}), opts...)
+			res, err := ch.Check(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.wantShadow == "" {
+				assert.Nil(t, res.Shadow)
+				return
+			}
+			require.NotNil(t, res.Shadow)
+			assert.Equal(t, tc.wantShadow, res.Shadow.Code)
+			assert.Equal(t, tc.wantLookups, res.Shadow.Lookups)
+			assert.Contains(t, res.Trace[len(res.Trace)-1].Note, "advisory shadow result is "+string(tc.wantShadow))
+		})
+	}
+}
+
+func TestWithShadowResultEvaluate(t *testing.T) {
+	txts := shadowZone(11, 0)
+	rec, err := parser.Parse(txts["example.com"][0])
+	require.NoError(t, err)
+
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeIPResolver{}), WithShadowResult())
+	res, err := ch.Evaluate(context.Background(), net.ParseIP("192.0.2.1"), "example.com", rec, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, PermError, res.Code)
+	require.NotNil(t, res.Shadow)
+	assert.Equal(t, Pass, res.Shadow.Code)
+	assert.Equal(t, "example.com", res.Shadow.TerminatedAt)
+	assert.Equal(t, "include:last.example", res.Shadow.Mechanism)
+}
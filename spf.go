@@ -2,16 +2,63 @@
 // by RFC 7208.  The primary entry point is CheckHost which walks the decision
 // tree in section 4.6 to determine the authorization result for a given IP
 // and domain.
-
+//
+// # API stability
+//
+// The module follows semantic versioning and the v1 API is frozen.  It
+// consists of:
+//
+//   - Checker, NewChecker, Check, CheckHost, CheckHostWithHELO, Evaluate,
+//     EvaluateRequest and CheckHostResult
+//   - Request and Identity
+//   - Result and its constants, and the lookup limits
+//   - the Record, Mechanism, Modifier and Qualifier aliases of the parser types
+//   - the Resolver, TXTResolver and IPResolver aliases of the dns types
+//
+// # Return contract
+//
+// Check and Checker.Evaluate always return a CheckHostResult with a non-empty
+// Code when the error is nil.  DNS failures, missing records and malformed
+// input are SPF outcomes reported through Code and Cause, never through the
+// error.  The error is non-nil only for context cancellation or deadline
+// expiry and for caller mistakes such as a missing client IP, and then the
+// result must be ignored.
+//
+// CheckHost and CheckHostWithHELO keep the original contract for
+// compatibility: a missing domain (NXDOMAIN) is also returned as the error,
+// and a domain without an SPF record yields a zero CheckHostResult.
+//
+// # Concurrency
+//
+// A configured Checker may be shared by any number of goroutines; each
+// evaluation keeps its own lookup counters, trace and macro state.  Options
+// and exported fields must be set before the first evaluation.  Resolver
+// backends supplied through dns.NewCustomDNSResolver must be safe for
+// concurrent use.
+//
+// The dns and parser subpackages are public and covered by the same promise.
+// Helpers under internal/ are implementation details and may change at any
+// time.
 package spf
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/internal/ipmatch"
+	"github.com/t0gun/go-spf/internal/mailaddr"
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/macro"
 	"github.com/t0gun/go-spf/parser"
 )
 
@@ -28,38 +75,299 @@ const (
 	PermError Result = "permerror" // perm error in record or >10 look‑ups
 )
 
+// ErrMechanismDisabled is the cause of a PermError raised when evaluation
+// reaches a mechanism disabled with WithDisabledMechanisms.
+var ErrMechanismDisabled = errors.New("mechanism disabled by policy")
+
+// ErrBroadCIDR is the cause of the PermError raised under WithStrictCIDR
+// for a term whose network is too broad.
+var ErrBroadCIDR = errors.New("network mask too broad")
+
+// ErrRedirectNone is the cause of the PermError returned when a redirect
+// target publishes no SPF record (RFC 7208 section 6.1).
+var ErrRedirectNone = errors.New("redirect target has no SPF record")
+
+// ErrIncludeNone is the cause of the PermError returned when an include
+// target publishes no SPF record (RFC 7208 section 5.2).
+var ErrIncludeNone = errors.New("include target has no SPF record")
+
+// Caller mistakes returned as errors by Check and Checker.Evaluate.
+var (
+	ErrNilRecord = errors.New("spf: nil record")
+	ErrNoIP      = errors.New("spf: no client IP address")
+)
+
+// ErrNoResolver is the cause of results and health checks of a Checker
+// without a Resolver.
+var ErrNoResolver = errors.New("spf: no resolver configured")
+
+// ErrInternal is wrapped by the cause of results produced by a failure of
+// the library or its configuration rather than of DNS or the record, see
+// WithInternalErrorAction.
+var ErrInternal = errors.New("spf: internal error")
+
+// ErrTooLarge is the cause of the PermError returned when DNS data exceeds
+// the limits set with WithSizeLimits.
+var ErrTooLarge = errors.New("DNS data exceeds size limit")
+
+// ErrInternalNetwork is the cause of the result returned for a client on an
+// internal network, see WithInternalResult.
+var ErrInternalNetwork = errors.New("internal network")
+
+// ErrEAISender is the cause of the None result for an internationalized
+// MAIL FROM address when WithRejectEAI is used.
+var ErrEAISender = errors.New("internationalized sender not accepted")
+
+// ErrNoSPFRecord is the cause of a None result for a domain that exists but
+// publishes no SPF record (RFC 7208 section 4.5).
+var ErrNoSPFRecord = errors.New("no SPF record published")
+
 // Limits from RFC 7208 section 4.6.4.
 const (
 	MaxDNSLookups  = 10 // any mechanism that triggers DNS counts
 	MaxVoidLookups = 2  // DNS look‑ups returning no usable data
+	MaxMXNames     = 10 // exchanges looked up for one mx mechanism
+	MaxPTRNames    = 10 // PTR names validated for one ptr mechanism
 )
 
+// ErrTooManyMX is the cause of the PermError returned when an mx mechanism
+// finds more than MaxMXNames exchanges (RFC 7208 section 4.6.4).
+var ErrTooManyMX = errors.New("too many MX records")
+
 // Checker implements a full RFC 7208–compliant SPF policy evaluator.
+//
+// A Checker is safe for concurrent use by multiple goroutines once it has
+// been configured: every evaluation keeps its counters and trace in its own
+// state.  Its exported fields must not be changed while evaluations are
+// running, and the Resolver's backends must themselves be safe for
+// concurrent use, as net.Resolver is.
 type Checker struct {
 	Resolver       *dns.Resolver
 	MaxLookups     int
 	MaxVoidLookups int
-	Lookups        int
-	Voids          int
-	// Future fields may allow customization of evaluation behaviour.
+
+	// Deprecated: lookups are counted per evaluation and reported in
+	// CheckHostResult.Lookups and VoidLookups.  These fields are no longer
+	// updated; sharing them made concurrent evaluations race and exhaust
+	// each other's limits.
+	Lookups int
+	// Deprecated: see Lookups.
+	Voids int
+
+	// Clock supplies the current time for the %{t} macro and decision
+	// cache expiry; see WithClock.  A nil Clock means the system clock.
+	Clock Clock
+
+	disabled       map[string]bool // mechanism kinds banned by policy
+	disabledAction DisabledAction
+	greylist       Greylister
+	modifiers      ModifierHandler
+	catalog        Catalog // see WithCatalog
+	healthName     string  // canary for HealthCheck
+	mode           Mode
+	orgFallback    bool
+	strictCIDR     *lint.Config // nil unless WithStrictCIDR is used
+	existsRanges   []*net.IPNet // non-RFC answer filter for exists
+	quirks         Quirks
+	internalAction InternalErrorAction
+	panicHook      PanicHook
+	sizeLimits     SizeLimits
+	parserOpts     parser.Options
+	decisions      *decisionCache    // nil unless WithDecisionCache is used
+	parsed         *parseCache       // nil unless WithParseCache is used
+	internal       *internalNets     // nil unless WithInternalResult is used
+	nat64          []*net.IPNet      // see WithNAT64
+	overrides      map[string]string // domain to record, see WithIncludeOverride
+	rejectEAI      bool
+	queryTrace     bool          // see WithQueryTrace
+	existsAAAA     bool          // see WithExistsAAAA
+	shadow         bool          // see WithShadowResult
+	timeout        time.Duration // see WithTimeout
+	defaultHELO    string        // %{h} when the request has no HELO name
+	receiver       string        // %{r} when the request names no receiver
+	internalErrors atomic.Int64
+}
+
+// Clock supplies the current time.  Tests inject a fixed clock to make
+// time-dependent output deterministic.
+type Clock interface {
+	Now() time.Time
 }
 
-// NewChecker returns a Checker that uses the given TXTResolver.
-func NewChecker(r *dns.Resolver) *Checker {
-	return &Checker{
+// ClockFunc adapts an ordinary function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time { return f() }
+
+// now returns the current time from the configured Clock.
+func (c *Checker) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// NewChecker returns a Checker that uses the given TXTResolver, configured by
+// the supplied options.
+func NewChecker(r *dns.Resolver, opts ...Option) *Checker {
+	c := &Checker{
 		Resolver:       r,
 		MaxLookups:     MaxDNSLookups,
 		MaxVoidLookups: MaxVoidLookups,
-		Lookups:        0,
-		Voids:          0,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 
+	return c
 }
 
 // CheckHostResult contains the result code and optional cause returned by
+// an evaluation, plus the trace of notable steps taken to reach it.
 type CheckHostResult struct {
 	Code  Result
 	Cause error
+	Trace []TraceEntry
+
+	// Chain lists the records evaluated at the top level in order: the
+	// starting domain followed by each redirect= target (RFC 7208 section
+	// 6.1).  Included records are not part of the chain.
+	Chain []Hop
+	// Included lists the records evaluated for include mechanisms, in the
+	// order they were reached, including redirect= targets followed from
+	// within an included record.
+	Included []Hop
+	// TerminatedAt is the domain whose record produced Code.
+	TerminatedAt string
+	// Mechanism is the canonical text of the term that produced Code, e.g.
+	// "ip4:192.0.2.0/24", the include term when the match was inside an
+	// include, or "default" when no term matched.  It is empty when Code
+	// did not come from a term.
+	Mechanism string
+
+	// Domain and IP are the starting domain and client address of the
+	// check, and Elapsed the time it took.  Check and Evaluate set them.
+	Domain  string
+	IP      net.IP
+	Elapsed time.Duration
+
+	// OrgFallback is set when the result comes from the organizational
+	// domain's record because the evaluated domain had none.  This is not
+	// RFC 7208 behaviour, see WithOrgDomainFallback.
+	OrgFallback bool
+
+	// Lookups and VoidLookups are the section 4.6.4 counters at the end of
+	// the evaluation.
+	Lookups     int
+	VoidLookups int
+
+	// UsedMacros reports that a term reached during evaluation, in the
+	// record or any include or redirect target, has a macro in its
+	// domain-spec, so the outcome may differ per sender or client.
+	// UsedPTR reports that a ptr mechanism or a %{p} macro was reached, so
+	// the outcome depends on reverse DNS.  Reputation systems treat both
+	// as signals.
+	UsedMacros bool
+	UsedPTR    bool
+
+	// Explanation is the expanded exp= text for a Fail result (RFC 7208
+	// section 6.2) and ExplanationStatus tells whether one was available.
+	Explanation       string
+	ExplanationStatus ExplanationStatus
+
+	// Warnings lists deprecated or dangerous constructs exercised by this
+	// evaluation: a ptr term that was reached, or a matching term such as
+	// +all or a very broad network.  Terms the evaluation never reached are
+	// not reported; use the lint package to audit a whole record.
+	Warnings []Warning
+
+	// Cached is set when the Pass came from the decision cache instead of
+	// an evaluation, see WithDecisionCache.
+	Cached bool
+
+	// RetryAfter and Reply are set when the Greylister installed with
+	// WithGreylist deferred a TempError.  Reply is a suggested SMTP response.
+	RetryAfter time.Duration
+	Reply      string
+
+	// Shadow is set by WithShadowResult when Code is a PermError caused by
+	// the lookup limit.  It is advisory only and must never be enforced.
+	Shadow *ShadowResult
+}
+
+// AbortError is returned when the context is canceled or its deadline
+// expires during evaluation.  It carries the partial trace so operators can
+// see how far evaluation got, e.g. before an SMTP timeout.  errors.Is
+// matches the underlying context error.
+type AbortError struct {
+	Err    error  // context.Canceled or context.DeadlineExceeded
+	Domain string // domain being evaluated when the context ended
+	Trace  []TraceEntry
+	Chain  []Hop
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("spf: evaluation of %s aborted: %v", e.Domain, e.Err)
+}
+
+func (e *AbortError) Unwrap() error { return e.Err }
+
+// ExplanationStatus reports the fate of an exp= modifier.
+type ExplanationStatus string
+
+const (
+	// ExplanationNone means no explanation applies: the result is not Fail
+	// or the record has no exp= modifier.
+	ExplanationNone ExplanationStatus = ""
+	// ExplanationAvailable means Explanation holds the expanded text.
+	ExplanationAvailable ExplanationStatus = "available"
+	// ExplanationSuppressed means the record asked for an explanation but
+	// none could be produced: the lookup failed, returned no or several TXT
+	// records, or the text was invalid.  RFC 7208 section 6.2 says to
+	// proceed as if there were no exp= modifier.
+	ExplanationSuppressed ExplanationStatus = "suppressed"
+)
+
+// Hop is one record visited while following redirects or includes.
+type Hop struct {
+	Domain string
+	// Record is the TXT string selected and evaluated, exactly as served,
+	// so audit logs keep what the policy said at decision time.  Evaluate
+	// reports the canonical form of the record it was given.
+	Record           string
+	RecordHash       string // hex SHA-256 of the record text
+	LookupsRemaining int    // lookup budget left on arriving at the record
+}
+
+// Warning is a lint finding for a term exercised during evaluation.
+type Warning struct {
+	Domain  string // domain whose record holds the term
+	Rule    string // lint rule identifier, e.g. lint.RulePTR
+	Term    string
+	Message string
+}
+
+// TraceEntry records one notable step of an evaluation.
+type TraceEntry struct {
+	Domain    string // domain whose record was being evaluated
+	Mechanism string // mechanism kind, empty for record-level steps
+	Note      string
+	Rcode     string // DNS response code of a failed lookup, when known
+
+	// Query, QueryType, Answers, Server and Latency describe a DNS query,
+	// for entries recorded with WithQueryTrace.  Server is empty when the
+	// backend does not report it.
+	Query     string
+	QueryType string
+	Answers   int
+	Server    string
+	Latency   time.Duration
+
+	// LookupsRemaining is what was left of the section 4.6.4 lookup budget
+	// when the entry was recorded.  The budget is shared by the whole
+	// evaluation: redirect and include continue with the same counter.
+	LookupsRemaining int
 }
 
 // defaultChecker backs the package-level CheckHost convenience function.
@@ -70,16 +378,122 @@ var defaultChecker = NewChecker(dns.NewDNSResolver())
 // is the EHLO hostname or the domain part of MAIL FROM.  The sender parameter is
 // the full MAIL FROM address ("<>" for bounces) and is used only for macro
 // expansion.
+//
+// CheckHost does not know the HELO hostname, so %{h} expands to an empty
+// string.  Use CheckHostWithHELO when it is available.
 func (c *Checker) CheckHost(ctx context.Context, ip net.IP, domain, sender string) (CheckHostResult, error) {
-	valDomain, err := parser.ValidateDomain(domain)
+	return c.CheckHostWithHELO(ctx, ip, domain, sender, "")
+}
+
+// CheckHostWithHELO is CheckHost with the HELO/EHLO hostname presented by the
+// client.  The hostname feeds the %{h} macro (RFC 7208 section 7.3) and, when
+// sender is empty or "<>", replaces the null reverse-path with
+// postmaster@<helo> as described in section 2.4.
+func (c *Checker) CheckHostWithHELO(ctx context.Context, ip net.IP, domain, sender, helo string) (CheckHostResult, error) {
+	return legacyResult(c.Check(ctx, Request{IP: ip, MailFrom: sender, HELODomain: helo, Domain: domain}))
+}
+
+// legacyResult converts a Check outcome to the original CheckHost contract:
+// NXDOMAIN is also returned as the error and a domain without an SPF record
+// yields a zero result.
+func legacyResult(res CheckHostResult, err error) (CheckHostResult, error) {
+	if err != nil || res.Code != None {
+		return res, err
+	}
+	switch {
+	case errors.Is(res.Cause, dns.ErrNoDNSrecord):
+		return res, res.Cause
+	case errors.Is(res.Cause, ErrNoSPFRecord):
+		return CheckHostResult{}, nil
+	}
+	return res, nil
+}
+
+// Check runs check_host (RFC 7208 section 4.6) for the inputs in req.  It is
+// the most general entry point; CheckHost and CheckHostWithHELO are thin
+// wrappers around it.  See the package documentation for the return
+// contract: every SPF outcome, including DNS failures, is reported in the
+// result and the error is reserved for context errors and caller mistakes.
+// A panic during evaluation is recovered and reported as an internal error,
+// see WithInternalErrorAction and WithPanicHook.
+func (c *Checker) Check(ctx context.Context, req Request) (res CheckHostResult, err error) {
+	defer stamp(&res, req.StartDomain(), req.IP, time.Now())
+	defer c.recoverPanic(ctx, req, &res, &err)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	res, err = c.check(ctx, req, c.Resolver)
+	if err == nil && c.orgFallback && res.Code == None {
+		res, err = c.checkOrgDomain(ctx, req, res)
+	}
+	if err != nil || res.Code != TempError || c.greylist == nil {
+		return res, err
+	}
+	if after, ok := c.greylist(ctx, req, res); ok {
+		res.RetryAfter = after
+		res.Reply = c.greylistReply(req.StartDomain(), after)
+	}
+	return res, nil
+}
+
+// stamp records the inputs and duration of a check in res.  It runs
+// deferred, after any recovered panic has produced res.
+func stamp(res *CheckHostResult, domain string, ip net.IP, start time.Time) {
+	res.Domain, res.IP, res.Elapsed = domain, ip, time.Since(start)
+}
+
+// greylistReply formats the 451 response suggested for a greylisted
+// TempError, using the RFC 7372 enhanced status code for SPF DNS errors.
+// The text comes from the Catalog set with WithCatalog.
+func (c *Checker) greylistReply(domain string, after time.Duration) string {
+	return "451 4.7.24 " + Message(c.catalog, MsgGreylist, MessageArgs{Domain: domain, RetryAfter: after})
+}
+
+// check is Check without the greylist hook, querying r.  Only SelfTest
+// passes a resolver other than c.Resolver.
+func (c *Checker) check(ctx context.Context, req Request, r *dns.Resolver) (CheckHostResult, error) {
+	if req.IP == nil {
+		return CheckHostResult{}, ErrNoIP
+	}
+	if err := ctx.Err(); err != nil {
+		return CheckHostResult{}, err
+	}
+	ctx = dns.StickyContext(ctx) // chain resolvers keep their backend per evaluation
+	if c.internal != nil && c.internal.contains(req.IP) {
+		return CheckHostResult{Code: c.internal.code, Cause: ErrInternalNetwork}, nil
+	}
+	if c.rejectEAI && mailaddr.International(req.sender()) {
+		// treated like a malformed identity, RFC 7208 section 4.3
+		return CheckHostResult{Code: None, Cause: ErrEAISender}, nil
+	}
+	valDomain, err := c.parserOpts.ValidateDomain(req.StartDomain())
 	if err != nil {
 		// RFC 7208 section 4.3 malformed domain results to none
 		return CheckHostResult{Code: None, Cause: err}, nil
 	}
-	domain = valDomain
-	lp := localPart(sender)
+	domain := valDomain
+	ev := c.newEvaluation(req, domain)
+	ev.events = eventsFrom(ctx)
+	ev.resolver = r
+	ev.applyFlags(ctx)
+	if ev.resolver == nil {
+		return ev.finish(c.internalError(ev, ErrNoResolver)), nil
+	}
+	// decisions are only valid for the configured resolver and limits, and a
+	// query trace asked for by Flags needs the queries made
+	decisions := c.decisions
+	if ev.resolver != c.Resolver || ev.disabled != nil || ev.maxLookups != c.MaxLookups || c.modifiers != nil ||
+		ev.queries && !c.queryTrace {
+		decisions = nil
+	}
+	if decisions != nil {
+		// stored under the address evaluated, after NAT64 translation
+		if n, ok := decisions.lookup(domain, ev.ip, c.now()); ok {
+			ev.note("", "pass cached for "+n.String())
+			return CheckHostResult{Code: Pass, TerminatedAt: domain, Trace: ev.trace, Cached: true}, nil
+		}
+	}
 	// Perform the SPF record lookup per RFC 7208 section 4.4.
-	spfRecord, err := dns.GetSPFRecord(ctx, domain, c.Resolver)
+	spfRecord, raw, err := c.getRecord(ctx, ev, domain)
 
 	// Apply the record-selection logic from RFC 7208 section 4.5.
 	switch {
@@ -87,21 +501,81 @@ func (c *Checker) CheckHost(ctx context.Context, ip net.IP, domain, sender strin
 		// Context errors are outside the scope of RFC 7208.
 		return CheckHostResult{}, err
 	case errors.Is(err, dns.ErrNoDNSrecord):
-		return CheckHostResult{Code: None, Cause: err}, err
+		return ev.finish(CheckHostResult{Code: None, Cause: err}), nil
 	case errors.Is(err, dns.ErrTempfail):
-		return CheckHostResult{Code: TempError, Cause: err}, nil
-	case errors.Is(err, dns.ErrPermfail), errors.Is(err, dns.ErrMultipleSPF):
-		return CheckHostResult{Code: PermError, Cause: err}, nil
+		ev.noteLookupError("", domain, err)
+		return ev.finish(CheckHostResult{Code: TempError, Cause: err}), nil
 	case err != nil:
-		return CheckHostResult{}, err
+		// ErrPermfail, ErrMultipleSPF; GetSPFRecord classifies everything else
+		ev.noteLookupError("", domain, err)
+		return ev.finish(CheckHostResult{Code: PermError, Cause: err}), nil
 	}
 
 	if spfRecord == "" {
-		return CheckHostResult{}, err
+		// section 4.5 - no SPF record published
+		return ev.finish(CheckHostResult{Code: None, Cause: ErrNoSPFRecord}), nil
+	}
+
+	ev.hop(domain, raw)
+	rec, err := c.parse(spfRecord)
+	if err != nil {
+		return ev.finish(CheckHostResult{Code: PermError, Cause: err}), nil
 	}
+	res, err := c.evaluateRecord(ctx, ev, rec)
+	if err != nil {
+		return CheckHostResult{}, ev.abort(err)
+	}
+	if c.shadow && ev.limitHit && res.Code == PermError {
+		res.Shadow = c.shadowResult(ctx, ev, req, domain, rec)
+	}
+	if decisions != nil && res.Code == Pass && ev.cache.net != nil && !ev.cache.unsafe {
+		decisions.store(domain, ev.cache.net, ev.recordDomains(), ev.cache.ttl, c.now())
+	}
+	return ev.finish(res), nil
 
-	return c.evaluate(ctx, ip, valDomain, spfRecord, lp)
+}
 
+// Evaluate runs check_host against rec, an already parsed record published
+// by domain, skipping the TXT lookup and parsing.  It lets callers that cache
+// parsed records evaluate them repeatedly; mechanisms that need DNS still use
+// the Checker's Resolver.  A nil rec is a caller error.
+func (c *Checker) Evaluate(ctx context.Context, ip net.IP, domain string, rec *parser.Record, sender string) (CheckHostResult, error) {
+	return c.EvaluateRequest(ctx, Request{IP: ip, MailFrom: sender, Domain: domain}, rec)
+}
+
+// EvaluateRequest is Evaluate for the inputs in req, so the HELO name,
+// identity and the other Request fields reach the macros as they do for
+// Check.  rec is taken to be the record published at req.StartDomain().
+func (c *Checker) EvaluateRequest(ctx context.Context, req Request, rec *parser.Record) (res CheckHostResult, err error) {
+	defer stamp(&res, req.StartDomain(), req.IP, time.Now())
+	defer c.recoverPanic(ctx, req, &res, &err)
+	if rec == nil {
+		return CheckHostResult{}, ErrNilRecord
+	}
+	ctx = dns.StickyContext(ctx)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if req.IP == nil {
+		return CheckHostResult{}, ErrNoIP
+	}
+	valDomain, err := c.parserOpts.ValidateDomain(req.StartDomain())
+	if err != nil {
+		return CheckHostResult{Code: None, Cause: err}, nil
+	}
+	req.Domain = valDomain
+	ev := c.newEvaluation(req, valDomain)
+	ev.events = eventsFrom(ctx)
+	ev.resolver = c.Resolver
+	ev.applyFlags(ctx)
+	ev.hop(valDomain, rec.String())
+	res, err = c.evaluateRecord(ctx, ev, rec)
+	if err != nil {
+		return CheckHostResult{}, ev.abort(err)
+	}
+	if c.shadow && ev.limitHit && res.Code == PermError {
+		res.Shadow = c.shadowResult(ctx, ev, req, valDomain, rec)
+	}
+	return ev.finish(res), nil
 }
 
 // CheckHost is a convenience wrapper around Checker.CheckHost for callers that
@@ -110,55 +584,673 @@ func CheckHost(ip net.IP, domain, sender string) (CheckHostResult, error) {
 	return defaultChecker.CheckHost(context.Background(), ip, domain, sender)
 }
 
+// Check is a convenience wrapper around Checker.Check for callers that do
+// not require custom configuration.
+func Check(ctx context.Context, req Request) (CheckHostResult, error) {
+	return defaultChecker.Check(ctx, req)
+}
+
+// evaluation carries the inputs of one check_host run.  vars.Domain always
+// holds the domain whose record is currently being evaluated.
+type evaluation struct {
+	ip       net.IP
+	vars     macro.Vars
+	trace    []TraceEntry
+	chain    []Hop
+	included []Hop
+	warnings []Warning
+	events   func(Event)     // set by CheckWithEvents
+	resolver *dns.Resolver   // the Checker's, or SelfTest's zone
+	disabled map[string]bool // mechanism kinds disabled by Flags
+	queries  bool            // record every query in the trace, see WithQueryTrace
+	depth    int             // include nesting; explanations only apply at depth 0
+	cache    cacheable       // see WithDecisionCache
+
+	// section 4.6.4 counters, shared by the whole evaluation including
+	// redirect targets and included records
+	lookups    int
+	voids      int
+	maxLookups int
+	limitHit   bool // the lookup limit was exceeded
+	shadow     bool // a ShadowResult evaluation, without the void limit
+
+	terms int // terms in the records fetched so far, see SizeLimits
+
+	usedMacros, usedPTR bool // see CheckHostResult.UsedMacros
+}
+
+// reached records the signals of a term with domain-spec spec, reached
+// during evaluation.
+func (ev *evaluation) reached(kind, spec string, hasMacro bool) {
+	if hasMacro {
+		ev.usedMacros = true
+		if macro.UsesLetter(spec, 'p') {
+			ev.usedPTR = true
+		}
+	}
+	if kind == "ptr" {
+		ev.usedPTR = true
+	}
+}
+
+// noteLookupError records the response code of a failed lookup of name in
+// the trace, so operators can tell a REFUSED remote server from a timeout.
+// Errors without a known rcode are not noted.
+func (ev *evaluation) noteLookupError(mechanism, name string, err error) {
+	if errors.Is(err, dns.ErrTCPFallback) {
+		ev.note(mechanism, "lookup of "+name+" failed: "+dns.ErrTCPFallback.Error())
+		return
+	}
+	rcode, ok := dns.ErrorRcode(err)
+	if !ok {
+		return
+	}
+	ev.trace = append(ev.trace, TraceEntry{
+		Domain:           ev.vars.Domain,
+		Mechanism:        mechanism,
+		Note:             "lookup of " + name + " failed",
+		Rcode:            dns.RcodeName(rcode),
+		LookupsRemaining: ev.remaining(),
+	})
+}
+
+// hop records that evaluation moved to the record of domain.
+func (ev *evaluation) hop(domain, record string) {
+	ev.chain = append(ev.chain, ev.newHop(domain, record))
+}
+
+// newHop describes arriving at record, published by domain.
+func (ev *evaluation) newHop(domain, record string) Hop {
+	sum := sha256.Sum256([]byte(record))
+	return Hop{Domain: domain, Record: record, RecordHash: hex.EncodeToString(sum[:]), LookupsRemaining: ev.remaining()}
+}
+
+// recordDomains returns the domains whose records were fetched so far.
+func (ev *evaluation) recordDomains() []string {
+	var out []string
+	for _, h := range slices.Concat(ev.chain, ev.included) {
+		if !slices.Contains(out, h.Domain) {
+			out = append(out, h.Domain)
+		}
+	}
+	return out
+}
+
+// remaining returns the unspent part of the lookup budget.
+func (ev *evaluation) remaining() int {
+	return max(ev.maxLookups-ev.lookups, 0)
+}
+
+// finish attaches the accumulated trace, chain and counters to res.
+func (ev *evaluation) finish(res CheckHostResult) CheckHostResult {
+	res.Trace = ev.trace
+	res.Chain = ev.chain
+	res.Included = ev.included
+	res.Warnings = ev.warnings
+	res.Lookups = ev.lookups
+	res.VoidLookups = ev.voids
+	res.UsedMacros = ev.usedMacros
+	res.UsedPTR = ev.usedPTR
+	if len(ev.chain) > 0 {
+		// the current domain: includes restore it, redirects replace it
+		res.TerminatedAt = ev.vars.Domain
+	}
+	return res
+}
+
+// warn records findings for a term of the current record, once per
+// domain, rule and term.
+func (ev *evaluation) warn(findings []lint.Finding) {
+	for _, f := range findings {
+		w := Warning{Domain: ev.vars.Domain, Rule: f.Rule, Term: f.Term, Message: f.Message}
+		if !slices.Contains(ev.warnings, w) {
+			ev.warnings = append(ev.warnings, w)
+		}
+	}
+}
+
+// abort wraps the context error err that stopped the evaluation together
+// with the trace and chain accumulated so far.
+func (ev *evaluation) abort(err error) error {
+	ev.note("", "evaluation aborted: "+err.Error())
+	return &AbortError{Err: err, Domain: ev.vars.Domain, Trace: ev.trace, Chain: ev.chain}
+}
+
+// note appends a trace entry for the current domain.
+func (ev *evaluation) note(mechanism, note string) {
+	ev.trace = append(ev.trace, TraceEntry{Domain: ev.vars.Domain, Mechanism: mechanism, Note: note, LookupsRemaining: ev.remaining()})
+}
+
+// query is a DNS lookup in progress, see startQuery.
+type query struct {
+	start  time.Time
+	report func() (dns.QueryInfo, bool) // nil when nobody is listening
+}
+
+// startQuery prepares ctx for one lookup.  When the query is traced or
+// delivered as an event, the backend's report is observed.
+func (ev *evaluation) startQuery(ctx context.Context) (context.Context, query) {
+	q := query{start: time.Now()}
+	if ev.queries || ev.events != nil {
+		ctx, q.report = dns.ObserveQuery(ctx)
+	}
+	return ctx, q
+}
+
+// endQuery emits the EventQuery of a lookup of name started with
+// startQuery and, with WithQueryTrace, records it in the trace.  answers is
+// the number of results, used when the backend reported nothing.
+func (ev *evaluation) endQuery(q query, mechanism, name, qtype string, answers int, err error) {
+	if q.report == nil {
+		return
+	}
+	latency := time.Since(q.start)
+	info, ok := q.report()
+	rcode := info.Rcode
+	if !ok {
+		info.Answers = answers
+		switch code, known := dns.ErrorRcode(err); {
+		case known:
+			rcode = code
+		case err != nil && errors.Is(dns.ClassifyError(err), dns.ErrNoDNSrecord):
+			rcode = dns.RcodeNameError
+		}
+	}
+	rname := dns.RcodeName(rcode)
+	if !ok && err != nil && rcode == 0 {
+		rname = "" // failed without a response, e.g. a timeout
+	}
+	ev.emit(Event{Kind: EventQuery, Query: name, QueryType: qtype, Err: err,
+		Rcode: rname, Answers: info.Answers, Server: info.Server, Latency: latency})
+	if !ev.queries {
+		return
+	}
+	note := qtype + " " + name + ": "
+	if rname != "" {
+		note += rname + ", "
+	}
+	note += fmt.Sprintf("%d answers in %v", info.Answers, latency.Round(time.Microsecond))
+	if info.Server != "" {
+		note += " via " + info.Server
+	}
+	ev.trace = append(ev.trace, TraceEntry{
+		Domain:           ev.vars.Domain,
+		Mechanism:        mechanism,
+		Note:             note,
+		Rcode:            rname,
+		Query:            name,
+		QueryType:        qtype,
+		Answers:          info.Answers,
+		Server:           info.Server,
+		Latency:          latency,
+		LookupsRemaining: ev.remaining(),
+	})
+}
+
+// newEvaluation builds the evaluation state for req starting at domain.
+func (c *Checker) newEvaluation(req Request, domain string) *evaluation {
+	sender := c.aLabelSender(mailaddr.NormalizeNull(req.sender(), req.HELODomain, domain, req.nullLocal()))
+	ip, translated := c.translateNAT64(req.IP)
+	ev := &evaluation{
+		ip: ip,
+		vars: macro.Vars{
+			Sender:    sender,
+			Domain:    domain,
+			IP:        ip,
+			HELO:      cmp.Or(req.HELODomain, c.defaultHELO),
+			Receiver:  cmp.Or(req.ReceiverHostname, c.receiver),
+			Timestamp: c.now(),
+
+			ClientHostname: normalizeFQDN(req.ClientHostname),
+		}.WithDefaults(),
+		maxLookups: c.MaxLookups,
+		queries:    c.queryTrace,
+	}
+	if translated {
+		ev.note("", fmt.Sprintf("NAT64 client %s evaluated as %s", req.IP, ip))
+	}
+	return ev
+}
+
+// translateNAT64 returns the IPv4 address embedded in ip when it lies in
+// one of the WithNAT64 prefixes, and ip unchanged otherwise.
+func (c *Checker) translateNAT64(ip net.IP) (net.IP, bool) {
+	for _, prefix := range c.nat64 {
+		if v4 := ipmatch.Embedded4(ip, prefix); v4 != nil {
+			return v4, true
+		}
+	}
+	return ip, false
+}
+
+// targetDomain returns the domain a mechanism applies to: its own
+// domain-spec after macro expansion, or the current domain when it has none.
+func (ev *evaluation) targetDomain(mech parser.Mechanism) (string, error) {
+	if mech.Domain == "" {
+		return ev.vars.Domain, nil
+	}
+	if !mech.Macro {
+		return normalizeFQDN(mech.Domain), nil
+	}
+	expanded, err := macro.Expand(mech.Domain, ev.vars)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", dns.ErrPermfail, err)
+	}
+	return normalizeFQDN(expanded), nil
+}
+
+// aLabelSender converts the domain part of an internationalized sender to
+// its A-label form, so %{s} and %{o} expand to names DNS can look up
+// (RFC 8616 section 4).  The local part is kept in UTF-8 for %{l}.
+func (c *Checker) aLabelSender(sender string) string {
+	if !mailaddr.International(sender) {
+		return sender
+	}
+	at := strings.LastIndexByte(sender, '@')
+	d, err := c.parserOpts.ValidateDomain(sender[at+1:])
+	if err != nil {
+		return sender
+	}
+	return sender[:at+1] + d
+}
+
+// getRecord fetches and selects the SPF record of domain (RFC 7208 section
+// 4.5), applying the configured SizeLimits and Quirks.FirstRecord.  It
+// returns the record normalised for parsing and as served.
+func (c *Checker) getRecord(ctx context.Context, ev *evaluation, domain string) (rec, raw string, err error) {
+	var txts []string
+	if override, ok := c.overrides[domain]; ok {
+		ev.note("", "record of "+domain+" overridden, not looked up")
+		txts = []string{override}
+	} else if txts = c.lookupSPFType(ctx, ev, domain); txts == nil {
+		var ttl time.Duration
+		qctx, q := ev.startQuery(ctx)
+		txts, ttl, err = ev.resolver.LookupTXTTTL(qctx, domain)
+		ev.endQuery(q, "", domain, "TXT", len(txts), err)
+		if err != nil {
+			return "", "", dns.ClassifyError(err)
+		}
+		ev.cache.seenTTL(ttl)
+	}
+	lim := c.sizeLimits
+	if lim.MaxTXTBytes > 0 {
+		size := 0
+		for _, t := range txts {
+			size += len(t)
+		}
+		if size > lim.MaxTXTBytes {
+			return "", "", fmt.Errorf("%w: %d bytes of TXT data at %s", ErrTooLarge, size, domain)
+		}
+	}
+
+	recs := dns.RawSPFRecords(txts)
+	if c.quirks.DuplicateRecords && len(recs) > 1 {
+		var unique []string
+		for _, r := range recs {
+			if !slices.Contains(unique, r) {
+				unique = append(unique, r)
+			}
+		}
+		if len(unique) < len(recs) {
+			msg := "duplicate SPF records at " + domain + " ignored"
+			ev.note("", msg)
+			if w := (Warning{Domain: domain, Rule: lint.RuleDuplicateRecord, Message: msg}); !slices.Contains(ev.warnings, w) {
+				ev.warnings = append(ev.warnings, w)
+			}
+			recs = unique
+		}
+	}
+	switch {
+	case len(recs) == 0:
+		return "", "", nil
+	case len(recs) == 1:
+		raw = recs[0]
+	case !c.quirks.FirstRecord:
+		return "", "", dns.ErrMultipleSPF
+	default:
+		ev.note("", fmt.Sprintf("%d SPF records at %s, evaluating the first", len(recs), domain))
+		raw = recs[0]
+	}
+	rec = strings.ToLower(strings.TrimSpace(raw))
+
+	if lim.MaxRecordBytes > 0 && len(rec) > lim.MaxRecordBytes {
+		return "", "", fmt.Errorf("%w: %d byte record at %s", ErrTooLarge, len(rec), domain)
+	}
+	if lim.MaxTerms > 0 || lim.MaxTreeTerms > 0 {
+		n := len(strings.Fields(rec)) - 1
+		if lim.MaxTerms > 0 && n > lim.MaxTerms {
+			return "", "", fmt.Errorf("%w: %d terms in record at %s", ErrTooLarge, n, domain)
+		}
+		ev.terms += n
+		if lim.MaxTreeTerms > 0 && ev.terms > lim.MaxTreeTerms {
+			return "", "", fmt.Errorf("%w: %d terms in the records reached by %s", ErrTooLarge, ev.terms, domain)
+		}
+	}
+	return rec, raw, nil
+}
+
+// lookupSPFType returns the type 99 SPF records of domain in ModeRFC4408,
+// nil when there are none and TXT records decide.  RFC 4408 section 4.5
+// discards the TXT records when any SPF records exist.  A failed type 99
+// query falls back to TXT: section 4.4 only gives up when every query
+// fails, and the TXT query reports that failure.
+func (c *Checker) lookupSPFType(ctx context.Context, ev *evaluation, domain string) []string {
+	if c.mode != ModeRFC4408 {
+		return nil
+	}
+	qctx, q := ev.startQuery(ctx)
+	recs, err := ev.resolver.LookupSPF(qctx, domain)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	ev.endQuery(q, "", domain, "SPF", len(recs), err)
+	if len(recs) == 0 {
+		return nil
+	}
+	ev.note("", "SPF type records at "+domain+" used, TXT records ignored")
+	return recs
+}
+
 // evaluate walks the mechanisms in the order they appear in the record.
 // RFC 7208 §4.6 requires sequential evaluation; the first mechanism that
 // matches terminates processing.
-func (c *Checker) evaluate(ctx context.Context, ip net.IP, domain, spf, localPart string) (CheckHostResult, error) {
-	rec, err := parser.Parse(spf)
+func (c *Checker) evaluate(ctx context.Context, ev *evaluation, spf string) (CheckHostResult, error) {
+	rec, err := c.parse(spf)
 	if err != nil {
 		return CheckHostResult{Code: PermError, Cause: err}, nil
 	}
+	return c.evaluateRecord(ctx, ev, rec)
+}
+
+// evaluateRecord is evaluate for a record that has already been parsed.
+func (c *Checker) evaluateRecord(ctx context.Context, ev *evaluation, rec *parser.Record) (CheckHostResult, error) {
+	// a shadow evaluation revisits records the handler has already seen
+	if c.modifiers != nil && !ev.shadow {
+		for _, m := range rec.Unknown {
+			c.modifiers(ctx, ev.vars.Domain, m)
+		}
+	}
 	// Walk mechanisms in order as required by RFC 7208 section 4.6.  Only
 	for _, mech := range rec.Mechs {
-		switch mech.Kind {
-		case "ip4":
-			if ip4 := ip.To4(); ip4 != nil && mech.Net.Contains(ip4) {
-				return CheckHostResult{Code: resultFromQualifier(mech.Qual)}, nil
-			}
-		case "ip6":
-			// Only match pure IPv6. IPv4-mapped addresses fall into ip4 via To4().
-			if ip.To4() == nil {
-				if ip6 := ip.To16(); ip6 != nil && mech.Net.Contains(ip6) {
-					return CheckHostResult{Code: resultFromQualifier(mech.Qual)}, nil
-				}
-			}
-		case "a":
-			// RFC  7208 section 5.3 - "a" mechanisms compare the sender IP against the A/AAAA records of the current pr
-			// explicit domain
-			ok, derr := c.evalA(ctx, mech, ip, domain)
-			if derr != nil {
-				// RFC  7208 section 2.6.4/2.6.5 DNS errors map to Temp/PermError
-				if errors.Is(derr, context.Canceled) || errors.Is(derr, context.DeadlineExceeded) {
-					return CheckHostResult{}, derr
-				}
-				if errors.Is(derr, dns.ErrTempfail) {
-					return CheckHostResult{Code: TempError, Cause: derr}, nil
-				}
-				return CheckHostResult{Code: PermError, Cause: derr}, nil
-			}
-			if ok {
-				// RFC section 4.6, first match wins, qualifier determines result.
-				return CheckHostResult{Code: resultFromQualifier(mech.Qual)}, nil
-			}
-			// No match continue with next mechanism
-
-		case "all":
-			// RFC 7208 5.1 - all always matches and everything after must be ignored.
-			return CheckHostResult{Code: resultFromQualifier(mech.Qual)}, nil
+		// stop between terms once the caller has given up
+		if err := ctx.Err(); err != nil {
+			return CheckHostResult{}, err
 		}
+		// only events carry the term, and formatting it allocates
+		var term string
+		if ev.events != nil {
+			term = mech.String()
+		}
+		domain := ev.vars.Domain
+		ev.emit(Event{Kind: EventMechanismStart, Domain: domain, Mechanism: term})
+		res, done, err := c.evalMechanism(ctx, ev, rec, mech)
+		ev.emit(Event{Kind: EventMechanismEnd, Domain: domain, Mechanism: term, Result: res.Code, Err: err})
+		ev.cache.reached(mech, done && err == nil)
+		ev.reached(mech.Kind, mech.Domain, mech.Macro)
+		if done || err != nil {
+			return res, err
+		}
+	}
+	// RFC 7208 6.1 - redirect applies only when no mechanism matched.
+	if rec.Redirect != nil {
+		if rec.Redirect.Macro {
+			ev.cache.unsafe = true
+		}
+		ev.reached("redirect", rec.Redirect.Value, rec.Redirect.Macro)
+		return c.evalRedirect(ctx, ev, rec.Redirect)
 	}
 	// RFC 7208 4.7 - default if no mechanism matched and no redirect is Neutral.
-	return CheckHostResult{Code: Neutral, Cause: errors.New("policy exists but no assertion")}, nil
+	return CheckHostResult{Code: Neutral, Mechanism: "default", Cause: errors.New("policy exists but no assertion")}, nil
+}
+
+// evalMechanism evaluates one term of rec.  done reports that the term
+// ended the evaluation with res, by matching or by an error result;
+// otherwise evaluation continues with the next term.
+func (c *Checker) evalMechanism(ctx context.Context, ev *evaluation, rec *parser.Record, mech parser.Mechanism) (res CheckHostResult, done bool, err error) {
+	if c.disabled[mech.Kind] || ev.disabled[mech.Kind] {
+		if c.disabledAction == DisabledPermError {
+			return CheckHostResult{Code: PermError, Cause: fmt.Errorf("%w: %s", ErrMechanismDisabled, mech.Kind)}, true, nil
+		}
+		ev.note(mech.Kind, "mechanism disabled by policy, treated as no match")
+		return CheckHostResult{}, false, nil
+	}
+	if mech.Kind == "ptr" {
+		// reaching ptr is worth reporting even when it does not match
+		ev.warn(lint.Term(mech, c.lintConfig()))
+	}
+	if c.strictCIDR != nil && lint.BroadCIDR(mech, *c.strictCIDR) {
+		return CheckHostResult{Code: PermError, Cause: fmt.Errorf("%w: %s", ErrBroadCIDR, mech)}, true, nil
+	}
+	switch mech.Kind {
+	case "ip4", "ip6":
+		// Only match pure IPv6 for ip6. IPv4-mapped addresses fall into ip4 via To4().
+		if matchesNetwork(mech, ev.ip) {
+			return c.matched(ctx, ev, rec, mech), true, nil
+		}
+	case "a":
+		// RFC  7208 section 5.3 - "a" mechanisms compare the sender IP against the A/AAAA records of the current pr
+		// explicit domain
+		ok, derr := c.evalA(ctx, ev, mech)
+		if derr != nil {
+			res, err := resultFromError(derr)
+			return res, true, err
+		}
+		if ok {
+			// RFC section 4.6, first match wins, qualifier determines result.
+			return c.matched(ctx, ev, rec, mech), true, nil
+		}
+		// No match continue with next mechanism
+
+	case "ptr":
+		ok, derr := c.evalPTR(ctx, ev, mech)
+		if derr != nil {
+			res, err := resultFromError(derr)
+			return res, true, err
+		}
+		if ok {
+			return c.matched(ctx, ev, rec, mech), true, nil
+		}
+
+	case "mx":
+		ok, derr := c.evalMX(ctx, ev, mech)
+		if derr != nil {
+			res, err := resultFromError(derr)
+			return res, true, err
+		}
+		if ok {
+			return c.matched(ctx, ev, rec, mech), true, nil
+		}
+
+	case "exists":
+		ok, derr := c.evalExists(ctx, ev, mech)
+		if derr != nil {
+			res, err := resultFromError(derr)
+			return res, true, err
+		}
+		if ok {
+			return c.matched(ctx, ev, rec, mech), true, nil
+		}
+
+	case "include":
+		matched, res, derr := c.evalInclude(ctx, ev, mech)
+		if derr != nil {
+			return CheckHostResult{}, true, derr
+		}
+		if res.Code != "" {
+			return res, true, nil
+		}
+		if matched {
+			// the include's own qualifier decides, never the child's result
+			return c.matched(ctx, ev, rec, mech), true, nil
+		}
+
+	case "all":
+		// RFC 7208 5.1 - all always matches and everything after must be ignored.
+		return c.matched(ctx, ev, rec, mech), true, nil
+	}
+	return CheckHostResult{}, false, nil
+}
+
+// matched returns the result of mech matching in rec.  A Fail at the top
+// level (not inside an include) picks up the explanation of rec.
+func (c *Checker) matched(ctx context.Context, ev *evaluation, rec *parser.Record, mech parser.Mechanism) CheckHostResult {
+	ev.warn(lint.Term(mech, c.lintConfig()))
+	res := CheckHostResult{Code: resultFromQualifier(mech.Qual), Mechanism: mech.String()}
+	if res.Code == Fail && rec.Exp != nil && ev.depth == 0 {
+		res.Explanation, res.ExplanationStatus = c.explain(ctx, ev, rec.Exp)
+	}
+	return res
+}
+
+// explain fetches and expands the explanation named by an exp= modifier -
+// RFC 7208 section 6.2.  The lookup does not count toward the DNS-lookup
+// limits.  The TXT strings of the single record are concatenated, and any
+// failure suppresses the explanation rather than changing the result.
+func (c *Checker) explain(ctx context.Context, ev *evaluation, mod *parser.Modifier) (string, ExplanationStatus) {
+	suppress := func(why string) (string, ExplanationStatus) {
+		ev.note("exp", "explanation suppressed: "+why)
+		return "", ExplanationSuppressed
+	}
+	target, err := macro.Expand(mod.Value, ev.vars)
+	if err != nil {
+		return suppress(err.Error())
+	}
+	if target, err = c.parserOpts.ValidateTargetName(target); err != nil {
+		return suppress(err.Error())
+	}
+	qctx, q := ev.startQuery(ctx)
+	txts, err := ev.resolver.LookupTXT(qctx, target)
+	ev.endQuery(q, "exp", target, "TXT", len(txts), err)
+	ev.noteLookupError("exp", target, err)
+	switch {
+	case err != nil:
+		return suppress("lookup of " + target + " failed")
+	case len(txts) == 0:
+		return suppress("no TXT record at " + target)
+	case len(txts) > 1:
+		return suppress("multiple TXT records at " + target)
+	}
+	text, err := macro.ExpandExplanation(txts[0], ev.vars)
+	if err != nil {
+		return suppress(err.Error())
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] < 0x20 || text[i] > 0x7e {
+			return suppress("explanation is not printable ASCII")
+		}
+	}
+	return text, ExplanationAvailable
+}
+
+// evalRedirect follows a redirect modifier - RFC 7208 section 6.1.
+// The target domain-spec is macro expanded and its record replaces the
+// current one: its result becomes the result of the whole evaluation.
+// Fetching the target counts toward the DNS-lookup limit, which also bounds
+// redirect loops.  A target without an SPF record is a PermError.
+func (c *Checker) evalRedirect(ctx context.Context, ev *evaluation, mod *parser.Modifier) (CheckHostResult, error) {
+	target := mod.Value
+	if mod.Macro {
+		expanded, err := macro.Expand(target, ev.vars)
+		if err != nil {
+			return CheckHostResult{Code: PermError, Cause: err}, nil
+		}
+		target = expanded
+	}
+	target, err := c.parserOpts.ValidateTargetName(target)
+	if err != nil {
+		return CheckHostResult{Code: PermError, Cause: err}, nil
+	}
+
+	// section 4.6.4 redirect counts toward the global DNS-lookup limit
+	if ev.countLookup() {
+		return CheckHostResult{Code: PermError, Cause: dns.ErrPermfail}, nil
+	}
+
+	spfRecord, raw, err := c.getRecord(ctx, ev, target)
+	ev.noteLookupError("redirect", target, err)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return CheckHostResult{}, err
+	case errors.Is(err, dns.ErrTempfail):
+		return CheckHostResult{Code: TempError, Cause: err}, nil
+	case err != nil:
+		return CheckHostResult{Code: PermError, Cause: err}, nil
+	case spfRecord == "":
+		// section 6.1 - a redirect target without a record is a permerror
+		return CheckHostResult{Code: PermError, Cause: fmt.Errorf("%w: no SPF record at redirect target %s", ErrRedirectNone, target)}, nil
+	}
+
+	ev.vars.Domain = target
+	if ev.depth > 0 {
+		// a redirect inside an include replaces the included record
+		ev.included = append(ev.included, ev.newHop(target, raw))
+	} else {
+		ev.hop(target, raw)
+	}
+	ev.note("redirect", "following redirect to "+target)
+	return c.evaluate(ctx, ev, spfRecord)
+}
+
+// evalInclude evaluates the "include" mechanism - RFC 7208 section 5.2.
+// The target's record is evaluated as a nested check_host with the target as
+// the current domain.  Only a Pass from the child is a match; Fail, SoftFail
+// and Neutral mean "no match" and evaluation continues with the next term.
+// TempError and PermError propagate, and a target without a record is a
+// PermError.  res is non-zero only when it terminates the evaluation.
+func (c *Checker) evalInclude(ctx context.Context, ev *evaluation, mech parser.Mechanism) (matched bool, res CheckHostResult, err error) {
+	target, err := ev.targetDomain(mech)
+	if err == nil {
+		target, err = c.parserOpts.ValidateTargetName(target)
+	}
+	if err != nil {
+		if c.macroNoMatch(ev, mech, err) {
+			return false, CheckHostResult{}, nil
+		}
+		return false, CheckHostResult{Code: PermError, Cause: err}, nil
+	}
+
+	// section 4.6.4 include counts toward the global DNS-lookup limit
+	if ev.countLookup() {
+		return false, CheckHostResult{Code: PermError, Cause: dns.ErrPermfail}, nil
+	}
+
+	spfRecord, raw, err := c.getRecord(ctx, ev, target)
+	ev.noteLookupError("include", target, err)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false, CheckHostResult{}, err
+	case errors.Is(err, dns.ErrTempfail):
+		return false, CheckHostResult{Code: TempError, Cause: err}, nil
+	case errors.Is(err, dns.ErrNoDNSrecord), err == nil && spfRecord == "":
+		// section 5.2 - a child result of none is a permerror
+		return false, CheckHostResult{Code: PermError, Cause: fmt.Errorf("%w: %s", ErrIncludeNone, target)}, nil
+	case err != nil:
+		return false, CheckHostResult{Code: PermError, Cause: err}, nil
+	}
+
+	parent := ev.vars.Domain
+	ev.vars.Domain = target
+	ev.note("include", "evaluating include "+target)
+	ev.included = append(ev.included, ev.newHop(target, raw))
+	ev.depth++
+	child, err := c.evaluate(ctx, ev, spfRecord)
+	ev.depth--
+	if err != nil {
+		// keep the child as current domain so an abort reports where it stopped
+		return false, CheckHostResult{}, err
+	}
+	ev.vars.Domain = parent
+
+	switch child.Code {
+	case Pass:
+		return true, CheckHostResult{}, nil
+	case Fail, SoftFail, Neutral:
+		return false, CheckHostResult{}, nil
+	case TempError:
+		return false, child, nil
+	default:
+		return false, CheckHostResult{Code: PermError, Cause: child.Cause}, nil
+	}
 }
 
 // evalA evaluates the "a" mechanism - RFC 7208 section 5.3
@@ -168,44 +1260,43 @@ func (c *Checker) evaluate(ctx context.Context, ip net.IP, domain, spf, localPar
 // each DNS lookup increments the SPF DNS-lookup counter. rfc 7208 section 4.6.4
 // empty DNS responses count towards the "void lookup" limit .RFC 7208 section 4.6.4
 // Errors are mapped to TemprError and PermError as per RFC 7208 section 2.6.4 and 2.6.5
-func (c *Checker) evalA(ctx context.Context, mech parser.Mechanism, connectIP net.IP, currentDomain string) (matched bool, err error) {
+func (c *Checker) evalA(ctx context.Context, ev *evaluation, mech parser.Mechanism) (matched bool, err error) {
+	connectIP := ev.ip
 	// section 5.3 - default to the current domain if none is provided
-	target := mech.Domain
-	if target == "" {
-		target = currentDomain
+	target, err := ev.targetDomain(mech)
+	if err != nil {
+		if c.macroNoMatch(ev, mech, err) {
+			return false, nil
+		}
+		return false, err
 	}
 	// section 4.6.6 Enforce the global DNS-lookup limit
-	c.Lookups++
-	if c.Lookups > c.MaxLookups {
+	if ev.countLookup() {
 		return false, dns.ErrPermfail
 	}
 
 	// perform A/AAAA lookup
-	ips, err := c.Resolver.LookupIP(ctx, target)
-	if err != nil {
-		// section 2.6 , context cancellation is not SPF specific, we propagate
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return false, err
-		}
-		// section 2.6.4 , temporary DNS error => TempError
-		var dErr *net.DNSError
-		if errors.As(err, &dErr) && dErr.Temporary() {
-			return false, dns.ErrTempfail
-		}
-
-		// section 2.6.5, other DNS errors => PermError
-		return false, dns.ErrPermfail
+	qctx, q := ev.startQuery(ctx)
+	ips, err := ev.resolver.LookupIP(qctx, target)
+	ev.endQuery(q, mech.Kind, target, "A/AAAA", len(ips), err)
+	ev.noteLookupError(mech.Kind, target, err)
+	err = dns.ClassifyError(err)
+	if err != nil && !errors.Is(err, dns.ErrNoDNSrecord) {
+		// section 2.6.4/2.6.5 temp and perm errors, or context errors
+		return false, err
 	}
 
-	// section 4.6.4 - void lookups: domain exists but no usable A/AAAA
+	// section 4.6.4 - void lookups: NXDOMAIN or no usable A/AAAA
 	if len(ips) == 0 {
-		c.Voids++
-		if c.Voids > c.MaxVoidLookups {
-			return false, dns.ErrPermfail
-		}
-		return false, nil
+		return false, c.voidLookup(ev)
 	}
 
+	return matchesAddrs(connectIP, ips, mech), nil
+}
+
+// matchesAddrs reports whether connectIP lies within the dual-cidr-length
+// of mech around any of ips, as the a and mx mechanisms require.
+func matchesAddrs(connectIP net.IP, ips []net.IP, mech parser.Mechanism) bool {
 	// section 5.6IPv4 mask = /32, IPv6 mask = 128 if omitted
 	mask4 := mech.Mask4
 	if mask4 < 0 {
@@ -221,49 +1312,271 @@ func (c *Checker) evalA(ctx context.Context, mech parser.Mechanism, connectIP ne
 	if connectIP.To4() != nil {
 		cip := connectIP.To4()
 		for _, tip := range ips {
-			if t4 := tip.To4(); t4 != nil && prefixEqual(cip, t4, mask4, 32) {
-				return true, nil // section 4.6 rfc 7208, first match wins
+			if t4 := tip.To4(); t4 != nil && ipmatch.PrefixEqual(cip, t4, mask4, 32) {
+				return true // section 4.6 rfc 7208, first match wins
 			}
 		}
-		return false, nil
+		return false
 	}
 
 	// Sender is IPv6
 	cip6 := connectIP.To16()
 	if cip6 == nil {
-		return false, nil
+		return false
 	}
 	for _, tip := range ips {
-		if tip.To4() == nil && prefixEqual(cip6, tip.To16(), mask6, 128) {
+		if tip.To4() == nil && ipmatch.PrefixEqual(cip6, tip.To16(), mask6, 128) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evalMX evaluates the "mx" mechanism - RFC 7208 section 5.4.  The MX
+// lookup of the target counts toward the DNS-lookup limit and an empty
+// answer is a void lookup.  Exchanges are tried in priority order, lowest
+// preference first, and the one that matched is noted in the trace.  More
+// than MaxMXNames exchanges is a PermError (section 4.6.4), or in
+// ModeRFC4408 only the first MaxMXNames are checked; a null MX (RFC 7505)
+// has no addresses and never matches.
+func (c *Checker) evalMX(ctx context.Context, ev *evaluation, mech parser.Mechanism) (bool, error) {
+	target, err := ev.targetDomain(mech)
+	if err != nil {
+		if c.macroNoMatch(ev, mech, err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if ev.countLookup() {
+		return false, dns.ErrPermfail
+	}
+
+	qctx, q := ev.startQuery(ctx)
+	mxs, err := ev.resolver.LookupMX(qctx, target)
+	ev.endQuery(q, mech.Kind, target, "MX", len(mxs), err)
+	ev.noteLookupError(mech.Kind, target, err)
+	err = dns.ClassifyError(err)
+	if err != nil && !errors.Is(err, dns.ErrNoDNSrecord) {
+		return false, err
+	}
+	if len(mxs) == 0 {
+		return false, c.voidLookup(ev)
+	}
+	if len(mxs) > MaxMXNames && c.mode != ModeRFC4408 {
+		return false, fmt.Errorf("%w: %d at %s", ErrTooManyMX, len(mxs), target)
+	}
+
+	mxs = slices.Clone(mxs)
+	dns.SortMX(mxs)
+	if len(mxs) > MaxMXNames {
+		// RFC 4408 section 10.1 limits the exchanges checked, not the answer
+		ev.note(mech.Kind, fmt.Sprintf("%d exchanges at %s, checking the first %d", len(mxs), target, MaxMXNames))
+		mxs = mxs[:MaxMXNames]
+	}
+	for _, mx := range mxs {
+		if mx.Host == "" {
+			continue
+		}
+		qctx, q := ev.startQuery(ctx)
+		ips, err := ev.resolver.LookupIP(qctx, mx.Host)
+		ev.endQuery(q, mech.Kind, mx.Host, "A/AAAA", len(ips), err)
+		ev.noteLookupError(mech.Kind, mx.Host, err)
+		err = dns.ClassifyError(err)
+		if err != nil && !errors.Is(err, dns.ErrNoDNSrecord) {
+			return false, err
+		}
+		if matchesAddrs(ev.ip, ips, mech) {
+			ev.note(mech.Kind, fmt.Sprintf("matched MX host %s (preference %d)", mx.Host, mx.Pref))
 			return true, nil
 		}
 	}
+	return false, nil
+}
+
+// evalPTR evaluates the deprecated "ptr" mechanism - RFC 7208 section 5.5.
+// The client's PTR names are validated by a forward lookup that must return
+// the client address, and the mechanism matches when a validated name is
+// the target domain or a subdomain of it.  The term counts toward the
+// DNS-lookup limit; a failed PTR lookup is no match, and only the first
+// MaxPTRNames names are validated (section 4.6.4).  When the caller supplied
+// Request.ClientHostname it is the only validated name and no query is sent.
+func (c *Checker) evalPTR(ctx context.Context, ev *evaluation, mech parser.Mechanism) (bool, error) {
+	target, err := ev.targetDomain(mech)
+	if err != nil {
+		if c.macroNoMatch(ev, mech, err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if ev.countLookup() {
+		return false, dns.ErrPermfail
+	}
 
+	if host := ev.vars.ClientHostname; host != "" {
+		ok := host == target || strings.HasSuffix(host, "."+target)
+		if ok {
+			ev.note(mech.Kind, "matched caller-validated client hostname "+host)
+		}
+		return ok, nil
+	}
+
+	qctx, q := ev.startQuery(ctx)
+	names, err := ev.resolver.LookupPTR(qctx, ev.ip)
+	ev.endQuery(q, mech.Kind, ev.ip.String(), "PTR", len(names), err)
+	ev.noteLookupError(mech.Kind, ev.ip.String(), err)
+	if err := dns.ClassifyError(err); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false, err
+		}
+		if errors.Is(err, dns.ErrNoDNSrecord) {
+			return false, c.voidLookup(ev)
+		}
+		// section 5.5: a DNS error on the PTR lookup is no match
+		return false, nil
+	}
+	if len(names) == 0 {
+		return false, c.voidLookup(ev)
+	}
+	if len(names) > MaxPTRNames {
+		names = names[:MaxPTRNames]
+	}
+	for _, name := range names {
+		name = normalizeFQDN(name)
+		if name != target && !strings.HasSuffix(name, "."+target) {
+			continue
+		}
+		qctx, q := ev.startQuery(ctx)
+		ips, err := ev.resolver.LookupIP(qctx, name)
+		ev.endQuery(q, mech.Kind, name, "A/AAAA", len(ips), err)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			continue // a name that does not resolve is not validated
+		}
+		for _, ip := range ips {
+			if ip.Equal(ev.ip) {
+				ev.note(mech.Kind, "matched validated client hostname "+name)
+				return true, nil
+			}
+		}
+	}
 	return false, nil
 }
 
-// prefixEqual compares two IPs under a given prefix length.
-// Used to implement CIDR matching for "a" and "mx" mechanisms.
-//
-// Returns true if the first maskLen bits are identical.
-//   - totalBits = 32 for IPv4, 128 for IPv6.
-//   - 5.6 requires bounds-checking on CIDR lengths.
-func prefixEqual(a, b net.IP, maskLen, totalBits int) bool {
-	if a == nil || b == nil || maskLen < 0 || maskLen > totalBits {
-		return false
+// evalExists evaluates the "exists" mechanism - RFC 7208 section 5.7.
+// The macro-expanded domain is looked up and the mechanism matches if it has
+// any A record, whatever the connection's address family.  Only an A query
+// is sent when the resolver supports it, see dns.Resolver.LookupA; with
+// WithExistsAAAA AAAA records match too.  The lookup counts toward the
+// DNS-lookup limit and an empty answer is a void lookup.  With
+// WithExistsRanges only answers inside the configured ranges match.
+func (c *Checker) evalExists(ctx context.Context, ev *evaluation, mech parser.Mechanism) (bool, error) {
+	target, err := ev.targetDomain(mech)
+	if err != nil {
+		if c.macroNoMatch(ev, mech, err) {
+			return false, nil
+		}
+		return false, err
 	}
-	aa := a.To16()
-	bb := b.To16()
-	if aa == nil || bb == nil {
-		return false
+	if ev.countLookup() {
+		return false, dns.ErrPermfail
+	}
+
+	lookup, qtype := ev.resolver.LookupA, "A"
+	if c.existsAAAA {
+		lookup, qtype = ev.resolver.LookupIP, "A/AAAA"
 	}
-	mask := net.CIDRMask(maskLen, totalBits)
-	for i := 0; i < len(mask); i++ {
-		if (aa[i] & mask[i]) != (bb[i] & mask[i]) {
-			return false
+	qctx, q := ev.startQuery(ctx)
+	answers, err := lookup(qctx, target)
+	ev.endQuery(q, mech.Kind, target, qtype, len(answers), err)
+	ev.noteLookupError(mech.Kind, target, err)
+	err = dns.ClassifyError(err)
+	if err != nil && !errors.Is(err, dns.ErrNoDNSrecord) {
+		return false, err
+	}
+
+	if len(answers) == 0 {
+		return false, c.voidLookup(ev)
+	}
+	if len(c.existsRanges) == 0 {
+		return true, nil
+	}
+	for _, ip := range answers {
+		for _, n := range c.existsRanges {
+			if n.Contains(ip) {
+				return true, nil
+			}
 		}
 	}
-	return true
+	ev.note(mech.Kind, "answer for "+target+" outside the configured exists ranges, treated as no match")
+	return false, nil
+}
+
+// voidLookup counts a lookup that returned no usable answer and reports
+// ErrPermfail once the section 4.6.4 void limit is exceeded.  RFC 4408 had no
+// void limit, so ModeRFC4408 never fails here.
+func (c *Checker) voidLookup(ev *evaluation) error {
+	ev.voids++
+	if c.mode != ModeRFC4408 && !ev.shadow && ev.voids > c.MaxVoidLookups {
+		return dns.ErrPermfail
+	}
+	return nil
+}
+
+// countLookup counts a DNS-querying term and reports whether the section
+// 4.6.4 lookup limit is now exceeded.
+func (ev *evaluation) countLookup() bool {
+	ev.lookups++
+	if ev.lookups > ev.maxLookups {
+		ev.limitHit = true
+	}
+	return ev.limitHit
+}
+
+// lintConfig is the lint configuration for warnings: the WithStrictCIDR
+// thresholds when set, the lint defaults otherwise.
+func (c *Checker) lintConfig() lint.Config {
+	if c.strictCIDR != nil {
+		return *c.strictCIDR
+	}
+	return lint.Config{}
+}
+
+// internalError counts err, an internal failure, and returns the result
+// chosen by the configured InternalErrorAction.
+func (c *Checker) internalError(ev *evaluation, err error) CheckHostResult {
+	c.internalErrors.Add(1)
+	res := CheckHostResult{Code: TempError, Cause: fmt.Errorf("%w: %w", ErrInternal, err)}
+	switch c.internalAction {
+	case InternalPermError:
+		res.Code = PermError
+	case InternalFail:
+		res.Code = Fail
+	}
+	ev.note("", fmt.Sprintf("internal error (%v), returning %s", err, res.Code))
+	return res
+}
+
+// InternalErrors returns the number of internal errors c has met since it
+// was created, whatever result they were turned into.
+func (c *Checker) InternalErrors() int64 {
+	return c.internalErrors.Load()
+}
+
+// resultFromError converts a classified mechanism error into the result of
+// the evaluation.  Context errors are returned to the caller since they are
+// outside RFC 7208; DNS errors map to TempError or PermError (section 2.6).
+func resultFromError(err error) (CheckHostResult, error) {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return CheckHostResult{}, err
+	case errors.Is(err, dns.ErrTempfail):
+		return CheckHostResult{Code: TempError, Cause: err}, nil
+	default:
+		return CheckHostResult{Code: PermError, Cause: err}, nil
+	}
 }
 
 func resultFromQualifier(q parser.Qualifier) Result {
@@ -280,29 +1593,3 @@ func resultFromQualifier(q parser.Qualifier) Result {
 		return Neutral
 	}
 }
-
-// getSenderDomain extracts the domain part of a MAIL FROM address as described
-// in RFC 7208 section 4.1. It returns the substring after the first '@' and ok
-// set to true when an '@' is present. If sender lacks an '@', it returns ("",
-// false).
-func getSenderDomain(sender string) (string, bool) {
-	numofParts := 2
-	parts := strings.SplitN(sender, "@", numofParts)
-	if len(parts) == numofParts {
-		return parts[1], true
-	}
-
-	return "", false
-}
-
-// localPart extracts the string before '@'.  If the input lacks '@', RFC 7208
-// section 4.1 requires that "postmaster" be used instead.
-func localPart(sender string) string {
-	// strip surrounding angle brackets that MTAs sometimes keep.
-	sender = strings.Trim(sender, "<>")
-	if at := strings.IndexByte(sender, '@'); at > 0 {
-		return sender[:at] // real local part
-	}
-
-	return "postmaster"
-}
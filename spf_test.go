@@ -3,12 +3,15 @@ package spf
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
 	"github.com/t0gun/go-spf/parser"
 )
 
@@ -22,38 +25,56 @@ func (f *fakeResolver) LookupTXT(ctx context.Context, domain string) ([]string,
 	return f.txts, f.err
 }
 
-func TestGetSenderDomain(t *testing.T) {
-	t.Parallel()
-	tc := []struct {
-		sender string
-		domain string
-	}{
-		{"apps@gmail.com", "gmail.com"},
-		{"apps@yahoo.com", "yahoo.com"},
-	}
+// fakeTXTMap implements TXTResolver with per-domain answers.  Domains missing
+// from the map are reported as NXDOMAIN.
+type fakeTXTMap map[string][]string
 
-	for _, c := range tc {
-		got, ok := getSenderDomain(c.sender)
-		assert.Equal(t, c.domain, got)
-		assert.True(t, ok)
+func (f fakeTXTMap) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	txts, ok := f[domain]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
 	}
+	return txts, nil
 }
 
-func TestLocalPart(t *testing.T) {
-	tc := []struct{ sender, want string }{
-		{"alice@example.com", "alice"},
-		{"<alice@example.com>", "alice"},
-		{"<>", "postmaster"},
-		{"", "postmaster"},
+// fakeIPResolver implements IPResolver for unit tests.  Hosts missing from
+// the map are reported as NXDOMAIN.
+type fakeIPResolver map[string][]string
+
+func (f fakeIPResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
 	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
 
-	for _, c := range tc {
-		t.Run("local parts", func(t *testing.T) {
-			got := localPart(c.sender)
-			assert.Equal(t, got, c.want)
-		})
+// fakeHosts extends fakeIPResolver with MX and PTR answers, keyed by name
+// and by textual IP.  Missing names are reported as NXDOMAIN.
+type fakeHosts struct {
+	fakeIPResolver
+	mx  map[string][]*net.MX
+	ptr map[string][]string
+}
+
+func (f fakeHosts) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	mxs, ok := f.mx[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
 	}
+	return mxs, nil
+}
 
+func (f fakeHosts) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	names, ok := f.ptr[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
 }
 
 func TestChecker_CheckHost(t *testing.T) {
@@ -102,6 +123,13 @@ func TestChecker_CheckHost(t *testing.T) {
 			wantCode:  PermError,
 			wantCause: dns.ErrMultipleSPF,
 		},
+		{
+			name:      "NUL in record -> PermError",
+			domain:    "example.com",
+			resolver:  &fakeResolver{txts: []string{"v=spf1 ip4:192.0.2.1\x00 -all"}},
+			wantCode:  PermError,
+			wantCause: parser.ErrInvalidByte,
+		},
 		{
 			name:     "no SPF record → zero result",
 			domain:   "example.com",
@@ -210,3 +238,774 @@ func Test_EvaluateIP6(t *testing.T) {
 		})
 	}
 }
+
+func TestChecker_CheckHostWithHELO(t *testing.T) {
+	ips := fakeIPResolver{
+		"mail.example.org":  {"192.0.2.25"},
+		"other.example.org": {"198.51.100.1"},
+		"example.com":       {"198.51.100.2"},
+	}
+
+	cases := []struct {
+		name   string
+		record string
+		sender string
+		helo   string
+		want   Result
+	}{
+		{"helo macro matches", "v=spf1 a:%{h} -all", "user@example.com", "mail.example.org", Pass},
+		{"helo macro other host", "v=spf1 a:%{h} -all", "user@example.com", "other.example.org", Fail},
+		{"null sender falls back to helo", "v=spf1 a:%{o} -all", "<>", "mail.example.org", Pass},
+		{"sender domain wins when present", "v=spf1 a:%{o} -all", "user@example.com", "mail.example.org", Fail},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, ips))
+			res, err := ch.CheckHostWithHELO(context.Background(), net.ParseIP("192.0.2.25"), "example.com", tc.sender, tc.helo)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+		})
+	}
+}
+
+func TestChecker_Evaluate(t *testing.T) {
+	ips := fakeIPResolver{"example.com": {"192.0.2.1"}}
+	// the TXT resolver must never be consulted for a pre-parsed record
+	ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{err: errors.New("unexpected TXT lookup")}, ips))
+
+	rec, err := parser.Parse("v=spf1 a ip4:198.51.100.0/24 -all")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name string
+		ip   string
+		want Result
+	}{
+		{"a matches", "192.0.2.1", Pass},
+		{"ip4 matches", "198.51.100.7", Pass},
+		{"nothing matches", "203.0.113.1", Fail},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := ch.Evaluate(context.Background(), net.ParseIP(tc.ip), "example.com", rec, "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+		})
+	}
+
+	_, err = ch.Evaluate(context.Background(), net.ParseIP("192.0.2.1"), "example.com", nil, "")
+	require.ErrorIs(t, err, ErrNilRecord)
+}
+
+func TestChecker_EvaluateRequestHELO(t *testing.T) {
+	ips := fakeIPResolver{"mx1.example.org": {"192.0.2.1"}}
+	ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{err: errors.New("unexpected TXT lookup")}, ips))
+	rec, err := parser.Parse("v=spf1 a:%{h} -all")
+	require.NoError(t, err)
+
+	req := Request{IP: net.ParseIP("192.0.2.1"), HELODomain: "mx1.example.org", Domain: "example.com"}
+	res, err := ch.EvaluateRequest(context.Background(), req, rec)
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+	assert.Equal(t, "example.com", res.Domain)
+}
+
+func TestChecker_Redirect(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":         {"v=spf1 ip4:198.51.100.0/24 redirect=provider.net"},
+		"provider.net":        {"v=spf1 ip4:192.0.2.0/24 redirect=backup.provider.net"},
+		"backup.provider.net": {"v=spf1 ip4:203.0.113.0/24 -all"},
+		"all.example.com":     {"v=spf1 -all redirect=provider.net"},
+		"dangling.example":    {"v=spf1 redirect=missing.example"},
+		"loop-a.example":      {"v=spf1 redirect=loop-b.example"},
+		"loop-b.example":      {"v=spf1 redirect=loop-a.example"},
+		"macro.example":       {"v=spf1 redirect=%{l}.provider.net"},
+		"user.provider.net":   {"v=spf1 +all"},
+		"service.example":     {"v=spf1 redirect=_spf.provider.net"},
+		"_spf.provider.net":   {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}
+
+	cases := []struct {
+		name      string
+		domain    string
+		ip        string
+		want      Result
+		wantChain []string
+		wantCause error
+	}{
+		{"matches before redirect", "example.com", "198.51.100.1", Pass, []string{"example.com"}, nil},
+		{"one hop", "example.com", "192.0.2.1", Pass, []string{"example.com", "provider.net"}, nil},
+		{"two hops", "example.com", "203.0.113.9", Pass, []string{"example.com", "provider.net", "backup.provider.net"}, nil},
+		{"two hops no match", "example.com", "10.0.0.1", Fail, []string{"example.com", "provider.net", "backup.provider.net"}, nil},
+		{"all wins over redirect", "all.example.com", "192.0.2.1", Fail, []string{"all.example.com"}, nil},
+		{"missing target", "dangling.example", "192.0.2.1", PermError, []string{"dangling.example"}, nil},
+		{"loop hits lookup limit", "loop-a.example", "192.0.2.1", PermError, nil, dns.ErrPermfail},
+		{"underscore target", "service.example", "192.0.2.1", Pass, []string{"service.example", "_spf.provider.net"}, nil},
+		{"macro target", "macro.example", "192.0.2.1", Pass, []string{"macro.example", "user.provider.net"}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+			res, err := ch.CheckHost(context.Background(), net.ParseIP(tc.ip), tc.domain, "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.wantCause != nil {
+				require.ErrorIs(t, res.Cause, tc.wantCause)
+			}
+			if tc.wantChain == nil {
+				return
+			}
+			var domains []string
+			for _, hop := range res.Chain {
+				domains = append(domains, hop.Domain)
+				assert.Len(t, hop.RecordHash, 64)
+			}
+			assert.Equal(t, tc.wantChain, domains)
+			assert.Equal(t, tc.wantChain[len(tc.wantChain)-1], res.TerminatedAt)
+		})
+	}
+}
+
+// BenchmarkCheckHost10kConcurrent measures one burst of 10,000 concurrent
+// CheckHost calls sharing a single Checker.
+func BenchmarkCheckHost10kConcurrent(b *testing.B) {
+	const callers = 10000
+	txt := &fakeResolver{txts: []string{
+		"MS=ms12345678",
+		"v=spf1 ip4:198.51.100.0/24 ip4:203.0.113.0/24 ip6:2001:db8::/32 ip4:192.0.2.0/24 -all",
+	}}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	ip := net.ParseIP("192.0.2.1")
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		wg.Add(callers)
+		for j := 0; j < callers; j++ {
+			go func() {
+				defer wg.Done()
+				if res, err := ch.CheckHost(ctx, ip, "example.com", "user@example.com"); err != nil || res.Code != Pass {
+					b.Errorf("unexpected result %v, %v", res.Code, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestChecker_Include(t *testing.T) {
+	txt := fakeTXTMap{
+		"pass.example":       {"v=spf1 include:child.example -all"},
+		"softpass.example":   {"v=spf1 ~include:child.example -all"},
+		"neutral.example":    {"v=spf1 ?include:child.example +all"},
+		"child.example":      {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"childsoft.example":  {"v=spf1 ~all"},
+		"childneu.example":   {"v=spf1 ?all"},
+		"childfail.example":  {"v=spf1 -all"},
+		"fail.example":       {"v=spf1 -include:childfail.example +all"},
+		"soft.example":       {"v=spf1 -include:childsoft.example +all"},
+		"neu.example":        {"v=spf1 -include:childneu.example +all"},
+		"none.example":       {"v=spf1 include:nospf.example +all"},
+		"nospf.example":      {"google-site-verification=abc"},
+		"nx.example":         {"v=spf1 include:missing.example +all"},
+		"perm.example":       {"v=spf1 include:broken.example +all"},
+		"broken.example":     {"v=spf1 bogus"},
+		"macro.example":      {"v=spf1 include:%{l}.example -all"},
+		"user.example":       {"v=spf1 +all"},
+		"nested.example":     {"v=spf1 include:pass.example ~all"},
+		"childredir.example": {"v=spf1 include:redir.example -all"},
+		"redir.example":      {"v=spf1 redirect=child.example"},
+		"self.example":       {"v=spf1 include:self.example +all"},
+		"loop-x.example":     {"v=spf1 include:loop-y.example +all"},
+		"loop-y.example":     {"v=spf1 include:loop-x.example +all"},
+	}
+
+	cases := []struct {
+		name      string
+		domain    string
+		ip        string
+		want      Result
+		wantCause error
+	}{
+		{"child pass matches", "pass.example", "192.0.2.1", Pass, nil},
+		{"child pass uses include qualifier", "softpass.example", "192.0.2.1", SoftFail, nil},
+		{"neutral qualifier", "neutral.example", "192.0.2.1", Neutral, nil},
+		{"child fail is no match", "pass.example", "198.51.100.1", Fail, nil},
+		{"child fail never applies include qualifier", "fail.example", "192.0.2.1", Pass, nil},
+		{"child softfail is no match", "soft.example", "192.0.2.1", Pass, nil},
+		{"child neutral is no match", "neu.example", "192.0.2.1", Pass, nil},
+		{"child none is permerror", "none.example", "192.0.2.1", PermError, ErrIncludeNone},
+		{"child nxdomain is permerror", "nx.example", "192.0.2.1", PermError, ErrIncludeNone},
+		{"child permerror propagates", "perm.example", "192.0.2.1", PermError, nil},
+		{"macro target", "macro.example", "192.0.2.1", Pass, nil},
+		{"nested include", "nested.example", "192.0.2.1", Pass, nil},
+		{"nested include no match", "nested.example", "198.51.100.1", SoftFail, nil},
+		{"child redirect", "childredir.example", "192.0.2.1", Pass, nil},
+		{"self include hits lookup limit", "self.example", "192.0.2.1", PermError, dns.ErrPermfail},
+		{"include loop hits lookup limit", "loop-x.example", "192.0.2.1", PermError, dns.ErrPermfail},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+			res, err := ch.CheckHost(context.Background(), net.ParseIP(tc.ip), tc.domain, "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.wantCause != nil {
+				assert.ErrorIs(t, res.Cause, tc.wantCause)
+			}
+		})
+	}
+}
+
+func TestChecker_IncludeTerminatedAt(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":   {"v=spf1 include:child.example -all"},
+		"child.example": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	res, err := ch.CheckHost(context.Background(), net.ParseIP("198.51.100.1"), "example.com", "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, Fail, res.Code)
+	// the include is not a hop: Chain holds the start and redirects only
+	require.Len(t, res.Chain, 1)
+	assert.Equal(t, "example.com", res.Chain[0].Domain)
+	assert.Equal(t, "example.com", res.TerminatedAt)
+}
+
+func TestChecker_RecordsInResult(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":   {"v=spf1 include:child.example redirect=other.example", "unrelated"},
+		"child.example": {"v=spf1 IP4:192.0.2.0/24 -all"},
+		"other.example": {"v=spf1  -all"},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	res, err := ch.CheckHost(context.Background(), net.ParseIP("198.51.100.1"), "example.com", "user@example.com")
+	require.NoError(t, err)
+	require.Len(t, res.Chain, 2)
+	assert.Equal(t, "v=spf1 include:child.example redirect=other.example", res.Chain[0].Record)
+	assert.Equal(t, "v=spf1  -all", res.Chain[1].Record)
+	require.Len(t, res.Included, 1)
+	assert.Equal(t, "child.example", res.Included[0].Domain)
+	assert.Equal(t, "v=spf1 IP4:192.0.2.0/24 -all", res.Included[0].Record)
+	assert.NotEmpty(t, res.Included[0].RecordHash)
+}
+
+func TestChecker_RedirectInsideInclude(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":   {"v=spf1 include:a.example.net -all"},
+		"a.example.net": {"v=spf1 redirect=b.example.net"},
+		"b.example.net": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+	res, err := ch.CheckHost(context.Background(), net.ParseIP("192.0.2.1"), "example.com", "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, Pass, res.Code)
+	require.Len(t, res.Chain, 1)
+	assert.Equal(t, "example.com", res.Chain[0].Domain)
+	require.Len(t, res.Included, 2)
+	assert.Equal(t, "a.example.net", res.Included[0].Domain)
+	assert.Equal(t, "b.example.net", res.Included[1].Domain)
+	assert.Equal(t, "example.com", res.TerminatedAt)
+}
+
+func TestChecker_IncludeTempError(t *testing.T) {
+	txt := fakeTXTMap{"example.com": {"v=spf1 include:child.example -all"}}
+	ch := NewChecker(dns.NewCustomDNSResolver(includeTempTXT{txt}, nil))
+	res, err := ch.CheckHost(context.Background(), net.ParseIP("192.0.2.1"), "example.com", "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, TempError, res.Code)
+}
+
+// includeTempTXT answers from the map and fails every other name with SERVFAIL.
+type includeTempTXT struct{ fakeTXTMap }
+
+func (f includeTempTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	if txts, ok := f.fakeTXTMap[domain]; ok {
+		return txts, nil
+	}
+	return nil, rcodeError(dns.RcodeServerFailure)
+}
+
+func TestChecker_ANXDOMAINIsVoid(t *testing.T) {
+	ips := fakeIPResolver{"example.com": {"192.0.2.1"}}
+	ip := net.ParseIP("192.0.2.1")
+
+	cases := []struct {
+		name   string
+		record string
+		want   Result
+	}{
+		{"nxdomain target is no match", "v=spf1 a:gone.example.com a -all", Pass},
+		{"void limit exceeded", "v=spf1 a:gone1.example.com a:gone2.example.com a:gone3.example.com a -all", PermError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, ips))
+			res, err := ch.CheckHost(context.Background(), ip, "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+		})
+	}
+}
+
+// rcodeError is a backend error that exposes its DNS response code.
+type rcodeError int
+
+func (e rcodeError) Error() string { return "dns rcode " + dns.RcodeName(int(e)) }
+func (e rcodeError) Rcode() int    { return int(e) }
+
+func TestChecker_RcodeInTrace(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	cases := []struct {
+		name      string
+		err       error
+		want      Result
+		wantRcode string
+	}{
+		{"refused is permerror", rcodeError(dns.RcodeRefused), PermError, "REFUSED"},
+		{"notimp is permerror", rcodeError(dns.RcodeNotImplemented), PermError, "NOTIMP"},
+		{"servfail is temperror", rcodeError(dns.RcodeServerFailure), TempError, "SERVFAIL"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{err: tc.err}, nil))
+			res, err := ch.CheckHost(context.Background(), ip, "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			require.Len(t, res.Trace, 1)
+			assert.Equal(t, tc.wantRcode, res.Trace[0].Rcode)
+		})
+	}
+}
+
+// cancelTXT answers from the map and cancels the evaluation when the name
+// at is looked up, as if the SMTP timeout hit during that query.
+type cancelTXT struct {
+	fakeTXTMap
+	at     string
+	cancel context.CancelFunc
+}
+
+func (f cancelTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	if domain == f.at {
+		f.cancel()
+		return nil, ctx.Err()
+	}
+	return f.fakeTXTMap.LookupTXT(ctx, domain)
+}
+
+func TestChecker_AbortKeepsPartialTrace(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":   {"v=spf1 include:child.example -all"},
+		"child.example": {"v=spf1 ip4:198.51.100.0/24 redirect=slow.example"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := NewChecker(dns.NewCustomDNSResolver(cancelTXT{txt, "slow.example", cancel}, nil))
+
+	_, err := ch.Check(ctx, Request{IP: net.ParseIP("192.0.2.1"), Domain: "example.com"})
+	require.ErrorIs(t, err, context.Canceled)
+
+	var ae *AbortError
+	require.ErrorAs(t, err, &ae)
+	assert.Equal(t, "child.example", ae.Domain)
+	require.Len(t, ae.Chain, 1)
+	assert.Equal(t, "example.com", ae.Chain[0].Domain)
+
+	var notes []string
+	for _, e := range ae.Trace {
+		notes = append(notes, e.Note)
+	}
+	assert.Contains(t, notes, "evaluating include child.example")
+	assert.Contains(t, notes, "evaluation aborted: context canceled")
+}
+
+// fakeTXTStrings serves TXT answers as separate character-strings per RR.
+type fakeTXTStrings map[string][][]string
+
+func (f fakeTXTStrings) LookupTXTStrings(ctx context.Context, domain string) ([][]string, error) {
+	rrs, ok := f[domain]
+	if !ok {
+		return nil, rcodeError(dns.RcodeNameError)
+	}
+	return rrs, nil
+}
+
+func (f fakeTXTStrings) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	panic("LookupTXTStrings must be preferred")
+}
+
+func TestChecker_Explanation(t *testing.T) {
+	txt := fakeTXTStrings{
+		"example.com":                   {{"v=spf1 ip4:198.51.100.0/24 -all exp=explain.example.com"}},
+		"explain.example.com":           {{"%{i} is not one of ", "%{d}'s designated mail servers."}},
+		"multi.example":                 {{"v=spf1 -all exp=two.example.com"}},
+		"two.example.com":               {{"first"}, {"second"}},
+		"gone.example":                  {{"v=spf1 -all exp=nowhere.example.com"}},
+		"soft.example":                  {{"v=spf1 ~all exp=explain.example.com"}},
+		"macro.example":                 {{"v=spf1 -all exp=%{d}.exp.example.com"}},
+		"macro.example.exp.example.com": {{"Denied for %{s} via %{r}"}},
+		"bad.example":                   {{"v=spf1 -all exp=badmacro.example.com"}},
+		"badmacro.example.com":          {{"broken %{z}"}},
+		"parent.example":                {{"v=spf1 include:child.example -all"}},
+		"child.example":                 {{"v=spf1 -all exp=explain.example.com"}},
+		"redir.example":                 {{"v=spf1 redirect=example.com exp=other.example.com"}},
+	}
+
+	cases := []struct {
+		name       string
+		domain     string
+		want       Result
+		wantText   string
+		wantStatus ExplanationStatus
+	}{
+		{"multi-string txt concatenated", "example.com", Fail, "192.0.2.1 is not one of example.com's designated mail servers.", ExplanationAvailable},
+		{"pass has none", "example.com", Pass, "", ExplanationNone},
+		{"multiple records suppressed", "multi.example", Fail, "", ExplanationSuppressed},
+		{"nxdomain suppressed", "gone.example", Fail, "", ExplanationSuppressed},
+		{"softfail has none", "soft.example", SoftFail, "", ExplanationNone},
+		{"macro target and exp-only letters", "macro.example", Fail, "Denied for user@example.com via mx.receiver.example", ExplanationAvailable},
+		{"bad macro suppressed", "bad.example", Fail, "", ExplanationSuppressed},
+		{"include child exp ignored", "parent.example", Fail, "", ExplanationNone},
+		{"redirect target exp used", "redir.example", Fail, "192.0.2.1 is not one of example.com's designated mail servers.", ExplanationAvailable},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ip := "192.0.2.1"
+			if tc.want == Pass {
+				ip = "198.51.100.1"
+			}
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+			res, err := ch.Check(context.Background(), Request{
+				IP: net.ParseIP(ip), MailFrom: "user@example.com", Domain: tc.domain, ReceiverHostname: "mx.receiver.example",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			assert.Equal(t, tc.wantText, res.Explanation)
+			assert.Equal(t, tc.wantStatus, res.ExplanationStatus)
+		})
+	}
+}
+
+// TestChecker_ConcurrentStress shares one Checker between hundreds of
+// goroutines; run with -race.  Every call spends several lookups, so
+// counters shared between evaluations would also exhaust the limits.
+func TestChecker_ConcurrentStress(t *testing.T) {
+	const callers = 500
+	txt := fakeTXTMap{
+		"example.com":   {"v=spf1 a:host.example include:inc.example redirect=redir.example"},
+		"inc.example":   {"v=spf1 ip4:198.51.100.0/24 -all"},
+		"redir.example": {"v=spf1 a:gone.example ip4:192.0.2.0/24 -all exp=exp.example"},
+		"exp.example":   {"%{i} denied"},
+	}
+	ips := fakeIPResolver{"host.example": {"203.0.113.1"}}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, ips))
+
+	cases := []struct {
+		ip   string
+		want Result
+	}{
+		{"203.0.113.1", Pass},
+		{"198.51.100.7", Pass},
+		{"192.0.2.9", Pass},
+		{"10.0.0.1", Fail},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		tc := cases[i%len(cases)]
+		go func() {
+			defer wg.Done()
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP(tc.ip), MailFrom: "user@example.com"})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.want, res.Code, tc.ip)
+			if tc.want == Fail {
+				assert.Equal(t, tc.ip+" denied", res.Explanation)
+				assert.Equal(t, 4, res.Lookups)
+				assert.Equal(t, 1, res.VoidLookups)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestChecker_LookupBudgetShared(t *testing.T) {
+	txt := fakeTXTMap{
+		// 2 lookups here, 1 for the redirect, 1 for the include, 2 more in
+		// the include and 1 in the redirect target: 7 in total
+		"example.com":    {"v=spf1 a:a1.example a:a2.example redirect=target.example"},
+		"target.example": {"v=spf1 include:inc.example a:a3.example -all"},
+		"inc.example":    {"v=spf1 a:a4.example a:a5.example -all"},
+	}
+	ips := fakeIPResolver{}
+	for _, h := range []string{"a1.example", "a2.example", "a3.example", "a4.example", "a5.example"} {
+		ips[h] = []string{"203.0.113.1"}
+	}
+
+	cases := []struct {
+		name  string
+		limit int
+		want  Result
+	}{
+		{"within budget", 7, Fail},
+		{"redirect does not reset the counter", 6, PermError},
+		{"include shares the counter", 5, PermError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txt, ips))
+			ch.MaxLookups = tc.limit
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), Domain: "example.com"})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+		})
+	}
+
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, ips))
+	res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), Domain: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, 7, res.Lookups)
+
+	// remaining budget on arrival at each hop: 10, then 10 - 3
+	require.Len(t, res.Chain, 2)
+	assert.Equal(t, MaxDNSLookups, res.Chain[0].LookupsRemaining)
+	assert.Equal(t, MaxDNSLookups-3, res.Chain[1].LookupsRemaining)
+
+	var remaining []int
+	for _, e := range res.Trace {
+		remaining = append(remaining, e.LookupsRemaining)
+	}
+	// redirect note after 3 lookups, include note after 4
+	assert.Equal(t, []int{MaxDNSLookups - 3, MaxDNSLookups - 4}, remaining)
+}
+
+func TestChecker_Exists(t *testing.T) {
+	ips := fakeIPResolver{
+		"1.2.0.192.list.example": {"127.0.0.2"},
+		"v6only.example":         {"2001:db8::1"},
+		"user.senders.example":   {"127.0.0.1"},
+	}
+	cases := []struct {
+		name    string
+		record  string
+		ip      string
+		want    Result
+		lookups int
+	}{
+		{"ip macro listed", "v=spf1 exists:%{ir}.list.example -all", "192.0.2.1", Pass, 1},
+		{"ip macro not listed", "v=spf1 exists:%{ir}.list.example -all", "192.0.2.9", Fail, 1},
+		{"ipv6 client still uses A", "v=spf1 exists:user.senders.example -all", "2001:db8::9", Pass, 1},
+		{"aaaa only is no match", "v=spf1 exists:v6only.example -all", "192.0.2.1", Fail, 1},
+		{"local part macro", "v=spf1 exists:%{l}.senders.example -all", "192.0.2.1", Pass, 1},
+		{"two voids allowed", "v=spf1 exists:a.example exists:b.example exists:user.senders.example -all", "192.0.2.1", Pass, 3},
+		{"void limit", "v=spf1 exists:a.example exists:b.example exists:c.example +all", "192.0.2.1", PermError, 3},
+		{"qualifier applies", "v=spf1 ~exists:%{ir}.list.example +all", "192.0.2.1", SoftFail, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, ips))
+			res, err := ch.CheckHost(context.Background(), net.ParseIP(tc.ip), "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			assert.Equal(t, tc.lookups, res.Lookups)
+		})
+	}
+}
+
+func TestChecker_MX(t *testing.T) {
+	var many, ten []*net.MX
+	for i := range MaxMXNames + 1 {
+		many = append(many, &net.MX{Host: fmt.Sprintf("mx%d.many.example", i), Pref: 10})
+	}
+	for i := range MaxMXNames {
+		ten = append(ten, &net.MX{Host: fmt.Sprintf("mx%d.ten.example", i), Pref: uint16(i)})
+	}
+	hosts := fakeHosts{
+		fakeIPResolver: fakeIPResolver{
+			"mx1.example.com":    {"192.0.2.10"},
+			"mx2.example.com":    {"192.0.2.20", "2001:db8::20"},
+			"backup.example.net": {"198.51.100.5"},
+			"mx9.ten.example":    {"192.0.2.10"},
+		},
+		mx: map[string][]*net.MX{
+			"example.com":    {{Host: "backup.example.net", Pref: 50}, {Host: "mx2.example.com", Pref: 20}, {Host: "mx1.example.com", Pref: 10}},
+			"null.example":   {{Host: "", Pref: 0}},
+			"many.example":   many,
+			"ten.example":    ten,
+			"nohost.example": {{Host: "gone.example", Pref: 10}},
+		},
+	}
+	cases := []struct {
+		name   string
+		record string
+		ip     string
+		want   Result
+		note   string
+	}{
+		{"lowest preference first", "v=spf1 mx -all", "192.0.2.10", Pass, "matched MX host mx1.example.com (preference 10)"},
+		{"higher preference", "v=spf1 mx -all", "198.51.100.5", Pass, "matched MX host backup.example.net (preference 50)"},
+		{"ipv6", "v=spf1 mx -all", "2001:db8::20", Pass, "matched MX host mx2.example.com (preference 20)"},
+		{"cidr", "v=spf1 mx/24 -all", "192.0.2.99", Pass, "matched MX host mx1.example.com (preference 10)"},
+		{"no match", "v=spf1 mx -all", "203.0.113.1", Fail, ""},
+		{"null mx", "v=spf1 mx:null.example -all", "192.0.2.10", Fail, ""},
+		{"exchange without address", "v=spf1 mx:nohost.example -all", "192.0.2.10", Fail, ""},
+		{"ipv6 cidr", "v=spf1 mx//64 -all", "2001:db8::ffff", Pass, "matched MX host mx2.example.com (preference 20)"},
+		{"ipv4 cidr leaves ipv6 exact", "v=spf1 mx/24 -all", "2001:db8::ffff", Fail, ""},
+		{"dual cidr", "v=spf1 mx/24//64 -all", "2001:db8::ffff", Pass, "matched MX host mx2.example.com (preference 20)"},
+		{"ten exchanges", "v=spf1 mx:ten.example -all", "192.0.2.10", Pass, "matched MX host mx9.ten.example (preference 9)"},
+		{"too many exchanges", "v=spf1 mx:many.example -all", "192.0.2.10", PermError, ""},
+		{"void limit", "v=spf1 mx:a.example mx:b.example mx:c.example +all", "192.0.2.10", PermError, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, hosts))
+			res, err := ch.CheckHost(context.Background(), net.ParseIP(tc.ip), "example.com", "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.want == PermError && tc.name == "too many exchanges" {
+				require.ErrorIs(t, res.Cause, ErrTooManyMX)
+			}
+			if tc.note != "" {
+				require.NotEmpty(t, res.Trace)
+				assert.Equal(t, tc.note, res.Trace[len(res.Trace)-1].Note)
+			}
+		})
+	}
+}
+
+func TestChecker_PTR(t *testing.T) {
+	hosts := fakeHosts{
+		fakeIPResolver: fakeIPResolver{
+			"mail.example.com":    {"192.0.2.10"},
+			"spoofed.example.com": {"198.51.100.1"},
+		},
+		ptr: map[string][]string{
+			"192.0.2.10":  {"mail.example.com."},
+			"192.0.2.20":  {"spoofed.example.com."},
+			"192.0.2.30":  {"mail.other.example."},
+			"2001:db8::1": {"mail.example.com."},
+		},
+	}
+	cases := []struct {
+		name   string
+		record string
+		req    Request
+		want   Result
+		note   string
+	}{
+		{"validated subdomain", "v=spf1 ptr -all", Request{IP: net.ParseIP("192.0.2.10")}, Pass, "matched validated client hostname mail.example.com"},
+		{"explicit target", "v=spf1 ptr:mail.example.com -all", Request{IP: net.ParseIP("192.0.2.10")}, Pass, ""},
+		{"forward lookup does not confirm", "v=spf1 ptr -all", Request{IP: net.ParseIP("192.0.2.20")}, Fail, ""},
+		{"name outside target", "v=spf1 ptr -all", Request{IP: net.ParseIP("192.0.2.30")}, Fail, ""},
+		{"no ptr record", "v=spf1 ptr -all", Request{IP: net.ParseIP("203.0.113.1")}, Fail, ""},
+		{"ipv6 not confirmed by A only", "v=spf1 ptr -all", Request{IP: net.ParseIP("2001:db8::1")}, Fail, ""},
+		{"supplied hostname", "v=spf1 ptr -all", Request{IP: net.ParseIP("203.0.113.1"), ClientHostname: "MX.Example.com."}, Pass, "matched caller-validated client hostname mx.example.com"},
+		{"supplied hostname outside target", "v=spf1 ptr -all", Request{IP: net.ParseIP("192.0.2.10"), ClientHostname: "mx.example.net"}, Fail, ""},
+		{"supplied hostname in macro", "v=spf1 exists:%{p}.allow.example -all", Request{IP: net.ParseIP("203.0.113.1"), ClientHostname: "mx.example.com"}, Pass, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ips := hosts
+			ips.fakeIPResolver = fakeIPResolver{"mx.example.com.allow.example": {"127.0.0.2"}}
+			for k, v := range hosts.fakeIPResolver {
+				ips.fakeIPResolver[k] = v
+			}
+			ch := NewChecker(dns.NewCustomDNSResolver(&fakeResolver{txts: []string{tc.record}}, ips))
+			req := tc.req
+			req.MailFrom = "user@example.com"
+			res, err := ch.Check(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res.Code)
+			if tc.note != "" {
+				require.NotEmpty(t, res.Trace)
+				assert.Equal(t, tc.note, res.Trace[len(res.Trace)-1].Note)
+			}
+		})
+	}
+}
+
+func TestChecker_Warnings(t *testing.T) {
+	txts := fakeTXTMap{
+		"open.example":    {"v=spf1 ip4:198.51.100.1 +all"},
+		"ptr.example":     {"v=spf1 ptr ip4:192.0.2.0/24 -all"},
+		"broad.example":   {"v=spf1 ip4:192.0.0.0/8 ip4:0.0.0.0/0 -all"},
+		"include.example": {"v=spf1 include:open.example -all"},
+		"clean.example":   {"v=spf1 ip4:192.0.2.0/24 ptr +all"},
+	}
+	cases := []struct {
+		domain string
+		want   []Warning
+	}{
+		{"open.example", []Warning{{Domain: "open.example", Rule: lint.RulePassAll, Term: "all"}}},
+		{"ptr.example", []Warning{{Domain: "ptr.example", Rule: lint.RulePTR, Term: "ptr"}}},
+		{"broad.example", []Warning{{Domain: "broad.example", Rule: lint.RuleCIDRBroad, Term: "ip4:192.0.0.0/8"}}},
+		{"include.example", []Warning{{Domain: "open.example", Rule: lint.RulePassAll, Term: "all"}}},
+		// the match comes first, so ptr and +all are never exercised
+		{"clean.example", nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.domain, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(txts, nil))
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@" + tc.domain})
+			require.NoError(t, err)
+			for i := range res.Warnings {
+				assert.NotEmpty(t, res.Warnings[i].Message)
+				res.Warnings[i].Message = ""
+			}
+			assert.Equal(t, tc.want, res.Warnings)
+		})
+	}
+}
+
+func TestChecker_TCPFallbackFailed(t *testing.T) {
+	truncated := &fakeResolver{err: fmt.Errorf("lookup example.com TXT: %w", dns.ErrTCPFallback)}
+	ch := NewChecker(dns.NewCustomDNSResolver(truncated, nil))
+	res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, TempError, res.Code)
+	require.ErrorIs(t, res.Cause, dns.ErrTCPFallback)
+	require.Len(t, res.Trace, 1)
+	assert.Equal(t, "lookup of example.com failed: tcp-fallback-failed", res.Trace[0].Note)
+}
+
+func TestChecker_UsedMacrosAndPTR(t *testing.T) {
+	txts := fakeTXTMap{
+		"plain.example":    {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"macro.example":    {"v=spf1 exists:%{ir}.list.example -all"},
+		"late.example":     {"v=spf1 ip4:192.0.2.0/24 exists:%{ir}.list.example -all"},
+		"ptr.example":      {"v=spf1 ptr -all"},
+		"pmacro.example":   {"v=spf1 exists:%{p}.allow.example -all"},
+		"include.example":  {"v=spf1 include:pmacro.example -all"},
+		"redirect.example": {"v=spf1 redirect=%{d2}.example"},
+	}
+	cases := []struct {
+		domain             string
+		wantMacro, wantPTR bool
+	}{
+		{"plain.example", false, false},
+		{"macro.example", true, false},
+		{"late.example", false, false}, // the macro term is never reached
+		{"ptr.example", false, true},
+		{"pmacro.example", true, true},
+		{"include.example", true, true},
+		{"redirect.example", true, false},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txts, fakeHosts{fakeIPResolver: fakeIPResolver{}}))
+	for _, tc := range cases {
+		t.Run(tc.domain, func(t *testing.T) {
+			res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.1"), MailFrom: "user@" + tc.domain})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantMacro, res.UsedMacros)
+			assert.Equal(t, tc.wantPTR, res.UsedPTR)
+		})
+	}
+}
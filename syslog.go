@@ -0,0 +1,55 @@
+package spf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SyslogString returns a one-line key=value summary of r for mail logs, e.g.
+//
+//	result=pass domain=example.com ip=192.0.2.1 mechanism=ip4:192.0.2.0/24 lookups=2 ms=13
+//
+// Keys appear in a fixed order, so the line can be grepped like Postfix or
+// policyd-spf output.  A value that is not plain printable ASCII, or that
+// contains a space, quote, backslash or "=", is written as a Go quoted
+// string, so record or sender data cannot break the line or forge keys.
+// mechanism is left out when no term decided the result, and an error
+// result ends with a quoted problem= reason.
+func (r CheckHostResult) SyslogString() string {
+	var b strings.Builder
+	b.WriteString("result=")
+	b.WriteString(string(r.Code))
+	if r.Domain != "" {
+		b.WriteString(" domain=")
+		b.WriteString(syslogValue(r.Domain))
+	}
+	if r.IP != nil {
+		b.WriteString(" ip=")
+		b.WriteString(r.IP.String())
+	}
+	if r.Mechanism != "" {
+		b.WriteString(" mechanism=")
+		b.WriteString(syslogValue(r.Mechanism))
+	}
+	b.WriteString(" lookups=")
+	b.WriteString(strconv.Itoa(r.Lookups))
+	b.WriteString(" ms=")
+	b.WriteString(strconv.FormatInt(r.Elapsed.Milliseconds(), 10))
+	if (r.Code == PermError || r.Code == TempError) && r.Cause != nil {
+		b.WriteString(" problem=")
+		b.WriteString(strconv.QuoteToASCII(r.Cause.Error()))
+	}
+	return b.String()
+}
+
+// syslogValue returns v as is when it can stand unquoted in a key=value
+// line, and quoted with non-ASCII and control characters escaped otherwise.
+func syslogValue(v string) string {
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '\\' || c == '=' {
+			return strconv.QuoteToASCII(v)
+		}
+	}
+	return v
+}
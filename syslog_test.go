@@ -0,0 +1,78 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+func TestSyslogString(t *testing.T) {
+	tc := []struct {
+		name string
+		res  CheckHostResult
+		want string
+	}{
+		{
+			"pass",
+			CheckHostResult{Code: Pass, Domain: "example.com", IP: net.ParseIP("192.0.2.1"), Mechanism: "ip4:192.0.2.0/24", Lookups: 2, Elapsed: 13 * time.Millisecond},
+			"result=pass domain=example.com ip=192.0.2.1 mechanism=ip4:192.0.2.0/24 lookups=2 ms=13",
+		},
+		{
+			"none without mechanism",
+			CheckHostResult{Code: None, Domain: "example.com", IP: net.ParseIP("2001:db8::1")},
+			"result=none domain=example.com ip=2001:db8::1 lookups=0 ms=0",
+		},
+		{
+			"permerror reason quoted",
+			CheckHostResult{Code: PermError, Domain: "example.com", Lookups: 11, Cause: errors.New("too many DNS lookups")},
+			`result=permerror domain=example.com lookups=11 ms=0 problem="too many DNS lookups"`,
+		},
+		{
+			"line breaks escaped",
+			CheckHostResult{Code: PermError, Domain: "example.com\r\nresult=pass", Mechanism: "a:x\nresult=pass",
+				Cause: errors.New("bad\r\nresult=pass")},
+			`result=permerror domain="example.com\r\nresult=pass" mechanism="a:x\nresult=pass" lookups=0 ms=0 problem="bad\r\nresult=pass"`,
+		},
+		{
+			"quotes and non-ASCII escaped",
+			CheckHostResult{Code: Neutral, Domain: "bücher.example", Mechanism: `a:"x" key=v`},
+			`result=neutral domain="b\u00fccher.example" mechanism="a:\"x\" key=v" lookups=0 ms=0`,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, c.res.SyslogString())
+		})
+	}
+}
+
+func TestCheckSetsSyslogFields(t *testing.T) {
+	txt := fakeTXTMap{
+		"example.com":      {"v=spf1 include:_spf.example.net -all"},
+		"_spf.example.net": {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"neutral.example":  {"v=spf1 ip4:198.51.100.1"},
+		"spf.example.org":  {"v=spf1 ip4:192.0.2.0/24 -all"},
+	}
+	ch := NewChecker(dns.NewCustomDNSResolver(txt, nil))
+
+	res, err := ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.7"), MailFrom: "alice@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", res.Domain)
+	assert.Equal(t, "include:_spf.example.net", res.Mechanism)
+	assert.Regexp(t, regexp.MustCompile(`^result=pass domain=example\.com ip=192\.0\.2\.7 mechanism=include:_spf\.example\.net lookups=1 ms=\d+$`), res.SyslogString())
+
+	res, err = ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.7"), MailFrom: "alice@neutral.example"})
+	require.NoError(t, err)
+	assert.Equal(t, "default", res.Mechanism)
+
+	res, err = ch.Check(context.Background(), Request{IP: net.ParseIP("192.0.2.7"), MailFrom: "alice@example.com", Domain: "spf.example.org"})
+	require.NoError(t, err)
+	assert.Equal(t, "ip4:192.0.2.0/24", res.Mechanism)
+}
@@ -0,0 +1,153 @@
+// Package template renders SPF records for many domains from one base
+// policy.  An organization writes the base once with placeholders such as
+// {{providers}} or {{corp_ranges}}, fills them per domain, and gets records
+// the parser has already accepted.  Drift compares a rendered record with
+// the one published in DNS.
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/parser"
+)
+
+// Errors returned by Parse and Render.
+var (
+	ErrSyntax     = errors.New("template syntax error")
+	ErrMissingVar = errors.New("template variable not set")
+	ErrInvalid    = errors.New("rendered record is invalid")
+)
+
+// Vars maps placeholder names to the terms they expand to.  An empty list
+// removes the placeholder from the record.
+type Vars map[string][]string
+
+// Template is a parsed base policy.
+type Template struct {
+	text  string
+	names []string // placeholders in order of first use
+}
+
+// Parse checks the placeholder syntax of text.  A placeholder is a name of
+// letters, digits, "_" and "-" between "{{" and "}}", spaces around the name
+// being ignored.
+func Parse(text string) (*Template, error) {
+	t := &Template{text: text}
+	rest := text
+	for {
+		open := strings.Index(rest, "{{")
+		if open < 0 {
+			if strings.Contains(rest, "}}") {
+				return nil, fmt.Errorf("%w: unmatched }}", ErrSyntax)
+			}
+			return t, nil
+		}
+		if strings.Contains(rest[:open], "}}") {
+			return nil, fmt.Errorf("%w: unmatched }}", ErrSyntax)
+		}
+		end := strings.Index(rest[open:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated {{", ErrSyntax)
+		}
+		name := strings.TrimSpace(rest[open+2 : open+end])
+		if !validName(name) {
+			return nil, fmt.Errorf("%w: bad placeholder %q", ErrSyntax, name)
+		}
+		if !slices.Contains(t.names, name) {
+			t.names = append(t.names, name)
+		}
+		rest = rest[open+end+2:]
+	}
+}
+
+// Placeholders returns the placeholder names in order of first use.
+func (t *Template) Placeholders() []string {
+	return append([]string(nil), t.names...)
+}
+
+// Render substitutes vars into the template and returns the record with
+// single spaces between terms.  Every placeholder must be set, and the
+// result must parse as an SPF record; otherwise ErrMissingVar or ErrInvalid
+// is returned.
+func (t *Template) Render(vars Vars) (string, error) {
+	for _, n := range t.names {
+		if _, ok := vars[n]; !ok {
+			return "", fmt.Errorf("%w: %s", ErrMissingVar, n)
+		}
+	}
+	var b strings.Builder
+	rest := t.text
+	for {
+		open := strings.Index(rest, "{{")
+		if open < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.Index(rest[open:], "}}")
+		b.WriteString(rest[:open])
+		b.WriteString(strings.Join(vars[strings.TrimSpace(rest[open+2:open+end])], " "))
+		rest = rest[open+end+2:]
+	}
+	rec := strings.Join(strings.Fields(b.String()), " ")
+	if _, err := parser.Parse(strings.ToLower(rec)); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return rec, nil
+}
+
+// Drift is the comparison of a rendered record with the published one.
+type Drift struct {
+	Domain string
+	Want   string // rendered record
+	Live   string // published record, empty when none
+	InSync bool   // the records are semantically equal, see parser.Equal
+}
+
+// CheckDrift fetches the record of domain through r and compares it with
+// want.  Formatting differences such as letter case, spacing or an explicit
+// "+" are not drift.  A missing domain or record is drift with an empty
+// Live; other lookup errors are returned as from dns.GetSPFRecord.
+func CheckDrift(ctx context.Context, r dns.TXTResolver, domain, want string) (Drift, error) {
+	d := Drift{Domain: domain, Want: want}
+	live, err := dns.GetSPFRecord(ctx, domain, r)
+	if errors.Is(err, dns.ErrNoDNSrecord) {
+		return d, nil
+	}
+	if err != nil {
+		return d, err
+	}
+	d.Live = live
+	if live == "" {
+		return d, nil
+	}
+	w, err := parser.Parse(strings.ToLower(want))
+	if err != nil {
+		return d, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	l, err := parser.Parse(live)
+	if err != nil {
+		// a published record that does not parse is drift, not a failure
+		return d, nil
+	}
+	d.InSync = parser.Equal(w, l)
+	return d, nil
+}
+
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
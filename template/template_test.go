@@ -0,0 +1,80 @@
+package template
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+)
+
+const base = "v=spf1 {{corp_ranges}} {{ providers }} {{extra}} -all"
+
+func TestParse(t *testing.T) {
+	tpl, err := Parse(base + " {{providers}}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"corp_ranges", "providers", "extra"}, tpl.Placeholders())
+
+	for _, bad := range []string{"v=spf1 {{corp -all", "v=spf1 corp}} -all", "v=spf1 {{}} -all", "v=spf1 {{a b}} -all", "v=spf1 }} {{a}}"} {
+		_, err := Parse(bad)
+		assert.ErrorIs(t, err, ErrSyntax, bad)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tpl, err := Parse(base)
+	require.NoError(t, err)
+
+	rec, err := tpl.Render(Vars{
+		"corp_ranges": {"ip4:192.0.2.0/24", "ip6:2001:db8::/32"},
+		"providers":   {"include:_spf.example.net"},
+		"extra":       nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 include:_spf.example.net -all", rec)
+
+	_, err = tpl.Render(Vars{"corp_ranges": nil, "providers": nil})
+	require.ErrorIs(t, err, ErrMissingVar)
+
+	_, err = tpl.Render(Vars{"corp_ranges": {"ip4:192.0.2.300"}, "providers": nil, "extra": nil})
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+type fakeTXT map[string]string
+
+func (f fakeTXT) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	if r, ok := f[domain]; ok {
+		return []string{r}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+}
+
+func TestCheckDrift(t *testing.T) {
+	r := dns.NewCustomDNSResolver(fakeTXT{
+		"same.example":   "v=spf1 +IP4:192.0.2.0/24   -all",
+		"drift.example":  "v=spf1 ip4:198.51.100.0/24 -all",
+		"broken.example": "v=spf1 bogus -all",
+	}, nil)
+	want := "v=spf1 ip4:192.0.2.0/24 -all"
+	ctx := context.Background()
+
+	tc := []struct {
+		domain string
+		live   string
+		inSync bool
+	}{
+		{"same.example", "v=spf1 +ip4:192.0.2.0/24   -all", true},
+		{"drift.example", "v=spf1 ip4:198.51.100.0/24 -all", false},
+		{"broken.example", "v=spf1 bogus -all", false},
+		{"missing.example", "", false},
+	}
+	for _, c := range tc {
+		t.Run(c.domain, func(t *testing.T) {
+			d, err := CheckDrift(ctx, r, c.domain, want)
+			require.NoError(t, err)
+			assert.Equal(t, Drift{Domain: c.domain, Want: want, Live: c.live, InSync: c.inSync}, d)
+		})
+	}
+}
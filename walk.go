@@ -0,0 +1,369 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/t0gun/go-spf/lint"
+	"github.com/t0gun/go-spf/parser"
+	"golang.org/x/net/publicsuffix"
+)
+
+// RecordGraph is the include/redirect dependency graph of a domain's SPF
+// policy, as returned by Checker.WalkRecord.
+type RecordGraph struct {
+	Root  string
+	Nodes map[string]*RecordNode // keyed by domain
+	Edges []RecordEdge           // in discovery order
+
+	opts parser.Options // the walking Checker's record options, for Flatten
+}
+
+// RecordNode is one domain in a RecordGraph.
+type RecordNode struct {
+	Domain string
+	Record string // raw record text, empty when it could not be fetched
+	Size   int    // length of Record in bytes
+	// Cost is the number of terms in Record that count toward the RFC 7208
+	// section 4.6.4 lookup limit, including its include and redirect terms.
+	Cost int
+	Err  error // fetch or parse failure
+	// Findings report the duplicate records tolerated by Quirks and how
+	// the TXT RRs of Domain divide "v=spf1" between character-strings, see
+	// lint.TXTStrings.
+	Findings []lint.Finding
+}
+
+// RecordEdge is an include or redirect reference between two records.
+type RecordEdge struct {
+	From, To string
+	Kind     string // "include" or "redirect"
+}
+
+// TotalCost returns the lookups spent on domain's record and everything it
+// references, counting a record once for every reference to it, as
+// evaluation does.  It is the worst case for one evaluation and should not
+// exceed MaxDNSLookups.  A reference back to a record on the current path
+// is a loop that evaluation ends with a PermError; it is not followed.
+func (g *RecordGraph) TotalCost(domain string) int {
+	path := map[string]bool{}
+	memo := map[string]int{} // costs of subtrees that reach no loop
+	var walk func(d string) (cost int, loop bool)
+	walk = func(d string) (int, bool) {
+		if c, ok := memo[d]; ok {
+			return c, false
+		}
+		n, ok := g.Nodes[d]
+		if !ok {
+			return 0, false
+		}
+		if path[d] {
+			return 0, true
+		}
+		path[d] = true
+		defer delete(path, d)
+		cost, loop := n.Cost, false
+		for _, e := range g.Edges {
+			if e.From == d {
+				c, l := walk(e.To)
+				cost, loop = cost+c, loop || l
+			}
+		}
+		if !loop {
+			memo[d] = cost
+		}
+		return cost, loop
+	}
+	cost, _ := walk(domain)
+	return cost
+}
+
+// WalkRecord fetches the record of domain and, recursively, of every
+// include and redirect target without evaluating any mechanism.  Records
+// are fetched as Check fetches them, so include overrides, ModeRFC4408,
+// SizeLimits and Quirks apply.  Targets containing macros depend on the
+// message and are not followed.  Each domain is fetched once, so reference
+// loops terminate.  Only a failure of the root lookup is returned as an
+// error; other failures are recorded on their node.
+func (c *Checker) WalkRecord(ctx context.Context, domain string) (*RecordGraph, error) {
+	root, err := c.parserOpts.ValidateDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	if c.Resolver == nil {
+		return nil, ErrNoResolver
+	}
+	g := &RecordGraph{Root: root, Nodes: map[string]*RecordNode{}, opts: c.recordOptions()}
+	// records are fetched as evaluation fetches them, with the same
+	// overrides, record type, size limits and quirks
+	ev := &evaluation{resolver: c.Resolver, maxLookups: c.MaxLookups}
+	queue := []string{root}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if _, ok := g.Nodes[d]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := &RecordNode{Domain: d}
+		g.Nodes[d] = n
+
+		warned := len(ev.warnings)
+		n.Record, _, n.Err = c.getRecord(ctx, ev, d)
+		for _, w := range ev.warnings[warned:] {
+			n.Findings = append(n.Findings, lint.Finding{Rule: w.Rule, Severity: lint.Warning, Message: w.Message})
+		}
+		if _, ok := c.overrides[d]; !ok && n.Err == nil {
+			n.Findings = append(n.Findings, c.txtFindings(ctx, d)...)
+		}
+		if n.Err == nil && n.Record == "" {
+			n.Err = ErrNoSPFRecord
+		}
+		if n.Err != nil {
+			if d == root {
+				return nil, n.Err
+			}
+			continue
+		}
+		n.Size = len(n.Record)
+		rec, err := c.parse(n.Record)
+		if err != nil {
+			n.Err = err
+			continue
+		}
+		for _, m := range rec.Mechs {
+			switch m.Kind {
+			case "a", "mx", "ptr", "exists":
+				n.Cost++
+			case "include":
+				n.Cost++
+				if !m.Macro {
+					to := normalizeFQDN(m.Domain)
+					g.Edges = append(g.Edges, RecordEdge{From: d, To: to, Kind: "include"})
+					queue = append(queue, to)
+				}
+			}
+		}
+		if rec.Redirect != nil {
+			n.Cost++
+			if !rec.Redirect.Macro {
+				to := normalizeFQDN(rec.Redirect.Value)
+				g.Edges = append(g.Edges, RecordEdge{From: d, To: to, Kind: "redirect"})
+				queue = append(queue, to)
+			}
+		}
+	}
+	return g, nil
+}
+
+// txtFindings lints the character-strings of the TXT RRs of domain with
+// lint.TXTStrings.  It queries domain again, as the record lookup only
+// returns the joined strings; a failed query yields no findings.
+func (c *Checker) txtFindings(ctx context.Context, domain string) []lint.Finding {
+	rrs, err := c.Resolver.LookupTXTStrings(ctx, domain)
+	if err != nil {
+		return nil
+	}
+	var out []lint.Finding
+	for _, strs := range rrs {
+		out = append(out, lint.TXTStrings(strs)...)
+	}
+	return out
+}
+
+// Flattened is the result of RecordGraph.Flatten.
+type Flattened struct {
+	// Networks are the pass ip4 and ip6 terms reachable from the root,
+	// deduplicated, in evaluation order.
+	Networks []string
+	// Residual lists, as "domain: term", what cannot be expressed as a
+	// network without further lookups or changing the result: a, mx, ptr
+	// and exists terms, terms with other qualifiers including +all,
+	// includes other than +include, macro targets, reference loops and
+	// records that could not be fetched or parsed.
+	Residual []string
+}
+
+// Flatten collects the networks authorized by the root record and
+// everything it includes or redirects to, following the references the way
+// an evaluation would: only +include is inlined, terms after all are never
+// reached, and a redirect is ignored when the record has an all term
+// (RFC 7208 section 6.1).  It is the first step of flattening a record to
+// save lookups; when Residual is empty the networks followed by the root's
+// all term give the same result as the original record.
+func (g *RecordGraph) Flatten() Flattened {
+	var out Flattened
+	done := map[string]bool{}
+	path := map[string]bool{} // references being flattened, to find loops
+	residual := func(d, term string) { out.Residual = append(out.Residual, d+": "+term) }
+	var walk func(d string)
+	follow := func(d, term, to string) {
+		if path[to] {
+			residual(d, term+" (loop)")
+			return
+		}
+		walk(to)
+	}
+	walk = func(d string) {
+		if done[d] {
+			return
+		}
+		done[d] = true
+		n := g.Nodes[d]
+		if n == nil {
+			return
+		}
+		if n.Err != nil {
+			out.Residual = append(out.Residual, fmt.Sprintf("%s: %v", d, n.Err))
+			return
+		}
+		rec, err := g.opts.Parse(n.Record)
+		if err != nil {
+			out.Residual = append(out.Residual, fmt.Sprintf("%s: %v", d, err))
+			return
+		}
+		path[d] = true
+		defer delete(path, d)
+		for _, m := range rec.Mechs {
+			switch {
+			case m.Kind == "all":
+				if m.Qual == parser.QPlus {
+					residual(d, m.String())
+				}
+				// the rest of the record, redirect included, is never reached
+				return
+			case m.Kind == "include" && m.Qual == parser.QPlus && !m.Macro:
+				follow(d, m.String(), normalizeFQDN(m.Domain))
+			case (m.Kind == "ip4" || m.Kind == "ip6") && m.Qual == parser.QPlus:
+				if t := m.String(); !slices.Contains(out.Networks, t) {
+					out.Networks = append(out.Networks, t)
+				}
+			default:
+				residual(d, m.String())
+			}
+		}
+		if r := rec.Redirect; r != nil {
+			if r.Macro {
+				residual(d, "redirect="+r.Value)
+			} else {
+				follow(d, "redirect="+r.Value, normalizeFQDN(r.Value))
+			}
+		}
+	}
+	walk(g.Root)
+	return out
+}
+
+// Metrics measures the tree below the root for lint.Tree.  Domains outside
+// the root's organizational domain (public suffix plus one label) count as
+// third party.
+func (g *RecordGraph) Metrics() lint.TreeMetrics {
+	m := lint.TreeMetrics{Domains: len(g.Nodes), CIDRs: len(g.Flatten().Networks)}
+	org := orgDomain(g.Root)
+	for d := range g.Nodes {
+		if orgDomain(d) != org {
+			m.ThirdPartyDomains++
+		}
+	}
+
+	// breadth first, so each domain gets its shallowest depth; redirects
+	// replace the record and do not nest
+	depth := map[string]int{g.Root: 0}
+	queue := []string{g.Root}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		m.MaxIncludeDepth = max(m.MaxIncludeDepth, depth[d])
+		for _, e := range g.Edges {
+			if _, seen := depth[e.To]; e.From != d || seen {
+				continue
+			}
+			depth[e.To] = depth[d]
+			if e.Kind == "include" {
+				depth[e.To]++
+			}
+			queue = append(queue, e.To)
+		}
+	}
+	return m
+}
+
+// orgDomain returns the organizational domain of d, d itself when the
+// public suffix cannot be determined.
+func orgDomain(d string) string {
+	if org, err := publicsuffix.EffectiveTLDPlusOne(d); err == nil {
+		return org
+	}
+	return d
+}
+
+// domains returns the node names sorted, root first, for stable output.
+func (g *RecordGraph) domains() []string {
+	out := make([]string, 0, len(g.Nodes))
+	for d := range g.Nodes {
+		if d != g.Root {
+			out = append(out, d)
+		}
+	}
+	sort.Strings(out)
+	return append([]string{g.Root}, out...)
+}
+
+// label is the annotation shown for a node in rendered graphs.
+func (n *RecordNode) label() string {
+	if n.Err != nil {
+		return fmt.Sprintf("%s\nerror: %v", n.Domain, n.Err)
+	}
+	return fmt.Sprintf("%s\n%d lookups, %d bytes", n.Domain, n.Cost, n.Size)
+}
+
+// DOT renders the graph in Graphviz DOT syntax.  Nodes are labelled with
+// their lookup cost and record size; redirect edges are dashed and nodes
+// whose record could not be used are drawn red.
+func (g *RecordGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph spf {\n\tnode [shape=box];\n")
+	for _, d := range g.domains() {
+		n := g.Nodes[d]
+		attrs := fmt.Sprintf("label=%q", n.label())
+		if n.Err != nil {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(&b, "\t%q [%s];\n", d, attrs)
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Kind == "redirect" {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q%s];\n", e.From, e.To, e.Kind, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart with the same
+// annotations as DOT.
+func (g *RecordGraph) Mermaid() string {
+	ids := map[string]string{}
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for i, d := range g.domains() {
+		ids[d] = fmt.Sprintf("n%d", i)
+		label := strings.ReplaceAll(g.Nodes[d].label(), "\n", "<br/>")
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", ids[d], strings.ReplaceAll(label, `"`, "#quot;"))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind == "redirect" {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "\t%s %s|%s| %s\n", ids[e.From], arrow, e.Kind, ids[e.To])
+	}
+	return b.String()
+}
@@ -0,0 +1,199 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/t0gun/go-spf/dns"
+	"github.com/t0gun/go-spf/lint"
+)
+
+func walkFixture() fakeTXTMap {
+	return fakeTXTMap{
+		"example.com":       {"v=spf1 a mx include:_spf.provider.net include:%{i}.dyn.example redirect=backup.example"},
+		"_spf.provider.net": {"v=spf1 ip4:192.0.2.0/24 include:loop.example -all"},
+		"loop.example":      {"v=spf1 include:_spf.provider.net"},
+		"backup.example":    {"v=spf1 include:missing.example ~all"},
+	}
+}
+
+func TestChecker_WalkRecord(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(walkFixture(), nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, "example.com", g.Root)
+	assert.Len(t, g.Nodes, 5)
+	assert.Equal(t, 5, g.Nodes["example.com"].Cost)
+	assert.Equal(t, len(walkFixture()["example.com"][0]), g.Nodes["example.com"].Size)
+	assert.ErrorIs(t, g.Nodes["missing.example"].Err, dns.ErrNoDNSrecord)
+	assert.Equal(t, []RecordEdge{
+		{"example.com", "_spf.provider.net", "include"},
+		{"example.com", "backup.example", "redirect"},
+		{"_spf.provider.net", "loop.example", "include"},
+		{"backup.example", "missing.example", "include"},
+		{"loop.example", "_spf.provider.net", "include"},
+	}, g.Edges)
+	// 5 + 1 + 1 + 1, the loop back to _spf.provider.net not followed
+	assert.Equal(t, 8, g.TotalCost("example.com"))
+}
+
+func TestRecordGraph_TotalCostPerReference(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{
+		"example.com":    {"v=spf1 include:a.example include:b.example -all"},
+		"a.example":      {"v=spf1 include:shared.example -all"},
+		"b.example":      {"v=spf1 include:shared.example redirect=shared.example"},
+		"shared.example": {"v=spf1 a mx -all"},
+	}, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	// shared.example is evaluated three times, at two lookups each
+	assert.Equal(t, 2+1+2+3*2, g.TotalCost("example.com"))
+	assert.Equal(t, 2, g.TotalCost("shared.example"))
+}
+
+func TestChecker_WalkRecordRootErrors(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{"nospf.example": {"hello"}}, nil))
+	_, err := ch.WalkRecord(context.Background(), "missing.example")
+	assert.ErrorIs(t, err, dns.ErrNoDNSrecord)
+	_, err = ch.WalkRecord(context.Background(), "nospf.example")
+	assert.ErrorIs(t, err, ErrNoSPFRecord)
+}
+
+func TestRecordGraph_DOT(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{
+		"example.com": {"v=spf1 include:a.example redirect=b.example"},
+		"a.example":   {"v=spf1 -all"},
+	}, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+
+	want := `digraph spf {
+	node [shape=box];
+	"example.com" [label="example.com\n2 lookups, 43 bytes"];
+	"a.example" [label="a.example\n0 lookups, 11 bytes"];
+	"b.example" [label="b.example\nerror: DNS record not found (NXDOMAIN)", color=red];
+	"example.com" -> "a.example" [label="include"];
+	"example.com" -> "b.example" [label="redirect", style=dashed];
+}
+`
+	assert.Equal(t, want, g.DOT())
+
+	wantMermaid := `flowchart TD
+	n0["example.com<br/>2 lookups, 43 bytes"]
+	n1["a.example<br/>0 lookups, 11 bytes"]
+	n2["b.example<br/>error: DNS record not found (NXDOMAIN)"]
+	n0 -->|include| n1
+	n0 -.->|redirect| n2
+`
+	assert.Equal(t, wantMermaid, g.Mermaid())
+}
+
+func TestRecordGraph_Flatten(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{
+		"example.com":       {"v=spf1 ip4:198.51.100.1 include:_spf.provider.net include:%{i}.dyn.example redirect=backup.example"},
+		"_spf.provider.net": {"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 ip4:198.51.100.1 -ip4:203.0.113.5 include:loop.example -all"},
+		"loop.example":      {"v=spf1 include:_spf.provider.net"},
+		"backup.example":    {"v=spf1 mx include:missing.example ~all"},
+	}, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+
+	got := g.Flatten()
+	assert.Equal(t, []string{"ip4:198.51.100.1/32", "ip4:192.0.2.0/24", "ip6:2001:db8::/32"}, got.Networks)
+	assert.Equal(t, []string{
+		"_spf.provider.net: -ip4:203.0.113.5/32",
+		"loop.example: include:_spf.provider.net (loop)",
+		"example.com: include:%{i}.dyn.example",
+		"backup.example: mx",
+		"missing.example: DNS record not found (NXDOMAIN)",
+	}, got.Residual)
+}
+
+func TestRecordGraph_FlattenQualifiers(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{
+		"example.com":     {"v=spf1 -include:deny.example ~include:soft.example ?include:neutral.example include:ok.example -all redirect=other.example"},
+		"deny.example":    {"v=spf1 ip4:203.0.113.0/24 -all"},
+		"soft.example":    {"v=spf1 ip4:203.0.113.64/26 -all"},
+		"neutral.example": {"v=spf1 ip4:203.0.113.128/26 -all"},
+		"ok.example":      {"v=spf1 ip4:192.0.2.0/24 +all ip4:198.51.100.0/24"},
+		"other.example":   {"v=spf1 ip4:198.51.100.7 -all"},
+	}, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+
+	got := g.Flatten()
+	assert.Equal(t, []string{"ip4:192.0.2.0/24"}, got.Networks)
+	assert.Equal(t, []string{
+		"example.com: -include:deny.example",
+		"example.com: ~include:soft.example",
+		"example.com: ?include:neutral.example",
+		"ok.example: all",
+	}, got.Residual)
+}
+
+// The flattened record must give the same verdict as the original whenever
+// Flatten reports no residual terms.
+func TestRecordGraph_FlattenVerdict(t *testing.T) {
+	tests := []struct {
+		name string
+		zone fakeTXTMap
+	}{
+		{"includes", fakeTXTMap{
+			"example.com":  {"v=spf1 ip4:198.51.100.1 include:a.example include:b.example -all"},
+			"a.example":    {"v=spf1 ip4:192.0.2.0/25 include:b.example ~all"},
+			"b.example":    {"v=spf1 ip6:2001:db8::/32 ip4:192.0.2.128/25 ?all"},
+			"flat.example": nil,
+		}},
+		{"redirect", fakeTXTMap{
+			"example.com":  {"v=spf1 include:a.example redirect=b.example"},
+			"a.example":    {"v=spf1 ip4:192.0.2.0/24 -all"},
+			"b.example":    {"v=spf1 ip4:198.51.100.0/24 -all"},
+			"flat.example": nil,
+		}},
+		{"redirect ignored with all", fakeTXTMap{
+			"example.com":  {"v=spf1 ip4:192.0.2.0/24 -all redirect=b.example"},
+			"b.example":    {"v=spf1 ip4:198.51.100.0/24 -all"},
+			"flat.example": nil,
+		}},
+		{"terms after all", fakeTXTMap{
+			"example.com":  {"v=spf1 include:a.example -all"},
+			"a.example":    {"v=spf1 ip4:192.0.2.0/24 ?all ip4:198.51.100.0/24"},
+			"flat.example": nil,
+		}},
+	}
+	ips := []string{"192.0.2.1", "192.0.2.200", "198.51.100.1", "198.51.100.9", "203.0.113.1", "2001:db8::1", "2001:db9::1"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := NewChecker(dns.NewCustomDNSResolver(tt.zone, nil))
+			g, err := ch.WalkRecord(context.Background(), "example.com")
+			require.NoError(t, err)
+			got := g.Flatten()
+			require.Empty(t, got.Residual)
+
+			tt.zone["flat.example"] = []string{"v=spf1 " + strings.Join(got.Networks, " ") + " -all"}
+			for _, ip := range ips {
+				want, _ := ch.CheckHost(context.Background(), net.ParseIP(ip), "example.com", "user@example.com")
+				flat, _ := ch.CheckHost(context.Background(), net.ParseIP(ip), "flat.example", "user@flat.example")
+				assert.Equal(t, want.Code, flat.Code, ip)
+			}
+		})
+	}
+}
+
+func TestRecordGraph_Metrics(t *testing.T) {
+	ch := NewChecker(dns.NewCustomDNSResolver(fakeTXTMap{
+		"example.com":        {"v=spf1 ip4:192.0.2.1 include:_spf.example.com include:_spf.provider.net redirect=other.example.org -all"},
+		"_spf.example.com":   {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"_spf.provider.net":  {"v=spf1 include:relay.provider.net -all"},
+		"relay.provider.net": {"v=spf1 ip6:2001:db8::/32 include:_spf.provider.net -all"},
+		"other.example.org":  {"v=spf1 ip4:198.51.100.0/24 -all"},
+	}, nil))
+	g, err := ch.WalkRecord(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, lint.TreeMetrics{MaxIncludeDepth: 2, Domains: 5, ThirdPartyDomains: 3, CIDRs: 3}, g.Metrics())
+}